@@ -0,0 +1,39 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminSettings configure the authentication of the administration endpoints
+// (eg. relationship tuples, maintenance mode, audit).
+type AdminSettings struct {
+	// Token is the bearer token expected by the administration endpoints. If
+	// empty, they are refused.
+	Token string
+}
+
+// Admin are the administration endpoints settings.
+// They must be set before calling SetupRoutes().
+var Admin = AdminSettings{}
+
+// AdminMiddleware only lets through the requests with the admin token in the
+// `Authorization` header (eg. `Bearer s3cr3t`).
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if Admin.Token == "" {
+			abortWithError(c, http.StatusForbidden, ErrorForbidden, "administration endpoints are disabled")
+			return
+		}
+		header := c.Request.Header.Get("Authorization")
+		token := strings.TrimPrefix(header, "Bearer ")
+		if token == header || subtle.ConstantTimeCompare([]byte(token), []byte(Admin.Token)) != 1 {
+			abortWithError(c, http.StatusUnauthorized, ErrorUnauthenticated, "invalid admin token")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// performAdminRequest sends the request with the admin token.
+func performAdminRequest(r http.Handler, method, path string, body io.Reader) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+Admin.Token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminMiddleware(t *testing.T) {
+	r := gin.New()
+	r.GET("/admin", AdminMiddleware(), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	get := func(authorization string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/admin", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	defer func() { Admin.Token = "" }()
+
+	w := get("Bearer s3cr3t")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "administration endpoints are disabled")
+
+	Admin.Token = "s3cr3t"
+	assert.Equal(t, http.StatusUnauthorized, get("").Code)
+	assert.Equal(t, http.StatusUnauthorized, get("s3cr3t").Code)
+	assert.Equal(t, http.StatusUnauthorized, get("Bearer s3cr3").Code)
+	assert.Equal(t, http.StatusOK, get("Bearer s3cr3t").Code)
+}
@@ -1,7 +1,9 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mozilla/doorman/doorman"
@@ -9,62 +11,182 @@ import (
 
 func allowedHandler(c *gin.Context) {
 	if c.Request.ContentLength == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": "Missing body",
-		})
+		abortWithError(c, http.StatusBadRequest, ErrorMissingBody, "Missing body")
 		return
 	}
 
 	var r doorman.Request
 	if err := c.BindJSON(&r); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"message": err.Error(),
-		})
+		abortWithError(c, http.StatusBadRequest, ErrorInvalidBody, err.Error())
 		return
 	}
 
+	service := requestAudience(c.Request)
+	if e := prepareRequest(c, service, &r); e != nil {
+		abortWithResponseError(c, *e)
+		return
+	}
+
+	d := c.MustGet(DoormanContextKey).(doorman.Doorman)
+	result := d.Check(service, &r)
+
+	c.JSON(http.StatusOK, decisionResponse(c, d, service, &r, result))
+}
+
+// prepareRequest checks the authorization request of the caller, and completes
+// its principals and context.
+func prepareRequest(c *gin.Context, service string, r *doorman.Request) *ResponseError {
+	// Reserved context namespaces cannot be supplied by callers.
+	if reserved := r.Context.ReservedFields(); len(reserved) > 0 {
+		message := fmt.Sprintf("reserved context fields: %s", strings.Join(reserved, ", "))
+		return &ResponseError{Status: http.StatusBadRequest, Code: ErrorReservedContext, Message: message}
+	}
+
 	// Is authentication verification enable for this service?
 	// If disabled (like in tests), principals can be posted in JSON.
-	principals, ok := c.Get(PrincipalsContextKey)
+	principals, ok := PrincipalsFromContext(c)
 	if ok {
 		if len(r.Principals) > 0 {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"message": "cannot submit principals with authentication enabled",
-			})
-			return
+			return &ResponseError{Status: http.StatusBadRequest, Code: ErrorPrincipalsNotAllowed, Message: "cannot submit principals with authentication enabled"}
 		}
-		r.Principals = principals.(doorman.Principals)
+		// Copied, since the principals are shared by the requests of a batch.
+		r.Principals = append(doorman.Principals{}, principals...)
+		// The authentication time can only come from the token.
+		delete(r.Context, doorman.AuthTimeContextField)
 	} else {
 		if len(r.Principals) == 0 {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"message": "missing principals",
-			})
-			return
+			return &ResponseError{Status: http.StatusBadRequest, Code: ErrorMissingPrincipals, Message: "missing principals"}
 		}
 	}
 
 	d := c.MustGet(DoormanContextKey).(doorman.Doorman)
-	service := c.Request.Header.Get("Origin")
+
+	// Expand principals with caller's tenant.
+	tenant, hasTenant := c.Get(TenantContextKey)
+	if hasTenant && tenant != "" {
+		r.Principals = append(r.Principals, fmt.Sprintf("tenant:%s", tenant))
+	}
 
 	// Expand principals with local ones.
 	r.Principals = d.ExpandPrincipals(service, r.Principals)
 	// Expand principals with specified roles.
 	r.Principals = append(r.Principals, r.Roles()...)
 
-	// Force some context values (for Audit logger mainly)
+	// The request context is merged in order of precedence, the last wins:
+	// 1. the caller context, without the internal `_` fields;
+	// 2. the baggage entries mapped to context fields in the service configuration;
+	// 3. the fields set by Doorman: `remoteIP`, `clientIP`, `auth_time`, `tenant`, the reserved
+	//    namespaces (see doorman.IsReservedContextField) and the internal `_` fields.
 	// XXX: using the context field to pass custom values on *ladon.Request
 	// for audit logging is not very elegant.
 	if r.Context == nil {
 		r.Context = doorman.Context{}
 	}
+	for field := range r.Context {
+		if strings.HasPrefix(field, "_") {
+			delete(r.Context, field)
+		}
+	}
+	if config, ok := d.ServiceConfig(service); ok {
+		for field, value := range baggageContext(c.Request, config.Baggage) {
+			r.Context[field] = value
+		}
+	}
 	r.Context["remoteIP"] = c.Request.RemoteAddr
+	r.Context[doorman.RequestContextNamespace+"remoteIP"] = c.Request.RemoteAddr
+	clientIP := doorman.ClientIP(c.Request, ClientIP.TrustedProxies)
+	r.Context[doorman.ClientIPContextField] = clientIP
+	r.Context[doorman.RequestContextNamespace+"clientIP"] = clientIP
+	r.Context[doorman.RequestContextNamespace+"service"] = service
+	if authTime, ok := c.Get(AuthTimeContextKey); ok {
+		r.Context[doorman.AuthTimeContextField] = authTime
+		r.Context[doorman.SubjectContextNamespace+"authTime"] = authTime
+	}
+	if hasTenant {
+		r.Context[doorman.TenantContextField] = tenant
+		r.Context[doorman.SubjectContextNamespace+"tenant"] = tenant
+	}
 	r.Context["_service"] = service
 	r.Context["_principals"] = r.Principals
+	decisionID := c.GetString(DecisionIDContextKey)
+	if decisionID != "" {
+		r.Context["_decisionID"] = decisionID
+	}
+	return nil
+}
 
-	allowed := d.IsAllowed(service, &r)
-
-	c.JSON(http.StatusOK, gin.H{
-		"allowed":    allowed,
+// decisionResponse returns the response body of the decided request.
+func decisionResponse(c *gin.Context, d doorman.Doorman, service string, r *doorman.Request, result doorman.Result) gin.H {
+	response := gin.H{
+		"allowed":    result.Allowed,
 		"principals": r.Principals,
-	})
+	}
+	if decisionID := c.GetString(DecisionIDContextKey); decisionID != "" {
+		response["decision_id"] = decisionID
+	}
+	if d.Maintenance(service) {
+		response["maintenance"] = true
+	}
+	if result.Reason != "" {
+		response["reason"] = result.Reason
+	}
+	if len(result.Obligations) > 0 {
+		obligations := []gin.H{}
+		for _, obligation := range result.Obligations {
+			obligations = append(obligations, gin.H{
+				"type":    obligation.Type,
+				"options": obligation.Options,
+			})
+		}
+		response["obligations"] = obligations
+	}
+	return response
+}
+
+// MaxBatchRequests is the maximum number of authorization requests of a batch.
+const MaxBatchRequests = 100
+
+// allowedBatchHandler decides a list of authorization requests at once (eg. to
+// grey out the buttons of a page), and returns the decisions in order.
+func allowedBatchHandler(c *gin.Context) {
+	if c.Request.ContentLength == 0 {
+		abortWithError(c, http.StatusBadRequest, ErrorMissingBody, "Missing body")
+		return
+	}
+
+	var batch []doorman.Request
+	if err := c.BindJSON(&batch); err != nil {
+		abortWithError(c, http.StatusBadRequest, ErrorInvalidBody, err.Error())
+		return
+	}
+	if len(batch) == 0 || len(batch) > MaxBatchRequests {
+		message := fmt.Sprintf("batch must have between 1 and %d requests", MaxBatchRequests)
+		abortWithError(c, http.StatusBadRequest, ErrorInvalidBody, message)
+		return
+	}
+
+	service := requestAudience(c.Request)
+	requests := make([]*doorman.Request, len(batch))
+	for i := range batch {
+		requests[i] = &batch[i]
+		if e := prepareRequest(c, service, requests[i]); e != nil {
+			e.Message = fmt.Sprintf("request %d: %s", i, e.Message)
+			abortWithResponseError(c, *e)
+			return
+		}
+	}
+
+	d := c.MustGet(DoormanContextKey).(doorman.Doorman)
+	decisions := d.IsAllowedBatch(service, requests)
+
+	responses := []gin.H{}
+	for i, decision := range decisions {
+		result := doorman.Result{
+			Allowed:     decision.Allowed,
+			Reason:      decision.Reason,
+			Obligations: decision.Obligations,
+		}
+		responses = append(responses, decisionResponse(c, d, service, requests[i], result))
+	}
+	c.JSON(http.StatusOK, responses)
 }
@@ -3,21 +3,28 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mozilla/doorman/authn"
 	"github.com/mozilla/doorman/config"
 	"github.com/mozilla/doorman/doorman"
+	"github.com/ory/ladon"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
 type AllowedResponse struct {
 	Allowed    bool
 	Principals doorman.Principals
+	DecisionID string `json:"decision_id"`
 }
 
 type ErrorResponse struct {
@@ -49,7 +56,8 @@ func TestAllowedVerifiesAuthentication(t *testing.T) {
 			IdentityProvider: "https://auth.mozilla.auth0.com/",
 			Policies: doorman.Policies{
 				doorman.Policy{
-					Actions: []string{"update"},
+					Principals: []string{"userid:maria"},
+					Actions:    []string{"update"},
 				},
 			},
 		},
@@ -187,3 +195,424 @@ func TestAllowedHandlerRoles(t *testing.T) {
 	json.Unmarshal(w.Body.Bytes(), &resp)
 	assert.Equal(t, doorman.Principals{"userid:bob", "role:editor"}, resp.Principals)
 }
+
+func TestAllowedHandlerTenant(t *testing.T) {
+	var resp AllowedResponse
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	d := doorman.NewDefaultLadon()
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://sample.yaml",
+			Policies: doorman.Policies{
+				doorman.Policy{
+					ID:         "1",
+					Principals: []string{"tenant:acme"},
+					Actions:    []string{"read"},
+					Resources:  []string{"<.*>"},
+					Conditions: doorman.Conditions{
+						"resourceTenant": doorman.Condition{
+							Type: "MatchTenantCondition",
+						},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	c.Set(DoormanContextKey, d)
+	c.Set(TenantContextKey, "acme")
+
+	authzRequest := doorman.Request{
+		Principals: doorman.Principals{"userid:bob"},
+		Action:     "read",
+		Resource:   "invoice",
+		Context: doorman.Context{
+			"resourceTenant": "acme",
+			"tenant":         "spoofed",
+		},
+	}
+	post, _ := json.Marshal(authzRequest)
+	body := bytes.NewBuffer(post)
+	c.Request, _ = http.NewRequest("POST", "/allowed", body)
+	c.Request.Header.Set("Origin", "https://sample.yaml")
+	allowedHandler(c)
+
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.True(t, resp.Allowed)
+	assert.Equal(t, doorman.Principals{"userid:bob", "tenant:acme"}, resp.Principals)
+}
+
+func TestAllowedHandlerBaggage(t *testing.T) {
+	var resp AllowedResponse
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	d := doorman.NewDefaultLadon()
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://sample.yaml",
+			Baggage: map[string]string{
+				"experiment": "experiment",
+			},
+			Policies: doorman.Policies{
+				doorman.Policy{
+					ID:         "1",
+					Principals: []string{"<.*>"},
+					Actions:    []string{"read"},
+					Resources:  []string{"<.*>"},
+					Conditions: doorman.Conditions{
+						"experiment": doorman.Condition{
+							Type: "StringEqualCondition",
+							Options: map[string]interface{}{
+								"equals": "beta",
+							},
+						},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	c.Set(DoormanContextKey, d)
+
+	authzRequest := doorman.Request{
+		Principals: doorman.Principals{"userid:bob"},
+		Action:     "read",
+		Resource:   "feature",
+		Context: doorman.Context{
+			"experiment": "stable",
+		},
+	}
+	post, _ := json.Marshal(authzRequest)
+	body := bytes.NewBuffer(post)
+	c.Request, _ = http.NewRequest("POST", "/allowed", body)
+	c.Request.Header.Set("Origin", "https://sample.yaml")
+	c.Request.Header.Set("Baggage", "experiment=beta")
+	allowedHandler(c)
+
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.True(t, resp.Allowed)
+}
+
+func TestAllowedHandlerReservedContext(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://sample.yaml",
+			Policies: doorman.Policies{
+				doorman.Policy{
+					ID:         "1",
+					Principals: []string{"<.*>"},
+					Actions:    []string{"read"},
+					Resources:  []string{"<.*>"},
+					Conditions: doorman.Conditions{
+						"request.remoteIP": doorman.Condition{
+							Type: "StringEqualCondition",
+							Options: map[string]interface{}{
+								"equals": "10.0.0.1:443",
+							},
+						},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+
+	check := func(context doorman.Context) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set(DoormanContextKey, d)
+		post, _ := json.Marshal(doorman.Request{
+			Principals: doorman.Principals{"userid:bob"},
+			Action:     "read",
+			Resource:   "feature",
+			Context:    context,
+		})
+		c.Request, _ = http.NewRequest("POST", "/allowed", bytes.NewBuffer(post))
+		c.Request.Header.Set("Origin", "https://sample.yaml")
+		c.Request.RemoteAddr = "10.0.0.1:443"
+		allowedHandler(c)
+		return w
+	}
+
+	// Set by Doorman.
+	var resp AllowedResponse
+	w := check(doorman.Context{"_principals": []string{"userid:alice"}})
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.True(t, resp.Allowed)
+
+	// Spoofed by the caller.
+	var errResp ErrorResponse
+	w = check(doorman.Context{"request.remoteIP": "10.0.0.1:443", "env.stage": "prod"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &errResp)
+	assert.Equal(t, "reserved context fields: env.stage, request.remoteIP", errResp.Message)
+}
+
+func TestAllowedHandlerClientIP(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://sample.yaml",
+			Policies: doorman.Policies{
+				doorman.Policy{
+					ID:         "1",
+					Principals: []string{"<.*>"},
+					Actions:    []string{"read"},
+					Resources:  []string{"<.*>"},
+					Conditions: doorman.Conditions{
+						"clientIP": doorman.Condition{
+							Type: "CIDRsCondition",
+							Options: map[string]interface{}{
+								"cidrs": []string{"192.168.0.0/16", "172.16.0.0/12"},
+							},
+						},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+
+	ClientIP.TrustedProxies, _ = doorman.ParseCIDRs([]string{"10.0.0.0/8"})
+	defer func() {
+		ClientIP.TrustedProxies = nil
+	}()
+
+	check := func(remoteAddr string, forwarded string) bool {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set(DoormanContextKey, d)
+		post, _ := json.Marshal(doorman.Request{
+			Principals: doorman.Principals{"userid:bob"},
+			Action:     "read",
+			Resource:   "feature",
+			Context:    doorman.Context{"clientIP": "192.168.1.1"},
+		})
+		c.Request, _ = http.NewRequest("POST", "/allowed", bytes.NewBuffer(post))
+		c.Request.Header.Set("Origin", "https://sample.yaml")
+		c.Request.Header.Set("X-Forwarded-For", forwarded)
+		c.Request.RemoteAddr = remoteAddr
+		allowedHandler(c)
+		var resp AllowedResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Allowed
+	}
+
+	assert.True(t, check("192.168.1.1:443", ""))
+	assert.True(t, check("10.0.0.1:443", "1.2.3.4, 172.16.4.2, 10.0.0.2"))
+	// The header is ignored if not sent by a trusted proxy.
+	assert.False(t, check("1.2.3.4:443", "192.168.1.1"))
+	assert.False(t, check("10.0.0.1:443", "192.168.1.1, 1.2.3.4"))
+}
+
+// countingCondition is fulfilled by any value, and counts its evaluations.
+type countingCondition struct{}
+
+var countingConditionCalls int
+
+func (c *countingCondition) Fulfills(value interface{}, r *ladon.Request) bool {
+	countingConditionCalls++
+	return true
+}
+
+func (c *countingCondition) GetName() string {
+	return "countingCondition"
+}
+
+func TestAllowedHandlerDecisionCache(t *testing.T) {
+	doorman.RegisterCondition("countingCondition", func() ladon.Condition {
+		return new(countingCondition)
+	})
+	d := doorman.NewDefaultLadon()
+	d.SetDecisionCache(time.Minute, 0)
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://sample.yaml",
+			Policies: doorman.Policies{
+				doorman.Policy{
+					ID:         "1",
+					Principals: []string{"userid:bob"},
+					Actions:    []string{"read"},
+					Resources:  []string{"<.*>"},
+					Conditions: doorman.Conditions{
+						"remoteIP": doorman.Condition{Type: "countingCondition"},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	d.SetAuthenticator("https://sample.yaml", nil)
+
+	r := gin.New()
+	SetupRoutes(r, d)
+
+	check := func(remoteAddr string) bool {
+		body := bytes.NewBufferString(`{"principals": ["userid:bob"], "action": "read", "resource": "feature"}`)
+		req, _ := http.NewRequest("POST", "/allowed", body)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Origin", "https://sample.yaml")
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp AllowedResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Allowed
+	}
+
+	countingConditionCalls = 0
+	assert.True(t, check("192.168.1.1:50001"))
+	assert.Equal(t, 1, countingConditionCalls)
+	// The clients ports do not prevent the cache hits.
+	assert.True(t, check("192.168.1.1:50002"))
+	assert.Equal(t, 1, countingConditionCalls)
+	// Other clients addresses are evaluated.
+	assert.True(t, check("192.168.1.2:50001"))
+	assert.Equal(t, 2, countingConditionCalls)
+}
+
+func TestAllowedHandlerReauthenticate(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://sample.yaml",
+			Policies: doorman.Policies{
+				doorman.Policy{
+					ID:         "1",
+					Principals: []string{"userid:maria"},
+					Actions:    []string{"delete"},
+					Resources:  []string{"<.*>"},
+					Conditions: doorman.Conditions{
+						doorman.AuthTimeContextField: doorman.Condition{
+							Type:    "RecentAuthCondition",
+							Options: map[string]interface{}{"maxAge": "15m"},
+						},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	})
+	authTime := float64(time.Now().Add(-time.Hour).Unix())
+	v := &TestAuthenticator{}
+	v.On("ValidateRequest", mock.Anything).Return(&authn.UserInfo{
+		ID:     "maria",
+		Claims: map[string]interface{}{"auth_time": authTime},
+	}, nil)
+	d.SetAuthenticator("https://sample.yaml", v)
+
+	r := gin.New()
+	SetupRoutes(r, d)
+
+	// The posted authentication time is ignored.
+	recent := time.Now().Unix()
+	body := bytes.NewBufferString(fmt.Sprintf(`{"action": "delete", "context": {"auth_time": %d}}`, recent))
+	var resp map[string]interface{}
+	performAllowed(t, r, body, http.StatusOK, &resp)
+	assert.Equal(t, false, resp["allowed"])
+	assert.Equal(t, doorman.ReasonReauthenticate, resp["reason"])
+}
+
+func TestAllowedHandlerObligations(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://sample.yaml",
+			Policies: doorman.Policies{
+				doorman.Policy{
+					ID:         "1",
+					Principals: []string{"userid:maria"},
+					Actions:    []string{"read"},
+					Resources:  []string{"<.*>"},
+					Obligations: []doorman.Obligation{
+						{Type: "mask", Options: map[string]interface{}{"field": "email"}},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	})
+	d.SetAuthenticator("https://sample.yaml", nil)
+
+	r := gin.New()
+	SetupRoutes(r, d)
+
+	var resp map[string]interface{}
+	body := bytes.NewBufferString(`{"principals": ["userid:maria"], "action": "read"}`)
+	performAllowed(t, r, body, http.StatusOK, &resp)
+	assert.Equal(t, true, resp["allowed"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"type": "mask", "options": map[string]interface{}{"field": "email"}},
+	}, resp["obligations"])
+
+	resp = map[string]interface{}{}
+	body = bytes.NewBufferString(`{"principals": ["userid:maria"], "action": "write"}`)
+	performAllowed(t, r, body, http.StatusOK, &resp)
+	assert.Equal(t, false, resp["allowed"])
+	assert.Nil(t, resp["obligations"])
+}
+
+func TestAllowedBatchHandler(t *testing.T) {
+	configs, err := config.Load([]string{"../sample.yaml"})
+	require.Nil(t, err)
+	d := doorman.NewDefaultLadon()
+	require.Nil(t, d.LoadPolicies(configs))
+	// Authentication disabled: the principals are posted.
+	d.SetAuthenticator("https://sample.yaml", nil)
+
+	r := gin.New()
+	SetupRoutes(r, d)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/allowed/batch", bytes.NewBufferString(body))
+		req.Header.Set("Origin", "https://sample.yaml")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post(`[
+		{"principals": ["userid:maria"], "action": "update", "resource": "a"},
+		{"principals": ["userid:maria"], "action": "delete", "resource": "b"},
+		{"principals": ["userid:bob"], "action": "update", "resource": "pto", "context": {"roles": ["editor"]}}
+	]`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var responses []AllowedResponse
+	json.Unmarshal(w.Body.Bytes(), &responses)
+	require.Len(t, responses, 3)
+	assert.True(t, responses[0].Allowed)
+	assert.Equal(t, doorman.Principals{"userid:maria", "tag:admins"}, responses[0].Principals)
+	assert.False(t, responses[1].Allowed)
+	assert.Equal(t, doorman.Principals{"userid:bob", "role:editor"}, responses[2].Principals)
+	assert.NotEmpty(t, responses[0].DecisionID)
+	assert.Equal(t, responses[0].DecisionID, responses[2].DecisionID)
+
+	var errResp ErrorResponse
+	for body, message := range map[string]string{
+		"":   "Missing body",
+		"{}": "cannot unmarshal object",
+		"[]": "batch must have between 1 and 100 requests",
+		`[{"principals": ["userid:maria"]}, {"action": "read"}]`:                         "request 1: missing principals",
+		`[{"principals": ["userid:maria"], "context": {"request.remoteIP": "1.2.3.4"}}]`: "request 0: reserved context fields: request.remoteIP",
+	} {
+		w := post(body)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		json.Unmarshal(w.Body.Bytes(), &errResp)
+		assert.Contains(t, errResp.Message, message)
+	}
+
+	many := "[" + strings.Repeat(`{"principals": ["userid:maria"]},`, MaxBatchRequests) + `{"principals": ["userid:maria"]}]`
+	assert.Equal(t, http.StatusBadRequest, post(many).Code)
+}
@@ -9,12 +9,41 @@ import (
 func SetupRoutes(r *gin.Engine, d doorman.Doorman) {
 	r.Use(ContextMiddleware(d))
 
+	slo := newSLORecorder(Objectives)
+
 	a := r.Group("")
+	a.Use(DecisionIDMiddleware())
+	a.Use(decisionSLOMiddleware(slo))
+	a.Use(EncodingMiddleware())
 	a.Use(AuthnMiddleware(d))
+	a.Use(RateLimitMiddleware(d))
 	a.POST("/allowed", allowedHandler)
+	a.POST("/allowed/batch", allowedBatchHandler)
+
+	// Not an authorization decision: without decision ID nor SLO.
+	r.GET("/__principals", AuthnMiddleware(d), principalsHandler)
+	r.POST("/allowed/resources", EncodingMiddleware(), AuthnMiddleware(d), RateLimitMiddleware(d), allowedResourcesHandler)
+	r.POST("/allowed/filter", EncodingMiddleware(), AuthnMiddleware(d), RateLimitMiddleware(d), allowedFilterHandler)
 
 	sources := d.ConfigSources()
-	r.POST("/__reload__", reloadHandler(sources))
+	if Reload.Standby != nil {
+		r.POST("/__reload__", reloadSLOMiddleware(slo), standbyReloadHandler(Reload.Standby))
+	} else {
+		r.POST("/__reload__", reloadSLOMiddleware(slo), reloadHandler(sources))
+	}
+	r.GET("/__slo__", sloHandler(slo))
+	r.GET("/__maintenance__", maintenanceHandler)
+	r.POST("/__maintenance__", AdminMiddleware(), setMaintenanceHandler)
+	r.GET("/__decision_log__", decisionLogHandler)
+	r.POST("/__decision_log__", AdminMiddleware(), setDecisionLogHandler)
+	r.GET("/__audit__/who-can", AdminMiddleware(), whoCanHandler)
+	if History.Store != nil {
+		r.GET("/__audit__/principals/:id/recent", AdminMiddleware(), principalHistoryHandler(History.Store))
+	}
+	if Relations.Store != nil {
+		r.POST("/__relations__", AdminMiddleware(), writeRelationsHandler(Relations.Store))
+		r.GET("/__relations__/check", AdminMiddleware(), checkRelationHandler(Relations.Store))
+	}
 
 	r.GET("/__lbheartbeat__", lbHeartbeatHandler)
 	r.GET("/__heartbeat__", heartbeatHandler)
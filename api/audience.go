@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// AudienceSettings configure how the service of the authorization requests
+// (ie. the expected tokens audience) is determined.
+type AudienceSettings = doorman.AudienceSettings
+
+// Audience are the service location settings.
+// They must be set before calling SetupRoutes().
+var Audience = AudienceSettings{
+	Header: "Origin",
+}
+
+// requestAudience returns the service of the request, or an empty string if
+// not specified (see doorman.AudienceSettings).
+func requestAudience(r *http.Request) string {
+	return Audience.FromRequest(r)
+}
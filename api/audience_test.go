@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/doorman"
+)
+
+func TestRequestAudience(t *testing.T) {
+	defer func() { Audience = AudienceSettings{Header: "Origin"} }()
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "https://origin.com")
+	r.Header.Set("X-Doorman-Audience", "https://audience.com")
+	assert.Equal(t, "https://origin.com", requestAudience(r))
+
+	Audience.Header = "X-Doorman-Audience"
+	assert.Equal(t, "https://audience.com", requestAudience(r))
+
+	Audience.Fixed = "https://fixed.com"
+	assert.Equal(t, "https://fixed.com", requestAudience(r))
+
+	// Normalized like the services of the configuration.
+	Audience.Fixed = ""
+	r.Header.Set("X-Doorman-Audience", "HTTPS://Audience.com:443/")
+	assert.Equal(t, "https://audience.com", requestAudience(r))
+	r.Header.Set("X-Doorman-Audience", "https://")
+	assert.Equal(t, "https://", requestAudience(r))
+}
+
+func TestAuthnMiddlewareAudienceHeader(t *testing.T) {
+	Audience.Header = "X-Doorman-Audience"
+	defer func() { Audience = AudienceSettings{Header: "Origin"} }()
+
+	d := doorman.NewDefaultLadon()
+	d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{Service: "https://some.api.com"},
+	})
+	v := &TestAuthenticator{}
+	v.On("ValidateRequest", mock.Anything).Return(&authn.UserInfo{ID: "ldap|user"}, nil)
+	d.SetAuthenticator("https://some.api.com", v)
+	handler := AuthnMiddleware(d)
+
+	// Origin is ignored.
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	c.Request.Header.Set("Origin", "https://some.api.com")
+	handler(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Missing `X-Doorman-Audience` request header")
+
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	c.Request.Header.Set("X-Doorman-Audience", "https://some.api.com")
+	handler(c)
+	principals, ok := PrincipalsFromContext(c)
+	require.True(t, ok)
+	assert.Equal(t, doorman.Principals{"userid:ldap|user"}, principals)
+
+	// The authenticator receives the service as Origin.
+	validated := v.Calls[0].Arguments.Get(0).(*http.Request)
+	assert.Equal(t, "https://some.api.com", validated.Header.Get("Origin"))
+
+	// Fixed audience.
+	Audience.Fixed = "https://some.api.com"
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	handler(c)
+	_, ok = PrincipalsFromContext(c)
+	assert.True(t, ok)
+}
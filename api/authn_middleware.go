@@ -3,6 +3,7 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
@@ -13,9 +14,20 @@ import (
 // DoormanContextKey is the Gin context key to obtain the *Doorman instance.
 const DoormanContextKey string = "doorman"
 
+// ServiceContextKey is the Gin context key to obtain the service of the
+// authenticated request.
+const ServiceContextKey string = "service"
+
 // PrincipalsContextKey is the Gin context key to obtain the current user principals.
 const PrincipalsContextKey string = "principals"
 
+// TenantContextKey is the Gin context key to obtain the current user tenant.
+const TenantContextKey string = "tenant"
+
+// AuthTimeContextKey is the Gin context key to obtain the time when the current
+// user authenticated (`auth_time` claim).
+const AuthTimeContextKey string = "authTime"
+
 // ContextMiddleware adds the Doorman instance to the Gin context.
 func ContextMiddleware(d doorman.Doorman) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -30,64 +42,114 @@ func AuthnMiddleware(d doorman.Doorman) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// The service requesting must send its location. It will be compared
 		// with the services defined in policies files.
-		// XXX: The Origin request header might not be the best choice.
-		origin := c.Request.Header.Get("Origin")
+		// The Origin request header might be stripped by proxies (see Audience).
+		origin := requestAudience(c.Request)
 		if origin == "" {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-				"message": "Missing `Origin` request header",
-			})
+			message := fmt.Sprintf("Missing `%s` request header", Audience.Header)
+			abortWithError(c, http.StatusBadRequest, ErrorMissingAudience, message)
 			return
 		}
 
-		// Check if authentication was configured for this service.
-		authenticator, err := d.Authenticator(origin)
-		if err != nil {
-			// Unknown service
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"message": "Unknown service specified in `Origin`",
-			})
-			return
+		authenticate(c, d, origin)
+	}
+}
+
+// ServiceAuthnMiddleware relies on the authenticator of the specified service,
+// regardless of the request `Origin` header.
+func ServiceAuthnMiddleware(s *doorman.ServiceDoorman) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(DoormanContextKey, s.Doorman)
+		authenticate(c, s.Doorman, s.Service)
+	}
+}
+
+// authenticate validates the request authentication for the specified service and
+// sets the user principals in context.
+func authenticate(c *gin.Context, d doorman.Doorman, service string) {
+	c.Set(ServiceContextKey, service)
+
+	// Check if authentication was configured for this service.
+	authenticator, err := d.Authenticator(service)
+	if err != nil {
+		// Unknown service
+		abortWithError(c, http.StatusUnauthorized, ErrorUnknownService, fmt.Sprintf("Unknown service %q", service))
+		return
+	}
+	config, _ := d.ServiceConfig(service)
+	tenantEnabled := config.Tenant.Enabled()
+
+	// No authenticator configured for this service.
+	if authenticator == nil {
+		// Do nothing. The principals list will be empty.
+		if tenantEnabled {
+			c.Set(TenantContextKey, config.Tenant.FromRequest(c.Request, nil))
 		}
-		// No authenticator configured for this service.
-		if authenticator == nil {
-			// Do nothing. The principals list will be empty.
+		c.Next()
+		return
+	}
+
+	// Validate authentication, unless a valid session cookie was sent.
+	userInfo, ok := sessionUserInfo(c, service)
+	if !ok {
+		userInfo, err = validateRequest(c.Request, authenticator, service)
+		if err != nil && insecurePrincipals(c, service, err) {
 			c.Next()
 			return
 		}
-
-		// Validate authentication.
-		userInfo, err := authenticator.ValidateRequest(c.Request)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"message": err.Error(),
-			})
+			abortWithError(c, http.StatusUnauthorized, ErrorUnauthenticated, err.Error())
 			return
 		}
+	}
+	if unmet := config.UnmetClaims(userInfo.Claims); len(unmet) > 0 {
+		abortWithResponseError(c, ResponseError{
+			Status:  http.StatusForbidden,
+			Code:    ErrorRequiredClaims,
+			Message: fmt.Sprintf("missing required claims: %s", strings.Join(unmet, ", ")),
+			Details: map[string]interface{}{
+				"reason": ErrorRequiredClaims,
+				"claims": unmet,
+			},
+		})
+		return
+	}
+	setSessionCookie(c, service, userInfo)
 
-		principals := buildPrincipals(userInfo)
+	identity, err := identitySettings().Identity(c.Request, service, config, userInfo)
+	if err != nil {
+		abortWithError(c, http.StatusUnauthorized, ErrorUnauthenticated, err.Error())
+		return
+	}
+	userInfo = identity.UserInfo
 
-		c.Set(PrincipalsContextKey, principals)
+	c.Set(PrincipalsContextKey, identity.Principals)
+	c.Set(UserInfoContextKey, userInfo)
+	c.Set(ClaimsContextKey, userInfo.Claims)
 
-		c.Next()
+	if authTime, ok := userInfo.Claims["auth_time"]; ok {
+		c.Set(AuthTimeContextKey, authTime)
 	}
-}
-
-func buildPrincipals(userInfo *authn.UserInfo) doorman.Principals {
-	// Extract principals from JWT
-	var principals doorman.Principals
-	userid := fmt.Sprintf("userid:%s", userInfo.ID)
-	principals = append(principals, userid)
 
-	// Main email (no alias)
-	if userInfo.Email != "" {
-		email := fmt.Sprintf("email:%s", userInfo.Email)
-		principals = append(principals, email)
+	if tenantEnabled {
+		c.Set(TenantContextKey, identity.Tenant)
 	}
 
-	// Groups
-	for _, group := range userInfo.Groups {
-		prefixed := fmt.Sprintf("group:%s", group)
-		principals = append(principals, prefixed)
+	c.Next()
+}
+
+// validateRequest authenticates the request for the service. The authenticators
+// read the ID tokens audience from the `Origin` header, which must thus match the
+// service, regardless of the audience settings.
+func validateRequest(r *http.Request, authenticator authn.Authenticator, service string) (*authn.UserInfo, error) {
+	if r.Header.Get("Origin") != service {
+		original := r
+		r = new(http.Request)
+		*r = *original
+		r.Header = http.Header{}
+		for k, v := range original.Header {
+			r.Header[k] = v
+		}
+		r.Header.Set("Origin", service)
 	}
-	return principals
+	return authenticator.ValidateRequest(r)
 }
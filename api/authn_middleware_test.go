@@ -1,8 +1,10 @@
 package api
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -38,7 +40,9 @@ func TestAuthnMiddleware(t *testing.T) {
 	claims := &authn.UserInfo{
 		ID:     "ldap|user",
 		Email:  "user@corp.com",
+		Domain: "corp.com",
 		Groups: []string{"Employee", "Admins"},
+		Roles:  []string{"editor"},
 	}
 	v.On("ValidateRequest", mock.Anything).Return(claims, nil)
 	c, _ := gin.CreateTestContext(httptest.NewRecorder())
@@ -55,8 +59,10 @@ func TestAuthnMiddleware(t *testing.T) {
 	assert.Equal(t, principals, doorman.Principals{
 		"userid:ldap|user",
 		"email:user@corp.com",
+		"domain:corp.com",
 		"group:Employee",
 		"group:Admins",
+		"role:editor",
 	})
 
 	c, _ = gin.CreateTestContext(httptest.NewRecorder())
@@ -97,3 +103,173 @@ func TestAuthnMiddleware(t *testing.T) {
 	principals, _ = c.Get(PrincipalsContextKey)
 	assert.Equal(t, doorman.Principals{"userid:ldap|user"}, principals)
 }
+
+func TestAuthnMiddlewareTenant(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://some.api.com",
+			Tenant: doorman.TenantConfig{
+				Claim:  "https://corp.com/tenant",
+				Header: "X-Tenant",
+			},
+		},
+	})
+	handler := AuthnMiddleware(d)
+
+	// Read from header when authentication is disabled.
+	d.SetAuthenticator("https://some.api.com", nil)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	c.Request.Header.Set("Origin", "https://some.api.com")
+	c.Request.Header.Set("X-Tenant", "globex")
+	handler(c)
+	tenant, ok := c.Get(TenantContextKey)
+	require.True(t, ok)
+	assert.Equal(t, "globex", tenant)
+
+	// Claim has precedence over header.
+	v := &TestAuthenticator{}
+	v.On("ValidateRequest", mock.Anything).Return(&authn.UserInfo{
+		ID: "ldap|user",
+		Claims: map[string]interface{}{
+			"https://corp.com/tenant": "acme",
+		},
+	}, nil)
+	d.SetAuthenticator("https://some.api.com", v)
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	c.Request.Header.Set("Origin", "https://some.api.com")
+	c.Request.Header.Set("X-Tenant", "globex")
+	handler(c)
+	tenant, _ = c.Get(TenantContextKey)
+	assert.Equal(t, "acme", tenant)
+}
+
+func TestAuthnMiddlewareClaims(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://some.api.com",
+			Claims: map[string]string{
+				"https://corp.com/teams": "team",
+			},
+		},
+	})
+	handler := AuthnMiddleware(d)
+
+	v := &TestAuthenticator{}
+	v.On("ValidateRequest", mock.Anything).Return(&authn.UserInfo{
+		ID: "ldap|user",
+		Claims: map[string]interface{}{
+			"https://corp.com/teams": []interface{}{"platform", "security"},
+		},
+	}, nil)
+	d.SetAuthenticator("https://some.api.com", v)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	c.Request.Header.Set("Origin", "https://some.api.com")
+	handler(c)
+	principals, _ := c.Get(PrincipalsContextKey)
+	assert.Equal(t, doorman.Principals{"userid:ldap|user", "team:platform", "team:security"}, principals)
+}
+
+func TestAuthnMiddlewareRequiredClaims(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://some.api.com",
+			RequiredClaims: map[string]interface{}{
+				"email_verified": true,
+				"amr":            "mfa",
+			},
+		},
+	})
+	handler := AuthnMiddleware(d)
+
+	claims := map[string]interface{}{
+		"email_verified": true,
+		"amr":            []interface{}{"pwd"},
+	}
+	v := &TestAuthenticator{}
+	v.On("ValidateRequest", mock.Anything).Return(&authn.UserInfo{ID: "ldap|user", Claims: claims}, nil)
+	d.SetAuthenticator("https://some.api.com", v)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	c.Request.Header.Set("Origin", "https://some.api.com")
+	handler(c)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, map[string]interface{}{
+		"message": "missing required claims: amr",
+		"reason":  "required_claims",
+		"claims":  []interface{}{"amr"},
+	}, body)
+	_, ok := c.Get(PrincipalsContextKey)
+	assert.False(t, ok)
+
+	claims["amr"] = []interface{}{"pwd", "mfa"}
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	c.Request.Header.Set("Origin", "https://some.api.com")
+	handler(c)
+	principals, _ := c.Get(PrincipalsContextKey)
+	assert.Equal(t, doorman.Principals{"userid:ldap|user"}, principals)
+}
+
+func TestServiceAuthnMiddleware(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	handler := ServiceAuthnMiddleware(d.ForService("https://some.api.com"))
+
+	v := &TestAuthenticator{}
+	v.On("ValidateRequest", mock.Anything).Return(&authn.UserInfo{ID: "ldap|user"}, nil)
+	d.SetAuthenticator("https://some.api.com", v)
+
+	// No Origin header required.
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	handler(c)
+	principals, ok := c.Get(PrincipalsContextKey)
+	require.True(t, ok)
+	assert.Equal(t, doorman.Principals{"userid:ldap|user"}, principals)
+
+	// The authenticator receives the service as Origin.
+	validated := v.Calls[0].Arguments.Get(0).(*http.Request)
+	assert.Equal(t, "https://some.api.com", validated.Header.Get("Origin"))
+	assert.Equal(t, "", c.Request.Header.Get("Origin"))
+}
+
+func TestAuthnMiddlewareAPIKey(t *testing.T) {
+	os.Setenv("TEST_API_KEYS", "deploy-bot=s3cr3t")
+	defer os.Unsetenv("TEST_API_KEYS")
+
+	d := doorman.NewDefaultLadon()
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://some.api.com",
+			APIKeys: doorman.APIKeysConfig{Env: "TEST_API_KEYS"},
+		},
+	})
+	require.Nil(t, err)
+	handler := AuthnMiddleware(d)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	c.Request.Header.Set("Origin", "https://some.api.com")
+	c.Request.Header.Set(authn.APIKeyHeader, "s3cr3t")
+	handler(c)
+	principals, ok := c.Get(PrincipalsContextKey)
+	require.True(t, ok)
+	assert.Equal(t, doorman.Principals{"apikey:deploy-bot"}, principals)
+
+	w := httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	c.Request.Header.Set("Origin", "https://some.api.com")
+	c.Request.Header.Set(authn.APIKeyHeader, "bad")
+	handler(c)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
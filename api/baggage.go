@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// BaggageHeader is the W3C request header used by OpenTelemetry to propagate baggage.
+const BaggageHeader = "Baggage"
+
+// parseBaggage reads the entries of the W3C baggage header values
+// (eg. `tenant=acme,experiment=blue;ttl=3`). Entries properties are ignored.
+func parseBaggage(header http.Header) map[string]string {
+	entries := map[string]string{}
+	for _, value := range header[http.CanonicalHeaderKey(BaggageHeader)] {
+		for _, member := range strings.Split(value, ",") {
+			member = strings.SplitN(member, ";", 2)[0]
+			parts := strings.SplitN(member, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			key := strings.TrimSpace(parts[0])
+			v, err := url.PathUnescape(strings.TrimSpace(parts[1]))
+			if key == "" || err != nil {
+				continue
+			}
+			entries[key] = v
+		}
+	}
+	return entries
+}
+
+// baggageContext returns the context values from the baggage entries that are
+// mapped to context fields.
+func baggageContext(r *http.Request, mapping map[string]string) map[string]string {
+	values := map[string]string{}
+	if len(mapping) == 0 {
+		return values
+	}
+	for key, value := range parseBaggage(r.Header) {
+		if field, ok := mapping[key]; ok {
+			values[field] = value
+		}
+	}
+	return values
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBaggage(t *testing.T) {
+	header := http.Header{}
+	header.Add("Baggage", "tenant=acme, experiment=blue%20green;ttl=3")
+	header.Add("Baggage", "invalid,=empty,region=eu")
+	assert.Equal(t, map[string]string{
+		"tenant":     "acme",
+		"experiment": "blue green",
+		"region":     "eu",
+	}, parseBaggage(header))
+}
+
+func TestBaggageContext(t *testing.T) {
+	r, _ := http.NewRequest("POST", "/allowed", nil)
+	r.Header.Set("Baggage", "tenant=acme,experiment=blue")
+
+	assert.Equal(t, map[string]string{}, baggageContext(r, nil))
+	assert.Equal(t, map[string]string{
+		"experimentFlag": "blue",
+	}, baggageContext(r, map[string]string{
+		"experiment": "experimentFlag",
+		"missing":    "missing",
+	}))
+}
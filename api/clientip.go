@@ -0,0 +1,16 @@
+package api
+
+import (
+	"net"
+)
+
+// ClientIPSettings configure how the IP address of the clients is determined.
+type ClientIPSettings struct {
+	// TrustedProxies are the networks of the proxies whose `X-Forwarded-For`
+	// header is trusted (default: none, the header is ignored).
+	TrustedProxies []*net.IPNet
+}
+
+// ClientIP are the client IP address settings.
+// They must be set before calling SetupRoutes().
+var ClientIP = ClientIPSettings{}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/doorman"
+)
+
+// UserInfoContextKey is the Gin context key to obtain the current user info,
+// with all its claims.
+const UserInfoContextKey string = "userInfo"
+
+// ClaimsContextKey is the Gin context key to obtain the full decoded claims of
+// the current user, including the custom ones (eg. `locale`, `tenant_id`).
+const ClaimsContextKey string = "claims"
+
+// PrincipalsFromContext returns the principals of the authenticated user. It
+// returns false if authentication is disabled for the service.
+func PrincipalsFromContext(c *gin.Context) (doorman.Principals, bool) {
+	principals, ok := c.Get(PrincipalsContextKey)
+	if !ok {
+		return nil, false
+	}
+	p, ok := principals.(doorman.Principals)
+	return p, ok
+}
+
+// UserInfoFromContext returns the user info of the authenticated user (nil if
+// authentication is disabled for the service).
+func UserInfoFromContext(c *gin.Context) (*authn.UserInfo, bool) {
+	userInfo, ok := c.Get(UserInfoContextKey)
+	if !ok {
+		return nil, false
+	}
+	u, ok := userInfo.(*authn.UserInfo)
+	return u, ok
+}
+
+// ClaimsFromContext returns the claims of the authenticated user (eg. `email`),
+// or an empty map if authentication is disabled for the service.
+func ClaimsFromContext(c *gin.Context) map[string]interface{} {
+	if claims, ok := c.Get(ClaimsContextKey); ok {
+		if m, ok := claims.(map[string]interface{}); ok && m != nil {
+			return m
+		}
+	}
+	return map[string]interface{}{}
+}
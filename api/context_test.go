@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/doorman"
+)
+
+func TestContextAccessors(t *testing.T) {
+	// Nothing set when authentication is disabled.
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	_, ok := PrincipalsFromContext(c)
+	assert.False(t, ok)
+	_, ok = UserInfoFromContext(c)
+	assert.False(t, ok)
+	assert.Equal(t, map[string]interface{}{}, ClaimsFromContext(c))
+
+	d := doorman.NewDefaultLadon()
+	v := &TestAuthenticator{}
+	v.On("ValidateRequest", mock.Anything).Return(&authn.UserInfo{
+		ID:    "ldap|user",
+		Email: "user@corp.com",
+		Claims: map[string]interface{}{
+			"email":  "user@corp.com",
+			"locale": "fr-CA",
+		},
+	}, nil)
+	d.SetAuthenticator("https://some.api.com", v)
+
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	c.Request.Header.Set("Origin", "https://some.api.com")
+	AuthnMiddleware(d)(c)
+
+	principals, ok := PrincipalsFromContext(c)
+	require.True(t, ok)
+	assert.Equal(t, doorman.Principals{"userid:ldap|user", "email:user@corp.com"}, principals)
+	userInfo, ok := UserInfoFromContext(c)
+	require.True(t, ok)
+	assert.Equal(t, "ldap|user", userInfo.ID)
+	assert.Equal(t, "user@corp.com", ClaimsFromContext(c)["email"])
+	claims, ok := c.Get(ClaimsContextKey)
+	require.True(t, ok)
+	assert.Equal(t, "fr-CA", claims.(map[string]interface{})["locale"])
+
+	// Values of unexpected types are ignored.
+	c.Set(PrincipalsContextKey, []string{"userid:ldap|user"})
+	_, ok = PrincipalsFromContext(c)
+	assert.False(t, ok)
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DecisionIDContextKey is the Gin context key to obtain the current decision ID.
+const DecisionIDContextKey string = "decisionID"
+
+// DecisionIDHeader is the response header that contains the decision ID.
+const DecisionIDHeader string = "X-Decision-ID"
+
+// newDecisionID returns a random identifier for an authorization decision.
+func newDecisionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// DecisionIDMiddleware assigns a unique ID to every decision, sent back in the
+// response headers. It is included in the audit logs, so that a denied request
+// can be matched to the exact audit record.
+func DecisionIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := newDecisionID()
+		c.Set(DecisionIDContextKey, id)
+		c.Header(DecisionIDHeader, id)
+		c.Next()
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+func TestNewDecisionID(t *testing.T) {
+	a := newDecisionID()
+	assert.Equal(t, 32, len(a))
+	assert.NotEqual(t, a, newDecisionID())
+}
+
+func TestAllowedDecisionID(t *testing.T) {
+	r := gin.New()
+	d := doorman.NewDefaultLadon()
+	d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://sample.yaml",
+		},
+	})
+	d.SetAuthenticator("https://sample.yaml", nil)
+	SetupRoutes(r, d)
+
+	w := performEncoded(r, []byte(`{"principals": ["userid:maria"], "action": "read"}`), nil)
+	require.Equal(t, 200, w.Code)
+	id := w.Header().Get(DecisionIDHeader)
+	assert.NotEmpty(t, id)
+
+	var resp AllowedResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, id, resp.DecisionID)
+
+	// Every decision has its own ID.
+	w = performEncoded(r, []byte(`{"principals": ["userid:maria"], "action": "read"}`), nil)
+	assert.NotEqual(t, id, w.Header().Get(DecisionIDHeader))
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// DecisionLogRequest is the body of the decisions logs verbosity change.
+type DecisionLogRequest struct {
+	Service   string `json:"service" binding:"required"`
+	Verbosity string `json:"verbosity"`
+}
+
+// decisionLogHandler returns the decisions logs verbosity of the service specified in querystring.
+func decisionLogHandler(c *gin.Context) {
+	d := c.MustGet(DoormanContextKey).(doorman.Doorman)
+	service := c.Query("service")
+	if _, ok := d.ServiceConfig(service); !ok {
+		abortWithError(c, http.StatusNotFound, ErrorUnknownService, "unknown service")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"service":   service,
+		"verbosity": d.DecisionLog(service),
+	})
+}
+
+// setDecisionLogHandler changes the decisions logs verbosity of a service. An
+// empty verbosity restores the one of the configuration.
+func setDecisionLogHandler(c *gin.Context) {
+	var r DecisionLogRequest
+	if err := c.BindJSON(&r); err != nil {
+		abortWithError(c, http.StatusBadRequest, ErrorInvalidBody, err.Error())
+		return
+	}
+
+	d := c.MustGet(DoormanContextKey).(doorman.Doorman)
+	if _, ok := d.ServiceConfig(r.Service); !ok {
+		abortWithError(c, http.StatusNotFound, ErrorUnknownService, "unknown service")
+		return
+	}
+	if err := d.SetDecisionLog(r.Service, r.Verbosity); err != nil {
+		abortWithError(c, http.StatusBadRequest, ErrorInvalidBody, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"service":   r.Service,
+		"verbosity": d.DecisionLog(r.Service),
+	})
+}
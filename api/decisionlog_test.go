@@ -0,0 +1,81 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+type DecisionLogResponse struct {
+	Service   string
+	Verbosity string
+}
+
+func TestDecisionLogHandlers(t *testing.T) {
+	r := gin.New()
+	d := doorman.NewDefaultLadon()
+	d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service:     "https://sample.yaml",
+			DecisionLog: doorman.DecisionLogDenials,
+		},
+	})
+	SetupRoutes(r, d)
+	Admin.Token = "s3cr3t"
+	defer func() { Admin.Token = "" }()
+
+	var status DecisionLogResponse
+	w := performRequest(r, "GET", "/__decision_log__?service=https://sample.yaml", nil)
+	require.Equal(t, 200, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &status)
+	assert.Equal(t, "denials", status.Verbosity)
+
+	// Turning the logs off requires the admin token.
+	w = performRequest(r, "POST", "/__decision_log__", bytes.NewBufferString(`{"service": "https://sample.yaml", "verbosity": "none"}`))
+	require.Equal(t, 401, w.Code)
+	assert.Equal(t, "denials", d.DecisionLog("https://sample.yaml"))
+
+	w = performAdminRequest(r, "POST", "/__decision_log__", bytes.NewBufferString(`{"service": "https://sample.yaml", "verbosity": "none"}`))
+	require.Equal(t, 200, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &status)
+	assert.Equal(t, "none", status.Verbosity)
+	assert.Equal(t, "none", d.DecisionLog("https://sample.yaml"))
+
+	// Back to the configured verbosity.
+	w = performAdminRequest(r, "POST", "/__decision_log__", bytes.NewBufferString(`{"service": "https://sample.yaml"}`))
+	require.Equal(t, 200, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &status)
+	assert.Equal(t, "denials", status.Verbosity)
+}
+
+func TestDecisionLogHandlersErrors(t *testing.T) {
+	r := gin.New()
+	d := doorman.NewDefaultLadon()
+	d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{Service: "https://sample.yaml"},
+	})
+	SetupRoutes(r, d)
+	Admin.Token = "s3cr3t"
+	defer func() { Admin.Token = "" }()
+
+	var errResp ErrorResponse
+	w := performRequest(r, "GET", "/__decision_log__?service=unknown", nil)
+	assert.Equal(t, 404, w.Code)
+
+	w = performAdminRequest(r, "POST", "/__decision_log__", bytes.NewBufferString(`{"verbosity": "none"}`))
+	assert.Equal(t, 400, w.Code)
+
+	w = performAdminRequest(r, "POST", "/__decision_log__", bytes.NewBufferString(`{"service": "unknown", "verbosity": "none"}`))
+	assert.Equal(t, 404, w.Code)
+
+	w = performAdminRequest(r, "POST", "/__decision_log__", bytes.NewBufferString(`{"service": "https://sample.yaml", "verbosity": "verbose"}`))
+	assert.Equal(t, 400, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &errResp)
+	assert.Contains(t, errResp.Message, "unknown decision log verbosity")
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gzipResponseWriter compresses the response body on the fly.
+type gzipResponseWriter struct {
+	gin.ResponseWriter
+	writer *gzip.Writer
+}
+
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	if w.writer == nil {
+		w.Header().Del("Content-Length")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.writer = gzip.NewWriter(w.ResponseWriter)
+	}
+	return w.writer.Write(data)
+}
+
+func (w *gzipResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *gzipResponseWriter) close() {
+	if w.writer != nil {
+		w.writer.Close()
+	}
+}
+
+// MaxDecompressedBodySize is the maximum size of the decompressed requests bodies.
+const MaxDecompressedBodySize = 10 << 20
+
+// EncodingMiddleware negotiates the payloads encodings: gzip request bodies are
+// decompressed (`Content-Encoding`), and responses are compressed for clients that
+// accept it (`Accept-Encoding`). The authorization endpoints also accept and
+// return protobuf payloads (`Content-Type` and `Accept`, see doorman.proto).
+func EncodingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mediaType, _, _ := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+		protobufRequest := isProtobuf(mediaType)
+		codec, protobufSupported := protobufCodecs[c.Request.URL.Path]
+		if protobufRequest && !protobufSupported {
+			abortWithError(c, http.StatusUnsupportedMediaType, ErrorUnsupportedMediaType, "Unsupported content type "+mediaType)
+			return
+		}
+
+		if strings.EqualFold(c.Request.Header.Get("Content-Encoding"), "gzip") {
+			body, err := gzip.NewReader(c.Request.Body)
+			if err != nil {
+				abortWithError(c, http.StatusBadRequest, ErrorInvalidBody, "Invalid gzip body: "+err.Error())
+				return
+			}
+			defer body.Close()
+			c.Request.Body = http.MaxBytesReader(c.Writer, body, MaxDecompressedBodySize)
+			c.Request.ContentLength = -1
+			c.Request.Header.Del("Content-Encoding")
+		}
+
+		if protobufRequest {
+			content, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, MaxDecompressedBodySize))
+			if err == nil {
+				content, err = codec.request(content)
+			}
+			if err != nil {
+				abortWithError(c, http.StatusBadRequest, ErrorInvalidBody, "Invalid protobuf body: "+err.Error())
+				return
+			}
+			c.Request.Body = ioutil.NopCloser(bytes.NewReader(content))
+			c.Request.ContentLength = int64(len(content))
+			c.Request.Header.Set("Content-Type", "application/json")
+		}
+
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		if acceptsGzip(c.Request) {
+			w := &gzipResponseWriter{ResponseWriter: c.Writer}
+			c.Writer = w
+			defer w.close()
+		}
+		if protobufSupported {
+			c.Writer.Header().Add("Vary", "Accept")
+			if acceptsProtobuf(c.Request, protobufRequest) {
+				w := &protobufResponseWriter{ResponseWriter: c.Writer}
+				c.Writer = w
+				defer w.flush(c, codec)
+			}
+		}
+		c.Next()
+	}
+}
+
+// acceptsGzip returns true if the gzip encoding is accepted for the response.
+func acceptsGzip(r *http.Request) bool {
+	for _, value := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(value, ";")
+		if strings.TrimSpace(parts[0]) != "gzip" {
+			continue
+		}
+		for _, param := range parts[1:] {
+			if strings.Replace(param, " ", "", -1) == "q=0" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
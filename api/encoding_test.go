@@ -0,0 +1,233 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/protobuf/proto"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+func performEncoded(r http.Handler, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/allowed", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Origin", "https://sample.yaml")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestEncodingGzip(t *testing.T) {
+	r := gin.New()
+	d := doorman.NewDefaultLadon()
+	d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://sample.yaml",
+		},
+	})
+	d.SetAuthenticator("https://sample.yaml", nil)
+	SetupRoutes(r, d)
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(`{"principals": ["userid:maria"], "action": "read"}`))
+	gz.Close()
+
+	// Compressed request.
+	w := performEncoded(r, compressed.Bytes(), map[string]string{
+		"Content-Encoding": "gzip",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+	var resp AllowedResponse
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
+	require.Nil(t, err)
+	assert.Equal(t, doorman.Principals{"userid:maria"}, resp.Principals)
+
+	// Compressed response.
+	w = performEncoded(r, compressed.Bytes(), map[string]string{
+		"Content-Encoding": "gzip",
+		"Accept-Encoding":  "deflate, gzip;q=0.8",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	body, err := gzip.NewReader(w.Body)
+	require.Nil(t, err)
+	content, _ := ioutil.ReadAll(body)
+	err = json.Unmarshal(content, &resp)
+	require.Nil(t, err)
+	assert.Equal(t, doorman.Principals{"userid:maria"}, resp.Principals)
+
+	// Invalid gzip.
+	w = performEncoded(r, []byte("{}"), map[string]string{
+		"Content-Encoding": "gzip",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Decompressed bodies are limited.
+	compressed.Reset()
+	gz = gzip.NewWriter(&compressed)
+	gz.Write([]byte(`{"action": "read", "resource": "`))
+	gz.Write(bytes.Repeat([]byte("a"), MaxDecompressedBodySize))
+	gz.Write([]byte(`"}`))
+	gz.Close()
+	w = performEncoded(r, compressed.Bytes(), map[string]string{
+		"Content-Encoding": "gzip",
+	})
+	assert.NotEqual(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "too large")
+}
+
+func TestEncodingProtobuf(t *testing.T) {
+	r := gin.New()
+	d := doorman.NewDefaultLadon()
+	d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://sample.yaml",
+			Policies: doorman.Policies{
+				doorman.Policy{
+					ID:         "1",
+					Principals: []string{"userid:maria"},
+					Actions:    []string{"read"},
+					Resources:  []string{"<.*>"},
+					Conditions: doorman.Conditions{
+						"country": doorman.Condition{
+							Type:    "StringEqualCondition",
+							Options: map[string]interface{}{"equals": "fr"},
+						},
+					},
+					Obligations: []doorman.Obligation{
+						{Type: "mask", Options: map[string]interface{}{"field": "email"}},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	})
+	d.SetAuthenticator("https://sample.yaml", nil)
+	SetupRoutes(r, d)
+
+	context := &structpb.Struct{Fields: map[string]*structpb.Value{
+		"country": {Kind: &structpb.Value_StringValue{StringValue: "fr"}},
+	}}
+	request := &AuthorizationRequest{
+		Principals: []string{"userid:maria"},
+		Action:     "read",
+		Resource:   "article",
+		Context:    context,
+	}
+	body, err := proto.Marshal(request)
+	require.Nil(t, err)
+
+	// Protobuf request and response.
+	w := performEncoded(r, body, map[string]string{
+		"Content-Type": "application/x-protobuf",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-protobuf", w.Header().Get("Content-Type"))
+	var decision Decision
+	require.Nil(t, proto.Unmarshal(w.Body.Bytes(), &decision))
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, []string{"userid:maria"}, decision.Principals)
+	assert.NotEqual(t, "", decision.DecisionID)
+	require.Len(t, decision.Obligations, 1)
+	assert.Equal(t, "mask", decision.Obligations[0].Type)
+	assert.Equal(t, "email", decision.Obligations[0].Options.Fields["field"].GetStringValue())
+
+	// JSON response.
+	w = performEncoded(r, body, map[string]string{
+		"Content-Type": "application/x-protobuf",
+		"Accept":       "application/json",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp AllowedResponse
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Allowed)
+
+	// Protobuf response of a JSON request.
+	w = performEncoded(r, []byte(`{"principals": ["userid:maria"], "action": "read", "context": {"country": "de"}}`), map[string]string{
+		"Accept": "application/x-protobuf",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	decision = Decision{}
+	require.Nil(t, proto.Unmarshal(w.Body.Bytes(), &decision))
+	assert.False(t, decision.Allowed)
+
+	// Batch, compressed.
+	second := *request
+	second.Action = "delete"
+	body, _ = proto.Marshal(&AuthorizationRequests{Requests: []*AuthorizationRequest{request, &second}})
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(body)
+	gz.Close()
+	req, _ := http.NewRequest("POST", "/allowed/batch", &compressed)
+	req.Header.Set("Origin", "https://sample.yaml")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	uncompressed, err := gzip.NewReader(w.Body)
+	require.Nil(t, err)
+	content, _ := ioutil.ReadAll(uncompressed)
+	var decisions Decisions
+	require.Nil(t, proto.Unmarshal(content, &decisions))
+	require.Len(t, decisions.Decisions, 2)
+	assert.True(t, decisions.Decisions[0].Allowed)
+	assert.False(t, decisions.Decisions[1].Allowed)
+
+	// Errors are returned as JSON.
+	w = performEncoded(r, []byte{}, map[string]string{
+		"Content-Type": "application/x-protobuf",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+
+	// Invalid protobuf.
+	w = performEncoded(r, []byte{0x0a}, map[string]string{
+		"Content-Type": "application/x-protobuf",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid protobuf body")
+
+	// Not supported by the other endpoints.
+	req, _ = http.NewRequest("POST", "/allowed/filter", bytes.NewReader(body))
+	req.Header.Set("Origin", "https://sample.yaml")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for value, expected := range map[string]bool{
+		"":                 false,
+		"gzip":             true,
+		"deflate, gzip":    true,
+		"gzip;q=0":         false,
+		"gzip; q=0":        false,
+		"br, gzip;q=0.5":   true,
+		"x-gzip, identity": false,
+	} {
+		r, _ := http.NewRequest("POST", "/allowed", nil)
+		r.Header.Set("Accept-Encoding", value)
+		assert.Equal(t, expected, acceptsGzip(r), value)
+	}
+}
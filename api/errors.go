@@ -0,0 +1,209 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Codes of the errors responses.
+const (
+	ErrorMissingBody          = "missing_body"
+	ErrorInvalidBody          = "invalid_body"
+	ErrorReservedContext      = "reserved_context"
+	ErrorPrincipalsNotAllowed = "principals_not_allowed"
+	ErrorMissingPrincipals    = "missing_principals"
+	ErrorMissingAudience      = "missing_audience"
+	ErrorUnknownService       = "unknown_service"
+	ErrorUnauthenticated      = "unauthenticated"
+	ErrorForbidden            = "forbidden"
+	ErrorRequiredClaims       = "required_claims"
+	ErrorInternal             = "internal_error"
+	ErrorUnsupportedMediaType = "unsupported_media_type"
+)
+
+// ResponseError is an error returned to the clients (eg. 400, 401 or 403).
+type ResponseError struct {
+	// Status is the HTTP status code.
+	Status int
+	// Code identifies the error (see ErrorUnauthenticated, …).
+	Code string
+	// Message is the default message, in English.
+	Message string
+	// Details are extra fields of the response body (eg. the unmet claims).
+	Details map[string]interface{}
+}
+
+// ErrorRenderer renders the body of the errors responses, for consumer-facing
+// services that return branded or localized payloads.
+type ErrorRenderer interface {
+	RenderError(r *http.Request, e ResponseError) interface{}
+}
+
+// ErrorRendererFunc is an adapter to use ordinary functions as ErrorRenderer.
+type ErrorRendererFunc func(r *http.Request, e ResponseError) interface{}
+
+// RenderError calls f(r, e).
+func (f ErrorRendererFunc) RenderError(r *http.Request, e ResponseError) interface{} {
+	return f(r, e)
+}
+
+// ErrorsSettings configure the errors responses.
+type ErrorsSettings struct {
+	// Renderer renders the errors bodies. The default body is the message only.
+	Renderer ErrorRenderer
+}
+
+// Errors are the errors responses settings.
+// They must be set before calling SetupRoutes().
+var Errors = ErrorsSettings{}
+
+// abortWithError stops the request with the error response.
+func abortWithError(c *gin.Context, status int, code string, message string) {
+	abortWithResponseError(c, ResponseError{Status: status, Code: code, Message: message})
+}
+
+// abortWithResponseError stops the request with the error response, and its details.
+func abortWithResponseError(c *gin.Context, e ResponseError) {
+	if Errors.Renderer == nil {
+		body := gin.H{}
+		for field, value := range e.Details {
+			body[field] = value
+		}
+		body["message"] = e.Message
+		c.AbortWithStatusJSON(e.Status, body)
+		return
+	}
+	body := Errors.Renderer.RenderError(c.Request, e)
+	// gin keeps the content type if already set.
+	if typed, ok := body.(contentTyper); ok {
+		c.Header("Content-Type", typed.ContentType())
+	}
+	c.AbortWithStatusJSON(e.Status, body)
+}
+
+// contentTyper is implemented by the errors bodies with a specific media type
+// (eg. Problem).
+type contentTyper interface {
+	ContentType() string
+}
+
+// TemplateErrorRenderer renders the messages from templates per language and
+// error code. The language is negotiated with the `Accept-Language` header.
+type TemplateErrorRenderer struct {
+	// DefaultLanguage is used when none of the accepted languages has templates.
+	DefaultLanguage string
+	templates       map[string]map[string]*template.Template
+}
+
+// NewTemplateErrorRenderer parses the templates, by language (eg. `fr`, `pt-br`)
+// and error code. The templates use the text/template syntax, with the fields
+// of ResponseError (eg. `Accès refusé ({{.Message}})`).
+func NewTemplateErrorRenderer(templates map[string]map[string]string, defaultLanguage string) (*TemplateErrorRenderer, error) {
+	renderer := &TemplateErrorRenderer{
+		DefaultLanguage: strings.ToLower(defaultLanguage),
+		templates:       map[string]map[string]*template.Template{},
+	}
+	for language, codes := range templates {
+		language = strings.ToLower(language)
+		renderer.templates[language] = map[string]*template.Template{}
+		for code, text := range codes {
+			tmpl, err := template.New(language + "/" + code).Parse(text)
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("invalid %q template for %q", language, code))
+			}
+			renderer.templates[language][code] = tmpl
+		}
+	}
+	return renderer, nil
+}
+
+// LoadTemplateErrorRenderer reads the templates from a YAML file, with the
+// templates by error code under each language.
+func LoadTemplateErrorRenderer(filename string, defaultLanguage string) (*TemplateErrorRenderer, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read errors templates")
+	}
+	templates := map[string]map[string]string{}
+	if err := yaml.Unmarshal(content, &templates); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to parse errors templates %q", filename))
+	}
+	return NewTemplateErrorRenderer(templates, defaultLanguage)
+}
+
+// RenderError returns the code, the details and the localized message. The
+// default message is kept if no template matches.
+func (t *TemplateErrorRenderer) RenderError(r *http.Request, e ResponseError) interface{} {
+	body := gin.H{}
+	for field, value := range e.Details {
+		body[field] = value
+	}
+	body["code"] = e.Code
+	body["message"] = t.message(r, e)
+	return body
+}
+
+// message returns the localized message, or the default one.
+func (t *TemplateErrorRenderer) message(r *http.Request, e ResponseError) string {
+	for _, language := range append(acceptedLanguages(r), t.DefaultLanguage) {
+		tmpl, ok := t.templates[language][e.Code]
+		if !ok {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, e); err == nil {
+			return buf.String()
+		}
+	}
+	return e.Message
+}
+
+// acceptedLanguages returns the languages of the `Accept-Language` header, by
+// order of preference. Regional variants are followed by their base language
+// (eg. `fr-ca`, `fr`).
+func acceptedLanguages(r *http.Request) []string {
+	type accepted struct {
+		language string
+		quality  float64
+	}
+	entries := []accepted{}
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		language := strings.ToLower(strings.TrimSpace(fields[0]))
+		if language == "" || language == "*" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		entries = append(entries, accepted{language, quality})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].quality > entries[j].quality
+	})
+
+	languages := []string{}
+	for _, entry := range entries {
+		languages = append(languages, entry.language)
+		if i := strings.Index(entry.language, "-"); i > 0 {
+			languages = append(languages, entry.language[:i])
+		}
+	}
+	return languages
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+func TestAcceptedLanguages(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/", nil)
+	assert.Equal(t, []string{}, acceptedLanguages(r))
+
+	r.Header.Set("Accept-Language", "en;q=0.5, fr-CA, *;q=0.1, de;q=0.8")
+	assert.Equal(t, []string{"fr-ca", "fr", "de", "en"}, acceptedLanguages(r))
+}
+
+func TestTemplateErrorRenderer(t *testing.T) {
+	_, err := NewTemplateErrorRenderer(map[string]map[string]string{
+		"fr": {ErrorUnauthenticated: "{{.Message"},
+	}, "en")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid \"fr\" template for \"unauthenticated\"")
+
+	renderer, err := NewTemplateErrorRenderer(map[string]map[string]string{
+		"FR": {ErrorUnauthenticated: "Authentification requise ({{.Message}})"},
+		"en": {ErrorUnauthenticated: "Please sign in"},
+	}, "en")
+	require.Nil(t, err)
+
+	e := ResponseError{Status: http.StatusUnauthorized, Code: ErrorUnauthenticated, Message: "token not found"}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Language", "fr-FR,fr;q=0.9")
+	assert.Equal(t, gin.H{
+		"code":    ErrorUnauthenticated,
+		"message": "Authentification requise (token not found)",
+	}, renderer.RenderError(r, e))
+
+	// Details are kept.
+	e.Details = map[string]interface{}{"claims": []string{"amr"}}
+	assert.Equal(t, []string{"amr"}, renderer.RenderError(r, e).(gin.H)["claims"])
+	e.Details = nil
+
+	// Default language.
+	r.Header.Set("Accept-Language", "de")
+	assert.Equal(t, "Please sign in", renderer.RenderError(r, e).(gin.H)["message"])
+
+	// Default message.
+	e.Code = ErrorMissingPrincipals
+	e.Message = "missing principals"
+	assert.Equal(t, "missing principals", renderer.RenderError(r, e).(gin.H)["message"])
+}
+
+func TestLoadTemplateErrorRenderer(t *testing.T) {
+	_, err := LoadTemplateErrorRenderer("unknown.yaml", "en")
+	assert.Contains(t, err.Error(), "failed to read errors templates")
+
+	tmpfile, _ := ioutil.TempFile("", "*.yaml")
+	defer os.Remove(tmpfile.Name())
+	tmpfile.Write([]byte("fr:\n  missing_principals: Principaux manquants\n"))
+	tmpfile.Close()
+	renderer, err := LoadTemplateErrorRenderer(tmpfile.Name(), "fr")
+	require.Nil(t, err)
+	r, _ := http.NewRequest("GET", "/", nil)
+	body := renderer.RenderError(r, ResponseError{Code: ErrorMissingPrincipals})
+	assert.Equal(t, "Principaux manquants", body.(gin.H)["message"])
+}
+
+func TestAllowedHandlerErrorRenderer(t *testing.T) {
+	Errors.Renderer = ErrorRendererFunc(func(r *http.Request, e ResponseError) interface{} {
+		return gin.H{"error": e.Code, "status": e.Status, "brand": "acme"}
+	})
+	defer func() { Errors = ErrorsSettings{} }()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set(DoormanContextKey, doorman.NewDefaultLadon())
+	c.Request, _ = http.NewRequest("POST", "/allowed", nil)
+	allowedHandler(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, map[string]interface{}{"error": "missing_body", "status": 400.0, "brand": "acme"}, body)
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mozilla/doorman/doorman"
+)
+
+// allowedFilterHandler returns the partial evaluation of the request for the
+// action, without resource: the residual conditions can be translated by the
+// caller into a database filter (eg. to list the rows that the user can see).
+func allowedFilterHandler(c *gin.Context) {
+	service, r, ok := bindActionRequest(c)
+	if !ok {
+		return
+	}
+
+	d := c.MustGet(DoormanContextKey).(doorman.Doorman)
+	filter, err := d.PartialEvaluate(service, r)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, ErrorInternal, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"principals": r.Principals,
+		"action":     r.Action,
+		"allowed":    filterClausesJSON(filter.Allowed),
+		"denied":     filterClausesJSON(filter.Denied),
+	})
+}
+
+func filterClausesJSON(clauses []doorman.FilterClause) []gin.H {
+	result := []gin.H{}
+	for _, clause := range clauses {
+		conditions := []gin.H{}
+		for _, condition := range clause.Conditions {
+			conditions = append(conditions, gin.H{
+				"field":   condition.Field,
+				"type":    condition.Type,
+				"options": condition.Options,
+			})
+		}
+		result = append(result, gin.H{
+			"policy":     clause.Policy,
+			"resources":  clause.Resources,
+			"principals": clause.Principals,
+			"conditions": conditions,
+		})
+	}
+	return result
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mozilla/doorman/doorman"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllowedFilter(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://sample.yaml",
+			Policies: doorman.Policies{
+				doorman.Policy{
+					ID:         "authors",
+					Principals: []string{"userid:<.*>"},
+					Actions:    []string{"read"},
+					Resources:  []string{"articles/<.*>"},
+					Conditions: doorman.Conditions{
+						"resource.author": doorman.Condition{
+							Type: "MatchPrincipalsCondition",
+						},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+
+	type Condition struct {
+		Field   string
+		Type    string
+		Options map[string]interface{}
+	}
+	type Clause struct {
+		Policy     string
+		Resources  []string
+		Principals doorman.Principals
+		Conditions []Condition
+	}
+	type Response struct {
+		Allowed []Clause
+		Denied  []Clause
+		Message string
+	}
+	filter := func(body interface{}, expected int) Response {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set(DoormanContextKey, d)
+		post, _ := json.Marshal(body)
+		c.Request, _ = http.NewRequest("POST", "/allowed/filter", bytes.NewBuffer(post))
+		c.Request.Header.Set("Origin", "https://sample.yaml")
+		allowedFilterHandler(c)
+		require.Equal(t, expected, w.Code)
+		var resp Response
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+
+	resp := filter(doorman.Request{Principals: doorman.Principals{"userid:maria"}, Action: "read"}, http.StatusOK)
+	assert.Equal(t, []Clause{{
+		Policy:     "authors",
+		Resources:  []string{"articles/<.*>"},
+		Principals: doorman.Principals{"userid:maria"},
+		Conditions: []Condition{{Field: "resource.author", Type: "MatchPrincipalsCondition", Options: map[string]interface{}{}}},
+	}}, resp.Allowed)
+	assert.Equal(t, []Clause{}, resp.Denied)
+
+	resp = filter(doorman.Request{Principals: doorman.Principals{"userid:maria"}}, http.StatusBadRequest)
+	assert.Equal(t, "missing action", resp.Message)
+}
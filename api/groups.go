@@ -0,0 +1,29 @@
+package api
+
+import (
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/doorman"
+)
+
+// GroupsSettings configure how huge `groups` claims are handled.
+type GroupsSettings struct {
+	// Max is the maximum number of groups turned into principals (0 means unlimited).
+	Max int
+	// Resolver obtains the groups out-of-band when the identity provider signals
+	// an overage, or when the token carries more than Max groups.
+	Resolver authn.GroupsResolver
+}
+
+// Groups are the groups overflow settings.
+// They must be set before calling SetupRoutes().
+var Groups = GroupsSettings{}
+
+// identitySettings returns the settings of the shared identity building, from
+// the groups and principals settings.
+func identitySettings() doorman.IdentitySettings {
+	return doorman.IdentitySettings{
+		MaxGroups:         Groups.Max,
+		GroupsResolver:    Groups.Resolver,
+		PrincipalsBuilder: Principals.Builder,
+	}
+}
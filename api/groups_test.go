@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/doorman"
+)
+
+func TestAuthnMiddlewareMaxGroups(t *testing.T) {
+	defer func(s GroupsSettings) { Groups = s }(Groups)
+	Groups.Max = 1
+
+	d := doorman.NewDefaultLadon()
+	handler := AuthnMiddleware(d)
+
+	v := &TestAuthenticator{}
+	v.On("ValidateRequest", mock.Anything).Return(&authn.UserInfo{
+		ID:     "ldap|user",
+		Groups: []string{"a", "b", "c"},
+	}, nil)
+	d.SetAuthenticator("https://some.api.com", v)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	c.Request.Header.Set("Origin", "https://some.api.com")
+	handler(c)
+	principals, _ := c.Get(PrincipalsContextKey)
+	assert.Equal(t, doorman.Principals{"userid:ldap|user", "group:a"}, principals)
+}
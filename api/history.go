@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// defaultHistoryLimit is the number of decisions returned by default.
+const defaultHistoryLimit = 20
+
+// DecisionHistoryStore looks up the recent decisions of a principal (see
+// doorman.DecisionHistory).
+type DecisionHistoryStore interface {
+	Recent(principal string, limit int) []doorman.Decision
+}
+
+// HistorySettings configure the decisions history endpoint.
+type HistorySettings struct {
+	// Store provides the recent decisions. The endpoint is disabled if nil.
+	Store DecisionHistoryStore
+}
+
+// History are the decisions history settings.
+// They must be set before calling SetupRoutes().
+var History = HistorySettings{}
+
+// principalHistoryHandler returns the recent decisions of the principal, the
+// most recent first. Only the denials are returned with `denied=true`.
+func principalHistoryHandler(store DecisionHistoryStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := c.Param("id")
+
+		limit := defaultHistoryLimit
+		if value := c.Query("limit"); value != "" {
+			var err error
+			if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+				abortWithError(c, http.StatusBadRequest, ErrorInvalidBody, "invalid limit")
+				return
+			}
+		}
+		deniedOnly := c.Query("denied") == "true"
+
+		decisions := []gin.H{}
+		// The denials are filtered here, hence every decision is looked up.
+		lookup := limit
+		if deniedOnly {
+			lookup = 0
+		}
+		for _, decision := range store.Recent(principal, lookup) {
+			if deniedOnly && decision.Allowed {
+				continue
+			}
+			decisions = append(decisions, gin.H{
+				"decision_id": decision.ID,
+				"time":        decision.Time.UTC().Format(time.RFC3339Nano),
+				"service":     decision.Service,
+				"principals":  decision.Principals,
+				"action":      decision.Action,
+				"resource":    decision.Resource,
+				"remote_ip":   decision.RemoteIP,
+				"allowed":     decision.Allowed,
+				"maintenance": decision.Maintenance,
+				"policies":    decision.Policies,
+			})
+			if len(decisions) >= limit {
+				break
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"principal": principal,
+			"decisions": decisions,
+		})
+	}
+}
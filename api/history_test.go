@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+type HistoryResponse struct {
+	Principal string
+	Decisions []struct {
+		DecisionID string `json:"decision_id"`
+		Action     string
+		Allowed    bool
+	}
+}
+
+func TestPrincipalHistoryHandler(t *testing.T) {
+	h := doorman.NewDecisionHistory(10)
+	now := time.Now()
+	h.Record(doorman.Decision{ID: "1", Time: now, Principals: doorman.Principals{"userid:ana"}, Action: "read", Allowed: true})
+	h.Record(doorman.Decision{ID: "2", Time: now, Principals: doorman.Principals{"userid:ana"}, Action: "write"})
+	h.Record(doorman.Decision{ID: "3", Time: now, Principals: doorman.Principals{"userid:ana"}, Action: "read", Allowed: true})
+	h.Record(doorman.Decision{ID: "4", Time: now, Principals: doorman.Principals{"userid:bob"}, Action: "delete"})
+
+	// Disabled by default.
+	r := gin.New()
+	SetupRoutes(r, doorman.NewDefaultLadon())
+	w := performRequest(r, "GET", "/__audit__/principals/userid:ana/recent", nil)
+	assert.Equal(t, 404, w.Code)
+
+	History.Store = h
+	defer func() { History = HistorySettings{} }()
+	Admin.Token = "s3cr3t"
+	defer func() { Admin.Token = "" }()
+	r = gin.New()
+	SetupRoutes(r, doorman.NewDefaultLadon())
+
+	// Requires the admin token.
+	w = performRequest(r, "GET", "/__audit__/principals/userid:ana/recent", nil)
+	assert.Equal(t, 401, w.Code)
+
+	var response HistoryResponse
+	w = performAdminRequest(r, "GET", "/__audit__/principals/userid:ana/recent", nil)
+	require.Equal(t, 200, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "userid:ana", response.Principal)
+	require.Len(t, response.Decisions, 3)
+	assert.Equal(t, "3", response.Decisions[0].DecisionID)
+	assert.Equal(t, "1", response.Decisions[2].DecisionID)
+
+	w = performAdminRequest(r, "GET", "/__audit__/principals/userid:ana/recent?limit=1", nil)
+	response = HistoryResponse{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	require.Len(t, response.Decisions, 1)
+	assert.Equal(t, "3", response.Decisions[0].DecisionID)
+
+	w = performAdminRequest(r, "GET", "/__audit__/principals/userid:ana/recent?denied=true", nil)
+	response = HistoryResponse{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	require.Len(t, response.Decisions, 1)
+	assert.Equal(t, "write", response.Decisions[0].Action)
+	assert.False(t, response.Decisions[0].Allowed)
+
+	w = performAdminRequest(r, "GET", "/__audit__/principals/userid:eve/recent", nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"decisions":[]`)
+
+	w = performAdminRequest(r, "GET", "/__audit__/principals/userid:ana/recent?limit=-1", nil)
+	assert.Equal(t, 400, w.Code)
+	var errResp ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &errResp)
+	assert.Equal(t, "invalid limit", errResp.Message)
+}
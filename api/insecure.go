@@ -0,0 +1,33 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// InsecureSettings configure the development mode, where the requests that fail
+// authentication are accepted (eg. local development or integration tests without
+// identity provider). It must never be enabled in production.
+type InsecureSettings struct {
+	// Principals are assigned to the requests that fail authentication. The
+	// development mode is disabled if empty.
+	Principals doorman.Principals
+}
+
+// Insecure are the development mode settings.
+// They must be set before calling SetupRoutes().
+var Insecure = InsecureSettings{}
+
+// insecurePrincipals sets the development principals in context, if enabled.
+func insecurePrincipals(c *gin.Context, service string, err error) bool {
+	if len(Insecure.Principals) == 0 {
+		return false
+	}
+	log.Warningf("Unauthenticated request to %q accepted in development mode: %s", service, err)
+	principals := make(doorman.Principals, len(Insecure.Principals))
+	copy(principals, Insecure.Principals)
+	c.Set(PrincipalsContextKey, principals)
+	return true
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/doorman"
+)
+
+func TestAuthnMiddlewareInsecure(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{Service: "https://some.api.com"},
+	})
+	v := &TestAuthenticator{}
+	v.On("ValidateRequest", mock.Anything).Return(&authn.UserInfo{}, fmt.Errorf("token not found"))
+	d.SetAuthenticator("https://some.api.com", v)
+	handler := AuthnMiddleware(d)
+
+	// Disabled by default.
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	c.Request.Header.Set("Origin", "https://some.api.com")
+	handler(c)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	Insecure.Principals = doorman.Principals{"userid:dev", "group:admins"}
+	defer func() { Insecure = InsecureSettings{} }()
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	c.Request.Header.Set("Origin", "https://some.api.com")
+	handler(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+	principals, ok := PrincipalsFromContext(c)
+	require.True(t, ok)
+	assert.Equal(t, doorman.Principals{"userid:dev", "group:admins"}, principals)
+
+	// Principals are copied.
+	principals[0] = "userid:root"
+	assert.Equal(t, "userid:dev", Insecure.Principals[0])
+}
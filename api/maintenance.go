@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// MaintenanceRequest is the body of the maintenance mode switch.
+type MaintenanceRequest struct {
+	Service string `json:"service" binding:"required"`
+	Enabled bool   `json:"enabled"`
+}
+
+// maintenanceHandler returns the maintenance mode of the service specified in querystring.
+func maintenanceHandler(c *gin.Context) {
+	d := c.MustGet(DoormanContextKey).(doorman.Doorman)
+	service := c.Query("service")
+	config, ok := d.ServiceConfig(service)
+	if !ok {
+		abortWithError(c, http.StatusNotFound, ErrorUnknownService, "unknown service")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"service": service,
+		"enabled": d.Maintenance(service),
+		"allow":   config.Maintenance.Allow,
+		"deny":    config.Maintenance.Deny,
+		"default": config.Maintenance.Default,
+	})
+}
+
+// setMaintenanceHandler enables or disables the maintenance mode of a service.
+func setMaintenanceHandler(c *gin.Context) {
+	var r MaintenanceRequest
+	if err := c.BindJSON(&r); err != nil {
+		abortWithError(c, http.StatusBadRequest, ErrorInvalidBody, err.Error())
+		return
+	}
+
+	d := c.MustGet(DoormanContextKey).(doorman.Doorman)
+	if err := d.SetMaintenance(r.Service, r.Enabled); err != nil {
+		abortWithError(c, http.StatusNotFound, ErrorUnknownService, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"service": r.Service,
+		"enabled": d.Maintenance(r.Service),
+	})
+}
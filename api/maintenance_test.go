@@ -0,0 +1,107 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+type MaintenanceResponse struct {
+	Service string
+	Enabled bool
+	Allow   []string
+	Deny    []string
+	Default string
+}
+
+func TestMaintenanceHandlers(t *testing.T) {
+	r := gin.New()
+	d := doorman.NewDefaultLadon()
+	d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://sample.yaml",
+			Maintenance: doorman.MaintenanceConfig{
+				Allow:   []string{"read"},
+				Default: doorman.MaintenanceDeny,
+			},
+			Policies: doorman.Policies{
+				doorman.Policy{
+					ID:         "1",
+					Principals: []string{"userid:maria"},
+					Actions:    []string{"<.*>"},
+					Resources:  []string{"<.*>"},
+					Effect:     "allow",
+					AllowBroad: true,
+				},
+			},
+		},
+	})
+	d.SetAuthenticator("https://sample.yaml", nil)
+	SetupRoutes(r, d)
+	Admin.Token = "s3cr3t"
+	defer func() { Admin.Token = "" }()
+
+	var status MaintenanceResponse
+	w := performRequest(r, "GET", "/__maintenance__?service=https://sample.yaml", nil)
+	require.Equal(t, 200, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &status)
+	assert.False(t, status.Enabled)
+	assert.Equal(t, []string{"read"}, status.Allow)
+	assert.Equal(t, "deny", status.Default)
+
+	var resp AllowedResponse
+	performAllowed(t, r, bytes.NewBufferString(`{"principals": ["userid:maria"], "action": "write"}`), 200, &resp)
+	assert.True(t, resp.Allowed)
+
+	// The switch requires the admin token.
+	w = performRequest(r, "POST", "/__maintenance__", bytes.NewBufferString(`{"service": "https://sample.yaml", "enabled": true}`))
+	require.Equal(t, 401, w.Code)
+	assert.False(t, d.Maintenance("https://sample.yaml"))
+
+	// Enable maintenance.
+	w = performAdminRequest(r, "POST", "/__maintenance__", bytes.NewBufferString(`{"service": "https://sample.yaml", "enabled": true}`))
+	require.Equal(t, 200, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &status)
+	assert.True(t, status.Enabled)
+
+	var maintenanceResp map[string]interface{}
+	performAllowed(t, r, bytes.NewBufferString(`{"principals": ["userid:maria"], "action": "write"}`), 200, &maintenanceResp)
+	assert.Equal(t, false, maintenanceResp["allowed"])
+	assert.Equal(t, true, maintenanceResp["maintenance"])
+	performAllowed(t, r, bytes.NewBufferString(`{"principals": ["userid:nobody"], "action": "read"}`), 200, &resp)
+	assert.True(t, resp.Allowed)
+}
+
+func TestMaintenanceHandlersErrors(t *testing.T) {
+	r := gin.New()
+	SetupRoutes(r, doorman.NewDefaultLadon())
+	Admin.Token = "s3cr3t"
+	defer func() { Admin.Token = "" }()
+
+	var errResp ErrorResponse
+	w := performRequest(r, "GET", "/__maintenance__?service=unknown", nil)
+	assert.Equal(t, 404, w.Code)
+
+	w = performAdminRequest(r, "POST", "/__maintenance__", bytes.NewBufferString(`{"enabled": true}`))
+	assert.Equal(t, 400, w.Code)
+
+	w = performAdminRequest(r, "POST", "/__maintenance__", bytes.NewBufferString(`{"service": "unknown", "enabled": true}`))
+	assert.Equal(t, 404, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &errResp)
+	assert.Contains(t, errResp.Message, "unknown service")
+
+	// The errors are rendered like the other endpoints.
+	Errors.Renderer = &ProblemErrorRenderer{}
+	defer func() { Errors = ErrorsSettings{} }()
+	w = performRequest(r, "GET", "/__maintenance__?service=unknown", nil)
+	assert.Equal(t, 404, w.Code)
+	var problem map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &problem)
+	assert.Equal(t, ErrorUnknownService, problem["code"])
+}
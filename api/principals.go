@@ -0,0 +1,60 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// PrincipalsBuilder adds or rewrites the principals of the authenticated users,
+// before they are set in context (eg. to map legacy user IDs).
+type PrincipalsBuilder = doorman.PrincipalsBuilder
+
+// PrincipalsBuilderFunc is an adapter to use ordinary functions as PrincipalsBuilder.
+type PrincipalsBuilderFunc = doorman.PrincipalsBuilderFunc
+
+// PrincipalsSettings configure how the principals of the users are built.
+type PrincipalsSettings struct {
+	// Builder is invoked after the principals are extracted from the claims.
+	Builder PrincipalsBuilder
+}
+
+// Principals are the principals building settings.
+// They must be set before calling SetupRoutes().
+var Principals = PrincipalsSettings{}
+
+// principalsHandler returns the effective principals of the caller for the
+// service, and why each tag was added, to debug the policies that do not match.
+func principalsHandler(c *gin.Context) {
+	principals, ok := PrincipalsFromContext(c)
+	if !ok {
+		abortWithError(c, http.StatusBadRequest, ErrorMissingPrincipals, "authentication is disabled for this service")
+		return
+	}
+	principals = append(doorman.Principals{}, principals...)
+	if tenant := c.GetString(TenantContextKey); tenant != "" {
+		principals = append(principals, fmt.Sprintf("tenant:%s", tenant))
+	}
+
+	d := c.MustGet(DoormanContextKey).(doorman.Doorman)
+	service := requestAudience(c.Request)
+	expanded, matches := d.ExplainPrincipals(service, principals)
+
+	tags := []gin.H{}
+	for _, match := range matches {
+		tags = append(tags, gin.H{
+			"tag":       match.Tag,
+			"member":    match.Member,
+			"principal": match.Principal,
+			"source":    match.Source,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"service":    service,
+		"principals": expanded,
+		"tags":       tags,
+	})
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/doorman"
+)
+
+func TestAuthnMiddlewarePrincipalsBuilder(t *testing.T) {
+	defer func(s PrincipalsSettings) { Principals = s }(Principals)
+
+	d := doorman.NewDefaultLadon()
+	handler := AuthnMiddleware(d)
+
+	v := &TestAuthenticator{}
+	v.On("ValidateRequest", mock.Anything).Return(&authn.UserInfo{
+		ID:     "legacy|42",
+		Groups: []string{"a"},
+	}, nil)
+	d.SetAuthenticator("https://some.api.com", v)
+
+	Principals.Builder = PrincipalsBuilderFunc(func(r *http.Request, service string, userInfo *authn.UserInfo, principals doorman.Principals) (doorman.Principals, error) {
+		assert.Equal(t, "https://some.api.com", service)
+		assert.Equal(t, doorman.Principals{"userid:legacy|42", "group:a"}, principals)
+		return append(principals[1:], "userid:ldap|ana"), nil
+	})
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	c.Request.Header.Set("Origin", "https://some.api.com")
+	handler(c)
+	principals, _ := c.Get(PrincipalsContextKey)
+	assert.Equal(t, doorman.Principals{"group:a", "userid:ldap|ana"}, principals)
+
+	// Builder errors reject the request.
+	Principals.Builder = PrincipalsBuilderFunc(func(r *http.Request, service string, userInfo *authn.UserInfo, principals doorman.Principals) (doorman.Principals, error) {
+		return nil, fmt.Errorf("unknown legacy user")
+	})
+
+	w := httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	c.Request.Header.Set("Origin", "https://some.api.com")
+	handler(c)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, "unknown legacy user", body["message"])
+	_, ok := c.Get(PrincipalsContextKey)
+	assert.False(t, ok)
+}
+
+func TestPrincipalsHandler(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://some.api.com",
+			Source:  "policies.yaml",
+			Tags:    doorman.Tags{"admins": {"group:ops"}},
+		},
+		doorman.ServiceConfig{
+			Service: "https://open.api.com",
+		},
+	})
+	require.Nil(t, err)
+	v := &TestAuthenticator{}
+	v.On("ValidateRequest", mock.Anything).Return(&authn.UserInfo{
+		ID:     "ldap|ana",
+		Email:  "ana@corp.com",
+		Groups: []string{"ops"},
+	}, nil)
+	d.SetAuthenticator("https://some.api.com", v)
+	d.SetAuthenticator("https://open.api.com", nil)
+
+	r := gin.New()
+	SetupRoutes(r, d)
+
+	req, _ := http.NewRequest("GET", "/__principals", nil)
+	req.Header.Set("Origin", "https://some.api.com")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Service    string
+		Principals doorman.Principals
+		Tags       []map[string]string
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, "https://some.api.com", body.Service)
+	assert.Equal(t, doorman.Principals{"userid:ldap|ana", "email:ana@corp.com", "group:ops", "tag:admins"}, body.Principals)
+	assert.Equal(t, []map[string]string{
+		{"tag": "tag:admins", "member": "group:ops", "principal": "group:ops", "source": "policies.yaml"},
+	}, body.Tags)
+
+	// Without authentication.
+	req.Header.Set("Origin", "https://open.api.com")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
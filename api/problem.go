@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+)
+
+// ProblemContentType is the media type of the problem details (RFC 7807).
+const ProblemContentType = "application/problem+json"
+
+// Problem is a problem details object (RFC 7807). Its standard members are
+// `type`, `title`, `status` and `detail`. The error code and the details of the
+// error (eg. the unmet claims) are extension members.
+type Problem map[string]interface{}
+
+// ContentType returns the media type of the problem details.
+func (p Problem) ContentType() string {
+	return ProblemContentType
+}
+
+// ProblemErrorRenderer renders the errors as problem details (RFC 7807), with
+// the `application/problem+json` content type.
+type ProblemErrorRenderer struct {
+	// TypeBaseURI is the prefix of the problem types, followed by the error code
+	// (eg. `https://errors.corp.com/doorman/`). If empty, the type is `about:blank`.
+	TypeBaseURI string
+	// Templates localizes the `detail` member, if set.
+	Templates *TemplateErrorRenderer
+}
+
+// RenderError returns the problem details of the error. The `title` is the
+// HTTP status text, and the `detail` is the (localized) message.
+func (p *ProblemErrorRenderer) RenderError(r *http.Request, e ResponseError) interface{} {
+	problem := Problem{}
+	for field, value := range e.Details {
+		problem[field] = value
+	}
+	problemType := "about:blank"
+	if p.TypeBaseURI != "" {
+		problemType = p.TypeBaseURI + e.Code
+	}
+	detail := e.Message
+	if p.Templates != nil {
+		detail = p.Templates.message(r, e)
+	}
+	problem["type"] = problemType
+	problem["title"] = http.StatusText(e.Status)
+	problem["status"] = e.Status
+	problem["detail"] = detail
+	problem["code"] = e.Code
+	return problem
+}
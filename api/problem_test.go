@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+func TestProblemErrorRenderer(t *testing.T) {
+	renderer := &ProblemErrorRenderer{}
+	e := ResponseError{
+		Status:  http.StatusForbidden,
+		Code:    ErrorRequiredClaims,
+		Message: "missing required claims: amr",
+		Details: map[string]interface{}{"claims": []string{"amr"}},
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	assert.Equal(t, Problem{
+		"type":   "about:blank",
+		"title":  "Forbidden",
+		"status": http.StatusForbidden,
+		"detail": "missing required claims: amr",
+		"code":   ErrorRequiredClaims,
+		"claims": []string{"amr"},
+	}, renderer.RenderError(r, e))
+
+	// Types from the error code.
+	renderer.TypeBaseURI = "https://errors.corp.com/doorman/"
+	assert.Equal(t, "https://errors.corp.com/doorman/required_claims", renderer.RenderError(r, e).(Problem)["type"])
+
+	// Localized details.
+	templates, err := NewTemplateErrorRenderer(map[string]map[string]string{
+		"fr": {ErrorRequiredClaims: "Authentification forte requise"},
+	}, "en")
+	require.Nil(t, err)
+	renderer.Templates = templates
+	r.Header.Set("Accept-Language", "fr")
+	assert.Equal(t, "Authentification forte requise", renderer.RenderError(r, e).(Problem)["detail"])
+}
+
+func TestAllowedHandlerProblem(t *testing.T) {
+	Errors.Renderer = &ProblemErrorRenderer{}
+	defer func() { Errors = ErrorsSettings{} }()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set(DoormanContextKey, doorman.NewDefaultLadon())
+	c.Request, _ = http.NewRequest("POST", "/allowed", nil)
+	allowedHandler(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, map[string]interface{}{
+		"type":   "about:blank",
+		"title":  "Bad Request",
+		"status": 400.0,
+		"detail": "Missing body",
+		"code":   "missing_body",
+	}, body)
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+)
+
+// protobufContentType is the media type of the protobuf payloads.
+const protobufContentType = "application/x-protobuf"
+
+// The protobuf messages of the authorization endpoints (see doorman.proto).
+
+// AuthorizationRequest is the protobuf body of POST /allowed.
+type AuthorizationRequest struct {
+	Principals []string         `protobuf:"bytes,1,rep,name=principals" json:"principals,omitempty"`
+	Action     string           `protobuf:"bytes,2,opt,name=action" json:"action,omitempty"`
+	Resource   string           `protobuf:"bytes,3,opt,name=resource" json:"resource,omitempty"`
+	Context    *structpb.Struct `protobuf:"bytes,4,opt,name=context" json:"context,omitempty"`
+}
+
+func (m *AuthorizationRequest) Reset()         { *m = AuthorizationRequest{} }
+func (m *AuthorizationRequest) String() string { return proto.CompactTextString(m) }
+func (*AuthorizationRequest) ProtoMessage()    {}
+
+// AuthorizationRequests is the protobuf body of POST /allowed/batch.
+type AuthorizationRequests struct {
+	Requests []*AuthorizationRequest `protobuf:"bytes,1,rep,name=requests" json:"requests,omitempty"`
+}
+
+func (m *AuthorizationRequests) Reset()         { *m = AuthorizationRequests{} }
+func (m *AuthorizationRequests) String() string { return proto.CompactTextString(m) }
+func (*AuthorizationRequests) ProtoMessage()    {}
+
+// Obligation is an obligation of a protobuf decision.
+type Obligation struct {
+	Type    string           `protobuf:"bytes,1,opt,name=type" json:"type,omitempty"`
+	Options *structpb.Struct `protobuf:"bytes,2,opt,name=options" json:"options,omitempty"`
+}
+
+func (m *Obligation) Reset()         { *m = Obligation{} }
+func (m *Obligation) String() string { return proto.CompactTextString(m) }
+func (*Obligation) ProtoMessage()    {}
+
+// Decision is the protobuf response of POST /allowed.
+type Decision struct {
+	Allowed     bool          `protobuf:"varint,1,opt,name=allowed" json:"allowed,omitempty"`
+	Principals  []string      `protobuf:"bytes,2,rep,name=principals" json:"principals,omitempty"`
+	DecisionID  string        `protobuf:"bytes,3,opt,name=decision_id,json=decisionId" json:"decision_id,omitempty"`
+	Maintenance bool          `protobuf:"varint,4,opt,name=maintenance" json:"maintenance,omitempty"`
+	Reason      string        `protobuf:"bytes,5,opt,name=reason" json:"reason,omitempty"`
+	Obligations []*Obligation `protobuf:"bytes,6,rep,name=obligations" json:"obligations,omitempty"`
+}
+
+func (m *Decision) Reset()         { *m = Decision{} }
+func (m *Decision) String() string { return proto.CompactTextString(m) }
+func (*Decision) ProtoMessage()    {}
+
+// Decisions is the protobuf response of POST /allowed/batch.
+type Decisions struct {
+	Decisions []*Decision `protobuf:"bytes,1,rep,name=decisions" json:"decisions,omitempty"`
+}
+
+func (m *Decisions) Reset()         { *m = Decisions{} }
+func (m *Decisions) String() string { return proto.CompactTextString(m) }
+func (*Decisions) ProtoMessage()    {}
+
+// protobufCodec converts the protobuf payloads of an endpoint from and to the
+// JSON payloads of its handler.
+type protobufCodec struct {
+	// request returns the JSON body of the protobuf request body.
+	request func(body []byte) ([]byte, error)
+	// response returns the protobuf response body of the JSON one.
+	response func(body []byte) ([]byte, error)
+}
+
+// protobufCodecs are the endpoints that support protobuf, by path.
+var protobufCodecs = map[string]protobufCodec{
+	"/allowed": {
+		request: func(body []byte) ([]byte, error) {
+			var m AuthorizationRequest
+			if err := proto.Unmarshal(body, &m); err != nil {
+				return nil, err
+			}
+			return protobufToJSON(&m)
+		},
+		response: func(body []byte) ([]byte, error) {
+			return jsonToProtobuf(body, &Decision{})
+		},
+	},
+	"/allowed/batch": {
+		request: func(body []byte) ([]byte, error) {
+			var m AuthorizationRequests
+			if err := proto.Unmarshal(body, &m); err != nil {
+				return nil, err
+			}
+			// The handler expects a list of requests.
+			requests := [][]byte{}
+			for _, r := range m.Requests {
+				encoded, err := protobufToJSON(r)
+				if err != nil {
+					return nil, err
+				}
+				requests = append(requests, encoded)
+			}
+			return append(append([]byte("["), bytes.Join(requests, []byte(","))...), ']'), nil
+		},
+		response: func(body []byte) ([]byte, error) {
+			wrapped := append(append([]byte(`{"decisions":`), body...), '}')
+			return jsonToProtobuf(wrapped, &Decisions{})
+		},
+	},
+}
+
+func protobufToJSON(m proto.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	marshaler := jsonpb.Marshaler{OrigName: true}
+	if err := marshaler.Marshal(&buf, m); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func jsonToProtobuf(body []byte, m proto.Message) ([]byte, error) {
+	unmarshaler := jsonpb.Unmarshaler{AllowUnknownFields: true}
+	if err := unmarshaler.Unmarshal(bytes.NewReader(body), m); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(m)
+}
+
+// isProtobuf returns true if the media type is protobuf (eg. `application/x-protobuf`).
+func isProtobuf(mediaType string) bool {
+	return strings.HasSuffix(mediaType, "protobuf")
+}
+
+// acceptsProtobuf returns true if a protobuf response is accepted. Protobuf
+// requests get protobuf responses if no other type is specified.
+func acceptsProtobuf(r *http.Request, protobufRequest bool) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" || accept == "*/*" {
+		return protobufRequest
+	}
+	for _, value := range strings.Split(accept, ",") {
+		mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(value))
+		if isProtobuf(mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// protobufResponseWriter keeps the JSON response body, to encode it as protobuf.
+type protobufResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *protobufResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *protobufResponseWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// flush writes the response, as protobuf if successful. The errors responses
+// are left as is.
+func (w *protobufResponseWriter) flush(c *gin.Context, codec protobufCodec) {
+	c.Writer = w.ResponseWriter
+	if w.Status() != http.StatusOK {
+		w.ResponseWriter.Write(w.body.Bytes())
+		return
+	}
+	encoded, err := codec.response(w.body.Bytes())
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, ErrorInternal, fmt.Sprintf("could not encode protobuf response: %s", err))
+		return
+	}
+	w.Header().Set("Content-Type", protobufContentType)
+	w.ResponseWriter.Write(encoded)
+}
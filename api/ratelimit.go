@@ -0,0 +1,116 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// ErrorRateLimited is the code of the responses to users exceeding the rate limit.
+const ErrorRateLimited = "rate_limited"
+
+// RateLimitMiddleware limits the requests of each authenticated user (`userid:`
+// principal), according to the `rateLimit` setting of the service. It must be
+// used after AuthnMiddleware. Exceeding requests get a `429 Too Many Requests`
+// with the `Retry-After` header.
+func RateLimitMiddleware(d doorman.Doorman) gin.HandlerFunc {
+	limiter := newRateLimiter()
+	return func(c *gin.Context) {
+		service := requestAudience(c.Request)
+		config, ok := d.ServiceConfig(service)
+		if !ok || config.RateLimit.Rate <= 0 {
+			c.Next()
+			return
+		}
+		userid := ""
+		principals, _ := PrincipalsFromContext(c)
+		for _, principal := range principals {
+			if strings.HasPrefix(principal, "userid:") {
+				userid = principal
+				break
+			}
+		}
+		if userid == "" {
+			c.Next()
+			return
+		}
+
+		if wait := limiter.take(service+"|"+userid, config.RateLimit, time.Now()); wait > 0 {
+			seconds := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			message := fmt.Sprintf("Rate limit exceeded, retry in %d seconds", seconds)
+			abortWithError(c, http.StatusTooManyRequests, ErrorRateLimited, message)
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimiterSweepInterval is the delay between the removals of the full buckets.
+const rateLimiterSweepInterval = time.Minute
+
+// tokenBucket holds the remaining requests of a user.
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket will be full again, and can be forgotten.
+	full time.Time
+}
+
+// rateLimiter keeps the token buckets of the users.
+type rateLimiter struct {
+	sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		buckets:   map[string]*tokenBucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+// take consumes a token from the bucket of key, and returns zero, or how long
+// to wait for a token if the bucket is empty.
+func (l *rateLimiter) take(key string, config doorman.RateLimitConfig, now time.Time) time.Duration {
+	l.Lock()
+	defer l.Unlock()
+
+	burst := float64(config.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, config.Rate)
+	}
+
+	if now.Sub(l.lastSweep) > rateLimiterSweepInterval {
+		for k, b := range l.buckets {
+			if now.After(b.full) {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.updated).Seconds()*config.Rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / config.Rate * float64(time.Second))
+	}
+	b.tokens--
+	b.full = now.Add(time.Duration((burst - b.tokens) / config.Rate * float64(time.Second)))
+	return 0
+}
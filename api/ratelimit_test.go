@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service:   "https://limited",
+			RateLimit: doorman.RateLimitConfig{Rate: 0.01, Burst: 2},
+		},
+		doorman.ServiceConfig{
+			Service: "https://unlimited",
+		},
+	})
+	handler := RateLimitMiddleware(d)
+
+	perform := func(service string, principals doorman.Principals) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("POST", "/allowed", nil)
+		c.Request.Header.Set("Origin", service)
+		if principals != nil {
+			c.Set(PrincipalsContextKey, principals)
+		}
+		handler(c)
+		if !c.IsAborted() {
+			c.Status(http.StatusOK)
+		}
+		return w
+	}
+
+	alice := doorman.Principals{"userid:alice", "group:admins"}
+	assert.Equal(t, http.StatusOK, perform("https://limited", alice).Code)
+	assert.Equal(t, http.StatusOK, perform("https://limited", alice).Code)
+	w := perform("https://limited", alice)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "100", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "Rate limit exceeded")
+
+	// Users have their own bucket.
+	assert.Equal(t, http.StatusOK, perform("https://limited", doorman.Principals{"userid:bob"}).Code)
+	// Requests without user or service limit are not limited.
+	assert.Equal(t, http.StatusOK, perform("https://limited", nil).Code)
+	assert.Equal(t, http.StatusOK, perform("https://limited", doorman.Principals{"group:admins"}).Code)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, perform("https://unlimited", alice).Code)
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	l := newRateLimiter()
+	config := doorman.RateLimitConfig{Rate: 2}
+	now := time.Now()
+
+	// Default burst is the rate.
+	assert.Equal(t, time.Duration(0), l.take("a", config, now))
+	assert.Equal(t, time.Duration(0), l.take("a", config, now))
+	assert.Equal(t, 500*time.Millisecond, l.take("a", config, now))
+
+	assert.Equal(t, time.Duration(0), l.take("a", config, now.Add(500*time.Millisecond)))
+
+	// Full buckets are removed.
+	l.take("b", config, now.Add(time.Second))
+	l.take("b", config, now.Add(2*time.Minute))
+	_, found := l.buckets["a"]
+	assert.False(t, found)
+	assert.Equal(t, 1, len(l.buckets))
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// RelationsSettings configure the relationship tuples endpoints.
+type RelationsSettings struct {
+	// Store holds the tuples (see doorman.SetRelationStore). The endpoints are
+	// disabled if nil.
+	Store doorman.RelationStore
+}
+
+// Relations are the relationship tuples settings.
+// They must be set before calling SetupRoutes().
+var Relations = RelationsSettings{}
+
+// RelationsRequest is the body of the relationship tuples changes.
+type RelationsRequest struct {
+	// Write and Delete are tuples (eg. `doc:42#editor@userid:alice`).
+	Write  []string
+	Delete []string
+}
+
+// writeRelationsHandler writes and deletes relationship tuples. Nothing is
+// changed if one of the tuples is invalid. The decisions cache is cleared.
+func writeRelationsHandler(store doorman.RelationStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var r RelationsRequest
+		if err := c.BindJSON(&r); err != nil {
+			abortWithError(c, http.StatusBadRequest, ErrorInvalidBody, err.Error())
+			return
+		}
+		writes, err := parseRelations(r.Write)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, ErrorInvalidBody, err.Error())
+			return
+		}
+		deletes, err := parseRelations(r.Delete)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, ErrorInvalidBody, err.Error())
+			return
+		}
+
+		// The deletions come first, so that a tuple can be replaced.
+		if err = store.Delete(deletes...); err == nil {
+			err = store.Write(writes...)
+		}
+		// The cached decisions may depend on the changed tuples, even if partially applied.
+		d := c.MustGet(DoormanContextKey).(doorman.Doorman)
+		d.ClearDecisionCache()
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, ErrorInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"written": len(writes),
+			"deleted": len(deletes),
+		})
+	}
+}
+
+func parseRelations(tuples []string) ([]doorman.Relation, error) {
+	relations := []doorman.Relation{}
+	for _, tuple := range tuples {
+		relation, err := doorman.ParseRelation(tuple)
+		if err != nil {
+			return nil, err
+		}
+		relations = append(relations, relation)
+	}
+	return relations, nil
+}
+
+// checkRelationHandler returns whether the subject has the relation with the
+// object, directly or through the subjects sets.
+func checkRelationHandler(store doorman.RelationStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		object := c.Query("object")
+		relation := c.Query("relation")
+		subject := c.Query("subject")
+		if object == "" || relation == "" || subject == "" {
+			abortWithError(c, http.StatusBadRequest, ErrorInvalidBody, "missing object, relation or subject")
+			return
+		}
+		found, err := doorman.CheckRelation(store, object, relation, doorman.Principals{subject})
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, ErrorInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"object":   object,
+			"relation": relation,
+			"subject":  subject,
+			"allowed":  found,
+		})
+	}
+}
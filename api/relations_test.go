@@ -0,0 +1,119 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+func TestRelationsHandlers(t *testing.T) {
+	store := doorman.NewMemoryRelationStore()
+	r := gin.New()
+	r.Use(ContextMiddleware(doorman.NewDefaultLadon()))
+	r.POST("/__relations__", writeRelationsHandler(store))
+	r.GET("/__relations__/check", checkRelationHandler(store))
+
+	post := func(body interface{}, expected int) map[string]interface{} {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/__relations__", bytes.NewBuffer(data))
+		r.ServeHTTP(w, req)
+		require.Equal(t, expected, w.Code)
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+	check := func(query string, expected int) map[string]interface{} {
+		w := performRequest(r, "GET", "/__relations__/check?"+query, nil)
+		require.Equal(t, expected, w.Code)
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+
+	resp := post(RelationsRequest{Write: []string{"doc:42#editor@group:eng#member", "group:eng#member@userid:bob"}}, http.StatusOK)
+	assert.Equal(t, 2.0, resp["written"])
+	assert.Equal(t, true, check("object=doc:42&relation=editor&subject=userid:bob", http.StatusOK)["allowed"])
+
+	resp = post(RelationsRequest{Delete: []string{"group:eng#member@userid:bob"}}, http.StatusOK)
+	assert.Equal(t, 1.0, resp["deleted"])
+	assert.Equal(t, false, check("object=doc:42&relation=editor&subject=userid:bob", http.StatusOK)["allowed"])
+
+	// Nothing is changed if a tuple is invalid.
+	resp = post(RelationsRequest{Write: []string{"doc:43#editor@userid:bob", "doc:43"}}, http.StatusBadRequest)
+	assert.Contains(t, resp["message"], "invalid relation \"doc:43\"")
+	assert.Equal(t, false, check("object=doc:43&relation=editor&subject=userid:bob", http.StatusOK)["allowed"])
+
+	resp = check("object=doc:42&relation=editor", http.StatusBadRequest)
+	assert.Equal(t, "missing object, relation or subject", resp["message"])
+}
+
+func TestRelationsRoutes(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	d.SetDecisionCache(time.Minute, 0)
+	require.Nil(t, d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "a",
+			Policies: doorman.Policies{
+				doorman.Policy{
+					ID:         "editors",
+					Principals: []string{"<.*>"},
+					Actions:    []string{"write"},
+					Resources:  []string{"doc:<.*>"},
+					Conditions: doorman.Conditions{
+						"resource.object": doorman.Condition{
+							Type:    "RelationCondition",
+							Options: map[string]interface{}{"relation": "editor"},
+						},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	}))
+	store := doorman.NewMemoryRelationStore()
+	store.Write(doorman.Relation{Object: "doc:42", Relation: "editor", Subject: "userid:alice"})
+	d.SetRelationStore(store)
+	Relations.Store = store
+	defer func() {
+		Relations.Store = nil
+		Admin.Token = ""
+	}()
+	r := gin.New()
+	SetupRoutes(r, d)
+
+	post := func(token string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/__relations__", bytes.NewBufferString(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	write := func() *doorman.Request {
+		return &doorman.Request{Principals: doorman.Principals{"userid:alice"}, Action: "write", Resource: "doc:42"}
+	}
+	deletion := `{"delete": ["doc:42#editor@userid:alice"]}`
+
+	// Disabled without admin token.
+	assert.Equal(t, http.StatusForbidden, post("s3cr3t", deletion).Code)
+	Admin.Token = "s3cr3t"
+	assert.Equal(t, http.StatusUnauthorized, post("", deletion).Code)
+	assert.Equal(t, http.StatusUnauthorized, post("guess", deletion).Code)
+	assert.Equal(t, http.StatusUnauthorized, performRequest(r, "GET", "/__relations__/check?object=doc:42&relation=editor&subject=userid:alice", nil).Code)
+
+	// The cached decisions are cleared when the tuples change.
+	assert.True(t, d.IsAllowed("a", write()))
+	assert.Equal(t, http.StatusOK, post("s3cr3t", deletion).Code)
+	assert.False(t, d.IsAllowed("a", write()))
+}
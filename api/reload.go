@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -9,6 +10,17 @@ import (
 	"github.com/mozilla/doorman/doorman"
 )
 
+// ReloadSettings configure the policies reloads.
+type ReloadSettings struct {
+	// Standby reloads the policies with a failover to secondary sources. If nil,
+	// the policies are reloaded from the sources they were loaded from.
+	Standby *config.Standby
+}
+
+// Reload are the policies reloads settings.
+// They must be set before calling SetupRoutes().
+var Reload = ReloadSettings{}
+
 func reloadHandler(sources []string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Load files (from folders, files, Github, etc.)
@@ -38,3 +50,46 @@ func reloadHandler(sources []string) gin.HandlerFunc {
 		})
 	}
 }
+
+// standbyReloadHandler reloads the primary policies, or activates the secondary
+// ones. The active source is returned, with the primary error if any.
+func standbyReloadHandler(s *config.Standby) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d := c.MustGet(DoormanContextKey).(doorman.Doorman)
+
+		if err := s.Load(d); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+
+		status := s.Status()
+		message := ""
+		if status.Error != nil {
+			message = status.Error.Error()
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": message,
+			"source":  status.Active,
+		})
+	}
+}
+
+// standbyStatus returns the active policies source, for the heartbeat.
+func standbyStatus(s *config.Standby) gin.H {
+	status := s.Status()
+	body := gin.H{
+		"active": status.Active,
+		"ready":  status.Ready,
+	}
+	if status.Error != nil {
+		body["error"] = status.Error.Error()
+	}
+	if !status.UnreachableSince.IsZero() {
+		body["unreachable_since"] = status.UnreachableSince.UTC().Format(time.RFC3339)
+	}
+	return body
+}
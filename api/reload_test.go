@@ -11,6 +11,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/mozilla/doorman/config"
 	"github.com/mozilla/doorman/doorman"
 )
 
@@ -32,6 +33,7 @@ service: a
 policies:
   -
     id: "1"
+    principals: ["userid:maria"]
     action: update
 `))
 
@@ -86,3 +88,50 @@ policies:
 
 	assert.Equal(t, w.Code, 500)
 }
+
+func TestStandbyReloadHandler(t *testing.T) {
+	primary, _ := ioutil.TempFile("", "")
+	defer os.Remove(primary.Name())
+	primary.Write([]byte("identityProvider:\nservice: a\n"))
+	primary.Close()
+	secondary, _ := ioutil.TempFile("", "")
+	defer os.Remove(secondary.Name())
+	secondary.Write([]byte("identityProvider:\nservice: b\n"))
+	secondary.Close()
+
+	Reload.Standby = &config.Standby{Primary: []string{primary.Name()}, Secondary: []string{secondary.Name()}}
+	defer func() { Reload = ReloadSettings{} }()
+	r := gin.New()
+	SetupRoutes(r, doorman.NewDefaultLadon())
+
+	var resp map[string]interface{}
+	w := performRequest(r, "POST", "/__reload__", nil)
+	assert.Equal(t, 200, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "primary", resp["source"])
+
+	os.Remove(primary.Name())
+	w = performRequest(r, "POST", "/__reload__", nil)
+	assert.Equal(t, 200, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "secondary", resp["source"])
+	assert.Contains(t, resp["message"], "no appropriate loader found")
+
+	var heartbeat struct {
+		Policies map[string]interface{}
+	}
+	w = performRequest(r, "GET", "/__heartbeat__", nil)
+	json.Unmarshal(w.Body.Bytes(), &heartbeat)
+	assert.Equal(t, "secondary", heartbeat.Policies["active"])
+	assert.Equal(t, true, heartbeat.Policies["ready"])
+	assert.Contains(t, heartbeat.Policies["error"], "no appropriate loader found")
+	assert.NotEmpty(t, heartbeat.Policies["unreachable_since"])
+
+	// No policies to serve.
+	os.Remove(secondary.Name())
+	Reload.Standby = &config.Standby{Primary: []string{primary.Name()}, Secondary: []string{secondary.Name()}}
+	r = gin.New()
+	SetupRoutes(r, doorman.NewDefaultLadon())
+	w = performRequest(r, "POST", "/__reload__", nil)
+	assert.Equal(t, 500, w.Code)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// Require rejects with a `403 Forbidden` the requests whose authenticated user
+// is not allowed to perform the action on the resource, so that each route
+// declares its permission inline. The `:name` segments of the resource are
+// replaced by the route parameters (eg. `records/:id`). It must be chained
+// after AuthnMiddleware or ServiceAuthnMiddleware.
+func Require(action string, resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r := doorman.Request{
+			Action:   action,
+			Resource: routeResource(c, resource),
+		}
+		message := fmt.Sprintf("not allowed to %s %s", r.Action, r.Resource)
+
+		// The requests without authentication are never allowed.
+		service := c.GetString(ServiceContextKey)
+		value, ok := c.Get(DoormanContextKey)
+		if _, authenticated := PrincipalsFromContext(c); !authenticated || !ok || service == "" {
+			abortForbidden(c, message, ErrorForbidden)
+			return
+		}
+		d := value.(doorman.Doorman)
+
+		if e := prepareRequest(c, service, &r); e != nil {
+			abortWithResponseError(c, *e)
+			return
+		}
+		if result := d.Check(service, &r); !result.Allowed {
+			reason := result.Reason
+			if reason == "" {
+				reason = ErrorForbidden
+			}
+			abortForbidden(c, message, reason)
+			return
+		}
+		c.Next()
+	}
+}
+
+// routeResource replaces the `:name` segments of the resource with the route
+// parameters.
+func routeResource(c *gin.Context, resource string) string {
+	segments := strings.Split(resource, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = c.Param(segment[1:])
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func abortForbidden(c *gin.Context, message string, reason string) {
+	abortWithResponseError(c, ResponseError{
+		Status:  http.StatusForbidden,
+		Code:    ErrorForbidden,
+		Message: message,
+		Details: map[string]interface{}{
+			"reason": reason,
+		},
+	})
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/doorman"
+)
+
+func TestRequire(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://records",
+			Policies: doorman.Policies{
+				doorman.Policy{
+					ID:         "1",
+					Principals: doorman.Principals{"userid:alice"},
+					Actions:    []string{"read"},
+					Resources:  []string{"records/42"},
+					Effect:     "allow",
+				},
+			},
+		},
+	})
+	v := &TestAuthenticator{}
+	v.On("ValidateRequest", mock.Anything).Return(&authn.UserInfo{ID: "alice"}, nil)
+	d.SetAuthenticator("https://records", v)
+	s := d.ForService("https://records")
+
+	r := gin.New()
+	r.GET("/records/:id", ServiceAuthnMiddleware(s), Require("read", "records/:id"), func(c *gin.Context) {
+		c.String(http.StatusOK, c.Param("id"))
+	})
+	r.GET("/open/:id", Require("read", "records/:id"), func(c *gin.Context) {
+		c.String(http.StatusOK, c.Param("id"))
+	})
+
+	w := performRequest(r, "GET", "/records/42", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "42", w.Body.String())
+
+	w = performRequest(r, "GET", "/records/43", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, "not allowed to read records/43", body["message"])
+	assert.Equal(t, "forbidden", body["reason"])
+
+	// Without authentication.
+	w = performRequest(r, "GET", "/open/42", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestRouteResource(t *testing.T) {
+	c, _ := gin.CreateTestContext(nil)
+	c.Params = gin.Params{{Key: "kind", Value: "invoice"}, {Key: "id", Value: "7"}}
+	assert.Equal(t, "records/invoice/7", routeResource(c, "records/:kind/:id"))
+	assert.Equal(t, "records/7:draft", routeResource(c, "records/7:draft"))
+	assert.Equal(t, "", routeResource(c, ":unknown"))
+}
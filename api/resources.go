@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mozilla/doorman/doorman"
+)
+
+// allowedResourcesHandler returns the resources patterns that the caller can
+// access with the action (eg. to only show what the user can access), instead
+// of checking the resources one by one.
+func allowedResourcesHandler(c *gin.Context) {
+	service, r, ok := bindActionRequest(c)
+	if !ok {
+		return
+	}
+
+	d := c.MustGet(DoormanContextKey).(doorman.Doorman)
+	patterns, err := d.AllowedResources(service, r)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, ErrorInternal, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"principals": r.Principals,
+		"action":     r.Action,
+		"allowed":    resourcePatternsJSON(patterns.Allowed),
+		"denied":     resourcePatternsJSON(patterns.Denied),
+	})
+}
+
+// bindActionRequest reads the posted request without resource, and prepares it
+// like for /allowed. The request is aborted if it is invalid.
+func bindActionRequest(c *gin.Context) (string, *doorman.Request, bool) {
+	if c.Request.ContentLength == 0 {
+		abortWithError(c, http.StatusBadRequest, ErrorMissingBody, "Missing body")
+		return "", nil, false
+	}
+
+	var r doorman.Request
+	if err := c.BindJSON(&r); err != nil {
+		abortWithError(c, http.StatusBadRequest, ErrorInvalidBody, err.Error())
+		return "", nil, false
+	}
+	if r.Action == "" {
+		abortWithError(c, http.StatusBadRequest, ErrorInvalidBody, "missing action")
+		return "", nil, false
+	}
+
+	service := requestAudience(c.Request)
+	if e := prepareRequest(c, service, &r); e != nil {
+		abortWithResponseError(c, *e)
+		return "", nil, false
+	}
+	return service, &r, true
+}
+
+func resourcePatternsJSON(patterns []doorman.ResourcePattern) []gin.H {
+	result := []gin.H{}
+	for _, pattern := range patterns {
+		result = append(result, gin.H{
+			"resource": pattern.Pattern,
+			"policy":   pattern.Policy,
+		})
+	}
+	return result
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mozilla/doorman/doorman"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllowedResources(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://sample.yaml",
+			Tags: doorman.Tags{
+				"editors": doorman.Principals{"userid:maria"},
+			},
+			Policies: doorman.Policies{
+				doorman.Policy{
+					ID:         "editors",
+					Principals: []string{"tag:editors"},
+					Actions:    []string{"read", "write"},
+					Resources:  []string{"articles/<.*>", "drafts"},
+					Effect:     "allow",
+				},
+				doorman.Policy{
+					ID:         "everyone",
+					Principals: []string{"userid:<.*>"},
+					Actions:    []string{"read"},
+					Resources:  []string{"home"},
+					Effect:     "allow",
+					AllowBroad: true,
+				},
+				doorman.Policy{
+					ID:         "archives",
+					Principals: []string{"userid:<.*>"},
+					Actions:    []string{"<.*>"},
+					Resources:  []string{"articles/archives/<.*>"},
+					Effect:     "deny",
+				},
+				doorman.Policy{
+					ID:         "staging",
+					Principals: []string{"userid:maria"},
+					Actions:    []string{"read"},
+					Resources:  []string{"staging"},
+					Conditions: doorman.Conditions{
+						"env": doorman.Condition{
+							Type: "StringEqualCondition",
+							Options: map[string]interface{}{
+								"equals": "stage",
+							},
+						},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+
+	type Pattern struct {
+		Resource string
+		Policy   string
+	}
+	type Response struct {
+		Principals doorman.Principals
+		Allowed    []Pattern
+		Denied     []Pattern
+		Message    string
+	}
+	list := func(body interface{}, expected int) Response {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set(DoormanContextKey, d)
+		post, _ := json.Marshal(body)
+		c.Request, _ = http.NewRequest("POST", "/allowed/resources", bytes.NewBuffer(post))
+		c.Request.Header.Set("Origin", "https://sample.yaml")
+		allowedResourcesHandler(c)
+		require.Equal(t, expected, w.Code)
+		var resp Response
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+
+	resp := list(doorman.Request{Principals: doorman.Principals{"userid:maria"}, Action: "read"}, http.StatusOK)
+	assert.Equal(t, doorman.Principals{"userid:maria", "tag:editors"}, resp.Principals)
+	assert.Equal(t, []Pattern{{"articles/<.*>", "editors"}, {"drafts", "editors"}, {"home", "everyone"}}, resp.Allowed)
+	assert.Equal(t, []Pattern{{"articles/archives/<.*>", "archives"}}, resp.Denied)
+
+	resp = list(doorman.Request{Principals: doorman.Principals{"userid:bob"}, Action: "write"}, http.StatusOK)
+	assert.Equal(t, []Pattern{}, resp.Allowed)
+	assert.Equal(t, 1, len(resp.Denied))
+
+	// The conditions are checked with the context.
+	resp = list(doorman.Request{Principals: doorman.Principals{"userid:maria"}, Action: "read", Context: doorman.Context{"env": "stage"}}, http.StatusOK)
+	assert.Equal(t, Pattern{"staging", "staging"}, resp.Allowed[len(resp.Allowed)-1])
+
+	resp = list(doorman.Request{Principals: doorman.Principals{"userid:maria"}}, http.StatusBadRequest)
+	assert.Equal(t, "missing action", resp.Message)
+	resp = list(doorman.Request{Action: "read"}, http.StatusBadRequest)
+	assert.Equal(t, "missing principals", resp.Message)
+}
+
+func TestAllowedResourcesMaintenance(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "a",
+			Maintenance: doorman.MaintenanceConfig{
+				Default: doorman.MaintenanceDeny,
+			},
+			Policies: doorman.Policies{
+				doorman.Policy{
+					ID:         "1",
+					Principals: []string{"userid:maria"},
+					Actions:    []string{"read"},
+					Resources:  []string{"articles"},
+					Effect:     "allow",
+				},
+			},
+		},
+	})
+	request := &doorman.Request{Principals: doorman.Principals{"userid:maria"}, Action: "read"}
+	patterns, err := d.AllowedResources("a", request)
+	require.Nil(t, err)
+	assert.Equal(t, 1, len(patterns.Allowed))
+
+	d.SetMaintenance("a", true)
+	patterns, err = d.AllowedResources("a", request)
+	require.Nil(t, err)
+	assert.Equal(t, 0, len(patterns.Allowed))
+
+	_, err = d.AllowedResources("b", request)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mozilla/doorman/authn"
+)
+
+// SessionSettings configure the session cookie mode, for browser-facing deployments
+// where sending a token on every request is not feasible.
+type SessionSettings struct {
+	// Codec encrypts the session cookies. Sessions are disabled if nil.
+	Codec *authn.SessionCodec
+	// CookieName is the name of the session cookie.
+	CookieName string
+	// TTL is the session duration, renewed on every authenticated request.
+	TTL time.Duration
+}
+
+// Sessions are the session cookie mode settings.
+// They must be set before calling SetupRoutes().
+var Sessions = SessionSettings{
+	CookieName: "doorman-session",
+	TTL:        time.Hour,
+}
+
+// sessionUserInfo returns the user info of the request session cookie, if any.
+func sessionUserInfo(c *gin.Context, service string) (*authn.UserInfo, bool) {
+	if Sessions.Codec == nil {
+		return nil, false
+	}
+	cookie, err := c.Request.Cookie(Sessions.CookieName)
+	if err != nil {
+		return nil, false
+	}
+	userInfo, err := Sessions.Codec.Decode(service, cookie.Value, time.Now())
+	if err != nil {
+		log.Debugf("Ignore session cookie: %s", err)
+		return nil, false
+	}
+	return userInfo, true
+}
+
+// setSessionCookie sends a session cookie with the user info, expiring after the
+// sessions TTL.
+func setSessionCookie(c *gin.Context, service string, userInfo *authn.UserInfo) {
+	if Sessions.Codec == nil {
+		return
+	}
+	expires := time.Now().Add(Sessions.TTL)
+	value, err := Sessions.Codec.Encode(service, userInfo, expires)
+	if err != nil {
+		log.Errorf("Could not encode session: %s", err)
+		return
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     Sessions.CookieName,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
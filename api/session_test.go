@@ -0,0 +1,82 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/doorman"
+)
+
+func TestAuthnMiddlewareSession(t *testing.T) {
+	codec, _ := authn.NewSessionCodec([]byte("0123456789abcdef0123456789abcdef"))
+	defer func(s SessionSettings) { Sessions = s }(Sessions)
+	Sessions.Codec = codec
+
+	d := doorman.NewDefaultLadon()
+	handler := AuthnMiddleware(d)
+	audience := "https://some.api.com"
+
+	v := &TestAuthenticator{}
+	v.On("ValidateRequest", mock.Anything).Return(&authn.UserInfo{ID: "ldap|user"}, nil)
+	d.SetAuthenticator(audience, v)
+
+	// Token is validated and session cookie is sent.
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	c.Request.Header.Set("Origin", audience)
+	handler(c)
+	v.AssertNumberOfCalls(t, "ValidateRequest", 1)
+	cookies := w.Result().Cookies()
+	require.Equal(t, 1, len(cookies))
+	assert.Equal(t, "doorman-session", cookies[0].Name)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.True(t, cookies[0].Secure)
+
+	// With session cookie, authenticator is not used anymore.
+	v = &TestAuthenticator{}
+	v.On("ValidateRequest", mock.Anything).Return((*authn.UserInfo)(nil), fmt.Errorf("token not found"))
+	d.SetAuthenticator(audience, v)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	c.Request.Header.Set("Origin", audience)
+	c.Request.AddCookie(cookies[0])
+	handler(c)
+	v.AssertNotCalled(t, "ValidateRequest", mock.Anything)
+	principals, _ := c.Get(PrincipalsContextKey)
+	assert.Equal(t, doorman.Principals{"userid:ldap|user"}, principals)
+	// Rolling expiry.
+	renewed := w.Result().Cookies()
+	require.Equal(t, 1, len(renewed))
+	assert.NotEqual(t, cookies[0].Value, renewed[0].Value)
+
+	// Session of another service is ignored.
+	d.SetAuthenticator("https://other.com", v)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	c.Request.Header.Set("Origin", "https://other.com")
+	c.Request.AddCookie(cookies[0])
+	handler(c)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Sessions disabled.
+	Sessions.Codec = nil
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/get", nil)
+	c.Request.Header.Set("Origin", audience)
+	c.Request.AddCookie(cookies[0])
+	handler(c)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
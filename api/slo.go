@@ -0,0 +1,159 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// latencySamples is the number of recent decisions used to compute latency percentiles.
+const latencySamples = 1000
+
+// SLOObjectives are the service level objectives of the authorization path.
+type SLOObjectives struct {
+	// Availability is the minimum ratio of decisions served without internal error.
+	Availability float64
+	// LatencyP99 is the maximum 99th percentile of decisions latency.
+	LatencyP99 time.Duration
+	// ReloadFreshness is the maximum age of the last successful policies load.
+	ReloadFreshness time.Duration
+}
+
+// Objectives are the service level objectives reported on the __slo__ endpoint.
+// They must be set before calling SetupRoutes().
+var Objectives = SLOObjectives{
+	Availability:    0.999,
+	LatencyP99:      100 * time.Millisecond,
+	ReloadFreshness: 24 * time.Hour,
+}
+
+// latencySample is the latency of a decision. The decision ID is reported as
+// exemplar of the latency percentile.
+type latencySample struct {
+	latency    time.Duration
+	decisionID string
+}
+
+// sloRecorder keeps track of the service level indicators of the authorization path.
+type sloRecorder struct {
+	sync.Mutex
+	objectives SLOObjectives
+	total      int64
+	failed     int64
+	latencies  []latencySample
+	next       int
+	loadedAt   time.Time
+}
+
+func newSLORecorder(objectives SLOObjectives) *sloRecorder {
+	return &sloRecorder{
+		objectives: objectives,
+		latencies:  []latencySample{},
+		loadedAt:   time.Now(),
+	}
+}
+
+// recordDecision counts a decision and its latency. Internal errors count as unavailable.
+func (s *sloRecorder) recordDecision(statusCode int, latency time.Duration, decisionID string) {
+	s.Lock()
+	defer s.Unlock()
+	s.total++
+	if statusCode >= http.StatusInternalServerError {
+		s.failed++
+	}
+	sample := latencySample{latency, decisionID}
+	if len(s.latencies) < latencySamples {
+		s.latencies = append(s.latencies, sample)
+	} else {
+		s.latencies[s.next] = sample
+	}
+	s.next = (s.next + 1) % latencySamples
+}
+
+// recordReload marks the policies as freshly loaded.
+func (s *sloRecorder) recordReload() {
+	s.Lock()
+	defer s.Unlock()
+	s.loadedAt = time.Now()
+}
+
+// p99 returns the 99th percentile of the recent decisions latency, along with
+// the decision ID of this sample.
+func (s *sloRecorder) p99() latencySample {
+	if len(s.latencies) == 0 {
+		return latencySample{}
+	}
+	sorted := make([]latencySample, len(s.latencies))
+	copy(sorted, s.latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].latency < sorted[j].latency })
+	index := (len(sorted)*99 + 99) / 100
+	return sorted[index-1]
+}
+
+// summary returns the current indicators compared to their objectives.
+func (s *sloRecorder) summary() gin.H {
+	s.Lock()
+	defer s.Unlock()
+
+	availability := 1.0
+	if s.total > 0 {
+		availability = float64(s.total-s.failed) / float64(s.total)
+	}
+	availabilityOk := availability >= s.objectives.Availability
+
+	p99 := s.p99()
+	latencyOk := p99.latency <= s.objectives.LatencyP99
+
+	age := time.Since(s.loadedAt)
+	reloadOk := age <= s.objectives.ReloadFreshness
+
+	return gin.H{
+		"ok": availabilityOk && latencyOk && reloadOk,
+		"availability": gin.H{
+			"ok":        availabilityOk,
+			"objective": s.objectives.Availability,
+			"current":   availability,
+			"total":     s.total,
+			"failed":    s.failed,
+		},
+		"latency": gin.H{
+			"ok":           latencyOk,
+			"objective_ms": float64(s.objectives.LatencyP99) / float64(time.Millisecond),
+			"p99_ms":       float64(p99.latency) / float64(time.Millisecond),
+			"p99_exemplar": p99.decisionID,
+		},
+		"reload": gin.H{
+			"ok":                reloadOk,
+			"objective_seconds": s.objectives.ReloadFreshness.Seconds(),
+			"age_seconds":       age.Seconds(),
+		},
+	}
+}
+
+// decisionSLOMiddleware records availability and latency of the decisions.
+func decisionSLOMiddleware(s *sloRecorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		s.recordDecision(c.Writer.Status(), time.Since(start), c.GetString(DecisionIDContextKey))
+	}
+}
+
+// reloadSLOMiddleware records the successful policies reloads.
+func reloadSLOMiddleware(s *sloRecorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.Writer.Status() == http.StatusOK {
+			s.recordReload()
+		}
+	}
+}
+
+func sloHandler(s *sloRecorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, s.summary())
+	}
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type SLOResponse struct {
+	Ok           bool
+	Availability struct {
+		Ok      bool
+		Current float64
+		Total   int64
+		Failed  int64
+	}
+	Latency struct {
+		Ok          bool
+		P99Ms       float64 `json:"p99_ms"`
+		P99Exemplar string  `json:"p99_exemplar"`
+	}
+	Reload struct {
+		Ok bool
+	}
+}
+
+func TestSLORecorder(t *testing.T) {
+	s := newSLORecorder(SLOObjectives{
+		Availability:    0.9,
+		LatencyP99:      10 * time.Millisecond,
+		ReloadFreshness: time.Hour,
+	})
+	for i := 0; i < 98; i++ {
+		s.recordDecision(http.StatusOK, time.Millisecond, "")
+	}
+	s.recordDecision(http.StatusOK, 20*time.Millisecond, "slow")
+	s.recordDecision(http.StatusInternalServerError, 20*time.Millisecond, "slow")
+	assert.Equal(t, 20*time.Millisecond, s.p99().latency)
+
+	var resp SLOResponse
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	sloHandler(s)(c)
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
+	require.Nil(t, err)
+	assert.False(t, resp.Ok)
+	assert.True(t, resp.Availability.Ok)
+	assert.Equal(t, 0.99, resp.Availability.Current)
+	assert.Equal(t, int64(100), resp.Availability.Total)
+	assert.Equal(t, int64(1), resp.Availability.Failed)
+	assert.False(t, resp.Latency.Ok)
+	assert.Equal(t, 20.0, resp.Latency.P99Ms)
+	assert.Equal(t, "slow", resp.Latency.P99Exemplar)
+	assert.True(t, resp.Reload.Ok)
+
+	// Latency samples are bounded.
+	for i := 0; i < 2*latencySamples; i++ {
+		s.recordDecision(http.StatusOK, time.Millisecond, "")
+	}
+	assert.Equal(t, latencySamples, len(s.latencies))
+	assert.Equal(t, time.Millisecond, s.p99().latency)
+
+	// Stale policies.
+	s.loadedAt = time.Now().Add(-2 * time.Hour)
+	assert.False(t, s.summary()["reload"].(gin.H)["ok"].(bool))
+	s.recordReload()
+	assert.True(t, s.summary()["reload"].(gin.H)["ok"].(bool))
+}
+
+func TestSLOEndpoint(t *testing.T) {
+	var resp SLOResponse
+	testJSONResponse(t, "/__slo__", &resp)
+	assert.True(t, resp.Ok)
+	assert.Equal(t, int64(0), resp.Availability.Total)
+}
@@ -5,9 +5,14 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gopkg.in/yaml.v2"
+
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/config"
+	"github.com/mozilla/doorman/doorman"
 )
 
 // Yaml2JSON converts an unmarshalled YAML object to a JSON one.
@@ -55,8 +60,84 @@ func lbHeartbeatHandler(c *gin.Context) {
 	})
 }
 
+// heartbeatHandler reports the state of the subsystems: the policies loads, the
+// status of each policies source, and whether the authenticators of the services
+// are initialized (eg. identity provider keys fetched). With a standby, the
+// active policies source is reported under `policies`.
+//
+// It fails if the policies were never loaded or if an authenticator is not ready.
 func heartbeatHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{})
+	d := c.MustGet(DoormanContextKey).(doorman.Doorman)
+	ready := true
+
+	status := d.LoadStatus()
+	load := gin.H{}
+	if status.LoadedAt.IsZero() {
+		ready = false
+	} else {
+		load["loaded_at"] = status.LoadedAt.UTC().Format(time.RFC3339)
+	}
+	if status.Error != nil {
+		load["error"] = status.Error.Error()
+		load["failed_at"] = status.FailedAt.UTC().Format(time.RFC3339)
+	}
+
+	sources := []gin.H{}
+	for _, source := range config.SourcesStatus() {
+		s := gin.H{
+			"source":   source.Source,
+			"services": source.Services,
+		}
+		if !source.FetchedAt.IsZero() {
+			s["fetched_at"] = source.FetchedAt.UTC().Format(time.RFC3339)
+		}
+		if source.Error != nil {
+			s["error"] = source.Error.Error()
+			s["failed_at"] = source.FailedAt.UTC().Format(time.RFC3339)
+		}
+		sources = append(sources, s)
+	}
+
+	// The policies loaded but skipped, outside of their validity.
+	inactive := gin.H{}
+	for _, service := range d.Services() {
+		if c, ok := d.ServiceConfig(service); ok {
+			if ids := c.InactivePolicies(time.Now()); len(ids) > 0 {
+				inactive[service] = ids
+			}
+		}
+	}
+
+	authenticators := gin.H{}
+	for _, service := range d.Services() {
+		a, err := d.Authenticator(service)
+		if err != nil || a == nil {
+			// Authentication is disabled.
+			continue
+		}
+		if err := authn.Ready(a); err != nil {
+			authenticators[service] = err.Error()
+			ready = false
+		} else {
+			authenticators[service] = "ok"
+		}
+	}
+
+	body := gin.H{
+		"ready":             ready,
+		"load":              load,
+		"sources":           sources,
+		"authenticators":    authenticators,
+		"inactive_policies": inactive,
+	}
+	if Reload.Standby != nil {
+		body["policies"] = standbyStatus(Reload.Standby)
+	}
+	code := http.StatusOK
+	if !ready {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, body)
 }
 
 func versionHandler(c *gin.Context) {
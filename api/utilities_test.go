@@ -8,8 +8,10 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mozilla/doorman/config"
 	"github.com/mozilla/doorman/doorman"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -48,9 +50,84 @@ func TestLBHeartbeat(t *testing.T) {
 
 func TestHeartbeat(t *testing.T) {
 	type Response struct {
+		Ready          bool
+		Load           map[string]string
+		Sources        []map[string]interface{}
+		Authenticators map[string]string
 	}
+	tmpfile, _ := ioutil.TempFile("", "")
+	defer os.Remove(tmpfile.Name())
+	tmpfile.Write([]byte("identityProvider:\nservice: a\n---\nservice: b\nidentityProvider: https://localhost:1/\n"))
+	tmpfile.Close()
+
+	d := doorman.NewDefaultLadon()
+	r := gin.New()
+	SetupRoutes(r, d)
+
+	// Policies never loaded.
 	var response Response
-	testJSONResponse(t, "/__heartbeat__", &response)
+	w := performRequest(r, "GET", "/__heartbeat__", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.False(t, response.Ready)
+	assert.Empty(t, response.Load["loaded_at"])
+
+	configs, err := config.Load([]string{tmpfile.Name()})
+	require.Nil(t, err)
+	require.Nil(t, d.LoadPolicies(configs))
+
+	// The keys of the identity provider cannot be fetched.
+	response = Response{}
+	w = performRequest(r, "GET", "/__heartbeat__", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.False(t, response.Ready)
+	assert.NotEmpty(t, response.Load["loaded_at"])
+	assert.Contains(t, response.Authenticators["b"], "failed to fetch OpenID configuration")
+	assert.NotContains(t, response.Authenticators, "a")
+
+	var source map[string]interface{}
+	for _, s := range response.Sources {
+		if s["source"] == tmpfile.Name() {
+			source = s
+		}
+	}
+	require.NotNil(t, source)
+	assert.Equal(t, 2.0, source["services"])
+	assert.NotEmpty(t, source["fetched_at"])
+
+	// The last failure is reported, the previous policies are kept.
+	d.LoadPolicies(doorman.ServicesConfig{{Service: "a", IdentityProvider: "http://insecure"}})
+	d.SetAuthenticator("b", nil)
+	response = Response{}
+	w = performRequest(r, "GET", "/__heartbeat__", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.True(t, response.Ready)
+	assert.Contains(t, response.Load["error"], "does not use the https:// scheme")
+	assert.NotEmpty(t, response.Load["failed_at"])
+}
+
+func TestHeartbeatInactivePolicies(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "a",
+			Policies: doorman.Policies{
+				doorman.Policy{ID: "current", Principals: []string{"userid:maria"}},
+				doorman.Policy{ID: "expired", Principals: []string{"userid:maria"}, ValidUntil: time.Now().Add(-time.Hour)},
+			},
+		},
+	})
+	r := gin.New()
+	SetupRoutes(r, d)
+
+	var response struct {
+		InactivePolicies map[string][]string `json:"inactive_policies"`
+	}
+	w := performRequest(r, "GET", "/__heartbeat__", nil)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, map[string][]string{"a": {"expired"}}, response.InactivePolicies)
 }
 
 func TestVersion(t *testing.T) {
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// whoCanHandler returns the principals that the policies of the service allow
+// or deny to perform the action on the resource, for access reviews.
+func whoCanHandler(c *gin.Context) {
+	d := c.MustGet(DoormanContextKey).(doorman.Doorman)
+	service := c.Query("service")
+	action := c.Query("action")
+	resource := c.Query("resource")
+	if action == "" || resource == "" {
+		abortWithError(c, http.StatusBadRequest, ErrorInvalidBody, "missing action or resource")
+		return
+	}
+	if _, ok := d.ServiceConfig(service); !ok {
+		abortWithError(c, http.StatusNotFound, ErrorUnknownService, "unknown service")
+		return
+	}
+	grants, err := d.WhoCan(service, action, resource)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, ErrorInternal, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"service":  service,
+		"action":   action,
+		"resource": resource,
+		"allowed":  principalGrantsJSON(grants.Allowed),
+		"denied":   principalGrantsJSON(grants.Denied),
+	})
+}
+
+func principalGrantsJSON(grants []doorman.PrincipalGrant) []gin.H {
+	result := []gin.H{}
+	for _, grant := range grants {
+		entry := gin.H{
+			"principal":   grant.Principal,
+			"policy":      grant.Policy,
+			"conditional": grant.Conditional,
+		}
+		if grant.Members != nil {
+			entry["members"] = grant.Members
+		}
+		result = append(result, entry)
+	}
+	return result
+}
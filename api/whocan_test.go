@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+func TestWhoCanHandler(t *testing.T) {
+	r := gin.New()
+	d := doorman.NewDefaultLadon()
+	d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://sample.yaml",
+			Tags: doorman.Tags{
+				"editors": doorman.Principals{"userid:maria"},
+			},
+			Policies: doorman.Policies{
+				doorman.Policy{
+					ID:         "1",
+					Principals: []string{"tag:editors", "group:admins"},
+					Actions:    []string{"write"},
+					Resources:  []string{"articles/<.*>"},
+					Effect:     "allow",
+				},
+			},
+		},
+	})
+	Admin.Token = "s3cr3t"
+	defer func() { Admin.Token = "" }()
+	SetupRoutes(r, d)
+
+	// Requires the admin token.
+	w := performRequest(r, "GET", "/__audit__/who-can?service=https://sample.yaml&action=write&resource=articles/42", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	type Grant struct {
+		Principal   string
+		Policy      string
+		Members     doorman.Principals
+		Conditional bool
+	}
+	var resp struct {
+		Resource string
+		Allowed  []Grant
+		Denied   []Grant
+		Message  string
+	}
+	w = performAdminRequest(r, "GET", "/__audit__/who-can?service=https://sample.yaml&action=write&resource=articles/42", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "articles/42", resp.Resource)
+	assert.Equal(t, []Grant{
+		{Principal: "tag:editors", Policy: "1", Members: doorman.Principals{"userid:maria"}},
+		{Principal: "group:admins", Policy: "1"},
+	}, resp.Allowed)
+	assert.Equal(t, []Grant{}, resp.Denied)
+
+	w = performAdminRequest(r, "GET", "/__audit__/who-can?service=https://sample.yaml&action=write", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "missing action or resource", resp.Message)
+
+	w = performAdminRequest(r, "GET", "/__audit__/who-can?service=unknown&action=write&resource=a", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
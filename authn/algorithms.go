@@ -0,0 +1,49 @@
+package authn
+
+import (
+	"fmt"
+
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// SigningAlgorithms are the algorithms that can be accepted for the tokens
+// signatures. Symmetric algorithms (`HS256`, …) and `none` are never accepted.
+var SigningAlgorithms = []string{
+	string(jose.RS256), string(jose.RS384), string(jose.RS512),
+	string(jose.PS256), string(jose.PS384), string(jose.PS512),
+	string(jose.ES256), string(jose.ES384), string(jose.ES512),
+	string(jose.EdDSA),
+}
+
+// IsSigningAlgorithm returns true if the algorithm is one of SigningAlgorithms.
+func IsSigningAlgorithm(name string) bool {
+	for _, s := range SigningAlgorithms {
+		if name == s {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSigningAlgorithms returns the specified algorithms, or an error if one
+// of them is not supported.
+func parseSigningAlgorithms(names []string) ([]jose.SignatureAlgorithm, error) {
+	algorithms := []jose.SignatureAlgorithm{}
+	for _, name := range names {
+		if !IsSigningAlgorithm(name) {
+			return nil, fmt.Errorf("unsupported signing algorithm %q", name)
+		}
+		algorithms = append(algorithms, jose.SignatureAlgorithm(name))
+	}
+	return algorithms, nil
+}
+
+// acceptsAlgorithm returns true if the tokens signed with the algorithm are accepted.
+func (v *openIDAuthenticator) acceptsAlgorithm(algorithm string) bool {
+	for _, a := range v.SignatureAlgorithms {
+		if string(a) == algorithm {
+			return true
+		}
+	}
+	return false
+}
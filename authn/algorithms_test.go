@@ -0,0 +1,66 @@
+package authn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ed25519"
+	jose "gopkg.in/square/go-jose.v2"
+	jwt "gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestSigningAlgorithms(t *testing.T) {
+	_, err := NewAuthenticatorWithOptions("https://auth.example.com", AuthenticatorOptions{SigningAlgorithms: []string{"HS256"}})
+	require.NotNil(t, err)
+	assert.Equal(t, "unsupported signing algorithm \"HS256\"", err.Error())
+
+	a, err := NewAuthenticatorWithOptions("https://auth.example.com", AuthenticatorOptions{SigningAlgorithms: []string{"ES256", "EdDSA"}})
+	require.Nil(t, err)
+	v := a.(*openIDAuthenticator)
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPublic, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	jwks, _ := json.Marshal(publicKeys{Keys: []jose.JSONWebKey{
+		{Key: &rsaKey.PublicKey, KeyID: "rsa"},
+		{Key: &ecKey.PublicKey, KeyID: "ec"},
+		{Key: edPublic, KeyID: "ed"},
+	}})
+	v.cache.Set("jwks:"+v.Issuer, jwks)
+
+	sign := func(algorithm jose.SignatureAlgorithm, keyID string, private interface{}) string {
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: algorithm, Key: private}, (&jose.SignerOptions{}).WithHeader("kid", keyID))
+		require.Nil(t, err)
+		token, err := jwt.Signed(signer).Claims(map[string]interface{}{
+			"iss": "https://auth.example.com",
+			"aud": "https://api.example.com",
+			"sub": "1234",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}).CompactSerialize()
+		require.Nil(t, err)
+		return token
+	}
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "https://api.example.com")
+	for _, token := range []string{sign(jose.ES256, "ec", ecKey), sign(jose.EdDSA, "ed", edKey)} {
+		r.Header.Set("Authorization", "Bearer "+token)
+		userinfo, err := v.ValidateRequest(r)
+		require.Nil(t, err)
+		assert.Equal(t, "1234", userinfo.ID)
+	}
+
+	// Other algorithms are rejected.
+	r.Header.Set("Authorization", "Bearer "+sign(jose.RS256, "rsa", rsaKey))
+	_, err = v.ValidateRequest(r)
+	require.NotNil(t, err)
+	assert.Equal(t, "invalid algorithm \"RS256\"", err.Error())
+}
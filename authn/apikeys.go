@@ -0,0 +1,155 @@
+package authn
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// APIKeyHeader is the request header that contains the API key.
+const APIKeyHeader = "X-Api-Key"
+
+// apiKeyHashPrefix marks the keys stored as SHA-256 hex digests.
+const apiKeyHashPrefix = "sha256:"
+
+// APIKey is the identity of a machine client.
+type APIKey struct {
+	Name   string
+	Groups []string
+}
+
+// APIKeyStore looks up the API keys. It returns nil if the key is unknown.
+type APIKeyStore interface {
+	LookupAPIKey(key string) (*APIKey, error)
+}
+
+// APIKeyStoreFunc is an adapter to use ordinary functions as APIKeyStore.
+type APIKeyStoreFunc func(key string) (*APIKey, error)
+
+// LookupAPIKey calls f(key).
+func (f APIKeyStoreFunc) LookupAPIKey(key string) (*APIKey, error) {
+	return f(key)
+}
+
+var apiKeyStores = map[string]APIKeyStore{}
+
+// RegisterAPIKeyStore adds a custom API keys store, that can be used in the
+// services configurations. It must be called before loading policies.
+func RegisterAPIKeyStore(name string, store APIKeyStore) {
+	apiKeyStores[name] = store
+}
+
+// RegisteredAPIKeyStore returns the API keys store registered with this name.
+func RegisteredAPIKeyStore(name string) (APIKeyStore, error) {
+	store, ok := apiKeyStores[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown API keys store %q", name)
+	}
+	return store, nil
+}
+
+// hashAPIKey returns the digest the keys are indexed with.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// staticAPIKeys is a store of keys indexed by digest.
+type staticAPIKeys map[string]*APIKey
+
+func (s staticAPIKeys) LookupAPIKey(key string) (*APIKey, error) {
+	return s[hashAPIKey(key)], nil
+}
+
+func (s staticAPIKeys) add(key string, apiKey *APIKey) error {
+	if apiKey.Name == "" || key == "" {
+		return fmt.Errorf("API key without name or value")
+	}
+	digest := hashAPIKey(key)
+	if strings.HasPrefix(key, apiKeyHashPrefix) {
+		digest = strings.ToLower(strings.TrimPrefix(key, apiKeyHashPrefix))
+	}
+	s[digest] = apiKey
+	return nil
+}
+
+// NewAPIKeysFile reads the API keys from a YAML file. Each entry has a `name`,
+// a `key` (either clear or its SHA-256 digest as `sha256:{hex}`), and optional
+// `groups`.
+func NewAPIKeysFile(filename string) (APIKeyStore, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read API keys file")
+	}
+	var entries []struct {
+		Name   string
+		Key    string
+		Groups []string
+	}
+	if err := yaml.Unmarshal(content, &entries); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to parse API keys file %q", filename))
+	}
+	store := staticAPIKeys{}
+	for _, entry := range entries {
+		if err := store.add(entry.Key, &APIKey{Name: entry.Name, Groups: entry.Groups}); err != nil {
+			return nil, fmt.Errorf("%s in %q", err, filename)
+		}
+	}
+	return store, nil
+}
+
+// NewAPIKeysEnv reads the API keys from an environment variable, as space
+// separated `{name}={key}` entries.
+func NewAPIKeysEnv(variable string) (APIKeyStore, error) {
+	store := staticAPIKeys{}
+	for _, entry := range strings.Fields(os.Getenv(variable)) {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid API key entry in %s", variable)
+		}
+		if err := store.add(parts[1], &APIKey{Name: parts[0]}); err != nil {
+			return nil, fmt.Errorf("%s in %s", err, variable)
+		}
+	}
+	return store, nil
+}
+
+// apiKeyAuthenticator authenticates the requests with the API key header.
+type apiKeyAuthenticator struct {
+	stores []APIKeyStore
+}
+
+// NewAPIKeyAuthenticator returns an authenticator that looks up the API key of
+// the request in the stores, in order.
+func NewAPIKeyAuthenticator(stores ...APIKeyStore) Authenticator {
+	return &apiKeyAuthenticator{stores: stores}
+}
+
+func (a *apiKeyAuthenticator) ValidateRequest(r *http.Request) (*UserInfo, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, fmt.Errorf("API key not found")
+	}
+	for _, store := range a.stores {
+		apiKey, err := store.LookupAPIKey(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not look up API key")
+		}
+		if apiKey != nil {
+			return &UserInfo{
+				ID:     apiKey.Name,
+				APIKey: apiKey.Name,
+				Groups: apiKey.Groups,
+				Claims: map[string]interface{}{},
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid API key")
+}
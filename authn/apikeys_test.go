@@ -0,0 +1,96 @@
+package authn
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAPIKeysFile(t *testing.T) {
+	_, err := NewAPIKeysFile("/does/not/exist.yaml")
+	require.NotNil(t, err)
+
+	tmpfile, _ := ioutil.TempFile("", "apikeys")
+	defer os.Remove(tmpfile.Name())
+	tmpfile.Write([]byte(`
+- name: deploy-bot
+  key: s3cr3t
+  groups: [deployers]
+- name: backup-bot
+  key: sha256:` + hashAPIKey("t0ps3cr3t") + `
+`))
+	store, err := NewAPIKeysFile(tmpfile.Name())
+	require.Nil(t, err)
+
+	apiKey, _ := store.LookupAPIKey("s3cr3t")
+	require.NotNil(t, apiKey)
+	assert.Equal(t, "deploy-bot", apiKey.Name)
+	assert.Equal(t, []string{"deployers"}, apiKey.Groups)
+	apiKey, _ = store.LookupAPIKey("t0ps3cr3t")
+	require.NotNil(t, apiKey)
+	assert.Equal(t, "backup-bot", apiKey.Name)
+	apiKey, _ = store.LookupAPIKey("sha256:" + hashAPIKey("t0ps3cr3t"))
+	assert.Nil(t, apiKey)
+
+	ioutil.WriteFile(tmpfile.Name(), []byte(`- name: nokey`), 0666)
+	_, err = NewAPIKeysFile(tmpfile.Name())
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "API key without name or value")
+}
+
+func TestNewAPIKeysEnv(t *testing.T) {
+	os.Setenv("TEST_API_KEYS", "deploy-bot=s3cr3t backup-bot=t0p=s3cr3t")
+	defer os.Unsetenv("TEST_API_KEYS")
+	store, err := NewAPIKeysEnv("TEST_API_KEYS")
+	require.Nil(t, err)
+	apiKey, _ := store.LookupAPIKey("t0p=s3cr3t")
+	require.NotNil(t, apiKey)
+	assert.Equal(t, "backup-bot", apiKey.Name)
+
+	os.Setenv("TEST_API_KEYS", "deploy-bot")
+	_, err = NewAPIKeysEnv("TEST_API_KEYS")
+	require.NotNil(t, err)
+}
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	RegisterAPIKeyStore("test", APIKeyStoreFunc(func(key string) (*APIKey, error) {
+		if key == "boom" {
+			return nil, fmt.Errorf("store unavailable")
+		}
+		if key == "s3cr3t" {
+			return &APIKey{Name: "deploy-bot", Groups: []string{"deployers"}}, nil
+		}
+		return nil, nil
+	}))
+	_, err := RegisteredAPIKeyStore("unknown")
+	require.NotNil(t, err)
+	store, err := RegisteredAPIKeyStore("test")
+	require.Nil(t, err)
+
+	a := NewAPIKeyAuthenticator(staticAPIKeys{}, store)
+	r, _ := http.NewRequest("GET", "/", nil)
+	_, err = a.ValidateRequest(r)
+	require.NotNil(t, err)
+	assert.Equal(t, "API key not found", err.Error())
+
+	r.Header.Set(APIKeyHeader, "bad")
+	_, err = a.ValidateRequest(r)
+	require.NotNil(t, err)
+	assert.Equal(t, "invalid API key", err.Error())
+
+	r.Header.Set(APIKeyHeader, "boom")
+	_, err = a.ValidateRequest(r)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "store unavailable")
+
+	r.Header.Set(APIKeyHeader, "s3cr3t")
+	userInfo, err := a.ValidateRequest(r)
+	require.Nil(t, err)
+	assert.Equal(t, "deploy-bot", userInfo.APIKey)
+	assert.Equal(t, []string{"deployers"}, userInfo.Groups)
+}
@@ -0,0 +1,83 @@
+package authn
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+)
+
+// defaultPorts are removed from the audiences.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// NormalizeAudience returns the canonical form of a service location, so that
+// the services of the configuration and of the requests are compared reliably:
+// the scheme and host are lower-cased, internationalized hosts are converted to
+// punycode, and the default port and trailing slash are removed (eg.
+// `HTTPS://Bücher.example:443/` becomes `https://xn--bcher-kva.example`).
+//
+// Audiences that are not URLs (eg. `/projects/123/apps/api` with Cloud IAP) are
+// returned as is.
+func NormalizeAudience(audience string) (string, error) {
+	if audience == "" {
+		return "", fmt.Errorf("empty audience")
+	}
+	if strings.IndexFunc(audience, unicode.IsSpace) >= 0 {
+		return "", fmt.Errorf("audience %q contains spaces", audience)
+	}
+	if !strings.Contains(audience, "://") {
+		return audience, nil
+	}
+
+	u, err := url.Parse(audience)
+	if err != nil {
+		return "", fmt.Errorf("invalid audience %q: %s", audience, err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("audience %q has no host", audience)
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("audience %q cannot have credentials, query or fragment", audience)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	// IP addresses are not domain names.
+	if net.ParseIP(host) == nil {
+		if host, err = idna.Lookup.ToASCII(host); err != nil {
+			return "", fmt.Errorf("invalid audience %q: %s", audience, err)
+		}
+	}
+	if port := u.Port(); port != "" && port != defaultPorts[scheme] {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		// IPv6 address.
+		host = "[" + host + "]"
+	}
+	return scheme + "://" + host + strings.TrimRight(u.EscapedPath(), "/"), nil
+}
+
+// matchAudience returns true if one of the audiences is the expected one, once
+// both are normalized (eg. tokens issued for `https://api.service.org/`).
+func matchAudience(audiences []string, expected string) bool {
+	expected = normalizedOrRaw(expected)
+	for _, audience := range audiences {
+		if normalizedOrRaw(audience) == expected {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizedOrRaw(audience string) string {
+	if normalized, err := NormalizeAudience(audience); err == nil {
+		return normalized
+	}
+	return audience
+}
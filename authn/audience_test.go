@@ -0,0 +1,54 @@
+package authn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeAudience(t *testing.T) {
+	for audience, expected := range map[string]string{
+		"https://api.service.org":            "https://api.service.org",
+		"https://api.service.org/":           "https://api.service.org",
+		"HTTPS://API.Service.org":            "https://api.service.org",
+		"https://api.service.org:443/":       "https://api.service.org",
+		"http://api.service.org:80":          "http://api.service.org",
+		"http://localhost:8080/":             "http://localhost:8080",
+		"https://api.service.org/v1/":        "https://api.service.org/v1",
+		"https://bücher.example":             "https://xn--bcher-kva.example",
+		"https://MÜNCHEN.de/":                "https://xn--mnchen-3ya.de",
+		"https://xn--bcher-kva.example":      "https://xn--bcher-kva.example",
+		"https://日本語.jp":                     "https://xn--wgv71a119e.jp",
+		"https://[::1]:8443/":                "https://[::1]:8443",
+		"http://127.0.0.1:8080":              "http://127.0.0.1:8080",
+		"/projects/123/apps/api":             "/projects/123/apps/api",
+		"api":                                "api",
+		"spiffe://corp.com/ns/default/sa/ci": "spiffe://corp.com/ns/default/sa/ci",
+	} {
+		normalized, err := NormalizeAudience(audience)
+		require.Nil(t, err, audience)
+		assert.Equal(t, expected, normalized, audience)
+	}
+
+	for audience, message := range map[string]string{
+		"":                             "empty audience",
+		"https://api.service.org /":    "contains spaces",
+		"https://":                     "has no host",
+		"https://api.service.org?a=":   "cannot have credentials, query or fragment",
+		"https://bob@api.org":          "cannot have credentials, query or fragment",
+		"https://api.service.org:port": "invalid audience",
+		"https://xn--a.example":        "invalid audience",
+	} {
+		_, err := NormalizeAudience(audience)
+		require.NotNil(t, err, audience)
+		assert.Contains(t, err.Error(), message)
+	}
+}
+
+func TestMatchAudience(t *testing.T) {
+	assert.True(t, matchAudience([]string{"https://API.service.org/"}, "https://api.service.org"))
+	assert.True(t, matchAudience([]string{"a", "https://api.service.org"}, "https://api.service.org:443/"))
+	assert.False(t, matchAudience([]string{"https://api.service.org/v1"}, "https://api.service.org"))
+	assert.False(t, matchAudience([]string{}, ""))
+}
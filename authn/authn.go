@@ -1,7 +1,7 @@
 // Package authn is in charge authenticating requests.
 //
 // Authenticators will be instantiated per identity provider URI.
-// Currently only OpenID is supported.
+// OpenID, Google Cloud IAP and Kubernetes service accounts are supported.
 //
 // OpenID configuration and keys will be cached.
 package authn
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 )
 
 // UserInfo contains the necessary attributes used in Doorman policies.
@@ -17,6 +18,42 @@ type UserInfo struct {
 	ID     string
 	Email  string
 	Groups []string
+	// Roles are the roles granted by the identity provider (eg. Keycloak).
+	Roles []string
+	// Domain is the organization domain of the user (eg. Google hosted domain).
+	Domain string
+	// ServiceAccount is the Kubernetes service account (`{namespace}/{name}`).
+	ServiceAccount string
+	// APIKey is the name of the API key of machine clients.
+	APIKey string
+	// Certificate is the subject common name of the TLS client certificate.
+	Certificate string
+	// SPIFFEID is the `spiffe://` URI of the TLS client certificate.
+	SPIFFEID string
+	// Scopes are the scopes granted to the token (`scope` or `scp` claim).
+	Scopes []string
+	// ClientID is the OAuth client the token was issued to (`azp` or `client_id`
+	// claim), eg. with the client credentials grant.
+	ClientID string
+	// Claims contains every attribute of the payload the user info were extracted from.
+	Claims map[string]interface{}
+	// GroupsOverage is true when the identity provider signals that the groups
+	// were left out of the token because there are too many.
+	GroupsOverage bool
+}
+
+// GroupsResolver obtains the user groups out-of-band, when they are not all
+// present in the token.
+type GroupsResolver interface {
+	ResolveGroups(userInfo *UserInfo) ([]string, error)
+}
+
+// GroupsResolverFunc is an adapter to use ordinary functions as GroupsResolver.
+type GroupsResolverFunc func(userInfo *UserInfo) ([]string, error)
+
+// ResolveGroups calls f(userInfo).
+func (f GroupsResolverFunc) ResolveGroups(userInfo *UserInfo) ([]string, error) {
+	return f(userInfo)
 }
 
 // Authenticator is in charge of authenticating requests.
@@ -24,10 +61,17 @@ type Authenticator interface {
 	ValidateRequest(*http.Request) (*UserInfo, error)
 }
 
-var authenticators map[string]Authenticator
+var (
+	authenticators map[string]Authenticator
+	// authenticatorsOwners are the owners of the cached authenticators (see
+	// RetainAuthenticators).
+	authenticatorsOwners map[string]map[interface{}]bool
+	authenticatorsLock   sync.Mutex
+)
 
 func init() {
 	authenticators = map[string]Authenticator{}
+	authenticatorsOwners = map[string]map[interface{}]bool{}
 }
 
 // NewAuthenticator instantiates or reuses an existing one for the specified
@@ -36,12 +80,150 @@ func NewAuthenticator(idP string) (Authenticator, error) {
 	if !strings.HasPrefix(idP, "https://") {
 		return nil, fmt.Errorf("identify provider %q does not use the https:// scheme", idP)
 	}
+	authenticatorsLock.Lock()
+	defer authenticatorsLock.Unlock()
 	// Reuse authenticator instances.
 	a, ok := authenticators[idP]
 	if !ok {
-		// Only OpenID is currently supported.
-		a = newOpenIDAuthenticator(idP)
+		if strings.TrimRight(idP, "/") == KubernetesIssuer {
+			k, err := newKubernetesAuthenticator()
+			if err != nil {
+				return nil, err
+			}
+			a = k
+		} else {
+			v := newIdentityProviderAuthenticator(idP)
+			if JWKSRefreshInterval > 0 {
+				v.refreshJWKSInBackground(JWKSRefreshInterval)
+			}
+			a = v
+		}
 		authenticators[idP] = a
 	}
 	return a, nil
 }
+
+// AuthenticatorOptions are the settings of an identity provider authenticator
+// that are part of the services configuration, and can thus change when the
+// policies are reloaded.
+type AuthenticatorOptions struct {
+	// JWKSFile is a local file containing the public keys, read instead of
+	// fetching them from the issuer (eg. offline or air-gapped environments).
+	JWKSFile string
+	// JWKSURI is the location of the public keys, instead of the one of the
+	// issuer OpenID configuration.
+	JWKSURI string
+	// IssuerAliases are other accepted values of the `iss` claim.
+	IssuerAliases []string
+	// ClaimsNamespace is the URL prefix of the custom claims holding the email,
+	// groups and roles (eg. `https://example.com/` with Auth0).
+	ClaimsNamespace string
+	// SigningAlgorithms are the accepted signing algorithms of the tokens (eg.
+	// `ES256`), instead of the identity provider default one (`RS256`, or
+	// `ES256` with Cloud IAP). See SigningAlgorithms.
+	SigningAlgorithms []string
+}
+
+// key identifies the authenticators instances with the same options.
+func (o AuthenticatorOptions) key() string {
+	return o.JWKSFile + "#" + o.JWKSURI + "#" + strings.Join(o.IssuerAliases, ",") + "#" + o.ClaimsNamespace + "#" + strings.Join(o.SigningAlgorithms, ",")
+}
+
+// NewAuthenticatorWithJWKSFile instantiates or reuses an existing one for the
+// specified identity provider, that reads the public keys from a local JWKS file
+// instead of the issuer endpoints (eg. offline or air-gapped environments).
+func NewAuthenticatorWithJWKSFile(idP string, jwksFile string) (Authenticator, error) {
+	return NewAuthenticatorWithOptions(idP, AuthenticatorOptions{JWKSFile: jwksFile})
+}
+
+// NewAuthenticatorWithOptions instantiates or reuses an existing one for the
+// specified identity provider and options.
+func NewAuthenticatorWithOptions(idP string, options AuthenticatorOptions) (Authenticator, error) {
+	if options.key() == (AuthenticatorOptions{}).key() {
+		return NewAuthenticator(idP)
+	}
+	if options.JWKSURI != "" && !strings.HasPrefix(options.JWKSURI, "https://") {
+		return nil, fmt.Errorf("JWKS URI %q does not use the https:// scheme", options.JWKSURI)
+	}
+	// With a local file, keys are never fetched: the scheme of the issuer does not matter.
+	if options.JWKSFile == "" && !strings.HasPrefix(idP, "https://") {
+		return nil, fmt.Errorf("identify provider %q does not use the https:// scheme", idP)
+	}
+	algorithms, err := parseSigningAlgorithms(options.SigningAlgorithms)
+	if err != nil {
+		return nil, err
+	}
+	cacheKey := idP + "#" + options.key()
+	authenticatorsLock.Lock()
+	defer authenticatorsLock.Unlock()
+	a, ok := authenticators[cacheKey]
+	if !ok {
+		v := newIdentityProviderAuthenticator(idP)
+		v.JWKSFile = options.JWKSFile
+		if options.JWKSURI != "" {
+			v.JWKSUri = options.JWKSURI
+		}
+		v.IssuerAliases = append(v.IssuerAliases, options.IssuerAliases...)
+		if len(algorithms) > 0 {
+			v.SignatureAlgorithms = algorithms
+		}
+		if options.ClaimsNamespace != "" {
+			v.ClaimExtractor = newNamespacedClaimExtractor(options.ClaimsNamespace, v.ClaimExtractor)
+		}
+		if v.JWKSFile != "" {
+			// Fail early if the file is invalid.
+			if _, err := v.jwks(); err != nil {
+				return nil, err
+			}
+		}
+		if JWKSRefreshInterval > 0 {
+			v.refreshJWKSInBackground(JWKSRefreshInterval)
+		}
+		a = v
+		authenticators[cacheKey] = a
+	}
+	return a, nil
+}
+
+// RetainAuthenticators records the cached authenticators used by the owner
+// (eg. a doorman, once its policies are loaded). Those that the owner used
+// before and that no owner uses anymore are evicted from the cache, and the
+// refresh of their public keys is stopped.
+func RetainAuthenticators(owner interface{}, used []Authenticator) {
+	inUse := map[Authenticator]bool{}
+	for _, a := range used {
+		inUse[a] = true
+	}
+
+	authenticatorsLock.Lock()
+	defer authenticatorsLock.Unlock()
+	for key, a := range authenticators {
+		owners := authenticatorsOwners[key]
+		if inUse[a] {
+			if owners == nil {
+				owners = map[interface{}]bool{}
+				authenticatorsOwners[key] = owners
+			}
+			owners[owner] = true
+			continue
+		}
+		if !owners[owner] {
+			continue
+		}
+		delete(owners, owner)
+		if len(owners) == 0 {
+			delete(authenticators, key)
+			delete(authenticatorsOwners, key)
+			if v, ok := a.(*openIDAuthenticator); ok {
+				v.stopRefresh()
+			}
+		}
+	}
+}
+
+func newIdentityProviderAuthenticator(idP string) *openIDAuthenticator {
+	if strings.TrimRight(idP, "/") == IAPIssuer {
+		return newIAPAuthenticator()
+	}
+	return newOpenIDAuthenticator(idP)
+}
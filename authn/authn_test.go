@@ -2,6 +2,7 @@ package authn
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -21,4 +22,78 @@ func TestNewAuthenticator(t *testing.T) {
 	other, err := NewAuthenticator("https://auth1.com")
 	require.Nil(t, err)
 	assert.NotEqual(t, authn1, other)
+
+	iap, err := NewAuthenticator("https://cloud.google.com/iap")
+	require.Nil(t, err)
+	assert.Equal(t, IAPHeader, iap.(*openIDAuthenticator).TokenHeader)
+}
+
+func TestNewAuthenticatorWithOptions(t *testing.T) {
+	// Without options, authenticators are shared.
+	a, err := NewAuthenticatorWithOptions("https://auth0.com", AuthenticatorOptions{})
+	require.Nil(t, err)
+	shared, _ := NewAuthenticator("https://auth0.com")
+	assert.Equal(t, shared, a)
+
+	_, err = NewAuthenticatorWithOptions("https://auth0.com", AuthenticatorOptions{JWKSURI: "http://auth0.com/keys"})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "https:// scheme")
+	_, err = NewAuthenticatorWithOptions("http://auth0.com", AuthenticatorOptions{JWKSURI: "https://auth0.com/keys"})
+	require.NotNil(t, err)
+
+	options := AuthenticatorOptions{
+		JWKSURI:       "https://auth0.com/keys",
+		IssuerAliases: []string{"auth0.com"},
+	}
+	a, err = NewAuthenticatorWithOptions("https://auth0.com", options)
+	require.Nil(t, err)
+	assert.NotEqual(t, shared, a)
+	v := a.(*openIDAuthenticator)
+	assert.Equal(t, "https://auth0.com/keys", v.JWKSUri)
+	assert.Equal(t, []string{"auth0.com"}, v.IssuerAliases)
+	assert.True(t, v.acceptsIssuer("auth0.com"))
+
+	// Instances are reused with the same options, and replaced when they change
+	// (eg. on policies reload).
+	same, _ := NewAuthenticatorWithOptions("https://auth0.com", options)
+	assert.Equal(t, a, same)
+	options.IssuerAliases = []string{"auth0.com", "login.auth0.com"}
+	changed, _ := NewAuthenticatorWithOptions("https://auth0.com", options)
+	assert.NotEqual(t, a, changed)
+
+	namespaced, _ := NewAuthenticatorWithOptions("https://auth0.com", AuthenticatorOptions{ClaimsNamespace: "https://example.com/"})
+	assert.IsType(t, &namespacedClaimExtractor{}, namespaced.(*openIDAuthenticator).ClaimExtractor)
+
+	// Default aliases are kept.
+	g, _ := NewAuthenticatorWithOptions(GoogleIssuer, AuthenticatorOptions{IssuerAliases: []string{"google.com"}})
+	assert.Equal(t, []string{"accounts.google.com", "google.com"}, g.(*openIDAuthenticator).IssuerAliases)
+}
+
+func TestRetainAuthenticators(t *testing.T) {
+	defer func(d time.Duration) { JWKSRefreshInterval = d }(JWKSRefreshInterval)
+	JWKSRefreshInterval = time.Hour
+
+	a, _ := NewAuthenticator("https://retain.auth0.com")
+	b, _ := NewAuthenticator("https://retain.auth1.com")
+	RetainAuthenticators("doorman", []Authenticator{a, b})
+	RetainAuthenticators("standby", []Authenticator{b})
+
+	// Still used by the other owner.
+	RetainAuthenticators("doorman", []Authenticator{a})
+	same, _ := NewAuthenticator("https://retain.auth1.com")
+	assert.True(t, b == same)
+
+	// Not used anymore: evicted and stopped.
+	RetainAuthenticators("standby", nil)
+	renewed, _ := NewAuthenticator("https://retain.auth1.com")
+	assert.False(t, b == renewed)
+	assert.Nil(t, b.(*openIDAuthenticator).refreshStop)
+	assert.NotNil(t, renewed.(*openIDAuthenticator).refreshStop)
+
+	// Never retained: kept.
+	RetainAuthenticators("doorman", nil)
+	same, _ = NewAuthenticator("https://retain.auth1.com")
+	assert.True(t, renewed == same)
+	renewed, _ = NewAuthenticator("https://retain.auth0.com")
+	assert.False(t, a == renewed)
 }
@@ -0,0 +1,98 @@
+package authn
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// AzureAllowedTenants are the Azure AD tenants IDs accepted by the multi-tenant
+// identity providers (eg. `https://login.microsoftonline.com/common/v2.0`).
+// It must be set before serving requests.
+var AzureAllowedTenants []string
+
+// azureIssuerRegexp matches the v1 (`https://sts.windows.net/{tid}/`) and
+// v2 (`https://login.microsoftonline.com/{tid}/v2.0`) issuers formats.
+var azureIssuerRegexp = regexp.MustCompile(`^https://(?:sts\.windows\.net/([^/]+)/|login\.microsoftonline\.com/([^/]+)/v2\.0/?)$`)
+
+// azureMultiTenants are the endpoints that accept users from any tenant.
+var azureMultiTenants = map[string]bool{
+	"common":        true,
+	"organizations": true,
+	"consumers":     true,
+}
+
+// azureTenant returns the tenant of an Azure AD issuer.
+func azureTenant(issuer string) (string, bool) {
+	m := azureIssuerRegexp.FindStringSubmatch(issuer)
+	if m == nil {
+		return "", false
+	}
+	return m[1] + m[2], true
+}
+
+// isAzureIssuer accepts the v1 and v2 issuers formats, the tenant is verified
+// against the `tid` claim by the extractor.
+func isAzureIssuer(issuer string) bool {
+	tenant, ok := azureTenant(issuer)
+	return ok && !azureMultiTenants[tenant]
+}
+
+// azureClaims are the Azure AD specific attributes.
+type azureClaims struct {
+	Issuer            string   `json:"iss"`
+	TenantID          string   `json:"tid"`
+	PreferredUsername string   `json:"preferred_username"`
+	UPN               string   `json:"upn"`
+	Roles             []string `json:"roles"`
+}
+
+type azureClaimExtractor struct {
+	// tenant is the tenant of the identity provider (eg. `common` or a tenant ID).
+	tenant string
+}
+
+// Extract verifies that the user belongs to an allowed tenant, and reads the
+// app roles and groups objects IDs.
+func (e *azureClaimExtractor) Extract(payload []byte) (*UserInfo, error) {
+	userInfo, err := defaultExtractor.Extract(payload)
+	if err != nil {
+		return nil, err
+	}
+	var claims = &azureClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, errors.Wrap(err, "failed to parse Azure AD claims from payload")
+	}
+
+	if claims.TenantID == "" {
+		return nil, fmt.Errorf("missing tid claim")
+	}
+	// When present (ie. not from userinfo endpoint), the issuer must be the one of the tenant.
+	if claims.Issuer != "" {
+		if tenant, _ := azureTenant(claims.Issuer); tenant != claims.TenantID {
+			return nil, fmt.Errorf("issuer %q does not match tenant %q", claims.Issuer, claims.TenantID)
+		}
+	}
+	allowed := []string{e.tenant}
+	if azureMultiTenants[e.tenant] {
+		allowed = AzureAllowedTenants
+	}
+	found := false
+	for _, tenant := range allowed {
+		found = found || tenant == claims.TenantID
+	}
+	if !found {
+		return nil, fmt.Errorf("tenant %q is not allowed", claims.TenantID)
+	}
+
+	if userInfo.Email == "" {
+		userInfo.Email = claims.PreferredUsername
+	}
+	if userInfo.Email == "" {
+		userInfo.Email = claims.UPN
+	}
+	userInfo.Roles = append(userInfo.Roles, claims.Roles...)
+	return userInfo, nil
+}
@@ -0,0 +1,104 @@
+package authn
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tenantID = "9188040d-6c67-4c5b-b112-36a304b66dad"
+
+func TestAzureTenant(t *testing.T) {
+	tenant, ok := azureTenant("https://login.microsoftonline.com/common/v2.0")
+	assert.True(t, ok)
+	assert.Equal(t, "common", tenant)
+	tenant, ok = azureTenant("https://sts.windows.net/" + tenantID + "/")
+	assert.True(t, ok)
+	assert.Equal(t, tenantID, tenant)
+	_, ok = azureTenant("https://login.microsoftonline.com.evil.com/abc/v2.0")
+	assert.False(t, ok)
+
+	assert.True(t, isAzureIssuer("https://login.microsoftonline.com/"+tenantID+"/v2.0"))
+	assert.False(t, isAzureIssuer("https://login.microsoftonline.com/common/v2.0"))
+}
+
+func TestAzureClaimsExtractor(t *testing.T) {
+	extractor := &azureClaimExtractor{tenant: tenantID}
+
+	userinfo, err := extractor.Extract([]byte(`{
+		"iss": "https://login.microsoftonline.com/` + tenantID + `/v2.0",
+		"tid": "` + tenantID + `",
+		"sub": "abc",
+		"preferred_username": "ada@lau.co",
+		"roles": ["Task.Write"],
+		"groups": ["e6c2d7b8-0f4a-4d8e-9b1a-3c5d7e9f1a2b"]
+	}`))
+	require.Nil(t, err)
+	assert.Equal(t, "ada@lau.co", userinfo.Email)
+	assert.Equal(t, []string{"Task.Write"}, userinfo.Roles)
+	assert.Equal(t, []string{"e6c2d7b8-0f4a-4d8e-9b1a-3c5d7e9f1a2b"}, userinfo.Groups)
+
+	// v1 issuer format, upn.
+	userinfo, err = extractor.Extract([]byte(`{"iss": "https://sts.windows.net/` + tenantID + `/", "tid": "` + tenantID + `", "upn": "ada@lau.co"}`))
+	require.Nil(t, err)
+	assert.Equal(t, "ada@lau.co", userinfo.Email)
+
+	// Other tenant.
+	_, err = extractor.Extract([]byte(`{"iss": "https://sts.windows.net/other/", "tid": "other"}`))
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "tenant \"other\" is not allowed")
+
+	// Issuer of another tenant.
+	_, err = extractor.Extract([]byte(`{"iss": "https://sts.windows.net/other/", "tid": "` + tenantID + `"}`))
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "does not match tenant")
+
+	// Missing tenant.
+	_, err = extractor.Extract([]byte(`{"sub": "abc"}`))
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "missing tid claim")
+
+	// Multi-tenant.
+	defer func(tenants []string) { AzureAllowedTenants = tenants }(AzureAllowedTenants)
+	extractor = &azureClaimExtractor{tenant: "common"}
+	AzureAllowedTenants = nil
+	_, err = extractor.Extract([]byte(`{"tid": "` + tenantID + `"}`))
+	require.NotNil(t, err)
+	AzureAllowedTenants = []string{"other", tenantID}
+	_, err = extractor.Extract([]byte(`{"tid": "` + tenantID + `"}`))
+	require.Nil(t, err)
+}
+
+func TestAzureIDToken(t *testing.T) {
+	defer func(tenants []string) { AzureAllowedTenants = tenants }(AzureAllowedTenants)
+	AzureAllowedTenants = []string{tenantID}
+
+	v := newOpenIDAuthenticator("https://login.microsoftonline.com/organizations/v2.0")
+	private, _ := rsa.GenerateKey(rand.Reader, 2048)
+	claims := map[string]interface{}{
+		"iss":   "https://sts.windows.net/" + tenantID + "/",
+		"tid":   tenantID,
+		"aud":   "api://doorman",
+		"sub":   "abc",
+		"roles": []string{"Admin"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "api://doorman")
+	r.Header.Set("Authorization", "Bearer "+signToken(t, v, private, &private.PublicKey, claims))
+	userinfo, err := v.ValidateRequest(r)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"Admin"}, userinfo.Roles)
+
+	// Not an Azure issuer.
+	claims["iss"] = "https://evil.com/" + tenantID + "/"
+	r.Header.Set("Authorization", "Bearer "+signToken(t, v, private, &private.PublicKey, claims))
+	_, err = v.ValidateRequest(r)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid issuer claim")
+}
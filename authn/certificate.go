@@ -0,0 +1,80 @@
+package authn
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+)
+
+// certificateAuthenticator authenticates the requests with the verified TLS
+// client certificate, when the server terminates TLS.
+type certificateAuthenticator struct {
+	next Authenticator
+}
+
+// NewCertificateAuthenticator returns an authenticator that reads the identity
+// of the client certificate. If the request has credentials and next is not
+// nil, they are validated with next, and the certificate identity is added to
+// the user info.
+func NewCertificateAuthenticator(next Authenticator) Authenticator {
+	return &certificateAuthenticator{next: next}
+}
+
+func (a *certificateAuthenticator) ValidateRequest(r *http.Request) (*UserInfo, error) {
+	cert := clientCertificate(r)
+	hasCredentials := r.Header.Get("Authorization") != "" || r.Header.Get(APIKeyHeader) != ""
+	if a.next != nil && (hasCredentials || cert == nil) {
+		userInfo, err := a.next.ValidateRequest(r)
+		if err != nil {
+			return nil, err
+		}
+		if cert == nil {
+			return userInfo, nil
+		}
+		// Authenticators may cache the user info: do not modify it.
+		copied := *userInfo
+		copied.Certificate, copied.SPIFFEID = certificateIdentity(cert)
+		return &copied, nil
+	}
+	if cert == nil {
+		return nil, fmt.Errorf("client certificate not found")
+	}
+	return CertificateIdentity(cert)
+}
+
+// CertificateIdentity returns the user info of a verified client certificate.
+// Since certificates are held by workloads, the user ID is left empty.
+func CertificateIdentity(cert *x509.Certificate) (*UserInfo, error) {
+	commonName, spiffeID := certificateIdentity(cert)
+	if commonName == "" && spiffeID == "" {
+		return nil, fmt.Errorf("client certificate without common name nor SPIFFE ID")
+	}
+	return &UserInfo{
+		Certificate: commonName,
+		SPIFFEID:    spiffeID,
+		Claims: map[string]interface{}{
+			"subject": cert.Subject.String(),
+		},
+	}, nil
+}
+
+// certificateIdentity returns the subject common name and the `spiffe://` URI
+// SAN of the certificate.
+func certificateIdentity(cert *x509.Certificate) (string, string) {
+	spiffeID := ""
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			spiffeID = uri.String()
+			break
+		}
+	}
+	return cert.Subject.CommonName, spiffeID
+}
+
+// clientCertificate returns the client certificate if it was verified by the server.
+func clientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
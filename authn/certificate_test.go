@@ -0,0 +1,86 @@
+package authn
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func requestWithCertificate(cert *x509.Certificate) *http.Request {
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.TLS = &tls.ConnectionState{}
+	if cert != nil {
+		r.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	}
+	return r
+}
+
+func TestCertificateAuthenticator(t *testing.T) {
+	spiffeID, _ := url.Parse("spiffe://example.org/ns/prod/sa/billing")
+	cert := &x509.Certificate{
+		Subject: pkix.Name{CommonName: "billing", Organization: []string{"Example"}},
+		URIs:    []*url.URL{spiffeID},
+	}
+	a := NewCertificateAuthenticator(nil)
+
+	userInfo, err := a.ValidateRequest(requestWithCertificate(cert))
+	require.Nil(t, err)
+	assert.Equal(t, "", userInfo.ID)
+	assert.Equal(t, "billing", userInfo.Certificate)
+	assert.Equal(t, "spiffe://example.org/ns/prod/sa/billing", userInfo.SPIFFEID)
+	assert.Equal(t, "CN=billing,O=Example", userInfo.Claims["subject"])
+
+	// Certificates without common name nor SPIFFE ID.
+	_, err = a.ValidateRequest(requestWithCertificate(&x509.Certificate{}))
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "without common name")
+
+	// Unverified certificates are ignored.
+	r := requestWithCertificate(nil)
+	r.TLS.PeerCertificates = []*x509.Certificate{cert}
+	_, err = a.ValidateRequest(r)
+	require.NotNil(t, err)
+	assert.Equal(t, "client certificate not found", err.Error())
+}
+
+func TestCertificateAuthenticatorWithTokens(t *testing.T) {
+	tokenUserInfo := &UserInfo{ID: "ada"}
+	a := NewCertificateAuthenticator(&fixedAuthenticator{userInfo: tokenUserInfo})
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}}
+
+	// Token only.
+	r := requestWithCertificate(nil)
+	r.Header.Set("Authorization", "Bearer abc")
+	userInfo, err := a.ValidateRequest(r)
+	require.Nil(t, err)
+	assert.Equal(t, tokenUserInfo, userInfo)
+
+	// Token and certificate.
+	r = requestWithCertificate(cert)
+	r.Header.Set("Authorization", "Bearer abc")
+	userInfo, err = a.ValidateRequest(r)
+	require.Nil(t, err)
+	assert.Equal(t, "ada", userInfo.ID)
+	assert.Equal(t, "billing", userInfo.Certificate)
+	assert.Equal(t, "", tokenUserInfo.Certificate)
+
+	// Certificate only.
+	userInfo, err = a.ValidateRequest(requestWithCertificate(cert))
+	require.Nil(t, err)
+	assert.Equal(t, "", userInfo.ID)
+	assert.Equal(t, "billing", userInfo.Certificate)
+
+	// Invalid token.
+	failing := &fixedAuthenticator{message: "invalid token"}
+	r = requestWithCertificate(cert)
+	r.Header.Set("Authorization", "Bearer abc")
+	_, err = NewCertificateAuthenticator(failing).ValidateRequest(r)
+	require.NotNil(t, err)
+	assert.Equal(t, "invalid token", err.Error())
+}
@@ -2,6 +2,8 @@ package authn
 
 import (
 	"encoding/json"
+	"strings"
+
 	"github.com/pkg/errors"
 )
 
@@ -26,11 +28,59 @@ func (*defaultClaimExtractor) Extract(payload []byte) (*UserInfo, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to parse user info from payload")
 	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, errors.Wrap(err, "failed to parse claims from payload")
+	}
 	return &UserInfo{
-		ID:     claims.Subject,
-		Email:  claims.Email,
-		Groups: claims.Groups,
+		ID:             claims.Subject,
+		Email:          claims.Email,
+		Groups:         claims.Groups,
+		Claims:         raw,
+		GroupsOverage:  groupsOverage(raw),
+		ServiceAccount: kubernetesServiceAccount(raw),
+		Scopes:         scopes(raw),
+		ClientID:       clientID(raw),
 	}, nil
 }
 
+// scopes reads the token scopes, from the space separated `scope` claim (RFC 8693)
+// or the `scp` claim, which is a list with some identity providers (eg. Okta).
+func scopes(raw map[string]interface{}) []string {
+	for _, name := range []string{"scope", "scp"} {
+		switch v := raw[name].(type) {
+		case string:
+			return strings.Fields(v)
+		case []interface{}:
+			return stringsClaim(v)
+		}
+	}
+	return nil
+}
+
+// clientID reads the OAuth client of the token, from the `azp` (authorized party)
+// or `client_id` claim (RFC 9068).
+func clientID(raw map[string]interface{}) string {
+	for _, name := range []string{"azp", "client_id"} {
+		if id, ok := raw[name].(string); ok && id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// groupsOverage detects the claims signaling that groups were left out of the
+// token (eg. `hasgroups` or `_claim_names` with Azure AD).
+func groupsOverage(raw map[string]interface{}) bool {
+	if hasGroups, ok := raw["hasgroups"].(bool); ok && hasGroups {
+		return true
+	}
+	if names, ok := raw["_claim_names"].(map[string]interface{}); ok {
+		if _, ok := names["groups"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
 var defaultExtractor = &defaultClaimExtractor{}
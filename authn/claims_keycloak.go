@@ -0,0 +1,43 @@
+package authn
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// keycloakClaims is a specific struct to extract the realm and clients roles
+// from Keycloak tokens.
+type keycloakClaims struct {
+	RealmAccess struct {
+		Roles []string `json:"roles"`
+	} `json:"realm_access"`
+	ResourceAccess map[string]struct {
+		Roles []string `json:"roles"`
+	} `json:"resource_access"`
+}
+
+type keycloakClaimExtractor struct{}
+
+// Extract reads the standard claims, and the Keycloak roles. Realm roles are
+// returned as is, and clients roles are prefixed with the client ID (eg. `account:view-profile`).
+func (*keycloakClaimExtractor) Extract(payload []byte) (*UserInfo, error) {
+	userInfo, err := defaultExtractor.Extract(payload)
+	if err != nil {
+		return nil, err
+	}
+	var claims = &keycloakClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, errors.Wrap(err, "failed to parse Keycloak roles from payload")
+	}
+	userInfo.Roles = append(userInfo.Roles, claims.RealmAccess.Roles...)
+	for client, access := range claims.ResourceAccess {
+		for _, role := range access.Roles {
+			userInfo.Roles = append(userInfo.Roles, fmt.Sprintf("%s:%s", client, role))
+		}
+	}
+	return userInfo, nil
+}
+
+var keycloakExtractor = &keycloakClaimExtractor{}
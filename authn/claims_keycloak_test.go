@@ -0,0 +1,31 @@
+package authn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeycloakClaimsExtractor(t *testing.T) {
+	data := []byte(`<"sub"`)
+	_, err := keycloakExtractor.Extract(data)
+	require.NotNil(t, err)
+
+	data = []byte(`{
+		"sub": "f1e5c1b2",
+		"email": "m@mozilla.com",
+		"realm_access": {"roles": ["admin", "offline_access"]},
+		"resource_access": {"account": {"roles": ["view-profile"]}}
+	}`)
+	userinfo, err := keycloakExtractor.Extract(data)
+	require.Nil(t, err)
+	assert.Equal(t, "f1e5c1b2", userinfo.ID)
+	assert.Equal(t, "m@mozilla.com", userinfo.Email)
+	assert.Equal(t, []string{"admin", "offline_access", "account:view-profile"}, userinfo.Roles)
+
+	// No roles.
+	userinfo, err = keycloakExtractor.Extract([]byte(`{"sub": "f1e5c1b2"}`))
+	require.Nil(t, err)
+	assert.Empty(t, userinfo.Roles)
+}
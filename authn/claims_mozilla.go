@@ -31,10 +31,17 @@ func (*mozillaClaimExtractor) Extract(payload []byte) (*UserInfo, error) {
 		email = userInfo.Emails[0]
 	}
 
+	var raw map[string]interface{}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, errors.Wrap(err, "failed to parse Mozilla claims from payload")
+	}
+
 	return &UserInfo{
-		ID:     userInfo.Subject,
-		Email:  email,
-		Groups: userInfo.Groups,
+		ID:            userInfo.Subject,
+		Email:         email,
+		Groups:        userInfo.Groups,
+		Claims:        raw,
+		GroupsOverage: groupsOverage(raw),
 	}, nil
 }
 
@@ -0,0 +1,49 @@
+package authn
+
+import (
+	"strings"
+)
+
+// namespacedClaimExtractor reads the user info from custom claims under a URL
+// namespace (eg. `https://example.com/groups`), like Auth0 forces for the
+// claims added by rules. The standard claims have precedence.
+type namespacedClaimExtractor struct {
+	namespace string
+	extractor claimExtractor
+}
+
+func newNamespacedClaimExtractor(namespace string, extractor claimExtractor) *namespacedClaimExtractor {
+	if !strings.HasSuffix(namespace, "/") {
+		namespace += "/"
+	}
+	return &namespacedClaimExtractor{namespace: namespace, extractor: extractor}
+}
+
+func (e *namespacedClaimExtractor) Extract(payload []byte) (*UserInfo, error) {
+	userInfo, err := e.extractor.Extract(payload)
+	if err != nil {
+		return nil, err
+	}
+	if email, ok := userInfo.Claims[e.namespace+"email"].(string); ok && userInfo.Email == "" {
+		userInfo.Email = email
+	}
+	if len(userInfo.Groups) == 0 {
+		userInfo.Groups = stringsClaim(userInfo.Claims[e.namespace+"groups"])
+	}
+	if len(userInfo.Roles) == 0 {
+		userInfo.Roles = stringsClaim(userInfo.Claims[e.namespace+"roles"])
+	}
+	return userInfo, nil
+}
+
+// stringsClaim returns the strings of a list claim value.
+func stringsClaim(value interface{}) []string {
+	values, _ := value.([]interface{})
+	var result []string
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,43 @@
+package authn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespacedClaimsExtractor(t *testing.T) {
+	extractor := newNamespacedClaimExtractor("https://example.com", defaultExtractor)
+
+	_, err := extractor.Extract([]byte(`<"sub"`))
+	require.NotNil(t, err)
+
+	userinfo, err := extractor.Extract([]byte(`{
+		"sub": "auth0|ada",
+		"https://example.com/email": "ada@example.com",
+		"https://example.com/groups": ["admins", 42],
+		"https://example.com/roles": ["editor"]
+	}`))
+	require.Nil(t, err)
+	assert.Equal(t, "auth0|ada", userinfo.ID)
+	assert.Equal(t, "ada@example.com", userinfo.Email)
+	assert.Equal(t, []string{"admins"}, userinfo.Groups)
+	assert.Equal(t, []string{"editor"}, userinfo.Roles)
+
+	// Standard claims have precedence.
+	userinfo, err = extractor.Extract([]byte(`{
+		"sub": "auth0|ada",
+		"email": "ada@lau.co",
+		"groups": ["scientists"],
+		"https://example.com/email": "ada@example.com",
+		"https://example.com/groups": ["admins"]
+	}`))
+	require.Nil(t, err)
+	assert.Equal(t, "ada@lau.co", userinfo.Email)
+	assert.Equal(t, []string{"scientists"}, userinfo.Groups)
+
+	// Other namespaces are ignored.
+	userinfo, _ = extractor.Extract([]byte(`{"sub": "auth0|ada", "https://other.com/groups": ["admins"]}`))
+	assert.Empty(t, userinfo.Groups)
+}
@@ -16,4 +16,36 @@ func TestDefaultClaimsExtractor(t *testing.T) {
 	userinfo, err := defaultExtractor.Extract(data)
 	require.Nil(t, err)
 	assert.Equal(t, "google-oauth2|104102306111350576628", userinfo.ID)
+	assert.Equal(t, "google-oauth2|104102306111350576628", userinfo.Claims["sub"])
+}
+
+func TestGroupsOverage(t *testing.T) {
+	userinfo, err := defaultExtractor.Extract([]byte(`{"sub":"abc","groups":["a"]}`))
+	require.Nil(t, err)
+	assert.False(t, userinfo.GroupsOverage)
+
+	userinfo, _ = defaultExtractor.Extract([]byte(`{"sub":"abc","hasgroups":true}`))
+	assert.True(t, userinfo.GroupsOverage)
+
+	userinfo, _ = defaultExtractor.Extract([]byte(`{
+		"sub": "abc",
+		"_claim_names": {"groups": "src1"},
+		"_claim_sources": {"src1": {"endpoint": "https://graph.windows.net/abc/users/def/getMemberObjects"}}
+	}`))
+	assert.True(t, userinfo.GroupsOverage)
+}
+
+func TestClientCredentialsClaims(t *testing.T) {
+	userinfo, err := defaultExtractor.Extract([]byte(`{"sub":"billing@clients","azp":"billing","scope":"read:invoices write:invoices"}`))
+	require.Nil(t, err)
+	assert.Equal(t, "billing", userinfo.ClientID)
+	assert.Equal(t, []string{"read:invoices", "write:invoices"}, userinfo.Scopes)
+
+	userinfo, _ = defaultExtractor.Extract([]byte(`{"sub":"abc","client_id":"billing","scp":["read","write"]}`))
+	assert.Equal(t, "billing", userinfo.ClientID)
+	assert.Equal(t, []string{"read", "write"}, userinfo.Scopes)
+
+	userinfo, _ = defaultExtractor.Extract([]byte(`{"sub":"abc"}`))
+	assert.Equal(t, "", userinfo.ClientID)
+	assert.Nil(t, userinfo.Scopes)
 }
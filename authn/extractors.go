@@ -0,0 +1,77 @@
+package authn
+
+import (
+	"net/http"
+	"strings"
+)
+
+// TokenExtractor reads the token of a request from elsewhere than the
+// `Authorization` header. It returns an empty string if not found.
+type TokenExtractor func(r *http.Request) string
+
+// TokenFromCookie reads the token from the specified cookie (eg. browser apps).
+func TokenFromCookie(name string) TokenExtractor {
+	return func(r *http.Request) string {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}
+}
+
+// TokenFromQuery reads the token from the specified querystring parameter (eg.
+// `access_token` for WebSocket handshakes, where headers cannot be set).
+func TokenFromQuery(param string) TokenExtractor {
+	return func(r *http.Request) string {
+		return r.URL.Query().Get(param)
+	}
+}
+
+// TokenFromHeader reads the token from the specified header, with or without
+// the `Bearer` prefix.
+func TokenFromHeader(name string) TokenExtractor {
+	return func(r *http.Request) string {
+		value := r.Header.Get(name)
+		if len(value) > 7 && strings.EqualFold(value[0:7], "BEARER ") {
+			return value[7:]
+		}
+		return value
+	}
+}
+
+// tokenExtractorAuthenticator submits the token found by the extractors to
+// the authenticator as if it was sent in the `Authorization` header.
+type tokenExtractorAuthenticator struct {
+	next       Authenticator
+	extractors []TokenExtractor
+}
+
+// NewTokenExtractorAuthenticator returns an authenticator that reads the token
+// with the extractors, in order, when the request has no `Authorization` header.
+func NewTokenExtractorAuthenticator(next Authenticator, extractors ...TokenExtractor) Authenticator {
+	if len(extractors) == 0 {
+		return next
+	}
+	return &tokenExtractorAuthenticator{next: next, extractors: extractors}
+}
+
+func (a *tokenExtractorAuthenticator) ValidateRequest(r *http.Request) (*UserInfo, error) {
+	if r.Header.Get("Authorization") != "" {
+		return a.next.ValidateRequest(r)
+	}
+	for _, extractor := range a.extractors {
+		if token := extractor(r); token != "" {
+			original := r
+			r = new(http.Request)
+			*r = *original
+			r.Header = http.Header{}
+			for k, v := range original.Header {
+				r.Header[k] = v
+			}
+			r.Header.Set("Authorization", "Bearer "+token)
+			break
+		}
+	}
+	return a.next.ValidateRequest(r)
+}
@@ -0,0 +1,60 @@
+package authn
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// authorizationAuthenticator returns the Authorization header as user ID.
+type authorizationAuthenticator struct{}
+
+func (a *authorizationAuthenticator) ValidateRequest(r *http.Request) (*UserInfo, error) {
+	return &UserInfo{ID: r.Header.Get("Authorization")}, nil
+}
+
+func TestTokenExtractors(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/ws?access_token=abc", nil)
+	r.AddCookie(&http.Cookie{Name: "session", Value: "def"})
+	r.Header.Set("X-Auth-Token", "Bearer ghi")
+
+	assert.Equal(t, "abc", TokenFromQuery("access_token")(r))
+	assert.Equal(t, "", TokenFromQuery("token")(r))
+	assert.Equal(t, "def", TokenFromCookie("session")(r))
+	assert.Equal(t, "", TokenFromCookie("token")(r))
+	assert.Equal(t, "ghi", TokenFromHeader("X-Auth-Token")(r))
+	r.Header.Set("X-Auth-Token", "jkl")
+	assert.Equal(t, "jkl", TokenFromHeader("X-Auth-Token")(r))
+}
+
+func TestTokenExtractorAuthenticator(t *testing.T) {
+	next := &authorizationAuthenticator{}
+	assert.Equal(t, next, NewTokenExtractorAuthenticator(next))
+
+	a := NewTokenExtractorAuthenticator(next, TokenFromCookie("session"), TokenFromQuery("access_token"))
+
+	// First extractor that finds a token wins.
+	r, _ := http.NewRequest("GET", "/ws?access_token=abc", nil)
+	r.AddCookie(&http.Cookie{Name: "session", Value: "def"})
+	userInfo, err := a.ValidateRequest(r)
+	require.Nil(t, err)
+	assert.Equal(t, "Bearer def", userInfo.ID)
+	// The original request is left intact.
+	assert.Equal(t, "", r.Header.Get("Authorization"))
+
+	r, _ = http.NewRequest("GET", "/ws?access_token=abc", nil)
+	userInfo, _ = a.ValidateRequest(r)
+	assert.Equal(t, "Bearer abc", userInfo.ID)
+
+	// The Authorization header has precedence.
+	r.Header.Set("Authorization", "Bearer xyz")
+	userInfo, _ = a.ValidateRequest(r)
+	assert.Equal(t, "Bearer xyz", userInfo.ID)
+
+	// No token.
+	r, _ = http.NewRequest("GET", "/", nil)
+	userInfo, _ = a.ValidateRequest(r)
+	assert.Equal(t, "", userInfo.ID)
+}
@@ -0,0 +1,59 @@
+package authn
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// GoogleIssuer is the issuer of Google ID tokens.
+const GoogleIssuer = "https://accounts.google.com"
+
+// IAPIssuer is the issuer of the Google Cloud Identity-Aware Proxy assertions.
+const IAPIssuer = "https://cloud.google.com/iap"
+
+// IAPHeader is the request header where Cloud IAP sends its signed assertion.
+const IAPHeader = "X-Goog-IAP-JWT-Assertion"
+
+// iapJWKSUri is the location of the Cloud IAP public keys.
+const iapJWKSUri = "https://www.gstatic.com/iap/verify/public_key-jwk"
+
+// newIAPAuthenticator returns a validator of the Cloud IAP assertions. The
+// assertion audience (eg. `/projects/{number}/apps/{id}`) must match the service.
+func newIAPAuthenticator() *openIDAuthenticator {
+	a := newOpenIDAuthenticator(IAPIssuer)
+	a.SignatureAlgorithms = []jose.SignatureAlgorithm{jose.ES256}
+	a.JWKSUri = iapJWKSUri
+	a.TokenHeader = IAPHeader
+	a.ClaimExtractor = googleExtractor
+	return a
+}
+
+// googleClaims are the Google specific attributes.
+type googleClaims struct {
+	EmailVerified *bool  `json:"email_verified"`
+	HostedDomain  string `json:"hd"`
+}
+
+type googleClaimExtractor struct{}
+
+// Extract reads the standard claims and the G Suite hosted domain. Unverified
+// emails are ignored.
+func (*googleClaimExtractor) Extract(payload []byte) (*UserInfo, error) {
+	userInfo, err := defaultExtractor.Extract(payload)
+	if err != nil {
+		return nil, err
+	}
+	var claims = &googleClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, errors.Wrap(err, "failed to parse Google claims from payload")
+	}
+	if claims.EmailVerified != nil && !*claims.EmailVerified {
+		userInfo.Email = ""
+	}
+	userInfo.Domain = claims.HostedDomain
+	return userInfo, nil
+}
+
+var googleExtractor = &googleClaimExtractor{}
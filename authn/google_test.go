@@ -0,0 +1,114 @@
+package authn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	jose "gopkg.in/square/go-jose.v2"
+	jwt "gopkg.in/square/go-jose.v2/jwt"
+)
+
+// signToken returns a signed JWT, and caches the public key in the validator.
+func signToken(t *testing.T, v *openIDAuthenticator, private interface{}, public interface{}, claims interface{}) string {
+	key := jose.SigningKey{Algorithm: v.SignatureAlgorithms[0], Key: private}
+	signer, err := jose.NewSigner(key, (&jose.SignerOptions{}).WithHeader("kid", "key1"))
+	require.Nil(t, err)
+	token, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	require.Nil(t, err)
+
+	jwks, _ := json.Marshal(publicKeys{Keys: []jose.JSONWebKey{{Key: public, KeyID: "key1"}}})
+	v.cache.Set("jwks:"+v.Issuer, jwks)
+	return token
+}
+
+func TestGoogleClaimsExtractor(t *testing.T) {
+	_, err := googleExtractor.Extract([]byte(`<"sub"`))
+	require.NotNil(t, err)
+
+	userinfo, err := googleExtractor.Extract([]byte(`{"sub":"1234","email":"ada@lau.co","email_verified":true,"hd":"lau.co"}`))
+	require.Nil(t, err)
+	assert.Equal(t, "1234", userinfo.ID)
+	assert.Equal(t, "ada@lau.co", userinfo.Email)
+	assert.Equal(t, "lau.co", userinfo.Domain)
+
+	// Unverified email.
+	userinfo, _ = googleExtractor.Extract([]byte(`{"sub":"1234","email":"ada@lau.co","email_verified":false}`))
+	assert.Equal(t, "", userinfo.Email)
+	assert.Equal(t, "", userinfo.Domain)
+}
+
+func TestGoogleIDToken(t *testing.T) {
+	v := newOpenIDAuthenticator(GoogleIssuer)
+	assert.Equal(t, googleExtractor, v.ClaimExtractor)
+
+	private, _ := rsa.GenerateKey(rand.Reader, 2048)
+	token := signToken(t, v, private, &private.PublicKey, map[string]interface{}{
+		"iss":   "accounts.google.com",
+		"aud":   "client-id.apps.googleusercontent.com",
+		"sub":   "1234",
+		"email": "ada@lau.co",
+		"hd":    "lau.co",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "client-id.apps.googleusercontent.com")
+	r.Header.Set("Authorization", "Bearer "+token)
+	userinfo, err := v.ValidateRequest(r)
+	require.Nil(t, err)
+	assert.Equal(t, "ada@lau.co", userinfo.Email)
+	assert.Equal(t, "lau.co", userinfo.Domain)
+}
+
+func TestIAPAssertion(t *testing.T) {
+	v := newIAPAuthenticator()
+	audience := "/projects/42/apps/doorman"
+
+	private, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	claims := map[string]interface{}{
+		"iss":   IAPIssuer,
+		"aud":   audience,
+		"sub":   "accounts.google.com:1234",
+		"email": "ada@lau.co",
+		"hd":    "lau.co",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+	token := signToken(t, v, private, &private.PublicKey, claims)
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", audience)
+
+	// Authorization header is ignored.
+	r.Header.Set("Authorization", "Bearer "+token)
+	_, err := v.ValidateRequest(r)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "token not found")
+
+	r.Header.Set(IAPHeader, token)
+	userinfo, err := v.ValidateRequest(r)
+	require.Nil(t, err)
+	assert.Equal(t, "accounts.google.com:1234", userinfo.ID)
+	assert.Equal(t, "lau.co", userinfo.Domain)
+
+	// Wrong audience.
+	r.Header.Set("Origin", "/projects/42/apps/other")
+	_, err = v.ValidateRequest(r)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid audience claim")
+
+	// Wrong issuer.
+	claims["iss"] = GoogleIssuer
+	r.Header.Set("Origin", audience)
+	r.Header.Set(IAPHeader, signToken(t, v, private, &private.PublicKey, claims))
+	_, err = v.ValidateRequest(r)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid issuer claim")
+}
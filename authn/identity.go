@@ -0,0 +1,49 @@
+package authn
+
+import (
+	"fmt"
+)
+
+// IdentityValidator authenticates workloads that do not send HTTP requests (eg.
+// message consumers, scheduled jobs), from their credentials.
+type IdentityValidator interface {
+	ValidateIdentity(credentials string) (*UserInfo, error)
+}
+
+// IdentityValidatorFunc is an adapter to use ordinary functions as IdentityValidator.
+type IdentityValidatorFunc func(credentials string) (*UserInfo, error)
+
+// ValidateIdentity calls f(credentials).
+func (f IdentityValidatorFunc) ValidateIdentity(credentials string) (*UserInfo, error) {
+	return f(credentials)
+}
+
+// TrustedIdentity returns the user info of an identity that was already verified
+// by the transport or the platform (eg. a scheduled job name), with no validation.
+func TrustedIdentity(id string, groups ...string) *UserInfo {
+	return &UserInfo{
+		ID:     id,
+		Groups: groups,
+		Claims: map[string]interface{}{},
+	}
+}
+
+// AMQPIdentity returns the user info of the publisher of an AMQP message. It is
+// only trustworthy if the broker validates the `user-id` message property
+// against the connection credentials (eg. RabbitMQ). The virtual host becomes
+// an `amqp:{vhost}` group.
+func AMQPIdentity(vhost string, userID string) (*UserInfo, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("empty AMQP user-id property")
+	}
+	if vhost == "" {
+		vhost = "/"
+	}
+	return &UserInfo{
+		ID:     userID,
+		Groups: []string{fmt.Sprintf("amqp:%s", vhost)},
+		Claims: map[string]interface{}{
+			"vhost": vhost,
+		},
+	}, nil
+}
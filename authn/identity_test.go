@@ -0,0 +1,42 @@
+package authn
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedIdentity(t *testing.T) {
+	userInfo := TrustedIdentity("cron:cleanup", "jobs")
+	assert.Equal(t, "cron:cleanup", userInfo.ID)
+	assert.Equal(t, []string{"jobs"}, userInfo.Groups)
+}
+
+func TestAMQPIdentity(t *testing.T) {
+	_, err := AMQPIdentity("/", "")
+	require.NotNil(t, err)
+
+	userInfo, err := AMQPIdentity("", "publisher")
+	require.Nil(t, err)
+	assert.Equal(t, "publisher", userInfo.ID)
+	assert.Equal(t, []string{"amqp:/"}, userInfo.Groups)
+
+	userInfo, _ = AMQPIdentity("billing", "publisher")
+	assert.Equal(t, "billing", userInfo.Claims["vhost"])
+}
+
+func TestIdentityValidatorFunc(t *testing.T) {
+	var v IdentityValidator = IdentityValidatorFunc(func(credentials string) (*UserInfo, error) {
+		if credentials != "secret" {
+			return nil, fmt.Errorf("invalid credentials")
+		}
+		return TrustedIdentity("worker"), nil
+	})
+	_, err := v.ValidateIdentity("bad")
+	assert.NotNil(t, err)
+	userInfo, err := v.ValidateIdentity("secret")
+	require.Nil(t, err)
+	assert.Equal(t, "worker", userInfo.ID)
+}
@@ -0,0 +1,163 @@
+package authn
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// JWKSRefreshInterval is the delay between the background refreshes of the
+// identity providers public keys. Keys are then always in cache, and rotations
+// are picked up before tokens signed with new keys are received. Background
+// refresh is disabled if zero.
+var JWKSRefreshInterval time.Duration
+
+// JWKSRefetchInterval is the minimum delay between the refetches of the public
+// keys triggered by tokens signed with an unknown key ID (eg. right after a key
+// rotation). It prevents forged key IDs from hammering the identity providers.
+var JWKSRefetchInterval = 1 * time.Minute
+
+// fetchJWKS obtains the public keys from the local file or the issuer.
+func (v *openIDAuthenticator) fetchJWKS() ([]byte, error) {
+	if v.JWKSFile != "" {
+		log.Debugf("Read public keys from %s", v.JWKSFile)
+		data, err := ioutil.ReadFile(v.JWKSFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read JWKS file")
+		}
+		return data, nil
+	}
+	uri := v.JWKSUri
+	if uri == "" {
+		config, err := v.config()
+		if err != nil {
+			return nil, err
+		}
+		uri = config.JWKSUri
+	}
+	log.Debugf("Fetch public keys from %s", uri)
+	data, err := downloadJSON(uri, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch JWKS")
+	}
+	return data, nil
+}
+
+// refreshJWKS fetches the public keys and puts them in cache. If they cannot be
+// obtained or are invalid, the last valid ones are served, so that an identity
+// provider outage or a botched rotation does not reject every request.
+func (v *openIDAuthenticator) refreshJWKS() ([]byte, error) {
+	data, err := v.fetchJWKS()
+	if err == nil {
+		_, err = parseJWKS(data)
+	}
+
+	v.lastJWKSLock.Lock()
+	defer v.lastJWKSLock.Unlock()
+	if err != nil {
+		if v.lastJWKS == nil {
+			return nil, err
+		}
+		log.Warningf("Serve previous public keys of %q: %s", v.Issuer, err)
+		data = v.lastJWKS
+	}
+	v.lastJWKS = data
+	v.cache.Set("jwks:"+v.Issuer, data)
+	return data, nil
+}
+
+// refreshJWKSInBackground fetches the public keys right away, and then on the
+// specified interval, until stopRefresh() is called.
+func (v *openIDAuthenticator) refreshJWKSInBackground(interval time.Duration) {
+	stop := make(chan struct{})
+	v.refreshLock.Lock()
+	v.refreshStop = stop
+	v.refreshLock.Unlock()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := v.refreshJWKS(); err != nil {
+				log.Warningf("Failed to refresh public keys of %q: %s", v.Issuer, err)
+			}
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopRefresh stops the background refresh of the public keys, if any.
+func (v *openIDAuthenticator) stopRefresh() {
+	v.refreshLock.Lock()
+	defer v.refreshLock.Unlock()
+	if v.refreshStop != nil {
+		close(v.refreshStop)
+		v.refreshStop = nil
+	}
+}
+
+// key returns the public key with the specified ID. Unknown key IDs trigger an
+// immediate refetch of the keys, at most once per JWKSRefetchInterval, so that
+// rotations do not reject the tokens signed with the new key until the cache
+// expires.
+func (v *openIDAuthenticator) key(keyID string) (*jose.JSONWebKey, error) {
+	keys, err := v.jwks()
+	if err != nil {
+		return nil, err
+	}
+	if key := findKey(keys, keyID); key != nil {
+		return key, nil
+	}
+
+	v.refetchLock.Lock()
+	defer v.refetchLock.Unlock()
+	if time.Since(v.lastRefetch) < JWKSRefetchInterval {
+		// Keys might have been refetched while waiting for the lock.
+		keys, err = v.jwks()
+	} else {
+		log.Debugf("Unknown key ID %q, refetch public keys of %q", keyID, v.Issuer)
+		v.lastRefetch = time.Now()
+		var data []byte
+		if data, err = v.refreshJWKS(); err == nil {
+			keys, err = parseJWKS(data)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key := findKey(keys, keyID); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("no JWT key with id %q", keyID)
+}
+
+func findKey(keys *publicKeys, keyID string) *jose.JSONWebKey {
+	for _, k := range keys.Keys {
+		if k.KeyID == keyID {
+			key := k
+			return &key
+		}
+	}
+	return nil
+}
+
+func parseJWKS(data []byte) (*publicKeys, error) {
+	var jwks = &publicKeys{}
+	err := json.Unmarshal(data, jwks)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse JWKS")
+	}
+
+	if len(jwks.Keys) < 1 {
+		return nil, fmt.Errorf("no JWKS found")
+	}
+	return jwks, nil
+}
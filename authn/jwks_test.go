@@ -0,0 +1,115 @@
+package authn
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+func writeJWKS(t *testing.T, filename string, keyID string) {
+	private, _ := rsa.GenerateKey(rand.Reader, 1024)
+	jwks, _ := json.Marshal(publicKeys{Keys: []jose.JSONWebKey{{Key: &private.PublicKey, KeyID: keyID}}})
+	require.Nil(t, ioutil.WriteFile(filename, jwks, 0666))
+}
+
+func TestRefreshJWKS(t *testing.T) {
+	tmpfile, _ := ioutil.TempFile("", "jwks")
+	defer os.Remove(tmpfile.Name())
+
+	v := newOpenIDAuthenticator("https://fake.com")
+	v.JWKSFile = tmpfile.Name()
+
+	// No valid keys yet.
+	_, err := v.refreshJWKS()
+	require.NotNil(t, err)
+
+	writeJWKS(t, tmpfile.Name(), "key1")
+	_, err = v.refreshJWKS()
+	require.Nil(t, err)
+	keys, _ := v.jwks()
+	assert.Equal(t, "key1", keys.Keys[0].KeyID)
+
+	// Invalid keys are ignored.
+	ioutil.WriteFile(tmpfile.Name(), []byte("{}"), 0666)
+	_, err = v.refreshJWKS()
+	require.Nil(t, err)
+	keys, _ = v.jwks()
+	assert.Equal(t, "key1", keys.Keys[0].KeyID)
+
+	// Rotation.
+	writeJWKS(t, tmpfile.Name(), "key2")
+	v.refreshJWKS()
+	keys, _ = v.jwks()
+	assert.Equal(t, "key2", keys.Keys[0].KeyID)
+}
+
+func TestRefreshJWKSInBackground(t *testing.T) {
+	tmpfile, _ := ioutil.TempFile("", "jwks")
+	defer os.Remove(tmpfile.Name())
+	writeJWKS(t, tmpfile.Name(), "key1")
+
+	v := newOpenIDAuthenticator("https://fake.com")
+	v.JWKSFile = tmpfile.Name()
+	v.refreshJWKSInBackground(10 * time.Millisecond)
+
+	// Fetched on start.
+	assert.True(t, waitFor(func() bool {
+		_, err := v.cache.Get("jwks:https://fake.com")
+		return err == nil
+	}))
+
+	writeJWKS(t, tmpfile.Name(), "key2")
+	assert.True(t, waitFor(func() bool {
+		keys, err := v.jwks()
+		return err == nil && keys.Keys[0].KeyID == "key2"
+	}))
+}
+
+// waitFor polls the condition for a second.
+func waitFor(condition func() bool) bool {
+	for i := 0; i < 200; i++ {
+		if condition() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
+
+func TestJWKSRefetchOnUnknownKeyID(t *testing.T) {
+	tmpfile, _ := ioutil.TempFile("", "jwks")
+	defer os.Remove(tmpfile.Name())
+	writeJWKS(t, tmpfile.Name(), "key1")
+
+	v := newOpenIDAuthenticator("https://fake.com")
+	v.JWKSFile = tmpfile.Name()
+	key, err := v.key("key1")
+	require.Nil(t, err)
+	assert.Equal(t, "key1", key.KeyID)
+
+	// Rotation: refetched right away.
+	writeJWKS(t, tmpfile.Name(), "key2")
+	key, err = v.key("key2")
+	require.Nil(t, err)
+	assert.Equal(t, "key2", key.KeyID)
+
+	// Rate limited.
+	writeJWKS(t, tmpfile.Name(), "key3")
+	_, err = v.key("key3")
+	require.NotNil(t, err)
+	assert.Equal(t, "no JWT key with id \"key3\"", err.Error())
+
+	defer func(interval time.Duration) { JWKSRefetchInterval = interval }(JWKSRefetchInterval)
+	JWKSRefetchInterval = 0
+	key, err = v.key("key3")
+	require.Nil(t, err)
+	assert.Equal(t, "key3", key.KeyID)
+}
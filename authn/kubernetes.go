@@ -0,0 +1,206 @@
+package authn
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/allegro/bigcache"
+	"github.com/pkg/errors"
+)
+
+// KubernetesIssuer is the identity provider of the in-cluster service accounts,
+// whose tokens are verified with the Kubernetes TokenReview API.
+const KubernetesIssuer = "https://kubernetes.default.svc"
+
+// kubernetesServiceAccountDir contains the credentials of the pod service account.
+const kubernetesServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubernetesReviewTTL is the cache duration of the tokens reviews. It is short,
+// since service accounts can be deleted.
+const kubernetesReviewTTL = 1 * time.Minute
+
+// tokenReview is the TokenReview resource of the `authentication.k8s.io/v1` API.
+type tokenReview struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		Token     string   `json:"token"`
+		Audiences []string `json:"audiences,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		Authenticated bool `json:"authenticated"`
+		User          struct {
+			Username string   `json:"username"`
+			UID      string   `json:"uid"`
+			Groups   []string `json:"groups"`
+		} `json:"user"`
+		Audiences []string `json:"audiences"`
+		Error     string   `json:"error"`
+	} `json:"status"`
+}
+
+// kubernetesAuthenticator verifies the tokens with the Kubernetes API server.
+type kubernetesAuthenticator struct {
+	// APIServer is the base URL of the Kubernetes API.
+	APIServer string
+	// TokenFile contains the token of the service account of Doorman, which
+	// must be allowed to create token reviews.
+	TokenFile string
+	client    *http.Client
+	cache     *bigcache.BigCache
+}
+
+// newKubernetesAuthenticator uses the in-cluster configuration of the pod.
+func newKubernetesAuthenticator() (*kubernetesAuthenticator, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster")
+	}
+	ca, err := ioutil.ReadFile(filepath.Join(kubernetesServiceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read Kubernetes CA")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("invalid Kubernetes CA")
+	}
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		},
+	}
+	return newKubernetesTokenReviewer("https://"+net.JoinHostPort(host, port), filepath.Join(kubernetesServiceAccountDir, "token"), client), nil
+}
+
+func newKubernetesTokenReviewer(apiServer string, tokenFile string, client *http.Client) *kubernetesAuthenticator {
+	cache, _ := bigcache.NewBigCache(bigcache.DefaultConfig(kubernetesReviewTTL))
+	return &kubernetesAuthenticator{
+		APIServer: apiServer,
+		TokenFile: tokenFile,
+		client:    client,
+		cache:     cache,
+	}
+}
+
+// ValidateRequest reviews the bearer token. The `Origin` header is the expected
+// audience of the token (see projected service account tokens).
+func (k *kubernetesAuthenticator) ValidateRequest(r *http.Request) (*UserInfo, error) {
+	token, err := fromHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	return k.review(token, r.Header.Get("Origin"))
+}
+
+// review submits the token to the TokenReview API. Successful reviews are cached.
+func (k *kubernetesAuthenticator) review(token string, audience string) (*UserInfo, error) {
+	cacheKey := "review:" + audience + ":" + token
+	if data, err := k.cache.Get(cacheKey); err == nil {
+		userInfo := &UserInfo{}
+		if err := json.Unmarshal(data, userInfo); err == nil {
+			return userInfo, nil
+		}
+	}
+
+	// The token of Doorman is read every time, since it is rotated by Kubernetes.
+	credentials, err := ioutil.ReadFile(k.TokenFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read Kubernetes service account token")
+	}
+
+	review := tokenReview{APIVersion: "authentication.k8s.io/v1", Kind: "TokenReview"}
+	review.Spec.Token = token
+	if audience != "" {
+		review.Spec.Audiences = []string{audience}
+	}
+	body, _ := json.Marshal(review)
+	req, _ := http.NewRequest("POST", k.APIServer+"/apis/authentication.k8s.io/v1/tokenreviews", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(credentials)))
+	response, err := k.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not review token")
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token review error (%s)", response.Status)
+	}
+	result := tokenReview{}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, errors.Wrap(err, "failed to parse token review")
+	}
+
+	if !result.Status.Authenticated {
+		if result.Status.Error != "" {
+			return nil, fmt.Errorf("token not authenticated: %s", result.Status.Error)
+		}
+		return nil, fmt.Errorf("token not authenticated")
+	}
+	if audience != "" && !contains(result.Status.Audiences, audience) {
+		return nil, fmt.Errorf("token not issued for audience %q", audience)
+	}
+
+	user := result.Status.User
+	userInfo := &UserInfo{
+		ID:             user.Username,
+		Groups:         user.Groups,
+		ServiceAccount: serviceAccountName(user.Username),
+		Claims: map[string]interface{}{
+			"uid": user.UID,
+		},
+	}
+	if data, err := json.Marshal(userInfo); err == nil {
+		k.cache.Set(cacheKey, data)
+	}
+	return userInfo, nil
+}
+
+// serviceAccountName returns `{namespace}/{name}` for the service accounts
+// usernames (ie. `system:serviceaccount:{namespace}:{name}`).
+func serviceAccountName(username string) string {
+	parts := strings.Split(username, ":")
+	if len(parts) != 4 || parts[0] != "system" || parts[1] != "serviceaccount" {
+		return ""
+	}
+	return parts[2] + "/" + parts[3]
+}
+
+// kubernetesServiceAccount reads the service account of the tokens issued by
+// Kubernetes, when verified with the cluster public keys.
+func kubernetesServiceAccount(raw map[string]interface{}) string {
+	if claim, ok := raw["kubernetes.io"].(map[string]interface{}); ok {
+		namespace, _ := claim["namespace"].(string)
+		serviceAccount, _ := claim["serviceaccount"].(map[string]interface{})
+		name, _ := serviceAccount["name"].(string)
+		if namespace != "" && name != "" {
+			return namespace + "/" + name
+		}
+	}
+	// Legacy secret-based tokens.
+	namespace, _ := raw["kubernetes.io/serviceaccount/namespace"].(string)
+	name, _ := raw["kubernetes.io/serviceaccount/service-account.name"].(string)
+	if namespace != "" && name != "" {
+		return namespace + "/" + name
+	}
+	return ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package authn
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewKubernetesAuthenticator(t *testing.T) {
+	os.Unsetenv("KUBERNETES_SERVICE_HOST")
+	_, err := NewAuthenticator(KubernetesIssuer)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "not running in a Kubernetes cluster")
+}
+
+func fakeAPIServer(t *testing.T, reviews *int) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*reviews++
+		assert.Equal(t, "/apis/authentication.k8s.io/v1/tokenreviews", r.URL.Path)
+		assert.Equal(t, "Bearer doorman-token", r.Header.Get("Authorization"))
+
+		var review tokenReview
+		json.NewDecoder(r.Body).Decode(&review)
+		switch review.Spec.Token {
+		case "valid":
+			review.Status.Authenticated = true
+			review.Status.User.Username = "system:serviceaccount:billing:worker"
+			review.Status.User.UID = "42"
+			review.Status.User.Groups = []string{"system:serviceaccounts", "system:serviceaccounts:billing"}
+			review.Status.Audiences = review.Spec.Audiences
+		case "other-audience":
+			review.Status.Authenticated = true
+			review.Status.User.Username = "system:serviceaccount:billing:worker"
+			review.Status.Audiences = []string{"https://kubernetes.default.svc"}
+		default:
+			review.Status.Error = "invalid bearer token"
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(review)
+	}))
+}
+
+func TestKubernetesTokenReview(t *testing.T) {
+	reviews := 0
+	server := fakeAPIServer(t, &reviews)
+	defer server.Close()
+
+	tokenFile, _ := ioutil.TempFile("", "token")
+	defer os.Remove(tokenFile.Name())
+	tokenFile.Write([]byte("doorman-token\n"))
+
+	k := newKubernetesTokenReviewer(server.URL, tokenFile.Name(), server.Client())
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "https://api.billing")
+	_, err := k.ValidateRequest(r)
+	require.NotNil(t, err)
+	assert.Equal(t, "token not found", err.Error())
+
+	r.Header.Set("Authorization", "Bearer valid")
+	userInfo, err := k.ValidateRequest(r)
+	require.Nil(t, err)
+	assert.Equal(t, "system:serviceaccount:billing:worker", userInfo.ID)
+	assert.Equal(t, "billing/worker", userInfo.ServiceAccount)
+	assert.Equal(t, []string{"system:serviceaccounts", "system:serviceaccounts:billing"}, userInfo.Groups)
+	assert.Equal(t, "42", userInfo.Claims["uid"])
+
+	// Reviews are cached.
+	k.ValidateRequest(r)
+	assert.Equal(t, 1, reviews)
+
+	r.Header.Set("Authorization", "Bearer other-audience")
+	_, err = k.ValidateRequest(r)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "not issued for audience")
+
+	r.Header.Set("Authorization", "Bearer invalid")
+	_, err = k.ValidateRequest(r)
+	require.NotNil(t, err)
+	assert.Equal(t, "token not authenticated: invalid bearer token", err.Error())
+}
+
+func TestServiceAccountName(t *testing.T) {
+	assert.Equal(t, "billing/worker", serviceAccountName("system:serviceaccount:billing:worker"))
+	assert.Equal(t, "", serviceAccountName("system:node:ip-10-0-0-1"))
+	assert.Equal(t, "", serviceAccountName("ada"))
+}
+
+func TestKubernetesServiceAccountClaims(t *testing.T) {
+	userInfo, err := defaultExtractor.Extract([]byte(`{
+		"sub": "system:serviceaccount:billing:worker",
+		"kubernetes.io": {"namespace": "billing", "serviceaccount": {"name": "worker", "uid": "42"}}
+	}`))
+	require.Nil(t, err)
+	assert.Equal(t, "billing/worker", userInfo.ServiceAccount)
+
+	userInfo, _ = defaultExtractor.Extract([]byte(`{
+		"kubernetes.io/serviceaccount/namespace": "billing",
+		"kubernetes.io/serviceaccount/service-account.name": "worker"
+	}`))
+	assert.Equal(t, "billing/worker", userInfo.ServiceAccount)
+
+	userInfo, _ = defaultExtractor.Extract([]byte(`{"sub": "ada"}`))
+	assert.Equal(t, "", userInfo.ServiceAccount)
+}
@@ -0,0 +1,99 @@
+package authn
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	jwt "gopkg.in/square/go-jose.v2/jwt"
+)
+
+// issuerAcceptor is implemented by the authenticators of JWT issuers.
+type issuerAcceptor interface {
+	acceptsIssuer(issuer string) bool
+}
+
+// multiAuthenticator delegates the validation to one of several authenticators,
+// selected from the token issuer (eg. when identities are federated from
+// several identity providers during a migration).
+type multiAuthenticator struct {
+	authenticators []Authenticator
+}
+
+// NewMultiAuthenticator returns an authenticator that validates the JWT with
+// the authenticator of its issuer (`iss` claim). Other tokens, and the JWT of
+// issuers that no authenticator claims (eg. Kubernetes service accounts, whose
+// issuer is set by the cluster), are submitted to each authenticator without
+// issuer in order, until one succeeds.
+func NewMultiAuthenticator(authenticators ...Authenticator) Authenticator {
+	if len(authenticators) == 1 {
+		return authenticators[0]
+	}
+	return &multiAuthenticator{authenticators: authenticators}
+}
+
+func (m *multiAuthenticator) ValidateRequest(r *http.Request) (*UserInfo, error) {
+	issuer, ok := unverifiedIssuer(r)
+	if !ok {
+		return validateInOrder(m.authenticators, r)
+	}
+	var others []Authenticator
+	for _, a := range m.authenticators {
+		acceptor, ok := a.(issuerAcceptor)
+		if !ok {
+			others = append(others, a)
+			continue
+		}
+		if acceptor.acceptsIssuer(issuer) {
+			return a.ValidateRequest(r)
+		}
+	}
+	if len(others) == 0 {
+		return nil, fmt.Errorf("untrusted issuer %q", issuer)
+	}
+	return validateInOrder(others, r)
+}
+
+// validateInOrder submits the request to each authenticator, until one succeeds.
+func validateInOrder(authenticators []Authenticator, r *http.Request) (*UserInfo, error) {
+	var errs []string
+	for _, a := range authenticators {
+		userInfo, err := a.ValidateRequest(r)
+		if err == nil {
+			return userInfo, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+}
+
+// unverifiedIssuer reads the `iss` claim of the JWT of the `Authorization` header,
+// without verifying its signature.
+func unverifiedIssuer(r *http.Request) (string, bool) {
+	value, err := fromHeader(r)
+	if err != nil {
+		return "", false
+	}
+	token, err := jwt.ParseSigned(value)
+	if err != nil {
+		return "", false
+	}
+	claims := jwt.Claims{}
+	if err := token.UnsafeClaimsWithoutVerification(&claims); err != nil || claims.Issuer == "" {
+		return "", false
+	}
+	return claims.Issuer, true
+}
+
+// acceptsIssuer returns true if the `iss` claim value is one of this issuer.
+func (v *openIDAuthenticator) acceptsIssuer(issuer string) bool {
+	if issuer == v.Issuer {
+		return true
+	}
+	for _, alias := range v.IssuerAliases {
+		if issuer == alias {
+			return true
+		}
+	}
+	return v.IssuerMatcher != nil && v.IssuerMatcher(issuer)
+}
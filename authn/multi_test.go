@@ -0,0 +1,117 @@
+package authn
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fixedAuthenticator struct {
+	userInfo *UserInfo
+	message  string
+}
+
+func (f *fixedAuthenticator) ValidateRequest(r *http.Request) (*UserInfo, error) {
+	if f.userInfo == nil {
+		return nil, fmt.Errorf("%s", f.message)
+	}
+	return f.userInfo, nil
+}
+
+func TestNewMultiAuthenticator(t *testing.T) {
+	a := newOpenIDAuthenticator("https://a.auth0.com/")
+	assert.Equal(t, a, NewMultiAuthenticator(a))
+}
+
+func TestMultiAuthenticatorIssuers(t *testing.T) {
+	old := newOpenIDAuthenticator("https://old.auth0.com/")
+	current := newOpenIDAuthenticator("https://login.microsoftonline.com/common/v2.0")
+	current.ClaimExtractor = defaultExtractor
+	m := NewMultiAuthenticator(old, current)
+
+	private, _ := rsa.GenerateKey(rand.Reader, 2048)
+	request := func(v *openIDAuthenticator, issuer string) *http.Request {
+		token := signToken(t, v, private, &private.PublicKey, map[string]interface{}{
+			"iss": issuer,
+			"aud": "https://api.service.org",
+			"sub": "ada",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		})
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Origin", "https://api.service.org")
+		r.Header.Set("Authorization", "Bearer "+token)
+		return r
+	}
+
+	userInfo, err := m.ValidateRequest(request(old, "https://old.auth0.com/"))
+	require.Nil(t, err)
+	assert.Equal(t, "ada", userInfo.ID)
+
+	// Issuers are matched with aliases and matchers too.
+	userInfo, err = m.ValidateRequest(request(current, "https://login.microsoftonline.com/72f988bf/v2.0"))
+	require.Nil(t, err)
+	assert.Equal(t, "ada", userInfo.ID)
+
+	_, err = m.ValidateRequest(request(old, "https://evil.com/"))
+	require.NotNil(t, err)
+	assert.Equal(t, "untrusted issuer \"https://evil.com/\"", err.Error())
+}
+
+func TestMultiAuthenticatorOtherTokens(t *testing.T) {
+	m := NewMultiAuthenticator(&fixedAuthenticator{message: "first"}, &fixedAuthenticator{message: "second"})
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer abc")
+	_, err := m.ValidateRequest(r)
+	require.NotNil(t, err)
+	assert.Equal(t, "first; second", err.Error())
+
+	m = NewMultiAuthenticator(&fixedAuthenticator{message: "first"}, &fixedAuthenticator{userInfo: TrustedIdentity("ada")})
+	userInfo, err := m.ValidateRequest(r)
+	require.Nil(t, err)
+	assert.Equal(t, "ada", userInfo.ID)
+}
+
+func TestMultiAuthenticatorKubernetes(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var review tokenReview
+		json.NewDecoder(r.Body).Decode(&review)
+		review.Status.Authenticated = true
+		review.Status.User.Username = "system:serviceaccount:billing:worker"
+		review.Status.Audiences = review.Spec.Audiences
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(review)
+	}))
+	defer server.Close()
+	tokenFile, _ := ioutil.TempFile("", "token")
+	defer os.Remove(tokenFile.Name())
+	tokenFile.Write([]byte("doorman-token\n"))
+
+	v := newOpenIDAuthenticator("https://auth.corp.com/")
+	k := newKubernetesTokenReviewer(server.URL, tokenFile.Name(), server.Client())
+	m := NewMultiAuthenticator(v, k)
+
+	// The service accounts tokens issuer is not claimed by the OpenID authenticator.
+	private, _ := rsa.GenerateKey(rand.Reader, 2048)
+	token := signToken(t, v, private, &private.PublicKey, map[string]interface{}{
+		"iss": "https://kubernetes.default.svc.cluster.local",
+		"aud": "https://api.service.org",
+		"sub": "system:serviceaccount:billing:worker",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "https://api.service.org")
+	r.Header.Set("Authorization", "Bearer "+token)
+	userInfo, err := m.ValidateRequest(r)
+	require.Nil(t, err)
+	assert.Equal(t, "billing/worker", userInfo.ServiceAccount)
+}
@@ -0,0 +1,73 @@
+package authn
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// OktaGroupsFilter keeps only the matching groups of the Okta `groups` claim (eg.
+// `^doorman-`), like the filter of the claim in the authorization server.
+// It must be set before serving requests.
+var OktaGroupsFilter *regexp.Regexp
+
+// oktaIssuerRegexp matches the org authorization server (`https://{org}.okta.com`)
+// and the custom ones (`https://{org}.okta.com/oauth2/{id}`) issuers.
+var oktaIssuerRegexp = regexp.MustCompile(`^https://[^/]+\.(?:okta|oktapreview|okta-emea)\.com(/oauth2/[^/]+)?/?$`)
+
+// isOktaIssuer returns true if the issuer is an Okta authorization server.
+func isOktaIssuer(issuer string) bool {
+	return oktaIssuerRegexp.MatchString(issuer)
+}
+
+// oktaJWKSURI returns the keys endpoint of the Okta authorization server: the org
+// one serves them on `/oauth2/v1/keys`, the custom ones (including `default`) on
+// `/v1/keys` under their issuer.
+func oktaJWKSURI(issuer string) string {
+	issuer = strings.TrimRight(issuer, "/")
+	if oktaIssuerRegexp.FindStringSubmatch(issuer)[1] == "" {
+		return issuer + "/oauth2/v1/keys"
+	}
+	return issuer + "/v1/keys"
+}
+
+// oktaClaims are the Okta specific attributes.
+type oktaClaims struct {
+	// UserID is set in the access tokens, whose subject is the user login.
+	UserID string `json:"uid"`
+}
+
+type oktaClaimExtractor struct{}
+
+// Extract reads the standard claims, with the Okta user ID as ID in the access
+// tokens too, and only keeps the groups matching OktaGroupsFilter.
+func (*oktaClaimExtractor) Extract(payload []byte) (*UserInfo, error) {
+	userInfo, err := defaultExtractor.Extract(payload)
+	if err != nil {
+		return nil, err
+	}
+	var claims = &oktaClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, errors.Wrap(err, "failed to parse Okta claims from payload")
+	}
+	if claims.UserID != "" {
+		if userInfo.Email == "" && strings.Contains(userInfo.ID, "@") {
+			userInfo.Email = userInfo.ID
+		}
+		userInfo.ID = claims.UserID
+	}
+	if OktaGroupsFilter != nil {
+		groups := []string{}
+		for _, group := range userInfo.Groups {
+			if OktaGroupsFilter.MatchString(group) {
+				groups = append(groups, group)
+			}
+		}
+		userInfo.Groups = groups
+	}
+	return userInfo, nil
+}
+
+var oktaExtractor = &oktaClaimExtractor{}
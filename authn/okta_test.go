@@ -0,0 +1,57 @@
+package authn
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOktaIssuer(t *testing.T) {
+	assert.True(t, isOktaIssuer("https://mozilla.okta.com"))
+	assert.True(t, isOktaIssuer("https://mozilla.oktapreview.com/"))
+	assert.True(t, isOktaIssuer("https://mozilla.okta.com/oauth2/default"))
+	assert.True(t, isOktaIssuer("https://mozilla.okta-emea.com/oauth2/aus8p23f2mJOdLgTk356"))
+	assert.False(t, isOktaIssuer("https://okta.com.evil.org"))
+	assert.False(t, isOktaIssuer("https://mozilla.okta.com/oauth2/default/extra"))
+
+	assert.Equal(t, "https://mozilla.okta.com/oauth2/v1/keys", oktaJWKSURI("https://mozilla.okta.com/"))
+	assert.Equal(t, "https://mozilla.okta.com/oauth2/default/v1/keys", oktaJWKSURI("https://mozilla.okta.com/oauth2/default"))
+
+	validator := newOpenIDAuthenticator("https://mozilla.okta.com/oauth2/default")
+	assert.Equal(t, "https://mozilla.okta.com/oauth2/default/v1/keys", validator.JWKSUri)
+	assert.Equal(t, "", newOpenIDAuthenticator("https://mozilla.org").JWKSUri)
+}
+
+func TestOktaClaimsExtractor(t *testing.T) {
+	_, err := oktaExtractor.Extract([]byte(`<"sub"`))
+	require.NotNil(t, err)
+
+	// ID token.
+	userinfo, err := oktaExtractor.Extract([]byte(`{
+		"sub": "00uid4BxXw6I6TV4m0g3",
+		"email": "m@mozilla.com",
+		"groups": ["doorman-admins", "Everyone"]
+	}`))
+	require.Nil(t, err)
+	assert.Equal(t, "00uid4BxXw6I6TV4m0g3", userinfo.ID)
+	assert.Equal(t, "m@mozilla.com", userinfo.Email)
+	assert.Equal(t, []string{"doorman-admins", "Everyone"}, userinfo.Groups)
+
+	// Access token.
+	userinfo, err = oktaExtractor.Extract([]byte(`{
+		"sub": "m@mozilla.com",
+		"uid": "00uid4BxXw6I6TV4m0g3",
+		"groups": ["doorman-admins", "Everyone"]
+	}`))
+	require.Nil(t, err)
+	assert.Equal(t, "00uid4BxXw6I6TV4m0g3", userinfo.ID)
+	assert.Equal(t, "m@mozilla.com", userinfo.Email)
+
+	OktaGroupsFilter = regexp.MustCompile("^doorman-")
+	defer func() { OktaGroupsFilter = nil }()
+	userinfo, err = oktaExtractor.Extract([]byte(`{"sub": "00uid4BxXw6I6TV4m0g3", "groups": ["doorman-admins", "Everyone"]}`))
+	require.Nil(t, err)
+	assert.Equal(t, []string{"doorman-admins"}, userinfo.Groups)
+}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/allegro/bigcache"
@@ -18,6 +19,10 @@ import (
 // CacheTTL is the cache duration for remote info like OpenID config or keys.
 const CacheTTL = 1 * time.Hour
 
+// ClockSkew is the tolerated clock drift between the identity providers and
+// Doorman, when validating the `exp`, `nbf` and `iat` claims of the tokens.
+var ClockSkew = jwt.DefaultLeeway
+
 // openIDConfiguration is the OpenID provider metadata about URIs, endpoints etc.
 type openIDConfiguration struct {
 	JWKSUri          string `json:"jwks_uri"`
@@ -30,11 +35,36 @@ type publicKeys struct {
 }
 
 type openIDAuthenticator struct {
-	Issuer             string
-	SignatureAlgorithm jose.SignatureAlgorithm
-	ClaimExtractor     claimExtractor
-	cache              *bigcache.BigCache
-	envTest            bool
+	Issuer string
+	// SignatureAlgorithms are the accepted signing algorithms of the tokens.
+	SignatureAlgorithms []jose.SignatureAlgorithm
+	ClaimExtractor      claimExtractor
+	// IssuerAliases are other accepted values of the `iss` claim (eg. without scheme).
+	IssuerAliases []string
+	// IssuerMatcher accepts other values of the `iss` claim (eg. per tenant issuers).
+	IssuerMatcher func(issuer string) bool
+	// JWKSUri is the location of the public keys, instead of the one of the OpenID
+	// configuration (eg. Okta keys endpoints, or issuers without OpenID configuration).
+	JWKSUri string
+	// JWKSFile is a local file containing the public keys, read instead of
+	// fetching them from the issuer.
+	JWKSFile string
+	// TokenHeader is the request header that contains the token, instead of
+	// the `Authorization` header.
+	TokenHeader string
+	cache       *bigcache.BigCache
+	envTest     bool
+
+	// lastJWKS are the last valid public keys obtained, served if they cannot
+	// be fetched anymore.
+	lastJWKS     []byte
+	lastJWKSLock sync.Mutex
+	// lastRefetch is when the keys were last refetched for an unknown key ID.
+	lastRefetch time.Time
+	refetchLock sync.Mutex
+	// refreshStop stops the background refresh of the public keys.
+	refreshStop chan struct{}
+	refreshLock sync.Mutex
 }
 
 // newOpenIDAuthenticator returns a new instance of a generic JWT validator
@@ -43,15 +73,34 @@ func newOpenIDAuthenticator(issuer string) *openIDAuthenticator {
 	cache, _ := bigcache.NewBigCache(bigcache.DefaultConfig(CacheTTL))
 
 	var extractor claimExtractor = defaultExtractor
+	var aliases []string
+	var jwksURI string
+	var matcher func(string) bool
 	if strings.Contains(issuer, "mozilla.auth0.com") {
 		extractor = mozillaExtractor
+	} else if strings.Contains(issuer, "/realms/") {
+		// Keycloak issuers look like https://{host}/auth/realms/{realm}
+		extractor = keycloakExtractor
+	} else if isOktaIssuer(issuer) {
+		extractor = oktaExtractor
+		jwksURI = oktaJWKSURI(issuer)
+	} else if strings.TrimRight(issuer, "/") == GoogleIssuer {
+		extractor = googleExtractor
+		// Google ID tokens may omit the scheme.
+		aliases = []string{"accounts.google.com"}
+	} else if tenant, ok := azureTenant(issuer); ok {
+		extractor = &azureClaimExtractor{tenant: tenant}
+		matcher = isAzureIssuer
 	}
 	return &openIDAuthenticator{
-		Issuer:             issuer,
-		SignatureAlgorithm: jose.RS256,
-		ClaimExtractor:     extractor,
-		cache:              cache,
-		envTest:            false,
+		Issuer:              issuer,
+		SignatureAlgorithms: []jose.SignatureAlgorithm{jose.RS256},
+		ClaimExtractor:      extractor,
+		IssuerAliases:       aliases,
+		IssuerMatcher:       matcher,
+		JWKSUri:             jwksURI,
+		cache:               cache,
+		envTest:             false,
 	}
 }
 
@@ -83,43 +132,35 @@ func (v *openIDAuthenticator) config() (*openIDConfiguration, error) {
 }
 
 func (v *openIDAuthenticator) jwks() (*publicKeys, error) {
-	cacheKey := "jwks:" + v.Issuer
-	data, err := v.cache.Get(cacheKey)
+	data, err := v.cache.Get("jwks:" + v.Issuer)
 
 	// Cache is empty or expired: fetch again.
 	if err != nil {
-		config, err := v.config()
+		data, err = v.refreshJWKS()
 		if err != nil {
 			return nil, err
 		}
-		uri := config.JWKSUri
-		log.Debugf("Fetch public keys from %s", uri)
-		data, err = downloadJSON(uri, nil)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to fetch JWKS")
-		}
-		v.cache.Set(cacheKey, data)
-	}
-
-	var jwks = &publicKeys{}
-	err = json.Unmarshal(data, jwks)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to parse JWKS")
 	}
-
-	if len(jwks.Keys) < 1 {
-		return nil, fmt.Errorf("no JWKS found")
-	}
-	return jwks, nil
+	return parseJWKS(data)
 }
 
 func (v *openIDAuthenticator) ValidateRequest(r *http.Request) (*UserInfo, error) {
+	if v.TokenHeader != "" {
+		// Only JWT are sent in custom headers.
+		token := r.Header.Get(v.TokenHeader)
+		if token == "" {
+			return nil, fmt.Errorf("token not found")
+		}
+		return v.FromJWTPayload(token, r.Header.Get("Origin"))
+	}
+
 	headerValue, err := fromHeader(r)
 	if err != nil {
 		return nil, err
 	}
 
-	if strings.Count(headerValue, ".") == 0 {
+	// Without local keys, the issuer endpoints are assumed unreachable.
+	if strings.Count(headerValue, ".") == 0 && v.JWKSFile == "" {
 		// No dots, could be an access token! Try to fetch user infos.
 		userinfo, err := v.FetchUserInfo(headerValue)
 		if err == nil {
@@ -178,25 +219,15 @@ func (v *openIDAuthenticator) FromJWTPayload(idToken string, audience string) (*
 		return nil, fmt.Errorf("no headers in the token")
 	}
 	header := token.Headers[0]
-	if header.Algorithm != string(v.SignatureAlgorithm) {
-		return nil, fmt.Errorf("invalid algorithm")
+	if !v.acceptsAlgorithm(header.Algorithm) {
+		return nil, fmt.Errorf("invalid algorithm %q", header.Algorithm)
 	}
 
 	// 3. Get public key with specified ID
-	keys, err := v.jwks()
+	key, err := v.key(header.KeyID)
 	if err != nil {
 		return nil, err
 	}
-	var key *jose.JSONWebKey
-	for _, k := range keys.Keys {
-		if k.KeyID == header.KeyID {
-			key = &k
-			break
-		}
-	}
-	if key == nil {
-		return nil, fmt.Errorf("no JWT key with id %q", header.KeyID)
-	}
 
 	// 4. Parse and verify signature.
 	jwtClaims := jwt.Claims{}
@@ -206,12 +237,23 @@ func (v *openIDAuthenticator) FromJWTPayload(idToken string, audience string) (*
 	}
 
 	// 5. Validate issuer, audience, claims and expiration.
+	issuer := v.Issuer
+	for _, alias := range v.IssuerAliases {
+		if jwtClaims.Issuer == alias {
+			issuer = alias
+		}
+	}
+	if v.IssuerMatcher != nil && v.IssuerMatcher(jwtClaims.Issuer) {
+		issuer = jwtClaims.Issuer
+	}
 	expected := jwt.Expected{
-		Issuer:   v.Issuer,
-		Audience: jwt.Audience{audience},
+		Issuer: issuer,
 	}
 	expected = expected.WithTime(time.Now())
-	err = jwtClaims.Validate(expected)
+	err = jwtClaims.ValidateWithLeeway(expected, ClockSkew)
+	if err == nil && !matchAudience(jwtClaims.Audience, audience) {
+		err = jwt.ErrInvalidAudience
+	}
 	if err != nil && !v.envTest { // flag for unit tests.
 		return nil, errors.Wrap(err, "invalid JWT claims")
 	}
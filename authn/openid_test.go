@@ -1,11 +1,19 @@
 package authn
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	jose "gopkg.in/square/go-jose.v2"
+	jwt "gopkg.in/square/go-jose.v2/jwt"
 )
 
 func TestFetchOpenIDConfiguration(t *testing.T) {
@@ -183,3 +191,77 @@ func BenchmarkParseKeys(b *testing.B) {
 		validator.jwks()
 	}
 }
+
+func TestOpenIDClaimExtractor(t *testing.T) {
+	assert.Equal(t, defaultExtractor, newOpenIDAuthenticator("https://mozilla.org").ClaimExtractor)
+	assert.Equal(t, mozillaExtractor, newOpenIDAuthenticator("https://auth.mozilla.auth0.com/").ClaimExtractor)
+	assert.Equal(t, keycloakExtractor, newOpenIDAuthenticator("https://sso.mozilla.org/auth/realms/staff").ClaimExtractor)
+	assert.Equal(t, oktaExtractor, newOpenIDAuthenticator("https://mozilla.okta.com/oauth2/default").ClaimExtractor)
+	assert.Equal(t, &azureClaimExtractor{tenant: "common"}, newOpenIDAuthenticator("https://login.microsoftonline.com/common/v2.0").ClaimExtractor)
+}
+
+func TestValidateRequestJWKSFile(t *testing.T) {
+	_, err := NewAuthenticatorWithJWKSFile("http://localhost:8080", "/does/not/exist.json")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed to read JWKS file")
+
+	private, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks, _ := json.Marshal(publicKeys{Keys: []jose.JSONWebKey{{Key: &private.PublicKey, KeyID: "key1"}}})
+	tmpfile, _ := ioutil.TempFile("", "jwks")
+	defer os.Remove(tmpfile.Name())
+	tmpfile.Write(jwks)
+
+	// Issuers without https:// are accepted, since nothing is fetched.
+	a, err := NewAuthenticatorWithJWKSFile("http://localhost:8080", tmpfile.Name())
+	require.Nil(t, err)
+	other, _ := NewAuthenticatorWithJWKSFile("http://localhost:8080", tmpfile.Name())
+	assert.Equal(t, a, other)
+	v := a.(*openIDAuthenticator)
+	assert.Equal(t, tmpfile.Name(), v.JWKSFile)
+
+	key := jose.SigningKey{Algorithm: jose.RS256, Key: private}
+	signer, _ := jose.NewSigner(key, (&jose.SignerOptions{}).WithHeader("kid", "key1"))
+	token, _ := jwt.Signed(signer).Claims(map[string]interface{}{
+		"iss": "http://localhost:8080",
+		"aud": "https://api.local",
+		"sub": "1234",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).CompactSerialize()
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "https://api.local")
+	r.Header.Set("Authorization", "Bearer "+token)
+	userinfo, err := v.ValidateRequest(r)
+	require.Nil(t, err)
+	assert.Equal(t, "1234", userinfo.ID)
+
+	// Access tokens cannot be checked offline.
+	r.Header.Set("Authorization", "Bearer abc")
+	_, err = v.ValidateRequest(r)
+	require.NotNil(t, err)
+}
+
+func TestValidateRequestClockSkew(t *testing.T) {
+	defer func(skew time.Duration) { ClockSkew = skew }(ClockSkew)
+
+	v := newOpenIDAuthenticator("https://auth.local")
+	private, _ := rsa.GenerateKey(rand.Reader, 2048)
+	// Issued by an identity provider whose clock is 30 seconds ahead.
+	now := time.Now().Add(30 * time.Second)
+	token := signToken(t, v, private, &private.PublicKey, map[string]interface{}{
+		"iss": "https://auth.local",
+		"aud": "https://api.local",
+		"sub": "1234",
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	})
+
+	_, err := v.FromJWTPayload(token, "https://api.local")
+	require.Nil(t, err)
+
+	ClockSkew = 5 * time.Second
+	_, err = v.FromJWTPayload(token, "https://api.local")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "not valid yet")
+}
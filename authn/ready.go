@@ -0,0 +1,41 @@
+package authn
+
+// readinessChecker is implemented by the authenticators that depend on remote
+// resources (eg. the public keys of the identity provider).
+type readinessChecker interface {
+	ready() error
+}
+
+// Ready returns an error if the authenticator cannot validate requests yet,
+// for example if the public keys of the identity provider cannot be obtained.
+func Ready(a Authenticator) error {
+	if checker, ok := a.(readinessChecker); ok {
+		return checker.ready()
+	}
+	return nil
+}
+
+func (v *openIDAuthenticator) ready() error {
+	_, err := v.jwks()
+	return err
+}
+
+func (m *multiAuthenticator) ready() error {
+	for _, a := range m.authenticators {
+		if err := Ready(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *certificateAuthenticator) ready() error {
+	if a.next == nil {
+		return nil
+	}
+	return Ready(a.next)
+}
+
+func (a *tokenExtractorAuthenticator) ready() error {
+	return Ready(a.next)
+}
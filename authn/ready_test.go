@@ -0,0 +1,32 @@
+package authn
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReady(t *testing.T) {
+	tmpfile, _ := ioutil.TempFile("", "jwks")
+	defer os.Remove(tmpfile.Name())
+
+	v := newOpenIDAuthenticator("https://fake.com")
+	v.JWKSFile = tmpfile.Name()
+
+	// No valid keys yet.
+	assert.NotNil(t, Ready(v))
+	assert.NotNil(t, Ready(NewMultiAuthenticator(&fixedAuthenticator{}, v)))
+	assert.NotNil(t, Ready(NewCertificateAuthenticator(v)))
+	assert.NotNil(t, Ready(NewTokenExtractorAuthenticator(v, TokenFromQuery("token"))))
+
+	writeJWKS(t, tmpfile.Name(), "key1")
+	assert.Nil(t, Ready(v))
+	assert.Nil(t, Ready(NewMultiAuthenticator(&fixedAuthenticator{}, v)))
+	assert.Nil(t, Ready(NewCertificateAuthenticator(v)))
+
+	// Authenticators without remote resources are always ready.
+	assert.Nil(t, Ready(&fixedAuthenticator{}))
+	assert.Nil(t, Ready(NewCertificateAuthenticator(nil)))
+}
@@ -0,0 +1,87 @@
+package authn
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// session is the content of session cookies.
+type session struct {
+	Audience string    `json:"aud"`
+	Expires  time.Time `json:"exp"`
+	UserInfo *UserInfo `json:"userinfo"`
+}
+
+// SessionCodec seals validated user info into encrypted session values, to be
+// stored in cookies.
+type SessionCodec struct {
+	aead cipher.AEAD
+}
+
+// NewSessionCodec instantiates a codec with the specified 32 bytes key.
+func NewSessionCodec(key []byte) (*SessionCodec, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("session key must be 32 bytes long")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SessionCodec{aead}, nil
+}
+
+// Encode returns the encrypted session value for the audience.
+func (s *SessionCodec) Encode(audience string, userInfo *UserInfo, expires time.Time) (string, error) {
+	data, err := json.Marshal(session{
+		Audience: audience,
+		Expires:  expires,
+		UserInfo: userInfo,
+	})
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := s.aead.Seal(nonce, nonce, data, []byte(audience))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decode returns the user info of the session value. It fails if the value was
+// altered, is expired or was issued for another audience.
+func (s *SessionCodec) Decode(audience string, value string, now time.Time) (*UserInfo, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session: %s", err)
+	}
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, fmt.Errorf("invalid session")
+	}
+	nonce, encrypted := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	data, err := s.aead.Open(nil, nonce, encrypted, []byte(audience))
+	if err != nil {
+		return nil, fmt.Errorf("invalid session")
+	}
+	var content session
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, fmt.Errorf("invalid session: %s", err)
+	}
+	if content.Audience != audience || content.UserInfo == nil {
+		return nil, fmt.Errorf("invalid session")
+	}
+	if !now.Before(content.Expires) {
+		return nil, fmt.Errorf("session expired")
+	}
+	return content.UserInfo, nil
+}
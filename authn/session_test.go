@@ -0,0 +1,56 @@
+package authn
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionCodec(t *testing.T) {
+	_, err := NewSessionCodec([]byte("short"))
+	require.NotNil(t, err)
+
+	codec, err := NewSessionCodec([]byte("0123456789abcdef0123456789abcdef"))
+	require.Nil(t, err)
+
+	now := time.Now()
+	userInfo := &UserInfo{
+		ID:     "ldap|maria",
+		Email:  "maria@mozilla.com",
+		Groups: []string{"staff"},
+	}
+	value, err := codec.Encode("https://api.service.org", userInfo, now.Add(time.Hour))
+	require.Nil(t, err)
+
+	decoded, err := codec.Decode("https://api.service.org", value, now)
+	require.Nil(t, err)
+	assert.Equal(t, userInfo, decoded)
+
+	// Other audience.
+	_, err = codec.Decode("https://other.org", value, now)
+	assert.NotNil(t, err)
+
+	// Expired.
+	_, err = codec.Decode("https://api.service.org", value, now.Add(2*time.Hour))
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "expired")
+
+	// Altered.
+	altered := "A" + value[1:]
+	if value[0] == 'A' {
+		altered = "B" + value[1:]
+	}
+	_, err = codec.Decode("https://api.service.org", altered, now)
+	assert.NotNil(t, err)
+	_, err = codec.Decode("https://api.service.org", "abc", now)
+	assert.NotNil(t, err)
+	_, err = codec.Decode("https://api.service.org", "$$$", now)
+	assert.NotNil(t, err)
+
+	// Other key.
+	other, _ := NewSessionCodec([]byte("abcdef0123456789abcdef0123456789"))
+	_, err = other.Decode("https://api.service.org", value, now)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+)
+
+// Decrypter is responsible for decrypting policies files content.
+type Decrypter interface {
+	// CanDecrypt determines if the decrypter can handle this content.
+	CanDecrypt(content []byte) bool
+	// Decrypt returns the clear content.
+	Decrypt(content []byte) ([]byte, error)
+}
+
+var decrypters []Decrypter
+
+// AddDecrypter allows to plug new kinds of decrypters (eg. AESCipher, SOPSDecrypter).
+func AddDecrypter(d Decrypter) {
+	decrypters = append(decrypters, d)
+}
+
+// decrypt returns the clear content of the file using the appropriate decrypter.
+// Unencrypted content is returned as is.
+func decrypt(content []byte, source string) ([]byte, error) {
+	for _, d := range decrypters {
+		if d.CanDecrypt(content) {
+			clear, err := d.Decrypt(content)
+			if err != nil {
+				return nil, fmt.Errorf("could not decrypt %q: %s", source, err)
+			}
+			return clear, nil
+		}
+	}
+	return content, nil
+}
+
+// aesHeader is the first line of files encrypted with AESCipher.
+const aesHeader = "DOORMAN-AES256-GCM\n"
+
+// AESCipher encrypts and decrypts policies files with AES-256-GCM.
+//
+// Encrypted files start with a `DOORMAN-AES256-GCM` line, followed by the nonce
+// and the encrypted content encoded in base64.
+type AESCipher struct {
+	// Key is the base64 encoded 32 bytes key.
+	Key string
+}
+
+func (a *AESCipher) aead() (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(a.Key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %s", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid key: must be 32 bytes long")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// CanDecrypt will return true if the content was encrypted with AESCipher.
+func (a *AESCipher) CanDecrypt(content []byte) bool {
+	return bytes.HasPrefix(content, []byte(aesHeader))
+}
+
+// Decrypt returns the clear content.
+func (a *AESCipher) Decrypt(content []byte) ([]byte, error) {
+	aead, err := a.aead()
+	if err != nil {
+		return nil, err
+	}
+	encoded := bytes.TrimSpace(bytes.TrimPrefix(content, []byte(aesHeader)))
+	data := make([]byte, base64.StdEncoding.DecodedLen(len(encoded)))
+	n, err := base64.StdEncoding.Decode(data, encoded)
+	if err != nil {
+		return nil, err
+	}
+	data = data[:n]
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("content too short")
+	}
+	nonce, encrypted := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, encrypted, nil)
+}
+
+// Encrypt returns the encrypted content, suitable for Decrypt.
+func (a *AESCipher) Encrypt(content []byte) ([]byte, error) {
+	aead, err := a.aead()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	data := aead.Seal(nonce, nonce, content, nil)
+	encoded := base64.StdEncoding.EncodeToString(data)
+	return []byte(aesHeader + encoded + "\n"), nil
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+var (
+	// sopsYAMLRegexp matches the metadata of the files encrypted with SOPS.
+	sopsYAMLRegexp = regexp.MustCompile(`(?m)^sops:\s*$`)
+	sopsJSONRegexp = regexp.MustCompile(`"sops"\s*:\s*{`)
+)
+
+const (
+	// ageHeader is the first line of the files encrypted with age.
+	ageHeader = "age-encryption.org/v1\n"
+	// ageArmorHeader is the first line of the armored files encrypted with age.
+	ageArmorHeader = "-----BEGIN AGE ENCRYPTED FILE-----"
+)
+
+// SOPSDecrypter decrypts the policies files encrypted with SOPS, using the
+// `sops` command. The keys are obtained by `sops` itself (eg. from KMS, or
+// `SOPS_AGE_KEY_FILE`).
+type SOPSDecrypter struct {
+	// Command is the path of the `sops` executable (default: `sops` in PATH).
+	Command string
+}
+
+// CanDecrypt will return true if the content has SOPS metadata.
+func (s *SOPSDecrypter) CanDecrypt(content []byte) bool {
+	return sopsYAMLRegexp.Match(content) || sopsJSONRegexp.Match(content)
+}
+
+// Decrypt returns the clear content.
+func (s *SOPSDecrypter) Decrypt(content []byte) ([]byte, error) {
+	format := "yaml"
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")) {
+		format = "json"
+	}
+	args := []string{"--decrypt", "--input-type", format, "--output-type", format, "/dev/stdin"}
+	return runDecryptCommand(s.Command, "sops", args, content)
+}
+
+// AgeDecrypter decrypts the policies files encrypted with age, using the `age`
+// command.
+type AgeDecrypter struct {
+	// IdentityFile is the location of the age identities (private keys).
+	IdentityFile string
+	// Command is the path of the `age` executable (default: `age` in PATH).
+	Command string
+}
+
+// CanDecrypt will return true if the content was encrypted with age.
+func (a *AgeDecrypter) CanDecrypt(content []byte) bool {
+	return bytes.HasPrefix(content, []byte(ageHeader)) ||
+		bytes.HasPrefix(bytes.TrimSpace(content), []byte(ageArmorHeader))
+}
+
+// Decrypt returns the clear content.
+func (a *AgeDecrypter) Decrypt(content []byte) ([]byte, error) {
+	if a.IdentityFile == "" {
+		return nil, fmt.Errorf("no age identity file")
+	}
+	args := []string{"--decrypt", "--identity", a.IdentityFile}
+	return runDecryptCommand(a.Command, "age", args, content)
+}
+
+// runDecryptCommand runs the command with the content on stdin, and returns
+// its output.
+func runDecryptCommand(command string, defaultCommand string, args []string, content []byte) ([]byte, error) {
+	if command == "" {
+		command = defaultCommand
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(command, args...)
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%s: %s (%s)", defaultCommand, err, message)
+		}
+		return nil, fmt.Errorf("%s: %s", defaultCommand, err)
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCommand creates an executable script that prints its arguments and stdin.
+func writeCommand(t *testing.T, dir string, name string, script string) string {
+	filename := filepath.Join(dir, name)
+	err := ioutil.WriteFile(filename, []byte("#!/bin/sh\n"+script+"\n"), 0700)
+	require.Nil(t, err)
+	return filename
+}
+
+func TestSOPSDecrypter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sops")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s := &SOPSDecrypter{Command: writeCommand(t, dir, "sops", `echo "# $*"; cat`)}
+	encrypted := []byte("service: ENC[AES256_GCM,data:abc]\nsops:\n    mac: ENC[AES256_GCM,data:def]\n")
+	assert.True(t, s.CanDecrypt(encrypted))
+	assert.True(t, s.CanDecrypt([]byte(`{"service": "ENC[]", "sops": {"mac": "ENC[]"}}`)))
+	assert.False(t, s.CanDecrypt([]byte("service: a\ntags:\n  sops:\n    - userid:maria\n")))
+
+	clear, err := s.Decrypt(encrypted)
+	require.Nil(t, err)
+	assert.Equal(t, "# --decrypt --input-type yaml --output-type yaml /dev/stdin\n"+string(encrypted), string(clear))
+
+	clear, err = s.Decrypt([]byte(`{"sops": {}}`))
+	require.Nil(t, err)
+	assert.Contains(t, string(clear), "--input-type json --output-type json")
+
+	// Failure.
+	s.Command = writeCommand(t, dir, "failing", `echo "no key could decrypt" >&2; exit 128`)
+	_, err = s.Decrypt(encrypted)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no key could decrypt")
+
+	// Missing command.
+	s.Command = filepath.Join(dir, "missing")
+	_, err = s.Decrypt(encrypted)
+	assert.NotNil(t, err)
+}
+
+func TestAgeDecrypter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "age")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	a := &AgeDecrypter{
+		IdentityFile: "/keys.txt",
+		Command:      writeCommand(t, dir, "age", `echo "# $*"; cat`),
+	}
+	encrypted := []byte(ageHeader + "-> X25519 abc\n--- def\n")
+	assert.True(t, a.CanDecrypt(encrypted))
+	assert.True(t, a.CanDecrypt([]byte(ageArmorHeader+"\nYWdl\n-----END AGE ENCRYPTED FILE-----\n")))
+	assert.False(t, a.CanDecrypt([]byte("service: a")))
+
+	clear, err := a.Decrypt(encrypted)
+	require.Nil(t, err)
+	assert.Equal(t, "# --decrypt --identity /keys.txt\n"+string(encrypted), string(clear))
+
+	// No identity.
+	_, err = (&AgeDecrypter{}).Decrypt(encrypted)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no age identity file")
+}
+
+func TestLoadEncryptedWithCommand(t *testing.T) {
+	defer func() { decrypters = nil }()
+
+	dir, err := ioutil.TempDir("", "encrypted")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	AddDecrypter(&AgeDecrypter{
+		IdentityFile: "/keys.txt",
+		Command:      writeCommand(t, dir, "age", `echo "service: a"; echo "identityProvider:"`),
+	})
+	writeFiles(t, dir, map[string]string{
+		"service.yaml": ageHeader + "-> X25519 abc\n",
+	})
+	configs, err := Load([]string{filepath.Join(dir, "service.yaml")})
+	require.Nil(t, err)
+	assert.Equal(t, "a", configs[0].Service)
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sampleKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+func TestAESCipher(t *testing.T) {
+	c := &AESCipher{Key: sampleKey}
+	encrypted, err := c.Encrypt([]byte("service: a"))
+	require.Nil(t, err)
+	assert.True(t, c.CanDecrypt(encrypted))
+	assert.False(t, c.CanDecrypt([]byte("service: a")))
+	assert.NotContains(t, string(encrypted), "service")
+
+	clear, err := c.Decrypt(encrypted)
+	require.Nil(t, err)
+	assert.Equal(t, "service: a", string(clear))
+
+	// Wrong key.
+	other := &AESCipher{Key: base64.StdEncoding.EncodeToString([]byte("abcdef0123456789abcdef0123456789"))}
+	_, err = other.Decrypt(encrypted)
+	assert.NotNil(t, err)
+
+	// Invalid keys.
+	_, err = (&AESCipher{Key: "abc"}).Encrypt([]byte(""))
+	assert.Contains(t, err.Error(), "invalid key")
+	_, err = (&AESCipher{Key: "YWJj"}).Decrypt(encrypted)
+	assert.Contains(t, err.Error(), "must be 32 bytes")
+
+	// Invalid content.
+	_, err = c.Decrypt([]byte(aesHeader + "YWJj"))
+	assert.Contains(t, err.Error(), "too short")
+	_, err = c.Decrypt([]byte(aesHeader + "$$$"))
+	assert.NotNil(t, err)
+}
+
+func TestLoadEncrypted(t *testing.T) {
+	c := &AESCipher{Key: sampleKey}
+	defer func() { decrypters = nil }()
+
+	dir, err := ioutil.TempDir("", "encrypted")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	service, _ := c.Encrypt([]byte(`
+service: a
+identityProvider:
+includes:
+  - partners.yaml
+`))
+	partners, _ := c.Encrypt([]byte(`
+tags:
+  partners:
+    - userid:acme
+`))
+	writeFiles(t, dir, map[string]string{
+		"service.yaml":  string(service),
+		"partners.yaml": string(partners),
+	})
+	filename := filepath.Join(dir, "service.yaml")
+
+	// Without decrypter.
+	_, err = Load([]string{filename})
+	assert.NotNil(t, err)
+
+	AddDecrypter(c)
+	configs, err := Load([]string{filename})
+	require.Nil(t, err)
+	assert.Equal(t, "a", configs[0].Service)
+	assert.Equal(t, []string{"userid:acme"}, []string(configs[0].Tags["partners"]))
+
+	// Corrupted file.
+	ioutil.WriteFile(filename, []byte(aesHeader+"AAAAAAAAAAAAAAAAAAAAAAAAAAAA"), 0600)
+	_, err = Load([]string{filename})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "could not decrypt")
+}
@@ -0,0 +1,387 @@
+package config
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	jose "gopkg.in/square/go-jose.v2"
+	jwt "gopkg.in/square/go-jose.v2/jwt"
+)
+
+// FetchAuthenticator authenticates the requests sent to fetch policies, for
+// protected repositories and buckets.
+type FetchAuthenticator interface {
+	// Authenticate adds the credentials to the request.
+	Authenticate(r *http.Request) error
+}
+
+// fetch sends a GET request to the URL, authenticated if specified.
+func fetch(uri string, headers map[string]string, auth FetchAuthenticator) ([]byte, error) {
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if auth != nil {
+		if err := auth.Authenticate(req); err != nil {
+			return nil, fmt.Errorf("could not authenticate request to %q: %s", uri, err)
+		}
+	}
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not download %q (status %d)", uri, response.StatusCode)
+	}
+	return ioutil.ReadAll(response.Body)
+}
+
+// HeaderAuth sets a static request header (eg. `Authorization: token abc`).
+type HeaderAuth struct {
+	Name  string
+	Value string
+}
+
+// Authenticate sets the header.
+func (h *HeaderAuth) Authenticate(r *http.Request) error {
+	r.Header.Set(h.Name, h.Value)
+	return nil
+}
+
+// bearerToken caches an access token until it expires.
+type bearerToken struct {
+	sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// get returns the cached token, or obtains a new one.
+func (b *bearerToken) get(obtain func() (string, time.Duration, error)) (string, error) {
+	b.Lock()
+	defer b.Unlock()
+	// Renew a bit before expiration.
+	if b.token != "" && time.Now().Add(30*time.Second).Before(b.expires) {
+		return b.token, nil
+	}
+	token, ttl, err := obtain()
+	if err != nil {
+		return "", err
+	}
+	b.token = token
+	b.expires = time.Now().Add(ttl)
+	return token, nil
+}
+
+// tokenResponse is the OAuth access token response.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func readTokenResponse(response *http.Response) (string, time.Duration, error) {
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("could not obtain access token (status %d)", response.StatusCode)
+	}
+	var token tokenResponse
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return "", 0, err
+	}
+	if token.AccessToken == "" {
+		return "", 0, fmt.Errorf("no access token in response")
+	}
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
+
+// OAuthClientCredentials obtains access tokens with the OAuth client credentials
+// grant, and sends them as bearer tokens.
+type OAuthClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	token        bearerToken
+}
+
+// Authenticate sets the `Authorization` header.
+func (o *OAuthClientCredentials) Authenticate(r *http.Request) error {
+	token, err := o.token.get(func() (string, time.Duration, error) {
+		form := url.Values{"grant_type": {"client_credentials"}}
+		if len(o.Scopes) > 0 {
+			form.Set("scope", strings.Join(o.Scopes, " "))
+		}
+		req, err := http.NewRequest("POST", o.TokenURL, strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", 0, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(url.QueryEscape(o.ClientID), url.QueryEscape(o.ClientSecret))
+		response, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", 0, err
+		}
+		return readTokenResponse(response)
+	})
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// gcpMetadataURL is the GCE metadata server endpoint for the default service account token.
+const gcpMetadataURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// GCPMetadataAuth sends the access token of the GCP default service account, as
+// provided by the metadata server on GCE, GKE or Cloud Run.
+type GCPMetadataAuth struct {
+	// MetadataURL is the token endpoint (default: GCE metadata server).
+	MetadataURL string
+	token       bearerToken
+}
+
+// Authenticate sets the `Authorization` header.
+func (g *GCPMetadataAuth) Authenticate(r *http.Request) error {
+	token, err := g.token.get(func() (string, time.Duration, error) {
+		uri := g.MetadataURL
+		if uri == "" {
+			uri = gcpMetadataURL
+		}
+		req, err := http.NewRequest("GET", uri, nil)
+		if err != nil {
+			return "", 0, err
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+		response, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", 0, err
+		}
+		return readTokenResponse(response)
+	})
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// GithubAppAuth sends installation access tokens of a GitHub App.
+type GithubAppAuth struct {
+	AppID          string
+	InstallationID string
+	// PrivateKey is the PEM encoded private key of the App.
+	PrivateKey []byte
+	// BaseURL is the GitHub API URL (default: `https://api.github.com`).
+	BaseURL string
+	token   bearerToken
+}
+
+// Authenticate sets the `Authorization` header.
+func (g *GithubAppAuth) Authenticate(r *http.Request) error {
+	token, err := g.token.get(func() (string, time.Duration, error) {
+		block, _ := pem.Decode(g.PrivateKey)
+		if block == nil {
+			return "", 0, fmt.Errorf("no PEM private key for GitHub App")
+		}
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return "", 0, err
+		}
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, nil)
+		if err != nil {
+			return "", 0, err
+		}
+		now := time.Now()
+		assertion, err := jwt.Signed(signer).Claims(jwt.Claims{
+			Issuer:   g.AppID,
+			IssuedAt: jwt.NewNumericDate(now.Add(-time.Minute)),
+			Expiry:   jwt.NewNumericDate(now.Add(9 * time.Minute)),
+		}).CompactSerialize()
+		if err != nil {
+			return "", 0, err
+		}
+
+		baseURL := g.BaseURL
+		if baseURL == "" {
+			baseURL = "https://api.github.com"
+		}
+		uri := fmt.Sprintf("%s/app/installations/%s/access_tokens", strings.TrimRight(baseURL, "/"), g.InstallationID)
+		req, err := http.NewRequest("POST", uri, nil)
+		if err != nil {
+			return "", 0, err
+		}
+		req.Header.Set("Authorization", "Bearer "+assertion)
+		req.Header.Set("Accept", "application/vnd.github+json")
+		response, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", 0, err
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusCreated {
+			return "", 0, fmt.Errorf("could not obtain GitHub App token (status %d)", response.StatusCode)
+		}
+		var installation struct {
+			Token     string    `json:"token"`
+			ExpiresAt time.Time `json:"expires_at"`
+		}
+		if err := json.NewDecoder(response.Body).Decode(&installation); err != nil {
+			return "", 0, err
+		}
+		return installation.Token, time.Until(installation.ExpiresAt), nil
+	})
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Authorization", "token "+token)
+	return nil
+}
+
+// AWSSigV4Auth signs requests with AWS Signature Version 4 (eg. for S3 buckets).
+type AWSSigV4Auth struct {
+	Region  string
+	Service string
+	// Credentials default to the `AWS_ACCESS_KEY_ID`, `AWS_SECRET_ACCESS_KEY` and
+	// `AWS_SESSION_TOKEN` environment variables.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// now is used in tests.
+	now func() time.Time
+}
+
+// Authenticate signs the request.
+func (a *AWSSigV4Auth) Authenticate(r *http.Request) error {
+	accessKeyID, secretAccessKey, sessionToken := a.AccessKeyID, a.SecretAccessKey, a.SessionToken
+	if accessKeyID == "" {
+		accessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		secretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if accessKeyID == "" || secretAccessKey == "" {
+		return fmt.Errorf("no AWS credentials")
+	}
+
+	now := time.Now
+	if a.now != nil {
+		now = a.now
+	}
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	var payload []byte
+	if r.GetBody != nil {
+		body, err := r.GetBody()
+		if err != nil {
+			return err
+		}
+		payload, err = ioutil.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return err
+		}
+	}
+	payloadSum := sha256.Sum256(payload)
+	payloadHash := hex.EncodeToString(payloadSum[:])
+	r.Header.Set("X-Amz-Date", amzDate)
+	if a.Service == "s3" {
+		r.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+	if sessionToken != "" {
+		r.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	// Canonical headers: host, content type and the `x-amz-*` ones.
+	headers := map[string]string{"host": r.URL.Host}
+	for name, values := range r.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := []string{}
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders bytes.Buffer
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := r.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	query := r.URL.Query()
+	keys := []string{}
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := []string{}
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, awsEscape(key)+"="+awsEscape(value))
+		}
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		path,
+		strings.Join(params, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := strings.Join([]string{date, a.Region, a.Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, a.Region)
+	key = hmacSHA256(key, a.Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	r.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, signature))
+	return nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsEscape encodes the query string values as specified by AWS.
+func awsEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	jwt "gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestHeaderAuth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token abc" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("service: a\nidentityProvider:\n"))
+	}))
+	defer ts.Close()
+
+	configs, err := LoadFrom(&URLSource{
+		URL:  ts.URL + "/policies.yaml",
+		Auth: &HeaderAuth{"Authorization", "token abc"},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, "a", configs[0].Service)
+}
+
+func TestOAuthClientCredentials(t *testing.T) {
+	issued := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			user, password, _ := r.BasicAuth()
+			r.ParseForm()
+			if user != "doorman" || password != "s3cr3t" || r.Form.Get("grant_type") != "client_credentials" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			assert.Equal(t, "read write", r.Form.Get("scope"))
+			issued++
+			fmt.Fprintf(w, `{"access_token": "tok%d", "expires_in": 3600}`, issued)
+			return
+		}
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer ts.Close()
+
+	auth := &OAuthClientCredentials{
+		TokenURL:     ts.URL + "/token",
+		ClientID:     "doorman",
+		ClientSecret: "s3cr3t",
+		Scopes:       []string{"read", "write"},
+	}
+	content, err := fetch(ts.URL+"/policies.yaml", nil, auth)
+	require.Nil(t, err)
+	assert.Equal(t, "Bearer tok1", string(content))
+	// Token is reused.
+	content, _ = fetch(ts.URL+"/policies.yaml", nil, auth)
+	assert.Equal(t, "Bearer tok1", string(content))
+	assert.Equal(t, 1, issued)
+
+	auth = &OAuthClientCredentials{TokenURL: ts.URL + "/token", ClientID: "doorman"}
+	_, err = fetch(ts.URL+"/policies.yaml", nil, auth)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "could not authenticate")
+}
+
+func TestGCPMetadataAuth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"access_token": "ya29.abc", "expires_in": 3599, "token_type": "Bearer"}`))
+	}))
+	defer ts.Close()
+
+	auth := &GCPMetadataAuth{MetadataURL: ts.URL}
+	r, _ := http.NewRequest("GET", "https://storage.googleapis.com/bucket/policies.yaml", nil)
+	err := auth.Authenticate(r)
+	require.Nil(t, err)
+	assert.Equal(t, "Bearer ya29.abc", r.Header.Get("Authorization"))
+}
+
+func TestGithubAppAuth(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	privateKey := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/app/installations/42/access_tokens", r.URL.Path)
+		token, err := jwt.ParseSigned(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		require.Nil(t, err)
+		claims := jwt.Claims{}
+		require.Nil(t, token.Claims(&key.PublicKey, &claims))
+		assert.Equal(t, "1234", claims.Issuer)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": "ghs_abc", "expires_at": %q}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+	}))
+	defer ts.Close()
+
+	auth := &GithubAppAuth{
+		AppID:          "1234",
+		InstallationID: "42",
+		PrivateKey:     privateKey,
+		BaseURL:        ts.URL,
+	}
+	r, _ := http.NewRequest("GET", "https://raw.githubusercontent.com/moz/ops/master/policies.yaml", nil)
+	err := auth.Authenticate(r)
+	require.Nil(t, err)
+	assert.Equal(t, "token ghs_abc", r.Header.Get("Authorization"))
+
+	err = (&GithubAppAuth{PrivateKey: []byte("abc")}).Authenticate(r)
+	assert.NotNil(t, err)
+}
+
+func TestAWSSigV4Auth(t *testing.T) {
+	// Example from the AWS Signature Version 4 documentation.
+	auth := &AWSSigV4Auth{
+		Region:          "us-east-1",
+		Service:         "iam",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		now: func() time.Time {
+			return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+		},
+	}
+	r, _ := http.NewRequest("GET", "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	err := auth.Authenticate(r)
+	require.Nil(t, err)
+	assert.Equal(t, "20150830T123600Z", r.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+		"SignedHeaders=content-type;host;x-amz-date, "+
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7", r.Header.Get("Authorization"))
+
+	// S3 requires the payload hash.
+	auth.Service = "s3"
+	auth.SessionToken = "session"
+	r, _ = http.NewRequest("GET", "https://bucket.s3.amazonaws.com/policies.yaml", nil)
+	err = auth.Authenticate(r)
+	require.Nil(t, err)
+	assert.NotEqual(t, "", r.Header.Get("X-Amz-Content-Sha256"))
+	assert.Equal(t, "session", r.Header.Get("X-Amz-Security-Token"))
+	assert.Contains(t, r.Header.Get("Authorization"), "SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token,")
+
+	// No credentials.
+	err = (&AWSSigV4Auth{Region: "us-east-1", Service: "s3"}).Authenticate(r)
+	assert.NotNil(t, err)
+}
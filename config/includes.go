@@ -0,0 +1,134 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// files gives access to the files included by policies files.
+type files interface {
+	// path returns the location of the file included from the source file.
+	path(source string, include string) (string, error)
+	// read returns the content of the file.
+	read(filename string) ([]byte, error)
+}
+
+// localFiles reads included files from local disk.
+type localFiles struct{}
+
+func (localFiles) path(source string, include string) (string, error) {
+	filename := include
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(filepath.Dir(source), include)
+	}
+	return filepath.Abs(filename)
+}
+
+func (localFiles) read(filename string) ([]byte, error) {
+	return ioutil.ReadFile(filename)
+}
+
+// fsFiles reads included files from a file system (eg. embedded files).
+type fsFiles struct {
+	fsys fs.FS
+}
+
+func (fsFiles) path(source string, include string) (string, error) {
+	filename := path.Join(path.Dir(source), include)
+	if !fs.ValidPath(filename) {
+		return "", fmt.Errorf("invalid include path %q in %q", include, source)
+	}
+	return filename, nil
+}
+
+func (f fsFiles) read(filename string) ([]byte, error) {
+	return fs.ReadFile(f.fsys, filename)
+}
+
+// resolveIncludes merges the tags and policies of the files listed in `includes`
+// into the specified configuration. Included files paths are relative to the
+// including file, and can include other files themselves.
+func (p *parser) resolveIncludes(config *doorman.ServiceConfig, source string, parents []string) error {
+	if len(config.Includes) == 0 {
+		return nil
+	}
+	if p.files == nil {
+		return fmt.Errorf("includes are only supported for local files (%q)", source)
+	}
+
+	current, err := p.files.path("", source)
+	if err != nil {
+		return err
+	}
+	parents = append(parents, current)
+
+	for _, include := range config.Includes {
+		filename, err := p.files.path(source, include)
+		if err != nil {
+			return err
+		}
+		for _, parent := range parents {
+			if parent == filename {
+				return fmt.Errorf("cyclic include of %q in %q", include, source)
+			}
+		}
+
+		log.Debugf("Include %q in %q", filename, source)
+		fragment, err := p.loadFragment(filename)
+		if err != nil {
+			return err
+		}
+		if err := p.resolveIncludes(fragment, filename, parents); err != nil {
+			return err
+		}
+
+		if len(fragment.Tags) > 0 && config.Tags == nil {
+			config.Tags = doorman.Tags{}
+		}
+		for tag, members := range fragment.Tags {
+			config.Tags[tag] = append(config.Tags[tag], members...)
+			for _, member := range members {
+				config.SetTagSource(tag, member, fragment.TagSource(tag, member))
+			}
+		}
+		config.Policies = append(config.Policies, fragment.Policies...)
+	}
+	return nil
+}
+
+// loadFragment reads a file of shared tags and policies.
+func (p *parser) loadFragment(filename string) (*doorman.ServiceConfig, error) {
+	content, err := p.files.read(filename)
+	if err != nil {
+		return nil, err
+	}
+	content, err = decrypt(content, filename)
+	if err != nil {
+		return nil, err
+	}
+	content, err = expandEnv(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s in %q", err, filename)
+	}
+
+	fragment := doorman.ServiceConfig{}
+	if isJSON(filename) {
+		err = json.Unmarshal(content, &fragment)
+	} else {
+		err = yaml.Unmarshal(content, &fragment)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fragment.Source = filename
+	return &fragment, nil
+}
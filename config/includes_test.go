@@ -0,0 +1,119 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		require.Nil(t, os.MkdirAll(filepath.Dir(filename), 0777))
+		require.Nil(t, ioutil.WriteFile(filename, []byte(content), 0666))
+	}
+}
+
+func TestLoadIncludes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "includes")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, dir, map[string]string{
+		"service.yaml": `
+identityProvider:
+service: a
+includes:
+  - shared/admins.yaml
+tags:
+  admins:
+    - userid:maria
+policies:
+  -
+    id: "1"
+    effect: allow
+`,
+		"shared/admins.yaml": `
+includes:
+  - security.json
+tags:
+  admins:
+    - userid:alice
+policies:
+  -
+    id: admins
+    principals:
+      - tag:admins
+    effect: allow
+`,
+		"shared/security.json": `{
+  "tags": {"security": ["userid:bob"]},
+  "policies": [{"id": "security", "principals": ["tag:security"], "effect": "allow"}]
+}`,
+	})
+
+	configs, err := Load([]string{filepath.Join(dir, "service.yaml")})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(configs))
+	assert.Equal(t, 2, len(configs[0].Tags))
+	assert.Equal(t, []string{"userid:maria", "userid:alice"}, []string(configs[0].Tags["admins"]))
+	require.Equal(t, 3, len(configs[0].Policies))
+	assert.Equal(t, "admins", configs[0].Policies[1].ID)
+	assert.Equal(t, "security", configs[0].Policies[2].ID)
+
+	// Provenance of tags members.
+	assert.Equal(t, filepath.Join(dir, "service.yaml"), configs[0].TagSource("admins", "userid:maria"))
+	assert.Equal(t, filepath.Join(dir, "shared/admins.yaml"), configs[0].TagSource("admins", "userid:alice"))
+	assert.Equal(t, filepath.Join(dir, "shared/security.json"), configs[0].TagSource("security", "userid:bob"))
+}
+
+func TestLoadIncludesErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "includes")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, dir, map[string]string{
+		"missing.yaml": `
+identityProvider:
+service: a
+includes:
+  - unknown.yaml
+`,
+		"cycle.yaml": `
+identityProvider:
+service: a
+includes:
+  - b.yaml
+`,
+		"b.yaml": `
+includes:
+  - c.yaml
+`,
+		"c.yaml": `
+includes:
+  - b.yaml
+`,
+	})
+
+	_, err = Load([]string{filepath.Join(dir, "missing.yaml")})
+	assert.NotNil(t, err)
+
+	_, err = Load([]string{filepath.Join(dir, "cycle.yaml")})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "cyclic include of \"b.yaml\"")
+
+	// Remote sources.
+	p := &parser{identityProvider: notSpecified}
+	c, err := p.parseConfigs([]byte(`
+identityProvider:
+service: a
+includes:
+  - b.yaml
+`), "https://github.com/moz/ops/config.yaml")
+	assert.Nil(t, c)
+	assert.Contains(t, err.Error(), "only supported for local files")
+}
@@ -2,9 +2,11 @@ package config
 
 import (
 	"fmt"
-	log "github.com/sirupsen/logrus"
 	"strings"
 
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mozilla/doorman/authn"
 	"github.com/mozilla/doorman/doorman"
 )
 
@@ -16,6 +18,9 @@ func lintConfigs(configs ...doorman.ServiceConfig) error {
 		if config.Service == "" {
 			return fmt.Errorf("empty service in %q", config.Source)
 		}
+		if _, err := authn.NormalizeAudience(config.Service); err != nil {
+			return fmt.Errorf("%s in %q", err, config.Source)
+		}
 
 		if len(config.Policies) == 0 {
 			log.Warningf("No policies found in %q", config.Source)
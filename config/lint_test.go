@@ -8,6 +8,7 @@ import (
 	"github.com/mozilla/doorman/doorman"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLintingErrors(t *testing.T) {
@@ -17,6 +18,12 @@ func TestLintingErrors(t *testing.T) {
 	}
 	err := lintConfigs(c)
 	assert.NotNil(t, err)
+
+	// Invalid audience
+	c.Service = "https://"
+	err = lintConfigs(c)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "audience \"https://\" has no host")
 }
 
 func TestLintingWarnings(t *testing.T) {
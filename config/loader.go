@@ -4,8 +4,6 @@
 package config
 
 import (
-	"fmt"
-
 	"github.com/mozilla/doorman/doorman"
 )
 
@@ -30,26 +28,31 @@ func AddLoader(l Loader) {
 
 // Load will load and parse the specified sources.
 func Load(sources []string) (doorman.ServicesConfig, error) {
+	configs, err := load(sources)
+	if err != nil {
+		return nil, err
+	}
+	if err := lintConfigs(configs...); err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+// load parses the specified sources using the appropriate loaders.
+func load(sources []string) (doorman.ServicesConfig, error) {
 	configs := doorman.ServicesConfig{}
-	for _, source := range sources {
-		loaded := false
-		for _, loader := range loaders {
-			if loader.CanLoad(source) {
-				c, err := loader.Load(source)
-				if err != nil {
-					return nil, err
-				}
-				err = lintConfigs(c...)
-				if err != nil {
-					return nil, err
-				}
-				configs = append(configs, c...)
-				loaded = true
-			}
+	for _, location := range sources {
+		source, err := NewSource(location)
+		if err != nil {
+			recordSourceStatus(location, 0, err)
+			return nil, err
 		}
-		if !loaded {
-			return nil, fmt.Errorf("no appropriate loader found for %q", source)
+		c, err := source.Fetch()
+		recordSourceStatus(location, len(c), err)
+		if err != nil {
+			return nil, err
 		}
+		configs = append(configs, c...)
 	}
 	return configs, nil
 }
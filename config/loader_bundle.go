@@ -0,0 +1,247 @@
+package config
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	jose "gopkg.in/square/go-jose.v2"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// bundleRegexp matches the bundles locations.
+var bundleRegexp = regexp.MustCompile(`^.*\.(tar\.gz|tgz)$`)
+
+const (
+	// bundleManifest is the name of the bundle manifest file.
+	bundleManifest = ".manifest"
+	// bundleSignature is the name of the file with the signed manifest.
+	bundleSignature = ".signature"
+)
+
+var (
+	// maxBundleFileSize is the maximum size of an uncompressed bundle file.
+	maxBundleFileSize int64 = 10 << 20
+	// maxBundleSize is the maximum size of all uncompressed bundle files.
+	maxBundleSize int64 = 50 << 20
+)
+
+// bundleManifestContent is the content of the bundle manifest.
+type bundleManifestContent struct {
+	// Revision identifies the version of the bundle.
+	Revision string `json:"revision"`
+	// Policies lists the services policies files (default: all files).
+	Policies []string `json:"policies"`
+	// Files maps every file of the bundle to its SHA-256 checksum.
+	Files map[string]string `json:"files"`
+}
+
+// BundleLoader reads configuration from signed tarball bundles, from disk or URLs.
+//
+// A bundle is a gzipped tarball with policies files, a `.manifest` file listing
+// their checksums, and a `.signature` file with the manifest signed as JWS.
+type BundleLoader struct {
+	// PublicKeyFile is the location of the PEM public key that verifies the bundles
+	// signatures.
+	PublicKeyFile string
+	// Auth authenticates the requests to download bundles (optional).
+	Auth FetchAuthenticator
+}
+
+func isBundle(source string) bool {
+	return bundleRegexp.MatchString(source)
+}
+
+// CanLoad will return true if the source is a bundle.
+func (b *BundleLoader) CanLoad(source string) bool {
+	return isBundle(source)
+}
+
+// Load reads the bundle, verifies its signature and parses its policies files.
+func (b *BundleLoader) Load(source string) (doorman.ServicesConfig, error) {
+	log.Infof("Load bundle %q", source)
+
+	content, err := b.read(source)
+	if err != nil {
+		return nil, err
+	}
+	files, err := untarBundle(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s (bundle %q)", err, source)
+	}
+	manifest, err := b.verify(files)
+	if err != nil {
+		return nil, fmt.Errorf("%s (bundle %q)", err, source)
+	}
+	log.Infof("Bundle %q revision %q verified", source, manifest.Revision)
+
+	filenames := manifest.Policies
+	if len(filenames) == 0 {
+		for filename := range manifest.Files {
+			filenames = append(filenames, filename)
+		}
+		sort.Strings(filenames)
+	}
+
+	p := &parser{files: bundleFiles(files), identityProvider: notSpecified}
+	configs := doorman.ServicesConfig{}
+	for _, filename := range filenames {
+		content, ok := files[filename]
+		if !ok {
+			return nil, fmt.Errorf("missing file %q (bundle %q)", filename, source)
+		}
+		c, err := p.parseConfigs(content, filename)
+		if err != nil {
+			return nil, fmt.Errorf("%s (bundle %q)", err, source)
+		}
+		for i := range c {
+			c[i].Source = fmt.Sprintf("%s#%s", source, filename)
+		}
+		configs = append(configs, c...)
+	}
+	return configs, nil
+}
+
+// verify checks the manifest signature and the files checksums.
+func (b *BundleLoader) verify(files map[string][]byte) (*bundleManifestContent, error) {
+	if b.PublicKeyFile == "" {
+		return nil, fmt.Errorf("no public key to verify bundle")
+	}
+	key, err := readPublicKey(b.PublicKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, ok := files[bundleSignature]
+	if !ok {
+		return nil, fmt.Errorf("missing %s file", bundleSignature)
+	}
+	jws, err := jose.ParseSigned(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return nil, err
+	}
+	payload, err := jws.Verify(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %s", err)
+	}
+	if !bytes.Equal(payload, files[bundleManifest]) {
+		return nil, fmt.Errorf("signature does not match %s", bundleManifest)
+	}
+
+	var manifest bundleManifestContent
+	if err := json.Unmarshal(payload, &manifest); err != nil {
+		return nil, err
+	}
+	for filename, content := range files {
+		if filename == bundleManifest || filename == bundleSignature {
+			continue
+		}
+		expected, ok := manifest.Files[filename]
+		if !ok {
+			return nil, fmt.Errorf("file %q not in %s", filename, bundleManifest)
+		}
+		sum := sha256.Sum256(content)
+		if hex.EncodeToString(sum[:]) != expected {
+			return nil, fmt.Errorf("checksum mismatch for %q", filename)
+		}
+	}
+	for filename := range manifest.Files {
+		if _, ok := files[filename]; !ok {
+			return nil, fmt.Errorf("missing file %q", filename)
+		}
+	}
+	return &manifest, nil
+}
+
+// read returns the bundle content from disk or URL.
+func (b *BundleLoader) read(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return ioutil.ReadFile(source)
+	}
+	log.Debugf("Download %q", source)
+	return fetch(source, nil, b.Auth)
+}
+
+// untarBundle returns the regular files of the gzipped tarball by path.
+//
+// The files are read before the signature is verified, hence their sizes are
+// limited (see maxBundleFileSize and maxBundleSize).
+func untarBundle(content []byte) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	files := map[string][]byte{}
+	var total int64
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		data, err := ioutil.ReadAll(io.LimitReader(archive, maxBundleFileSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(data)) > maxBundleFileSize {
+			return nil, fmt.Errorf("file %q exceeds %d bytes", name, maxBundleFileSize)
+		}
+		total += int64(len(data))
+		if total > maxBundleSize {
+			return nil, fmt.Errorf("bundle exceeds %d bytes", maxBundleSize)
+		}
+		files[name] = data
+	}
+	return files, nil
+}
+
+// readPublicKey reads a PEM encoded public key.
+func readPublicKey(filename string) (interface{}, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM public key in %q", filename)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// bundleFiles gives access to the files included from the bundle policies files.
+type bundleFiles map[string][]byte
+
+func (bundleFiles) path(source string, include string) (string, error) {
+	return fsFiles{}.path(source, include)
+}
+
+func (b bundleFiles) read(filename string) ([]byte, error) {
+	content, ok := b[filename]
+	if !ok {
+		return nil, fmt.Errorf("file %q not found in bundle", filename)
+	}
+	return content, nil
+}
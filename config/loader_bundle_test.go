@@ -0,0 +1,208 @@
+package config
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+var sampleBundleFiles = map[string]string{
+	"service.yaml": `
+service: a
+identityProvider:
+includes:
+  - shared/admins.yaml
+`,
+	"shared/admins.yaml": `
+tags:
+  admins:
+    - userid:maria
+`,
+}
+
+// writeBundle creates a bundle of the specified files, signed with the key.
+func writeBundle(t *testing.T, filename string, files map[string]string, key *ecdsa.PrivateKey) {
+	checksums := map[string]string{}
+	for name, content := range files {
+		sum := sha256.Sum256([]byte(content))
+		checksums[name] = hex.EncodeToString(sum[:])
+	}
+	manifest, _ := json.Marshal(bundleManifestContent{
+		Revision: "42",
+		Policies: []string{"service.yaml"},
+		Files:    checksums,
+	})
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, nil)
+	require.Nil(t, err)
+	jws, err := signer.Sign(manifest)
+	require.Nil(t, err)
+	signature, _ := jws.CompactSerialize()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	archive := tar.NewWriter(gz)
+	all := map[string]string{
+		bundleManifest:  string(manifest),
+		bundleSignature: signature,
+	}
+	for name, content := range files {
+		all[name] = content
+	}
+	for name, content := range all {
+		archive.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0600,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		})
+		archive.Write([]byte(content))
+	}
+	archive.Close()
+	gz.Close()
+	err = ioutil.WriteFile(filename, buf.Bytes(), 0600)
+	require.Nil(t, err)
+}
+
+func writePublicKey(t *testing.T, filename string, key *ecdsa.PrivateKey) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.Nil(t, err)
+	content := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	err = ioutil.WriteFile(filename, content, 0600)
+	require.Nil(t, err)
+}
+
+func TestBundleLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundles")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	publicKey := filepath.Join(dir, "key.pem")
+	writePublicKey(t, publicKey, key)
+	bundle := filepath.Join(dir, "policies.tar.gz")
+	writeBundle(t, bundle, sampleBundleFiles, key)
+
+	loader := &BundleLoader{PublicKeyFile: publicKey}
+	assert.True(t, loader.CanLoad(bundle))
+	assert.False(t, loader.CanLoad(filepath.Join(dir, "key.pem")))
+	assert.False(t, (&FileLoader{}).CanLoad(bundle))
+
+	configs, err := loader.Load(bundle)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(configs))
+	assert.Equal(t, "a", configs[0].Service)
+	assert.Equal(t, bundle+"#service.yaml", configs[0].Source)
+	assert.Equal(t, []string{"userid:maria"}, []string(configs[0].Tags["admins"]))
+
+	// From URL.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, bundle)
+	}))
+	defer ts.Close()
+	configs, err = loader.Load(ts.URL + "/policies.tar.gz")
+	require.Nil(t, err)
+	assert.Equal(t, 1, len(configs))
+}
+
+func TestBundleLoaderErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundles")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	publicKey := filepath.Join(dir, "key.pem")
+	writePublicKey(t, publicKey, key)
+	bundle := filepath.Join(dir, "policies.tgz")
+	writeBundle(t, bundle, sampleBundleFiles, key)
+
+	// No public key.
+	_, err = (&BundleLoader{}).Load(bundle)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no public key")
+
+	// Signed with another key.
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey := filepath.Join(dir, "other.pem")
+	writePublicKey(t, otherKey, other)
+	_, err = (&BundleLoader{PublicKeyFile: otherKey}).Load(bundle)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid signature")
+
+	loader := &BundleLoader{PublicKeyFile: publicKey}
+
+	// Missing bundle.
+	_, err = loader.Load(filepath.Join(dir, "missing.tgz"))
+	assert.NotNil(t, err)
+
+	// Not a tarball.
+	notBundle := filepath.Join(dir, "bad.tgz")
+	ioutil.WriteFile(notBundle, []byte("abc"), 0600)
+	_, err = loader.Load(notBundle)
+	assert.NotNil(t, err)
+
+	// Files not matching the manifest.
+	content, _ := ioutil.ReadFile(bundle)
+	files, _ := untarBundle(content)
+	files["shared/admins.yaml"] = []byte("tags:\n  admins:\n    - userid:mallory\n")
+	_, err = loader.verify(files)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "checksum mismatch for \"shared/admins.yaml\"")
+
+	files["shared/admins.yaml"] = []byte(sampleBundleFiles["shared/admins.yaml"])
+	files["extra.yaml"] = []byte("service: b")
+	_, err = loader.verify(files)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "not in .manifest")
+
+	delete(files, "extra.yaml")
+	delete(files, "service.yaml")
+	_, err = loader.verify(files)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "missing file \"service.yaml\"")
+}
+
+func TestBundleLoaderSizeLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundles")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	publicKey := filepath.Join(dir, "key.pem")
+	writePublicKey(t, publicKey, key)
+	bundle := filepath.Join(dir, "policies.tgz")
+	writeBundle(t, bundle, sampleBundleFiles, key)
+	loader := &BundleLoader{PublicKeyFile: publicKey}
+
+	defer func(file, total int64) {
+		maxBundleFileSize, maxBundleSize = file, total
+	}(maxBundleFileSize, maxBundleSize)
+
+	maxBundleFileSize = 16
+	_, err = loader.Load(bundle)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "exceeds 16 bytes")
+
+	maxBundleFileSize = 10 << 20
+	maxBundleSize = 64
+	_, err = loader.Load(bundle)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "bundle exceeds 64 bytes")
+}
@@ -1,25 +1,47 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 
+	"github.com/mozilla/doorman/authn"
 	"github.com/mozilla/doorman/doorman"
 )
 
 // notSpecified is a simple string to detect unspecified values while unmarshalling.
 const notSpecified = "N/A"
 
+// envVarRegexp matches the `${VAR}` placeholders in policies files.
+var envVarRegexp = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+// documentSeparatorRegexp matches the lines separating YAML documents.
+var documentSeparatorRegexp = regexp.MustCompile(`(?m)^---[ \t]*\r?$`)
+
+// parser holds the settings used to parse policies files.
+type parser struct {
+	// files gives access to the included files (nil if not supported).
+	files files
+	// identityProvider is used for files where it is not specified (notSpecified
+	// if mandatory).
+	identityProvider string
+}
+
 // FileLoader loads from local disk (file, folder)
 type FileLoader struct{}
 
-// CanLoad will return true if the path exists.
+// CanLoad will return true if the path exists (and is not a bundle).
 func (f *FileLoader) CanLoad(path string) bool {
+	if isBundle(path) {
+		return false
+	}
 	_, err := os.Stat(path)
 	return !os.IsNotExist(err)
 }
@@ -53,35 +75,144 @@ func (f *FileLoader) Load(path string) (doorman.ServicesConfig, error) {
 	// Load configurations.
 	configs := doorman.ServicesConfig{}
 	for _, f := range filenames {
-		config, err := loadFile(f)
+		c, err := loadFile(f)
 		if err != nil {
 			return nil, err
 		}
-		configs = append(configs, *config)
+		configs = append(configs, c...)
 	}
 	return configs, nil
 }
 
-func loadFile(filename string) (*doorman.ServiceConfig, error) {
+func loadFile(filename string) (doorman.ServicesConfig, error) {
 	log.Debugf("Parse file %q", filename)
 	fileContent, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
-	if len(fileContent) == 0 {
-		return nil, fmt.Errorf("empty file %q", filename)
+	p := &parser{files: localFiles{}, identityProvider: notSpecified}
+	return p.parseConfigs(fileContent, filename)
+}
+
+// parseConfigs reads the policies file content, decrypted if necessary. The source
+// extension determines whether it is parsed as JSON or YAML. YAML files can contain
+// several services configurations as `---` separated documents.
+func (p *parser) parseConfigs(content []byte, source string) (doorman.ServicesConfig, error) {
+	if len(content) == 0 {
+		return nil, fmt.Errorf("empty file %q", source)
+	}
+
+	content, err := decrypt(content, source)
+	if err != nil {
+		return nil, err
+	}
+	content, err = expandEnv(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s in %q", err, source)
+	}
+
+	documents := [][]byte{content}
+	if !isJSON(source) {
+		documents = splitDocuments(content)
+	}
+
+	configs := doorman.ServicesConfig{}
+	for _, document := range documents {
+		config, err := p.parseConfig(document, source)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.resolveIncludes(config, source, nil); err != nil {
+			return nil, err
+		}
+		if err := p.resolveOverlays(config, source); err != nil {
+			return nil, err
+		}
+		// Local keys paths are relative to the policies file.
+		if _, ok := p.files.(localFiles); ok {
+			for _, filename := range []*string{&config.JWKSFile, &config.APIKeys.File} {
+				if *filename == "" {
+					continue
+				}
+				if *filename, err = p.files.path(source, *filename); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err := expandTemplates(config); err != nil {
+			return nil, fmt.Errorf("%s in %q", err, source)
+		}
+		// Invalid audiences are reported by lintConfigs() and validateConfigs().
+		if service, err := authn.NormalizeAudience(config.Service); err == nil {
+			config.Service = service
+		}
+		configs = append(configs, *config)
 	}
+	return configs, nil
+}
 
+func (p *parser) parseConfig(content []byte, source string) (*doorman.ServiceConfig, error) {
+	var err error
 	config := doorman.ServiceConfig{
-		IdentityProvider: notSpecified,
+		IdentityProvider: p.identityProvider,
+	}
+	if isJSON(source) {
+		err = json.Unmarshal(content, &config)
+	} else {
+		err = yaml.Unmarshal(content, &config)
 	}
-	if err := yaml.Unmarshal(fileContent, &config); err != nil {
+	if err != nil {
 		return nil, err
 	}
+	if config.Version > SchemaVersion {
+		return nil, fmt.Errorf("unsupported schema version %d in %q", config.Version, source)
+	}
 	if config.IdentityProvider == notSpecified {
-		return nil, fmt.Errorf("identityProvider not specified in %q", filename)
+		if len(config.IdentityProviders) == 0 {
+			return nil, fmt.Errorf("identityProvider not specified in %q", source)
+		}
+		config.IdentityProvider = ""
 	}
-	config.Source = filename
+	config.Source = source
 
 	return &config, nil
 }
+
+func isJSON(source string) bool {
+	return strings.ToLower(filepath.Ext(source)) == ".json"
+}
+
+// splitDocuments splits the YAML content on `---` separators lines. Blank documents
+// are ignored.
+func splitDocuments(content []byte) [][]byte {
+	documents := [][]byte{}
+	for _, document := range documentSeparatorRegexp.Split(string(content), -1) {
+		if strings.TrimSpace(document) == "" {
+			continue
+		}
+		documents = append(documents, []byte(document))
+	}
+	// Always parse at least one document (eg. blank file).
+	if len(documents) == 0 {
+		documents = append(documents, content)
+	}
+	return documents
+}
+
+// expandEnv replaces the `${VAR}` placeholders with the values of the environment
+// variables. It fails if one of them is not defined.
+func expandEnv(content []byte) ([]byte, error) {
+	var err error
+	expanded := envVarRegexp.ReplaceAllFunc(content, func(match []byte) []byte {
+		name := string(envVarRegexp.FindSubmatch(match)[1])
+		value, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("undefined environment variable %q", name)
+		}
+		return []byte(value)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return expanded, nil
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// NewFromFS instantiates a doorman with the policies files or folders of the file
+// system (eg. embedded with `go:embed`). If not empty, the issuer is used as the
+// identity provider of the files that do not specify one.
+func NewFromFS(fsys fs.FS, paths []string, issuer string) (*doorman.LadonDoorman, error) {
+	p := &parser{files: fsFiles{fsys}, identityProvider: notSpecified}
+	if issuer != "" {
+		p.identityProvider = issuer
+	}
+	configs, err := p.loadFS(fsys, paths)
+	if err != nil {
+		return nil, err
+	}
+	if err := lintConfigs(configs...); err != nil {
+		return nil, err
+	}
+	d := doorman.NewDefaultLadon()
+	if err := d.LoadPolicies(configs); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// LoadFS will load and parse the specified files or folders of the file system.
+func LoadFS(fsys fs.FS, paths []string) (doorman.ServicesConfig, error) {
+	p := &parser{files: fsFiles{fsys}, identityProvider: notSpecified}
+	configs, err := p.loadFS(fsys, paths)
+	if err != nil {
+		return nil, err
+	}
+	if err := lintConfigs(configs...); err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+// Parse parses the content of a policies file. The source is only used to
+// determine the format (JSON with `.json` extension, YAML otherwise) and in error
+// messages. Included files are not supported.
+func Parse(content []byte, source string) (doorman.ServicesConfig, error) {
+	p := &parser{identityProvider: notSpecified}
+	configs, err := p.parseConfigs(content, source)
+	if err != nil {
+		return nil, err
+	}
+	if err := lintConfigs(configs...); err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+// Read reads and parses a policies file content. See Parse().
+func Read(r io.Reader, source string) (doorman.ServicesConfig, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(content, source)
+}
+
+// loadFS reads the files of the file system, and scans the folders.
+func (p *parser) loadFS(fsys fs.FS, paths []string) (doorman.ServicesConfig, error) {
+	configs := doorman.ServicesConfig{}
+	for _, root := range paths {
+		log.Infof("Load %q from file system", root)
+		fileInfo, err := fs.Stat(fsys, root)
+		if err != nil {
+			return nil, err
+		}
+
+		filenames := []string{root}
+		if fileInfo.IsDir() {
+			entries, err := fs.ReadDir(fsys, root)
+			if err != nil {
+				return nil, err
+			}
+			filenames = []string{}
+			for _, entry := range entries {
+				if entry.IsDir() {
+					continue
+				}
+				filenames = append(filenames, path.Join(root, entry.Name()))
+			}
+		}
+
+		for _, filename := range filenames {
+			log.Debugf("Parse file %q", filename)
+			content, err := fs.ReadFile(fsys, filename)
+			if err != nil {
+				return nil, err
+			}
+			c, err := p.parseConfigs(content, filename)
+			if err != nil {
+				return nil, err
+			}
+			configs = append(configs, c...)
+		}
+	}
+	return configs, nil
+}
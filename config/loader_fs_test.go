@@ -0,0 +1,111 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sampleFS = fstest.MapFS{
+	"policies/a.yaml": &fstest.MapFile{Data: []byte(`
+service: a
+includes:
+  - ../shared/admins.yaml
+policies:
+  - id: read
+    principals:
+      - tag:admins
+    actions:
+      - read
+    resources:
+      - <.*>
+    effect: allow
+`)},
+	"policies/b.json": &fstest.MapFile{Data: []byte(`{
+  "service": "b",
+  "identityProvider": "",
+  "policies": []
+}`)},
+	"shared/admins.yaml": &fstest.MapFile{Data: []byte(`
+tags:
+  admins:
+    - userid:maria
+`)},
+}
+
+func TestLoadFS(t *testing.T) {
+	_, err := LoadFS(sampleFS, []string{"policies"})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "identityProvider not specified in \"policies/a.yaml\"")
+
+	configs, err := LoadFS(sampleFS, []string{"policies/b.json"})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(configs))
+	assert.Equal(t, "b", configs[0].Service)
+	assert.Equal(t, "policies/b.json", configs[0].Source)
+
+	_, err = LoadFS(sampleFS, []string{"missing.yaml"})
+	assert.NotNil(t, err)
+}
+
+func TestNewFromFS(t *testing.T) {
+	d, err := NewFromFS(sampleFS, []string{"policies"}, "")
+	require.NotNil(t, err)
+	assert.Nil(t, d)
+
+	d, err = NewFromFS(sampleFS, []string{"policies"}, "https://auth.mozilla.auth0.com/")
+	require.Nil(t, err)
+
+	a, _ := d.ServiceConfig("a")
+	assert.Equal(t, "https://auth.mozilla.auth0.com/", a.IdentityProvider)
+	assert.Equal(t, []string{"userid:maria"}, []string(a.Tags["admins"]))
+	b, _ := d.ServiceConfig("b")
+	assert.Equal(t, "", b.IdentityProvider)
+
+	// Included files must remain in the file system.
+	fsys := fstest.MapFS{
+		"a.yaml": &fstest.MapFile{Data: []byte("service: a\nincludes:\n  - ../b.yaml\n")},
+	}
+	_, err = NewFromFS(fsys, []string{"a.yaml"}, "https://auth.mozilla.auth0.com/")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid include path")
+}
+
+func TestParse(t *testing.T) {
+	configs, err := Parse([]byte(`
+service: a
+identityProvider:
+---
+service: b
+identityProvider:
+`), "memory.yaml")
+	require.Nil(t, err)
+	assert.Equal(t, 2, len(configs))
+
+	configs, err = Read(strings.NewReader(`{"service": "a", "identityProvider": ""}`), "memory.json")
+	require.Nil(t, err)
+	assert.Equal(t, "a", configs[0].Service)
+
+	_, err = Parse([]byte("service: a\nidentityProvider:\nincludes:\n  - b.yaml\n"), "memory.yaml")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "only supported for local files")
+
+	_, err = Parse([]byte(""), "memory.yaml")
+	assert.NotNil(t, err)
+
+	configs, err = Parse([]byte(`
+service: a
+identityProvider:
+policies:
+  - id: temporary
+    validFrom: 2018-03-01T09:00:00Z
+    validUntil: 2018-03-02T09:00:00+01:00
+`), "memory.yaml")
+	require.Nil(t, err)
+	assert.Equal(t, time.Date(2018, 3, 1, 9, 0, 0, 0, time.UTC), configs[0].Policies[0].ValidFrom.UTC())
+	assert.Equal(t, time.Date(2018, 3, 2, 8, 0, 0, 0, time.UTC), configs[0].Policies[0].ValidUntil.UTC())
+}
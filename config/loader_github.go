@@ -2,9 +2,7 @@ package config
 
 import (
 	"fmt"
-	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"regexp"
 
@@ -18,10 +16,15 @@ type headers map[string]string
 // GithubLoader reads configuration from Github URLs.
 type GithubLoader struct {
 	Token string
+	// Auth authenticates the requests instead of the token (eg. GitHub App).
+	Auth FetchAuthenticator
 }
 
-// CanLoad will return true if the URL contains github
+// CanLoad will return true if the URL contains github (and is not a bundle).
 func (ghl *GithubLoader) CanLoad(url string) bool {
+	if isBundle(url) {
+		return false
+	}
 	regexpRepo, _ := regexp.Compile("^https://.*github.*/.*$")
 	return regexpRepo.MatchString(url)
 }
@@ -30,7 +33,7 @@ func (ghl *GithubLoader) CanLoad(url string) bool {
 func (ghl *GithubLoader) Load(source string) (doorman.ServicesConfig, error) {
 	log.Infof("Load %q from Github", source)
 
-	regexpFile, _ := regexp.Compile("^.*\\.ya?ml$")
+	regexpFile, _ := regexp.Compile("^.*\\.(ya?ml|json)$")
 
 	urls := []string{}
 	// Single file URL.
@@ -41,45 +44,49 @@ func (ghl *GithubLoader) Load(source string) (doorman.ServicesConfig, error) {
 		return nil, fmt.Errorf("loading from Github folder is not supported yet")
 	}
 
-	headers := headers{
-		"Authorization": fmt.Sprintf("token %s", ghl.Token),
+	headers := headers{}
+	if ghl.Token != "" {
+		headers["Authorization"] = fmt.Sprintf("token %s", ghl.Token)
 	}
 
-	// Load configurations.
+	// Load configurations. Included files are not supported.
+	p := &parser{identityProvider: notSpecified}
 	configs := doorman.ServicesConfig{}
 	for _, url := range urls {
-		tmpFile, err := download(url, headers)
+		tmpFile, err := download(url, headers, ghl.Auth)
 		if err != nil {
 			return nil, err
 		}
-		config, err := loadFile(tmpFile.Name())
+		content, err := ioutil.ReadFile(tmpFile.Name())
+		if err != nil {
+			return nil, err
+		}
+		c, err := p.parseConfigs(content, url)
 		if err != nil {
 			return nil, err
 		}
-		config.Source = url
 
 		// Only delete temp file if successful
 		os.Remove(tmpFile.Name())
-		configs = append(configs, *config)
+		configs = append(configs, c...)
 	}
 	return configs, nil
 }
 
-func download(url string, headers headers) (*os.File, error) {
-	f, err := ioutil.TempFile("", "doorman-policy-")
+func download(url string, headers headers, auth FetchAuthenticator) (*os.File, error) {
+	log.Debugf("Download %q", url)
+	content, err := fetch(url, headers, auth)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
 
-	log.Debugf("Download %q", url)
-	response, err := http.Get(url)
+	f, err := ioutil.TempFile("", "doorman-policy-")
 	if err != nil {
 		return nil, err
 	}
-	defer response.Body.Close()
+	defer f.Close()
 
-	size, err := io.Copy(f, response.Body)
+	size, err := f.Write(content)
 	if err != nil {
 		return nil, err
 	}
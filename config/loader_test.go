@@ -162,3 +162,161 @@ policies:
 	assert.Equal(t, len(configs[0].Tags["admins"]), 2)
 	assert.Equal(t, len(configs[0].Tags["editors"]), 1)
 }
+
+func TestLoadEnvVars(t *testing.T) {
+	os.Setenv("DOORMAN_TEST_ENV", "stage")
+	defer os.Unsetenv("DOORMAN_TEST_ENV")
+
+	configs, err := loadTempFiles(`
+identityProvider:
+service: https://${DOORMAN_TEST_ENV}.service.org
+policies:
+  -
+    id: "1"
+    resources:
+      - ${DOORMAN_TEST_ENV}:<.*>
+    effect: allow
+`)
+	require.Nil(t, err)
+	assert.Equal(t, "https://stage.service.org", configs[0].Service)
+	assert.Equal(t, []string{"stage:<.*>"}, configs[0].Policies[0].Resources)
+
+	// Undefined variable.
+	_, err = loadTempFiles(`
+identityProvider:
+service: https://${DOORMAN_TEST_UNDEFINED}.service.org
+`)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "undefined environment variable \"DOORMAN_TEST_UNDEFINED\"")
+}
+
+func TestLoadJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "example")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	testfile := filepath.Join(dir, "test.json")
+	err = ioutil.WriteFile(testfile, []byte(`{
+  "service": "a",
+  "identityProvider": "",
+  "tags": {"admins": ["userid:maria"]},
+  "policies": [
+    {
+      "id": "1",
+      "principals": ["tag:admins"],
+      "actions": ["read"],
+      "conditions": {"planet": {"type": "StringEqualCondition", "options": {"equals": "mars"}}},
+      "effect": "allow"
+    }
+  ]
+}`), 0666)
+	require.Nil(t, err)
+
+	configs, err := Load([]string{testfile})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(configs))
+	assert.Equal(t, "a", configs[0].Service)
+	assert.Equal(t, 1, len(configs[0].Tags))
+	assert.Equal(t, "StringEqualCondition", configs[0].Policies[0].Conditions["planet"].Type)
+
+	// Missing identity provider
+	err = ioutil.WriteFile(testfile, []byte(`{"service": "a"}`), 0666)
+	require.Nil(t, err)
+	_, err = Load([]string{testfile})
+	assert.NotNil(t, err)
+
+	// Bad JSON
+	err = ioutil.WriteFile(testfile, []byte(`service: a`), 0666)
+	require.Nil(t, err)
+	_, err = Load([]string{testfile})
+	assert.NotNil(t, err)
+}
+
+func TestLoadJWKSFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "example")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	testfile := filepath.Join(dir, "test.yaml")
+	err = ioutil.WriteFile(testfile, []byte(`
+service: a
+identityProvider: http://localhost:8080
+jwksFile: keys/jwks.json
+`), 0666)
+	require.Nil(t, err)
+
+	configs, err := Load([]string{testfile})
+	require.Nil(t, err)
+	expected, _ := filepath.Abs(filepath.Join(dir, "keys", "jwks.json"))
+	assert.Equal(t, expected, configs[0].JWKSFile)
+}
+
+func TestLoadIdentityProviders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "example")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	testfile := filepath.Join(dir, "test.yaml")
+	err = ioutil.WriteFile(testfile, []byte(`
+service: a
+identityProviders:
+  - https://old.auth0.com/
+  - https://login.microsoftonline.com/common/v2.0
+`), 0666)
+	require.Nil(t, err)
+
+	configs, err := Load([]string{testfile})
+	require.Nil(t, err)
+	assert.Equal(t, "", configs[0].IdentityProvider)
+	assert.Equal(t, []string{"https://old.auth0.com/", "https://login.microsoftonline.com/common/v2.0"}, configs[0].IdentityProviders)
+}
+
+func TestLoadMultipleDocuments(t *testing.T) {
+	configs, err := loadTempFiles(`---
+identityProvider:
+service: a
+policies:
+  -
+    id: "1"
+    effect: allow
+---
+identityProvider:
+service: b
+tags:
+  admins:
+    - userid:maria
+---
+`)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(configs))
+	assert.Equal(t, "a", configs[0].Service)
+	assert.Equal(t, 1, len(configs[0].Policies))
+	assert.Equal(t, "b", configs[1].Service)
+	assert.Equal(t, 1, len(configs[1].Tags))
+	assert.Equal(t, configs[0].Source, configs[1].Source)
+
+	// Each document is validated.
+	_, err = loadTempFiles(`
+identityProvider:
+service: a
+---
+service: b
+`)
+	assert.NotNil(t, err)
+}
+
+func TestLoadNormalizedService(t *testing.T) {
+	configs, err := loadTempFiles(`
+identityProvider:
+service: HTTPS://Bücher.example:443/
+`)
+	require.Nil(t, err)
+	assert.Equal(t, "https://xn--bcher-kva.example", configs[0].Service)
+
+	_, err = loadTempFiles(`
+identityProvider:
+service: https://api.service.org/?env=stage
+`)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "cannot have credentials, query or fragment")
+}
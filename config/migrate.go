@@ -0,0 +1,213 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// SchemaVersion is the current version of the policies files format.
+//
+// Version 1 is the historical format, with `audience`, `jwtIssuer` and policies
+// `subjects` fields. Version 2 is the current one.
+const SchemaVersion = 2
+
+// migration is a transformation of the policies files content. It is applied
+// on the text to preserve comments, formatting and values types.
+type migration struct {
+	re *regexp.Regexp
+	// replace is the replacement template (eg. `${1}service:`).
+	replace string
+	// expand computes the replacement, instead of the template.
+	expand  func(match string) string
+	message string
+}
+
+func (m migration) apply(document string) string {
+	if m.expand != nil {
+		return m.re.ReplaceAllStringFunc(document, m.expand)
+	}
+	return m.re.ReplaceAllString(document, m.replace)
+}
+
+// yamlSingleValueRegexp matches the policies fields with a single value instead
+// of a list (ie. not a flow or block list, block scalar, anchor or alias).
+var yamlSingleValueRegexp = regexp.MustCompile(`(?m)^([ \t]*(?:-[ \t]+)?)(principals|actions|resources):[ \t]+([^\s\[{#|>&*!'"][^#\n]*?|'(?:[^'\n]|'')*'|"(?:[^"\\\n]|\\.)*")([ \t]+#.*)?[ \t]*$`)
+
+// yamlSingleValueToList turns the single value into a flow list. Plain values
+// are quoted, since they could contain flow indicators (eg. `,` or `{`).
+func yamlSingleValueToList(match string) string {
+	groups := yamlSingleValueRegexp.FindStringSubmatch(match)
+	value := groups[3]
+	if !strings.HasPrefix(value, "'") && !strings.HasPrefix(value, "\"") {
+		value = "'" + strings.Replace(value, "'", "''", -1) + "'"
+	}
+	return fmt.Sprintf("%s%s: [%s]%s", groups[1], groups[2], value, groups[4])
+}
+
+var yamlMigrations = []migration{
+	{
+		re:      regexp.MustCompile(`(?m)^audience:`),
+		replace: "service:",
+		message: "renamed `audience` to `service`",
+	},
+	{
+		re:      regexp.MustCompile(`(?m)^jwtIssuer:`),
+		replace: "identityProvider:",
+		message: "renamed `jwtIssuer` to `identityProvider`",
+	},
+	{
+		re:      regexp.MustCompile(`(?m)^([ \t]*(?:-[ \t]+)?)subjects:`),
+		replace: "${1}principals:",
+		message: "renamed policy `subjects` to `principals`",
+	},
+	{
+		re:      yamlSingleValueRegexp,
+		expand:  yamlSingleValueToList,
+		message: "turned policy single value into a list",
+	},
+}
+
+var jsonMigrations = []migration{
+	{
+		re:      regexp.MustCompile(`"audience"(\s*):`),
+		replace: `"service"${1}:`,
+		message: "renamed `audience` to `service`",
+	},
+	{
+		re:      regexp.MustCompile(`"jwtIssuer"(\s*):`),
+		replace: `"identityProvider"${1}:`,
+		message: "renamed `jwtIssuer` to `identityProvider`",
+	},
+	{
+		re:      regexp.MustCompile(`"subjects"(\s*):`),
+		replace: `"principals"${1}:`,
+		message: "renamed policy `subjects` to `principals`",
+	},
+	{
+		re:      regexp.MustCompile(`"(principals|actions|resources)"(\s*):(\s*)("(?:[^"\\]|\\.)*")`),
+		replace: `"${1}"${2}:${3}[${4}]`,
+		message: "turned policy single value into a list",
+	},
+}
+
+// yamlVersionRegexp matches the schema version of a YAML document.
+var yamlVersionRegexp = regexp.MustCompile(`(?m)^version:[ \t]*(\d+)`)
+
+// jsonVersionRegexp matches the schema version of a JSON document.
+var jsonVersionRegexp = regexp.MustCompile(`"version"\s*:\s*(\d+)`)
+
+// Migrate upgrades the policies file content to the current schema version. It
+// returns the new content, and the list of transformations that were applied
+// (empty if the file is up to date).
+func Migrate(content []byte, source string) ([]byte, []string, error) {
+	if isJSON(source) {
+		return migrateDocument(string(content), source, jsonMigrations, jsonVersionRegexp)
+	}
+	// Migrate YAML documents separately, keeping the separators as is.
+	var result strings.Builder
+	report := []string{}
+	text := string(content)
+	previous := 0
+	for _, bounds := range append(documentSeparatorRegexp.FindAllStringIndex(text, -1), []int{len(text), len(text)}) {
+		migrated, applied, err := migrateDocument(text[previous:bounds[0]], source, yamlMigrations, yamlVersionRegexp)
+		if err != nil {
+			return nil, nil, err
+		}
+		result.Write(migrated)
+		result.WriteString(text[bounds[0]:bounds[1]])
+		report = append(report, applied...)
+		previous = bounds[1]
+	}
+	return []byte(result.String()), report, nil
+}
+
+func migrateDocument(document string, source string, migrations []migration, versionRegexp *regexp.Regexp) ([]byte, []string, error) {
+	report := []string{}
+	if strings.TrimSpace(document) == "" {
+		return []byte(document), report, nil
+	}
+	if m := versionRegexp.FindStringSubmatch(document); m != nil {
+		var version int
+		fmt.Sscanf(m[1], "%d", &version)
+		if version > SchemaVersion {
+			return nil, nil, fmt.Errorf("unsupported schema version %d in %q", version, source)
+		}
+		if version == SchemaVersion {
+			return []byte(document), report, nil
+		}
+	}
+
+	for _, m := range migrations {
+		if count := len(m.re.FindAllStringIndex(document, -1)); count > 0 {
+			document = m.apply(document)
+			report = append(report, fmt.Sprintf("%s (%d)", m.message, count))
+		}
+	}
+
+	// Set the version.
+	if versionRegexp.MatchString(document) {
+		document = versionRegexp.ReplaceAllStringFunc(document, func(match string) string {
+			return strings.TrimRight(match, "0123456789") + fmt.Sprint(SchemaVersion)
+		})
+	} else if versionRegexp == jsonVersionRegexp {
+		i := strings.Index(document, "{")
+		if i < 0 {
+			return nil, nil, fmt.Errorf("invalid JSON document in %q", source)
+		}
+		document = document[:i+1] + fmt.Sprintf("\n  \"version\": %d,", SchemaVersion) + document[i+1:]
+	} else {
+		// After the leading blank lines and comments.
+		lines := strings.SplitAfter(document, "\n")
+		i := 0
+		for i < len(lines) && (strings.TrimSpace(lines[i]) == "" || strings.HasPrefix(strings.TrimSpace(lines[i]), "#")) {
+			i++
+		}
+		lines = append(lines[:i], append([]string{fmt.Sprintf("version: %d\n", SchemaVersion)}, lines[i:]...)...)
+		document = strings.Join(lines, "")
+	}
+	report = append(report, fmt.Sprintf("set schema version %d", SchemaVersion))
+	return []byte(document), report, nil
+}
+
+// MigrateFile upgrades the policies file in place, unless dryRun is true. It
+// returns the list of transformations.
+func MigrateFile(filename string, dryRun bool) ([]string, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if decrypted, err := decrypt(content, filename); err != nil || string(decrypted) != string(content) {
+		return nil, fmt.Errorf("encrypted file %q cannot be migrated", filename)
+	}
+	migrated, report, err := Migrate(content, filename)
+	if err != nil {
+		return nil, err
+	}
+	// Make sure the result can be parsed. Includes and placeholders are left
+	// aside, since they are resolved at load time.
+	documents := [][]byte{migrated}
+	if !isJSON(filename) {
+		documents = splitDocuments(migrated)
+	}
+	p := &parser{identityProvider: notSpecified}
+	for _, document := range documents {
+		config, err := p.parseConfig(document, filename)
+		if err != nil {
+			return nil, fmt.Errorf("migrated file is invalid: %s", err)
+		}
+		if config.Service == "" {
+			return nil, fmt.Errorf("migrated file is invalid: empty service in %q", filename)
+		}
+	}
+	if dryRun || len(report) == 0 {
+		return report, nil
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	return report, ioutil.WriteFile(filename, migrated, info.Mode())
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateYAML(t *testing.T) {
+	migrated, report, err := Migrate([]byte(`# Legacy file.
+audience: https://sample.yaml
+jwtIssuer: https://auth.mozilla.auth0.com/
+tags:
+  admins:
+    - userid:maria
+policies:
+  -
+    id: "1"
+    subjects: userid:foo  # owner
+    actions: [update]
+    resources: records/{[0-9]+}, all
+    effect: allow
+  - id: "2"
+    subjects:
+      - tag:admins
+    actions: 'it''s'
+    resources:
+      - y
+---
+service: https://other.yaml
+identityProvider:
+`), "policies.yaml")
+	require.Nil(t, err)
+	assert.Equal(t, `# Legacy file.
+version: 2
+service: https://sample.yaml
+identityProvider: https://auth.mozilla.auth0.com/
+tags:
+  admins:
+    - userid:maria
+policies:
+  -
+    id: "1"
+    principals: ['userid:foo']  # owner
+    actions: [update]
+    resources: ['records/{[0-9]+}, all']
+    effect: allow
+  - id: "2"
+    principals:
+      - tag:admins
+    actions: ['it''s']
+    resources:
+      - y
+---
+version: 2
+service: https://other.yaml
+identityProvider:
+`, string(migrated))
+	assert.Equal(t, []string{
+		"renamed `audience` to `service` (1)",
+		"renamed `jwtIssuer` to `identityProvider` (1)",
+		"renamed policy `subjects` to `principals` (2)",
+		"turned policy single value into a list (3)",
+		"set schema version 2",
+		"set schema version 2",
+	}, report)
+
+	// Values are preserved.
+	configs, err := (&parser{identityProvider: notSpecified}).parseConfigs(migrated, "policies.yaml")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"records/{[0-9]+}, all"}, configs[0].Policies[0].Resources)
+	assert.Equal(t, []string{"it's"}, configs[0].Policies[1].Actions)
+	assert.Equal(t, []string{"y"}, configs[0].Policies[1].Resources)
+
+	// Up to date.
+	again, report, err := Migrate(migrated, "policies.yaml")
+	require.Nil(t, err)
+	assert.Empty(t, report)
+	assert.Equal(t, string(migrated), string(again))
+
+	// Old version number.
+	migrated, _, err = Migrate([]byte("version: 1\nservice: a\n"), "policies.yaml")
+	require.Nil(t, err)
+	assert.Equal(t, "version: 2\nservice: a\n", string(migrated))
+
+	// Newer version.
+	_, _, err = Migrate([]byte("version: 3\nservice: a\n"), "policies.yaml")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unsupported schema version 3")
+}
+
+func TestMigrateJSON(t *testing.T) {
+	migrated, report, err := Migrate([]byte(`{
+  "audience": "https://sample.yaml",
+  "jwtIssuer": "",
+  "policies": [{"id": "1", "subjects": "userid:foo", "actions": ["read"]}]
+}`), "policies.json")
+	require.Nil(t, err)
+	assert.Equal(t, `{
+  "version": 2,
+  "service": "https://sample.yaml",
+  "identityProvider": "",
+  "policies": [{"id": "1", "principals": ["userid:foo"], "actions": ["read"]}]
+}`, string(migrated))
+	assert.Equal(t, 5, len(report))
+}
+
+func TestMigrateFile(t *testing.T) {
+	tmpfile, _ := ioutil.TempFile("", "*.yaml")
+	defer os.Remove(tmpfile.Name())
+	tmpfile.Write([]byte("audience: a\njwtIssuer:\n"))
+	tmpfile.Close()
+
+	// Dry run.
+	report, err := MigrateFile(tmpfile.Name(), true)
+	require.Nil(t, err)
+	assert.Equal(t, 3, len(report))
+	content, _ := ioutil.ReadFile(tmpfile.Name())
+	assert.Equal(t, "audience: a\njwtIssuer:\n", string(content))
+
+	report, err = MigrateFile(tmpfile.Name(), false)
+	require.Nil(t, err)
+	assert.Equal(t, 3, len(report))
+	content, _ = ioutil.ReadFile(tmpfile.Name())
+	assert.Equal(t, "version: 2\nservice: a\nidentityProvider:\n", string(content))
+
+	// Invalid result.
+	ioutil.WriteFile(tmpfile.Name(), []byte("jwtIssuer:\n"), 0644)
+	_, err = MigrateFile(tmpfile.Name(), false)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "empty service")
+
+	_, err = MigrateFile("/unknown.yaml", false)
+	require.NotNil(t, err)
+}
+
+func TestLoadNewerSchemaVersion(t *testing.T) {
+	_, err := (&parser{identityProvider: notSpecified}).parseConfigs([]byte("version: 3\nservice: a\nidentityProvider:\n"), "a.yaml")
+	require.NotNil(t, err)
+	assert.Equal(t, "unsupported schema version 3 in \"a.yaml\"", err.Error())
+}
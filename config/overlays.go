@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// resolveOverlays patches the specified configuration with the files listed in
+// `overlays`, in order. Overlays paths are relative to the patched file, and
+// usually contain an environment variable (eg. `overlays/${ENVIRONMENT}.yaml`).
+func (p *parser) resolveOverlays(config *doorman.ServiceConfig, source string) error {
+	if len(config.Overlays) == 0 {
+		return nil
+	}
+	if p.files == nil {
+		return fmt.Errorf("overlays are only supported for local files (%q)", source)
+	}
+
+	for _, overlay := range config.Overlays {
+		filename, err := p.files.path(source, overlay)
+		if err != nil {
+			return err
+		}
+		log.Debugf("Apply overlay %q on %q", filename, source)
+		patch, err := p.loadFragment(filename)
+		if err != nil {
+			return err
+		}
+		if len(patch.Includes) > 0 || len(patch.Overlays) > 0 {
+			return fmt.Errorf("overlay %q cannot have includes nor overlays", filename)
+		}
+		applyOverlay(config, patch)
+	}
+	return nil
+}
+
+// applyOverlay merges the overlay into the configuration, like a strategic merge:
+//
+//   - policies are matched by ID, and the overlay fields replace the specified ones
+//     (conditions are merged by field, and removed if null). Unknown policies are added;
+//   - tags members are replaced, for the tags of the overlay;
+//   - variables are replaced, for the variables of the overlay.
+func applyOverlay(config *doorman.ServiceConfig, overlay *doorman.ServiceConfig) {
+	for _, patch := range overlay.Policies {
+		index := -1
+		for i, policy := range config.Policies {
+			if policy.ID == patch.ID {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			config.Policies = append(config.Policies, patch)
+			continue
+		}
+		patchPolicy(&config.Policies[index], patch)
+	}
+
+	if len(overlay.Tags) > 0 && config.Tags == nil {
+		config.Tags = doorman.Tags{}
+	}
+	for tag, members := range overlay.Tags {
+		config.Tags[tag] = members
+		for _, member := range members {
+			config.SetTagSource(tag, member, overlay.Source)
+		}
+	}
+
+	if len(overlay.Variables) > 0 && config.Variables == nil {
+		config.Variables = map[string]interface{}{}
+	}
+	for name, value := range overlay.Variables {
+		config.Variables[name] = value
+	}
+}
+
+// patchPolicy replaces the fields of the policy that are specified in the patch.
+func patchPolicy(policy *doorman.Policy, patch doorman.Policy) {
+	if patch.Description != "" {
+		policy.Description = patch.Description
+	}
+	if patch.Effect != "" {
+		policy.Effect = patch.Effect
+	}
+	if patch.Principals != nil {
+		policy.Principals = patch.Principals
+	}
+	if patch.Actions != nil {
+		policy.Actions = patch.Actions
+	}
+	if patch.Resources != nil {
+		policy.Resources = patch.Resources
+	}
+	if len(patch.Conditions) > 0 {
+		conditions := doorman.Conditions{}
+		for field, condition := range policy.Conditions {
+			conditions[field] = condition
+		}
+		for field, condition := range patch.Conditions {
+			if condition.Type == "" {
+				delete(conditions, field)
+			} else {
+				conditions[field] = condition
+			}
+		}
+		policy.Conditions = conditions
+	}
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+func TestLoadOverlays(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overlays")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, dir, map[string]string{
+		"base.yaml": `
+identityProvider:
+service: a
+overlays:
+  - overlays/${DOORMAN_TEST_ENV}.yaml
+variables:
+  env: stage
+tags:
+  admins:
+    - userid:maria
+policies:
+  -
+    id: read
+    principals:
+      - userid:<.*>
+    actions:
+      - read
+    resources:
+      - bucket:{{env}}
+    conditions:
+      remoteIP:
+        type: CIDRCondition
+        options:
+          cidr: 10.0.0.0/8
+      planet:
+        type: StringEqualCondition
+        options:
+          equals: mars
+    effect: allow
+  -
+    id: admins
+    principals:
+      - tag:admins
+    actions:
+      - <.*>
+    resources:
+      - <.*>
+    effect: allow
+`,
+		"overlays/production.yaml": `
+variables:
+  env: prod
+tags:
+  admins:
+    - userid:alice
+policies:
+  -
+    id: read
+    conditions:
+      remoteIP: null
+      planet:
+        type: StringEqualCondition
+        options:
+          equals: earth
+  -
+    id: admins
+    effect: deny
+  -
+    id: audit
+    principals:
+      - group:auditors
+    actions:
+      - read
+    resources:
+      - <.*>
+    effect: allow
+`,
+		"overlays/invalid.yaml": `
+includes:
+  - ../base.yaml
+`,
+	})
+
+	os.Setenv("DOORMAN_TEST_ENV", "production")
+	defer os.Unsetenv("DOORMAN_TEST_ENV")
+	configs, err := Load([]string{filepath.Join(dir, "base.yaml")})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(configs))
+	config := configs[0]
+
+	assert.Equal(t, doorman.Principals{"userid:alice"}, config.Tags["admins"])
+	assert.Equal(t, filepath.Join(dir, "overlays/production.yaml"), config.TagSource("admins", "userid:alice"))
+	require.Equal(t, 3, len(config.Policies))
+	assert.Equal(t, []string{"bucket:prod"}, config.Policies[0].Resources)
+	assert.Equal(t, []string{"read"}, config.Policies[0].Actions)
+	assert.Equal(t, 1, len(config.Policies[0].Conditions))
+	assert.Equal(t, "earth", config.Policies[0].Conditions["planet"].Options["equals"])
+	assert.Equal(t, "deny", config.Policies[1].Effect)
+	assert.Equal(t, []string{"tag:admins"}, config.Policies[1].Principals)
+	assert.Equal(t, "audit", config.Policies[2].ID)
+
+	os.Setenv("DOORMAN_TEST_ENV", "invalid")
+	_, err = Load([]string{filepath.Join(dir, "base.yaml")})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "cannot have includes nor overlays")
+
+	os.Setenv("DOORMAN_TEST_ENV", "unknown")
+	_, err = Load([]string{filepath.Join(dir, "base.yaml")})
+	assert.NotNil(t, err)
+
+	// Remote sources.
+	p := &parser{identityProvider: notSpecified}
+	_, err = p.parseConfigs([]byte(`
+identityProvider:
+service: a
+overlays:
+  - production.yaml
+`), "https://github.com/moz/ops/config.yaml")
+	assert.Contains(t, err.Error(), "only supported for local files")
+}
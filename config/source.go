@@ -0,0 +1,175 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// PolicySource provides services configurations from a storage.
+type PolicySource interface {
+	// Fetch returns the current configurations of the source.
+	Fetch() (doorman.ServicesConfig, error)
+}
+
+// Watcher is implemented by the sources that can notify their changes.
+type Watcher interface {
+	// Watch calls the function when the source content changes, until stop is called.
+	Watch(changed func()) (stop func())
+}
+
+// LoadFrom will fetch the configurations of the specified sources.
+func LoadFrom(sources ...PolicySource) (doorman.ServicesConfig, error) {
+	configs := doorman.ServicesConfig{}
+	for _, source := range sources {
+		c, err := source.Fetch()
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, c...)
+	}
+	if err := lintConfigs(configs...); err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+// NewSource returns a source that reads the specified location with the
+// appropriate loaders.
+func NewSource(location string) (PolicySource, error) {
+	matching := []Loader{}
+	for _, loader := range loaders {
+		if loader.CanLoad(location) {
+			matching = append(matching, loader)
+		}
+	}
+	if len(matching) == 0 {
+		return nil, fmt.Errorf("no appropriate loader found for %q", location)
+	}
+	return &loaderSource{matching, location}, nil
+}
+
+// loaderSource adapts the loaders to the PolicySource interface.
+type loaderSource struct {
+	loaders  []Loader
+	location string
+}
+
+func (s *loaderSource) Fetch() (doorman.ServicesConfig, error) {
+	configs := doorman.ServicesConfig{}
+	for _, loader := range s.loaders {
+		c, err := loader.Load(s.location)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, c...)
+	}
+	return configs, nil
+}
+
+// FileSource reads configurations from a local file or folder.
+type FileSource struct {
+	Path string
+	// Interval is the delay between modifications checks when watched (default: 5s).
+	Interval time.Duration
+}
+
+// Fetch reads the file, or the files of the folder.
+func (s *FileSource) Fetch() (doorman.ServicesConfig, error) {
+	return (&FileLoader{}).Load(s.Path)
+}
+
+// Watch polls the files modification times.
+func (s *FileSource) Watch(changed func()) (stop func()) {
+	interval := s.Interval
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+	done := make(chan struct{})
+	last := s.modTimes()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				current := s.modTimes()
+				if current != last {
+					log.Debugf("Files changed in %q", s.Path)
+					last = current
+					changed()
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// modTimes returns a fingerprint of the files names and modification times.
+func (s *FileSource) modTimes() string {
+	var fingerprint []string
+	filepath.Walk(s.Path, func(path string, info os.FileInfo, err error) error {
+		if err == nil {
+			fingerprint = append(fingerprint, fmt.Sprintf("%s:%d:%d", path, info.ModTime().UnixNano(), info.Size()))
+		}
+		return nil
+	})
+	return strings.Join(fingerprint, ",")
+}
+
+// URLSource reads configurations from a remote file.
+type URLSource struct {
+	URL string
+	// Headers are sent with the request.
+	Headers map[string]string
+	// Auth authenticates the request (optional).
+	Auth FetchAuthenticator
+}
+
+// Fetch downloads and parses the file. Included files are not supported.
+func (s *URLSource) Fetch() (doorman.ServicesConfig, error) {
+	log.Infof("Load %q from URL", s.URL)
+	content, err := fetch(s.URL, s.Headers, s.Auth)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{identityProvider: notSpecified}
+	return p.parseConfigs(content, s.URL)
+}
+
+// EnvSource reads configurations from the content of an environment variable.
+type EnvSource struct {
+	Name string
+}
+
+// Fetch parses the variable content as YAML.
+func (s *EnvSource) Fetch() (doorman.ServicesConfig, error) {
+	content, ok := os.LookupEnv(s.Name)
+	if !ok {
+		return nil, fmt.Errorf("undefined environment variable %q", s.Name)
+	}
+	p := &parser{identityProvider: notSpecified}
+	return p.parseConfigs([]byte(content), "env:"+s.Name)
+}
+
+// EnvLoader reads configurations from environment variables, specified as
+// `env:NAME` sources.
+type EnvLoader struct{}
+
+// CanLoad will return true if the source has the `env:` prefix.
+func (e *EnvLoader) CanLoad(source string) bool {
+	return strings.HasPrefix(source, "env:")
+}
+
+// Load parses the variable content.
+func (e *EnvLoader) Load(source string) (doorman.ServicesConfig, error) {
+	return (&EnvSource{strings.TrimPrefix(source, "env:")}).Fetch()
+}
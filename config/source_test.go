@@ -0,0 +1,91 @@
+package config
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSource(t *testing.T) {
+	_, err := NewSource("/tmp/unknown.yaml")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no appropriate loader found")
+
+	source, err := NewSource("../sample.yaml")
+	require.Nil(t, err)
+	configs, err := LoadFrom(source)
+	require.Nil(t, err)
+	assert.Equal(t, 1, len(configs))
+}
+
+func TestFileSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sources")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"a.yaml": "service: a\nidentityProvider:\n",
+	})
+
+	source := &FileSource{Path: dir, Interval: 10 * time.Millisecond}
+	configs, err := LoadFrom(source)
+	require.Nil(t, err)
+	assert.Equal(t, "a", configs[0].Service)
+
+	changed := make(chan bool, 1)
+	stop := source.Watch(func() { changed <- true })
+	defer stop()
+	writeFiles(t, dir, map[string]string{
+		"b.yaml": "service: b\nidentityProvider:\n",
+	})
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("change not detected")
+	}
+}
+
+func TestURLSource(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token abc" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("service: a\nidentityProvider:\n"))
+	}))
+	defer ts.Close()
+
+	_, err := LoadFrom(&URLSource{URL: ts.URL + "/policies.yaml"})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "status 403")
+
+	configs, err := LoadFrom(&URLSource{
+		URL:     ts.URL + "/policies.yaml",
+		Headers: map[string]string{"Authorization": "token abc"},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, "a", configs[0].Service)
+	assert.Equal(t, ts.URL+"/policies.yaml", configs[0].Source)
+}
+
+func TestEnvSource(t *testing.T) {
+	_, err := LoadFrom(&EnvSource{Name: "DOORMAN_TEST_POLICIES"})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "undefined environment variable")
+
+	os.Setenv("DOORMAN_TEST_POLICIES", "service: a\nidentityProvider:\n")
+	defer os.Unsetenv("DOORMAN_TEST_POLICIES")
+
+	loader := &EnvLoader{}
+	assert.True(t, loader.CanLoad("env:DOORMAN_TEST_POLICIES"))
+	assert.False(t, loader.CanLoad("policies.yaml"))
+	configs, err := loader.Load("env:DOORMAN_TEST_POLICIES")
+	require.Nil(t, err)
+	assert.Equal(t, "a", configs[0].Service)
+	assert.Equal(t, "env:DOORMAN_TEST_POLICIES", configs[0].Source)
+}
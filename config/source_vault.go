@@ -0,0 +1,128 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// vaultPrefix is the prefix of Vault sources (eg. `vault:secret/data/doorman`).
+const vaultPrefix = "vault:"
+
+// VaultSource reads configurations from a Vault KV secret. Each key of the secret
+// is a policies file name, and its value the file content.
+type VaultSource struct {
+	// Path is the secret API path (eg. `secret/data/doorman` with KV version 2).
+	Path string
+	// Address is the Vault server URL (default: `VAULT_ADDR` environment variable).
+	Address string
+	// Token is the Vault token (default: `VAULT_TOKEN` environment variable).
+	Token string
+	// Namespace is the Vault Enterprise namespace (default: `VAULT_NAMESPACE`
+	// environment variable).
+	Namespace string
+}
+
+// vaultResponse is the response of the Vault KV read endpoint.
+type vaultResponse struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+// Fetch reads the secret and parses its files.
+func (s *VaultSource) Fetch() (doorman.ServicesConfig, error) {
+	address := s.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		return nil, fmt.Errorf("no Vault address to read %q", s.Path)
+	}
+	token := s.Token
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	namespace := s.Namespace
+	if namespace == "" {
+		namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+
+	uri := strings.TrimRight(address, "/") + "/v1/" + strings.TrimLeft(s.Path, "/")
+	log.Infof("Load %q from Vault", s.Path)
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not read %q from Vault (status %d)", s.Path, response.StatusCode)
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	var secret vaultResponse
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return nil, fmt.Errorf("invalid Vault response for %q: %s", s.Path, err)
+	}
+
+	// KV version 2 nests the secret data.
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+
+	filenames := []string{}
+	for filename := range data {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	p := &parser{identityProvider: notSpecified}
+	configs := doorman.ServicesConfig{}
+	for _, filename := range filenames {
+		content, ok := data[filename].(string)
+		if !ok {
+			return nil, fmt.Errorf("value of %q is not a string in %q", filename, s.Path)
+		}
+		c, err := p.parseConfigs([]byte(content), filename)
+		if err != nil {
+			return nil, fmt.Errorf("%s (Vault %q)", err, s.Path)
+		}
+		for i := range c {
+			c[i].Source = fmt.Sprintf("%s%s#%s", vaultPrefix, s.Path, filename)
+		}
+		configs = append(configs, c...)
+	}
+	return configs, nil
+}
+
+// VaultLoader reads configurations from Vault secrets, specified as `vault:PATH`
+// sources. The server and token are read from the standard Vault environment
+// variables.
+type VaultLoader struct{}
+
+// CanLoad will return true if the source has the `vault:` prefix.
+func (v *VaultLoader) CanLoad(source string) bool {
+	return strings.HasPrefix(source, vaultPrefix)
+}
+
+// Load reads the secret files.
+func (v *VaultLoader) Load(source string) (doorman.ServicesConfig, error) {
+	return (&VaultSource{Path: strings.TrimPrefix(source, vaultPrefix)}).Fetch()
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVaultSource(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.abc" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/secret/data/doorman":
+			assert.Equal(t, "team", r.Header.Get("X-Vault-Namespace"))
+			w.Write([]byte(`{"data": {"data": {
+				"b.yaml": "service: b\nidentityProvider:\n",
+				"a.json": "{\"service\": \"a\", \"identityProvider\": \"\"}"
+			}, "metadata": {"version": 3}}}`))
+		case "/v1/kv/doorman":
+			w.Write([]byte(`{"data": {"a.yaml": "service: a\nidentityProvider:\n"}}`))
+		case "/v1/kv/invalid":
+			w.Write([]byte(`{"data": {"a.yaml": 42}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	// KV version 2.
+	configs, err := (&VaultSource{
+		Path:      "secret/data/doorman",
+		Address:   ts.URL,
+		Token:     "s.abc",
+		Namespace: "team",
+	}).Fetch()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(configs))
+	assert.Equal(t, "a", configs[0].Service)
+	assert.Equal(t, "vault:secret/data/doorman#a.json", configs[0].Source)
+	assert.Equal(t, "b", configs[1].Service)
+
+	// KV version 1, from environment.
+	os.Setenv("VAULT_ADDR", ts.URL)
+	os.Setenv("VAULT_TOKEN", "s.abc")
+	defer os.Unsetenv("VAULT_ADDR")
+	defer os.Unsetenv("VAULT_TOKEN")
+	loader := &VaultLoader{}
+	assert.True(t, loader.CanLoad("vault:kv/doorman"))
+	assert.False(t, loader.CanLoad("kv/doorman"))
+	configs, err = loader.Load("vault:kv/doorman")
+	require.Nil(t, err)
+	assert.Equal(t, "a", configs[0].Service)
+
+	// Errors.
+	_, err = loader.Load("vault:kv/unknown")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "status 404")
+	_, err = loader.Load("vault:kv/invalid")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "not a string")
+	_, err = (&VaultSource{Path: "kv/doorman", Address: ts.URL, Token: "bad"}).Fetch()
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "status 403")
+
+	os.Unsetenv("VAULT_ADDR")
+	_, err = loader.Load("vault:kv/doorman")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no Vault address")
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// Policies sources of a Standby.
+const (
+	// StandbyPrimary means that the policies come from the primary sources.
+	StandbyPrimary = "primary"
+	// StandbySecondary means that the policies come from the secondary sources.
+	StandbySecondary = "secondary"
+)
+
+// Standby loads the policies from the primary sources, and keeps the ones of
+// the secondary sources (eg. local files mirroring a remote Git repository)
+// pre-loaded, to switch to them without delay if the primary sources fail
+// validation, or are unreachable for longer than the threshold.
+type Standby struct {
+	Primary   []string
+	Secondary []string
+	// Threshold is how long the primary sources can be unreachable before the
+	// secondary ones are activated (default: immediately). Until then, the
+	// current policies are kept.
+	Threshold time.Duration
+
+	sync.Mutex
+	standby          doorman.ServicesConfig
+	active           string
+	unreachableSince time.Time
+	lastError        error
+}
+
+// StandbyStatus tells which policies sources are active.
+type StandbyStatus struct {
+	// Active is StandbyPrimary, StandbySecondary, or empty if nothing was loaded.
+	Active string
+	// Ready is true if the secondary policies are pre-loaded.
+	Ready bool
+	// Error is the last failure of the primary sources, if not active.
+	Error error
+	// UnreachableSince is when the primary sources started failing to be fetched.
+	UnreachableSince time.Time
+}
+
+// Load fetches the primary policies into Doorman, or activates the secondary
+// ones. The secondary sources are fetched on every load, to be kept up to date.
+func (s *Standby) Load(d doorman.Doorman) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if standby, err := Load(s.Secondary); err != nil {
+		log.Warningf("Could not pre-load the secondary policies: %s", err)
+	} else {
+		s.standby = standby
+	}
+
+	configs, err := load(s.Primary)
+	if err != nil {
+		if s.unreachableSince.IsZero() {
+			s.unreachableSince = time.Now()
+		}
+		// Nothing is served before the first load.
+		if s.active != "" && time.Since(s.unreachableSince) < s.Threshold {
+			s.lastError = err
+			log.Warningf("Primary policies unreachable since %s: %s", s.unreachableSince.Format(time.RFC3339), err)
+			return err
+		}
+		return s.failover(d, err)
+	}
+	s.unreachableSince = time.Time{}
+
+	if err = lintConfigs(configs...); err == nil {
+		err = d.LoadPolicies(configs)
+	}
+	if err != nil {
+		return s.failover(d, err)
+	}
+	if s.active == StandbySecondary {
+		log.Infof("Primary policies activated again")
+	}
+	s.active = StandbyPrimary
+	s.lastError = nil
+	return nil
+}
+
+// failover activates the secondary policies, or returns the primary error if
+// they are not available.
+func (s *Standby) failover(d doorman.Doorman, cause error) error {
+	s.lastError = cause
+	if s.standby == nil {
+		return cause
+	}
+	if err := d.LoadPolicies(s.standby); err != nil {
+		return err
+	}
+	if s.active != StandbySecondary {
+		log.Errorf("Primary policies failed, secondary policies activated: %s", cause)
+	}
+	s.active = StandbySecondary
+	return nil
+}
+
+// Status returns the active policies sources.
+func (s *Standby) Status() StandbyStatus {
+	s.Lock()
+	defer s.Unlock()
+	return StandbyStatus{
+		Active:           s.active,
+		Ready:            s.standby != nil,
+		Error:            s.lastError,
+		UnreachableSince: s.unreachableSince,
+	}
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+func TestStandby(t *testing.T) {
+	dir, err := ioutil.TempDir("", "standby")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	primary := filepath.Join(dir, "primary.yaml")
+	secondary := filepath.Join(dir, "secondary.yaml")
+	writeFiles(t, dir, map[string]string{
+		"primary.yaml":   "identityProvider:\nservice: primary\n",
+		"secondary.yaml": "identityProvider:\nservice: secondary\n",
+	})
+
+	d := doorman.NewDefaultLadon()
+	s := &Standby{Primary: []string{primary}, Secondary: []string{secondary}, Threshold: time.Hour}
+	require.Nil(t, s.Load(d))
+	status := s.Status()
+	assert.Equal(t, StandbyPrimary, status.Active)
+	assert.True(t, status.Ready)
+	assert.Nil(t, status.Error)
+	_, ok := d.ServiceConfig("primary")
+	assert.True(t, ok)
+
+	// Invalid primary policies: switched right away.
+	writeFiles(t, dir, map[string]string{"primary.yaml": "identityProvider:\nservice: \"\"\n"})
+	require.Nil(t, s.Load(d))
+	status = s.Status()
+	assert.Equal(t, StandbySecondary, status.Active)
+	assert.Contains(t, status.Error.Error(), "empty service")
+	_, ok = d.ServiceConfig("secondary")
+	assert.True(t, ok)
+
+	// Back to primary.
+	writeFiles(t, dir, map[string]string{"primary.yaml": "identityProvider:\nservice: primary\n"})
+	require.Nil(t, s.Load(d))
+	assert.Equal(t, StandbyPrimary, s.Status().Active)
+
+	// Unreachable primary: current policies are kept until the threshold.
+	os.Remove(primary)
+	err = s.Load(d)
+	require.NotNil(t, err)
+	status = s.Status()
+	assert.Equal(t, StandbyPrimary, status.Active)
+	assert.False(t, status.UnreachableSince.IsZero())
+	_, ok = d.ServiceConfig("primary")
+	assert.True(t, ok)
+
+	s.Threshold = 0
+	require.Nil(t, s.Load(d))
+	assert.Equal(t, StandbySecondary, s.Status().Active)
+}
+
+func TestStandbyFirstLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "standby")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	secondary := filepath.Join(dir, "secondary.yaml")
+
+	// Nothing to serve: no secondary policies.
+	d := doorman.NewDefaultLadon()
+	s := &Standby{Primary: []string{"/tmp/unknown.yaml"}, Secondary: []string{secondary}, Threshold: time.Hour}
+	err = s.Load(d)
+	require.NotNil(t, err)
+	assert.False(t, s.Status().Ready)
+	assert.Equal(t, "", s.Status().Active)
+
+	// Threshold is ignored on the first load.
+	writeFiles(t, dir, map[string]string{"secondary.yaml": "identityProvider:\nservice: secondary\n"})
+	require.Nil(t, s.Load(d))
+	assert.Equal(t, StandbySecondary, s.Status().Active)
+}
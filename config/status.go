@@ -0,0 +1,57 @@
+package config
+
+import (
+	"sync"
+	"time"
+)
+
+// SourceStatus is the outcome of the last fetch of a policies source.
+type SourceStatus struct {
+	Source string
+	// Services is the number of services obtained on the last successful fetch.
+	Services int
+	// FetchedAt is the time of the last successful fetch (zero if never fetched).
+	FetchedAt time.Time
+	// Error is the error of the last fetch, if it failed.
+	Error    error
+	FailedAt time.Time
+}
+
+var (
+	sourcesStatus     = map[string]*SourceStatus{}
+	sourcesStatusList []string
+	sourcesStatusLock sync.Mutex
+)
+
+// SourcesStatus returns the status of every source fetched so far, in the
+// order they were first fetched.
+func SourcesStatus() []SourceStatus {
+	sourcesStatusLock.Lock()
+	defer sourcesStatusLock.Unlock()
+
+	statuses := make([]SourceStatus, len(sourcesStatusList))
+	for i, location := range sourcesStatusList {
+		statuses[i] = *sourcesStatus[location]
+	}
+	return statuses
+}
+
+func recordSourceStatus(location string, services int, err error) {
+	sourcesStatusLock.Lock()
+	defer sourcesStatusLock.Unlock()
+
+	status, ok := sourcesStatus[location]
+	if !ok {
+		status = &SourceStatus{Source: location}
+		sourcesStatus[location] = status
+		sourcesStatusList = append(sourcesStatusList, location)
+	}
+	if err != nil {
+		status.Error = err
+		status.FailedAt = time.Now()
+	} else {
+		status.Error = nil
+		status.Services = services
+		status.FetchedAt = time.Now()
+	}
+}
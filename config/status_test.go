@@ -0,0 +1,35 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourcesStatus(t *testing.T) {
+	find := func(location string) *SourceStatus {
+		for _, s := range SourcesStatus() {
+			if s.Source == location {
+				return &s
+			}
+		}
+		return nil
+	}
+
+	_, err := Load([]string{"../sample.yaml"})
+	require.Nil(t, err)
+	status := find("../sample.yaml")
+	require.NotNil(t, status)
+	assert.Equal(t, 1, status.Services)
+	assert.False(t, status.FetchedAt.IsZero())
+	assert.Nil(t, status.Error)
+
+	_, err = Load([]string{"/tmp/unknown.yaml"})
+	require.NotNil(t, err)
+	status = find("/tmp/unknown.yaml")
+	require.NotNil(t, status)
+	assert.NotNil(t, status.Error)
+	assert.False(t, status.FailedAt.IsZero())
+	assert.True(t, status.FetchedAt.IsZero())
+}
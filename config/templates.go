@@ -0,0 +1,103 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// placeholderRegexp matches the `{{var}}` placeholders in policies.
+var placeholderRegexp = regexp.MustCompile(`\{\{\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*\}\}`)
+
+// expandTemplates replaces the `{{var}}` placeholders in policies with the values
+// from the `variables` section. When a placeholder refers to a list, the policy is
+// generated once for each of its values (and for each combination if several lists
+// are referenced).
+func expandTemplates(config *doorman.ServiceConfig) error {
+	policies := doorman.Policies{}
+	for _, policy := range config.Policies {
+		generated, err := expandPolicy(policy, config.Variables)
+		if err != nil {
+			return err
+		}
+		policies = append(policies, generated...)
+	}
+	config.Policies = policies
+	return nil
+}
+
+func expandPolicy(policy doorman.Policy, variables map[string]interface{}) (doorman.Policies, error) {
+	template, err := json.Marshal(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Look for referenced variables.
+	scalars := map[string]string{}
+	lists := map[string][]string{}
+	for _, match := range placeholderRegexp.FindAllSubmatch(template, -1) {
+		name := string(match[1])
+		value, defined := variables[name]
+		if !defined {
+			return nil, fmt.Errorf("undefined variable %q in policy %q", name, policy.ID)
+		}
+		if values, isList := value.([]interface{}); isList {
+			lists[name] = []string{}
+			for _, v := range values {
+				lists[name] = append(lists[name], fmt.Sprintf("%v", v))
+			}
+		} else {
+			scalars[name] = fmt.Sprintf("%v", value)
+		}
+	}
+	if len(scalars) == 0 && len(lists) == 0 {
+		return doorman.Policies{policy}, nil
+	}
+
+	policies := doorman.Policies{}
+	for _, combination := range combinations(lists) {
+		for name, value := range scalars {
+			combination[name] = value
+		}
+		content := placeholderRegexp.ReplaceAllFunc(template, func(match []byte) []byte {
+			name := string(placeholderRegexp.FindSubmatch(match)[1])
+			// Escape value to be inserted in JSON string.
+			escaped, _ := json.Marshal(combination[name])
+			return escaped[1 : len(escaped)-1]
+		})
+		var generated doorman.Policy
+		if err := json.Unmarshal(content, &generated); err != nil {
+			return nil, err
+		}
+		policies = append(policies, generated)
+	}
+	return policies, nil
+}
+
+// combinations returns every combination of the lists values.
+func combinations(lists map[string][]string) []map[string]string {
+	names := []string{}
+	for name := range lists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := []map[string]string{{}}
+	for _, name := range names {
+		next := []map[string]string{}
+		for _, partial := range result {
+			for _, value := range lists[name] {
+				combination := map[string]string{name: value}
+				for k, v := range partial {
+					combination[k] = v
+				}
+				next = append(next, combination)
+			}
+		}
+		result = next
+	}
+	return result
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadTemplates(t *testing.T) {
+	configs, err := loadTempFiles(`
+identityProvider:
+service: a
+variables:
+  env: stage
+  team:
+    - payments
+    - search
+  action:
+    - read
+    - write
+policies:
+  -
+    id: "{{ team }}-{{action}}"
+    description: "{{team}} can {{action}} their buckets on {{env}}"
+    principals:
+      - group:{{team}}
+    actions:
+      - "{{action}}"
+    resources:
+      - bucket:{{env}}-{{team}}-<.*>
+    conditions:
+      team:
+        type: StringEqualCondition
+        options:
+          equals: "{{team}}"
+    effect: allow
+  -
+    id: static
+    effect: deny
+`)
+	require.Nil(t, err)
+	policies := configs[0].Policies
+	require.Equal(t, 5, len(policies))
+	assert.Equal(t, "payments-read", policies[0].ID)
+	assert.Equal(t, "search-read", policies[1].ID)
+	assert.Equal(t, "payments-write", policies[2].ID)
+	assert.Equal(t, "search-write", policies[3].ID)
+	assert.Equal(t, "static", policies[4].ID)
+
+	search := policies[3]
+	assert.Equal(t, "search can write their buckets on stage", search.Description)
+	assert.Equal(t, []string{"group:search"}, search.Principals)
+	assert.Equal(t, []string{"write"}, search.Actions)
+	assert.Equal(t, []string{"bucket:stage-search-<.*>"}, search.Resources)
+	assert.Equal(t, "search", search.Conditions["team"].Options["equals"])
+}
+
+func TestLoadTemplatesUndefined(t *testing.T) {
+	_, err := loadTempFiles(`
+identityProvider:
+service: a
+policies:
+  -
+    id: "{{team}}"
+`)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "undefined variable \"team\" in policy \"{{team}}\"")
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/doorman"
+)
+
+// ValidationError describes a problem found in a policies file.
+type ValidationError struct {
+	Source  string
+	Service string
+	Policy  string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Policy != "" {
+		return fmt.Sprintf("%s (policy %q of %q in %q)", e.Message, e.Policy, e.Service, e.Source)
+	}
+	return fmt.Sprintf("%s (%q in %q)", e.Message, e.Service, e.Source)
+}
+
+// Validate parses and checks the specified sources without loading them into
+// any Doorman. It returns an error if a source could not be read or parsed, and
+// the list of problems found in the policies otherwise.
+func Validate(sources []string) ([]ValidationError, error) {
+	configs, err := load(sources)
+	if err != nil {
+		return nil, err
+	}
+	return validateConfigs(configs), nil
+}
+
+// validateConfigs inspects the services configurations and returns every problem
+// that would prevent them from being loaded.
+func validateConfigs(configs doorman.ServicesConfig) []ValidationError {
+	errs := []ValidationError{}
+	sources := map[string]string{}
+
+	// The base policies are merged into every service.
+	baseIDs := map[string]bool{}
+	for _, config := range configs {
+		if config.Service == doorman.BaseService {
+			for _, policy := range config.Policies {
+				baseIDs[policy.ID] = true
+			}
+		}
+	}
+
+	for _, config := range configs {
+		fail := func(policy string, format string, a ...interface{}) {
+			errs = append(errs, ValidationError{
+				Source:  config.Source,
+				Service: config.Service,
+				Policy:  policy,
+				Message: fmt.Sprintf(format, a...),
+			})
+		}
+
+		if config.Service == "" {
+			fail("", "empty service")
+		} else if _, err := authn.NormalizeAudience(config.Service); err != nil {
+			fail("", "%s", err)
+		} else if source, exists := sources[config.Service]; exists {
+			fail("", "duplicated service (already defined in %q)", source)
+		} else {
+			sources[config.Service] = config.Source
+		}
+
+		// The rules of the services loading.
+		for _, e := range config.Validate() {
+			fail(e.Policy, "%s", e.Message)
+		}
+
+		// The authenticators can also be set by the applications embedding Doorman.
+		if config.IdentityProvider == "" && len(config.RequiredClaims) > 0 {
+			fail("", "requiredClaims without identityProvider")
+		}
+
+		for _, policy := range config.Policies {
+			if config.Service != doorman.BaseService && baseIDs[policy.ID] {
+				fail(policy.ID, "policy ID already defined in the base configuration")
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+func TestValidateBadSources(t *testing.T) {
+	// Missing file
+	_, err := Validate([]string{"/tmp/unknown.yaml"})
+	assert.NotNil(t, err)
+
+	// Valid file
+	errs, err := Validate([]string{"../sample.yaml"})
+	require.Nil(t, err)
+	assert.Equal(t, 0, len(errs))
+}
+
+func TestValidateConfigs(t *testing.T) {
+	errs := validateConfigs(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Source:  "a.yaml",
+			Service: "a",
+			Policies: doorman.Policies{
+				doorman.Policy{
+					ID:         "1",
+					Principals: []string{"userid:alice"},
+				},
+				doorman.Policy{
+					ID:         "1",
+					Principals: []string{"userid:bob"},
+				},
+				doorman.Policy{
+					ID: "2",
+				},
+				doorman.Policy{
+					ID:         "3",
+					Principals: []string{"userid:bob"},
+					Conditions: doorman.Conditions{
+						"owner": doorman.Condition{
+							Type: "healthy",
+						},
+					},
+				},
+				doorman.Policy{
+					ID:         "4",
+					Principals: []string{"userid:bob"},
+					Conditions: doorman.Conditions{
+						"branch": doorman.Condition{
+							Type:    "RegexCondition",
+							Options: map[string]interface{}{"pattern": "release/("},
+						},
+					},
+				},
+			},
+		},
+		doorman.ServiceConfig{
+			Source:  "b.yaml",
+			Service: "a",
+		},
+		doorman.ServiceConfig{
+			Source:  "c.yaml",
+			Service: "",
+		},
+		doorman.ServiceConfig{
+			Source:  "d.yaml",
+			Service: "d",
+			Matcher: doorman.MatcherConfig{Type: "fuzzy"},
+		},
+		doorman.ServiceConfig{
+			Source:      "e.yaml",
+			Service:     "e",
+			Maintenance: doorman.MaintenanceConfig{Default: "maybe"},
+		},
+		doorman.ServiceConfig{
+			Source:   "f.yaml",
+			Service:  "f",
+			JWKSFile: "jwks.json",
+		},
+		doorman.ServiceConfig{
+			Source:  "g.yaml",
+			Service: "g",
+			APIKeys: doorman.APIKeysConfig{Store: "vault"},
+		},
+		doorman.ServiceConfig{
+			Source:  "h.yaml",
+			Service: "h",
+			Claims:  map[string]string{"teams": "tag:"},
+		},
+		doorman.ServiceConfig{
+			Source:        "i.yaml",
+			Service:       "i",
+			JWKSURI:       "https://auth.corp.com/keys",
+			IssuerAliases: []string{"auth.corp.com"},
+		},
+		doorman.ServiceConfig{
+			Source:          "j.yaml",
+			Service:         "j",
+			ClaimsNamespace: "https://corp.com/",
+		},
+		doorman.ServiceConfig{
+			Source:      "k.yaml",
+			Service:     "k",
+			DecisionLog: "verbose",
+		},
+		doorman.ServiceConfig{
+			Source:  "l.yaml",
+			Service: "l",
+			Baggage: map[string]string{"client.ip": "request.remoteIP"},
+		},
+		doorman.ServiceConfig{
+			Source:  "m.yaml",
+			Service: "m",
+			Policies: doorman.Policies{
+				doorman.Policy{ID: "all", Principals: []string{"<.*>"}, Effect: "allow"},
+			},
+		},
+		doorman.ServiceConfig{
+			Source:         "n.yaml",
+			Service:        "n",
+			RequiredClaims: map[string]interface{}{"amr": map[interface{}]interface{}{"contains": "mfa"}},
+		},
+		doorman.ServiceConfig{
+			Source:  "o.yaml",
+			Service: "https://api.service.org#main",
+		},
+		doorman.ServiceConfig{
+			Source:            "p.yaml",
+			Service:           "p",
+			IdentityProvider:  "https://auth.corp.com/",
+			SigningAlgorithms: []string{"ES256", "HS256"},
+		},
+		doorman.ServiceConfig{
+			Source:    "q.yaml",
+			Service:   "q",
+			RateLimit: doorman.RateLimitConfig{Rate: -1},
+		},
+		doorman.ServiceConfig{
+			Source:     "r.yaml",
+			Service:    "r",
+			BodyFields: map[string]string{"owner": "request.owner"},
+		},
+		doorman.ServiceConfig{
+			Source:  "s.yaml",
+			Service: "s",
+			Tags: doorman.Tags{
+				"admins":     doorman.Principals{"userid:maria", "tag:superusers"},
+				"superusers": doorman.Principals{"tag:admins"},
+			},
+		},
+		doorman.ServiceConfig{
+			Source:  "u.yaml",
+			Service: "u",
+			Tags: doorman.Tags{
+				"interns": doorman.Principals{"group:interns", "exclude:tag:devs"},
+			},
+			Scopes: map[string]doorman.ScopeGrant{
+				"write:records": {Actions: []string{"write"}},
+			},
+			Policies: doorman.Policies{
+				doorman.Policy{
+					ID:         "security",
+					Principals: []string{"group:security"},
+				},
+				doorman.Policy{
+					ID:         "oncall",
+					Principals: []string{"tag:employees AND"},
+					ValidFrom:  time.Date(2018, 3, 2, 0, 0, 0, 0, time.UTC),
+					ValidUntil: time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC),
+				},
+				doorman.Policy{
+					ID:          "export",
+					Principals:  []string{"group:analysts"},
+					Obligations: []doorman.Obligation{{Options: map[string]interface{}{"field": "email"}}},
+				},
+				doorman.Policy{
+					ID:          "interns",
+					Principals:  []string{"tag:interns"},
+					Effect:      "deny",
+					Obligations: []doorman.Obligation{{Type: "log"}},
+				},
+			},
+		},
+		doorman.ServiceConfig{
+			Source:  "base.yaml",
+			Service: doorman.BaseService,
+			Policies: doorman.Policies{
+				doorman.Policy{
+					ID:         "security",
+					Principals: []string{"group:security"},
+				},
+			},
+		},
+	})
+	require.Equal(t, 32, len(errs))
+	// The rules of the services loading come first.
+	assert.Equal(t, "duplicated policy ID", errs[0].Message)
+	assert.Equal(t, "1", errs[0].Policy)
+	assert.Equal(t, "empty principals", errs[1].Message)
+	assert.Equal(t, "unknown condition type \"healthy\" for field \"owner\"", errs[2].Message)
+	assert.Equal(t, "3", errs[2].Policy)
+	// The conditions are instantiated with their options.
+	assert.Contains(t, errs[3].Message, "invalid options of condition \"RegexCondition\" for field \"branch\"")
+	assert.Equal(t, "4", errs[3].Policy)
+	errs = errs[3:]
+	assert.Contains(t, errs[1].Message, "duplicated service")
+	assert.Equal(t, "b.yaml", errs[1].Source)
+	assert.Equal(t, "empty service", errs[2].Message)
+	assert.Contains(t, errs[2].Error(), "c.yaml")
+	assert.Equal(t, "unknown matcher type \"fuzzy\"", errs[3].Message)
+	assert.Equal(t, "unknown maintenance default value \"maybe\"", errs[4].Message)
+	assert.Equal(t, "jwksFile without identityProvider", errs[5].Message)
+	assert.Equal(t, "unknown API keys store \"vault\"", errs[6].Message)
+	assert.Equal(t, "claim \"teams\" cannot be mapped to tags", errs[7].Message)
+	assert.Equal(t, "jwksURI without identityProvider", errs[8].Message)
+	assert.Equal(t, "issuerAliases without identityProvider", errs[9].Message)
+	assert.Equal(t, "claimsNamespace without identityProvider", errs[10].Message)
+	assert.Equal(t, "unknown decision log verbosity \"verbose\"", errs[11].Message)
+	assert.Equal(t, "baggage entry \"client.ip\" cannot be mapped to reserved context field \"request.remoteIP\"", errs[12].Message)
+	assert.Equal(t, "policy allows any principal (\"<.*>\") (set `allowBroad: true` if intended)", errs[13].Message)
+	assert.Equal(t, "all", errs[13].Policy)
+	assert.Equal(t, "required claim \"amr\" must be a value or a list of values", errs[14].Message)
+	assert.Equal(t, "requiredClaims without identityProvider", errs[15].Message)
+	assert.Equal(t, "audience \"https://api.service.org#main\" cannot have credentials, query or fragment", errs[16].Message)
+	assert.Equal(t, "unsupported signing algorithm \"HS256\" (use one of RS256, RS384, RS512, PS256, PS384, PS512, ES256, ES384, ES512, EdDSA)", errs[17].Message)
+	assert.Equal(t, "negative rate limit", errs[18].Message)
+	assert.Equal(t, "JSON path \"owner\" must start with `$`", errs[19].Message)
+	assert.Equal(t, "body path \"owner\" cannot be mapped to reserved context field \"request.owner\"", errs[20].Message)
+	assert.Equal(t, "tags cycle admins -> superusers -> admins", errs[21].Message)
+	assert.Equal(t, "tag \"interns\" cannot exclude \"tag:devs\"", errs[22].Message)
+	assert.Equal(t, "scope without actions or resources", errs[23].Message)
+	assert.Equal(t, "scope:write:records", errs[23].Policy)
+	assert.Equal(t, "validUntil is not after validFrom", errs[24].Message)
+	assert.Equal(t, "obligations are only returned with allow decisions", errs[25].Message)
+	assert.Equal(t, "invalid principals expression \"tag:employees AND\": unexpected end", errs[26].Message)
+	assert.Equal(t, "obligation without type", errs[27].Message)
+	assert.Equal(t, "export", errs[27].Policy)
+	assert.Equal(t, "policy ID already defined in the base configuration", errs[28].Message)
+	assert.Equal(t, "u.yaml", errs[28].Source)
+}
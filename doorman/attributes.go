@@ -0,0 +1,158 @@
+package doorman
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ory/ladon"
+)
+
+// DefaultAttributesCacheSize is the maximum number of attributes entries kept
+// by the cached providers.
+const DefaultAttributesCacheSize = 10000
+
+// AttributesProvider fetches attributes of the authorization requests from an
+// external source (eg. the owner of the resource from a database), so that the
+// policies conditions can use data that is not sent in the requests.
+type AttributesProvider interface {
+	// Attributes returns the fields to merge into the request context (eg.
+	// `resource.owner`). An error is handled like any internal error, according
+	// to the service `onError` setting.
+	Attributes(service string, request *Request) (Context, error)
+}
+
+// AttributesProviderFunc is an adapter to use ordinary functions as AttributesProvider.
+type AttributesProviderFunc func(service string, request *Request) (Context, error)
+
+// Attributes calls f(service, request).
+func (f AttributesProviderFunc) Attributes(service string, request *Request) (Context, error) {
+	return f(service, request)
+}
+
+// AddAttributesProvider registers a provider whose attributes are merged into
+// the context of every request, before it is checked. The attributes of the
+// last providers win. It must be called before serving requests.
+func (doorman *LadonDoorman) AddAttributesProvider(p AttributesProvider) {
+	doorman.attributesProviders = append(doorman.attributesProviders, p)
+}
+
+// fetchAttributes merges the attributes of the providers into the request context
+// and the ladon context.
+func (doorman *LadonDoorman) fetchAttributes(service string, request *Request, context ladon.Context) error {
+	for _, p := range doorman.attributesProviders {
+		attributes, err := p.Attributes(service, request)
+		if err != nil {
+			return fmt.Errorf("attributes provider failed: %s", err)
+		}
+		if len(attributes) == 0 {
+			continue
+		}
+		if request.Context == nil {
+			request.Context = Context{}
+		}
+		for field, value := range attributes {
+			request.Context[field] = value
+			context[field] = value
+		}
+	}
+	return nil
+}
+
+// NewCachedAttributesProvider keeps the attributes of the provider for ttl, by
+// service, principals, action, resource and context (like the decisions cache).
+// The oldest are evicted beyond size entries.
+func NewCachedAttributesProvider(p AttributesProvider, ttl time.Duration, size int) AttributesProvider {
+	if size <= 0 {
+		size = DefaultAttributesCacheSize
+	}
+	return &cachedAttributesProvider{
+		provider: p,
+		ttl:      ttl,
+		entries:  newBoundedCache(size),
+	}
+}
+
+type cachedAttributes struct {
+	attributes Context
+	expires    time.Time
+}
+
+type cachedAttributesProvider struct {
+	provider AttributesProvider
+	ttl      time.Duration
+	entries  *boundedCache
+}
+
+func (c *cachedAttributesProvider) Attributes(service string, request *Request) (Context, error) {
+	key := decisionKey(service, request)
+
+	if value, found := c.entries.get(key); found {
+		if entry := value.(cachedAttributes); time.Now().Before(entry.expires) {
+			return entry.attributes, nil
+		}
+	}
+
+	// Errors are not cached.
+	attributes, err := c.provider.Attributes(service, request)
+	if err != nil {
+		return nil, err
+	}
+
+	c.entries.set(key, cachedAttributes{attributes: attributes, expires: time.Now().Add(c.ttl)})
+	return attributes, nil
+}
+
+// DefaultAttributesTimeout is the timeout of the HTTP attributes providers requests.
+const DefaultAttributesTimeout = 5 * time.Second
+
+// HTTPAttributesProvider posts the authorization requests to a remote service,
+// which returns the attributes as a JSON object.
+type HTTPAttributesProvider struct {
+	URL string
+	// Client sends the requests (default: with DefaultAttributesTimeout).
+	Client *http.Client
+}
+
+// Attributes posts the service, principals, action, resource and context of the
+// request (without the internal `_` fields) as JSON, and reads the attributes
+// from the response body.
+func (p *HTTPAttributesProvider) Attributes(service string, request *Request) (Context, error) {
+	context := Context{}
+	for field, value := range request.Context {
+		if !strings.HasPrefix(field, "_") {
+			context[field] = value
+		}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"service":    service,
+		"principals": request.Principals,
+		"action":     request.Action,
+		"resource":   request.Resource,
+		"context":    context,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: DefaultAttributesTimeout}
+	}
+	response, err := client.Post(p.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from %s", response.StatusCode, p.URL)
+	}
+	attributes := Context{}
+	if err := json.NewDecoder(response.Body).Decode(&attributes); err != nil {
+		return nil, fmt.Errorf("invalid attributes from %s: %s", p.URL, err)
+	}
+	return attributes, nil
+}
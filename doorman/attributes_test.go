@@ -0,0 +1,158 @@
+package doorman
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ownersDoorman(t *testing.T, onError string) *LadonDoorman {
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			OnError: onError,
+			Policies: Policies{
+				Policy{
+					ID:         "owners",
+					Principals: Principals{"userid:alice", "userid:bob"},
+					Actions:    []string{"delete"},
+					Resources:  []string{"<.*>"},
+					Conditions: Conditions{
+						"resource.owner": Condition{
+							Type: "MatchPrincipalsCondition",
+						},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	return d
+}
+
+func TestAttributesProvider(t *testing.T) {
+	d := ownersDoorman(t, "")
+	owners := map[string]string{"doc1": "userid:alice"}
+	d.AddAttributesProvider(AttributesProviderFunc(func(service string, r *Request) (Context, error) {
+		return Context{"resource.owner": owners[r.Resource]}, nil
+	}))
+
+	r := &Request{Principals: Principals{"userid:alice"}, Action: "delete", Resource: "doc1"}
+	assert.True(t, d.IsAllowed("a", r))
+	assert.Equal(t, "userid:alice", r.Context["resource.owner"])
+
+	r = &Request{Principals: Principals{"userid:bob"}, Action: "delete", Resource: "doc1"}
+	assert.False(t, d.IsAllowed("a", r))
+}
+
+func TestAttributesProviderError(t *testing.T) {
+	failing := AttributesProviderFunc(func(service string, r *Request) (Context, error) {
+		return nil, fmt.Errorf("boom")
+	})
+
+	d := ownersDoorman(t, "")
+	d.AddAttributesProvider(failing)
+	assert.False(t, d.IsAllowed("a", &Request{Principals: Principals{"userid:alice"}, Action: "delete", Resource: "doc1"}))
+
+	// The errors follow the onError setting.
+	d = ownersDoorman(t, OnErrorAllow)
+	d.AddAttributesProvider(failing)
+	assert.True(t, d.IsAllowed("a", &Request{Principals: Principals{"userid:alice"}, Action: "delete", Resource: "doc1"}))
+
+	_, err := d.AllowedResources("a", &Request{Principals: Principals{"userid:alice"}, Action: "delete"})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "attributes provider failed: boom")
+}
+
+func TestCachedAttributesProvider(t *testing.T) {
+	calls := 0
+	p := NewCachedAttributesProvider(AttributesProviderFunc(func(service string, r *Request) (Context, error) {
+		calls++
+		if r.Resource == "broken" {
+			return nil, fmt.Errorf("boom")
+		}
+		return Context{"calls": calls}, nil
+	}), time.Hour, 2)
+
+	alice := &Request{Principals: Principals{"userid:alice"}, Action: "read", Resource: "doc1"}
+	attributes, _ := p.Attributes("a", alice)
+	assert.Equal(t, 1, attributes["calls"])
+	attributes, _ = p.Attributes("a", alice)
+	assert.Equal(t, 1, attributes["calls"])
+
+	// Requests with another context have their own attributes.
+	other := &Request{Principals: Principals{"userid:alice"}, Action: "read", Resource: "doc1", Context: Context{"owner": "bob"}}
+	attributes, _ = p.Attributes("a", other)
+	assert.Equal(t, 2, attributes["calls"])
+	attributes, _ = p.Attributes("a", alice)
+	assert.Equal(t, 1, attributes["calls"])
+
+	// Errors are not cached.
+	broken := &Request{Principals: Principals{"userid:alice"}, Action: "read", Resource: "broken"}
+	p.Attributes("a", broken)
+	p.Attributes("a", broken)
+	assert.Equal(t, 4, calls)
+
+	// The oldest entries are evicted.
+	p.Attributes("b", alice)
+	p.Attributes("c", alice)
+	attributes, _ = p.Attributes("a", alice)
+	assert.Equal(t, 7, attributes["calls"])
+
+	// Entries expire.
+	p = NewCachedAttributesProvider(AttributesProviderFunc(func(service string, r *Request) (Context, error) {
+		calls++
+		return Context{"calls": calls}, nil
+	}), time.Nanosecond, 0)
+	first, _ := p.Attributes("a", alice)
+	time.Sleep(time.Millisecond)
+	second, _ := p.Attributes("a", alice)
+	assert.NotEqual(t, first["calls"], second["calls"])
+}
+
+func TestHTTPAttributesProvider(t *testing.T) {
+	var received map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		if received["resource"] == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if received["resource"] == "garbage" {
+			w.Write([]byte("<html>"))
+			return
+		}
+		w.Write([]byte(`{"resource.owner": "userid:alice"}`))
+	}))
+	defer ts.Close()
+
+	p := &HTTPAttributesProvider{URL: ts.URL}
+	attributes, err := p.Attributes("a", &Request{
+		Principals: Principals{"userid:alice"},
+		Action:     "delete",
+		Resource:   "doc1",
+		Context:    Context{"remoteIP": "1.2.3.4", "_principals": Principals{"userid:alice"}},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, Context{"resource.owner": "userid:alice"}, attributes)
+	assert.Equal(t, "a", received["service"])
+	assert.Equal(t, []interface{}{"userid:alice"}, received["principals"])
+	assert.Equal(t, "delete", received["action"])
+	assert.Equal(t, map[string]interface{}{"remoteIP": "1.2.3.4"}, received["context"])
+
+	_, err = p.Attributes("a", &Request{Resource: "missing"})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unexpected status 404")
+
+	_, err = p.Attributes("a", &Request{Resource: "garbage"})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid attributes from")
+}
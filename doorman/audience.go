@@ -0,0 +1,41 @@
+package doorman
+
+import (
+	"net/http"
+
+	"github.com/mozilla/doorman/authn"
+)
+
+// AudienceSettings configure how the service of the requests (ie. the expected
+// tokens audience) is determined.
+type AudienceSettings struct {
+	// Header is the request header with the service location (default: `Origin`).
+	// Proxies often strip or rewrite `Origin`, a custom header like
+	// `X-Doorman-Audience` can be used instead.
+	Header string
+	// Fixed is the service of every request, regardless of its headers (eg.
+	// when Doorman is deployed alongside a single service).
+	Fixed string
+}
+
+// HeaderName returns the request header with the service location.
+func (a AudienceSettings) HeaderName() string {
+	if a.Header == "" {
+		return "Origin"
+	}
+	return a.Header
+}
+
+// FromRequest returns the service of the request, or an empty string if not
+// specified. It is normalized like the services of the configuration (see
+// authn.NormalizeAudience), and returned as is if invalid.
+func (a AudienceSettings) FromRequest(r *http.Request) string {
+	audience := a.Fixed
+	if audience == "" {
+		audience = r.Header.Get(a.HeaderName())
+	}
+	if normalized, err := authn.NormalizeAudience(audience); err == nil {
+		return normalized
+	}
+	return audience
+}
@@ -0,0 +1,56 @@
+package doorman
+
+import (
+	"fmt"
+)
+
+// BaseService is the service of the base configuration, whose tags and policies
+// apply to every other service (eg. the platform administrators).
+const BaseService = "*"
+
+// MergeBase returns the configurations with the tags and policies of the base
+// configuration merged into every service, and the base configuration itself
+// (nil if there is none). The tags defined in both are combined.
+func (configs ServicesConfig) MergeBase() (ServicesConfig, *ServiceConfig, error) {
+	var base *ServiceConfig
+	services := ServicesConfig{}
+	for i, config := range configs {
+		if config.Service != BaseService {
+			services = append(services, config)
+			continue
+		}
+		if base != nil {
+			return nil, nil, fmt.Errorf("duplicated base configuration %q (source %q)", BaseService, config.Source)
+		}
+		base = &configs[i]
+	}
+	if base == nil {
+		return configs, nil, nil
+	}
+
+	for i, config := range services {
+		ids := map[string]bool{}
+		for _, policy := range config.Policies {
+			ids[policy.ID] = true
+		}
+		policies := append(Policies{}, config.Policies...)
+		for _, policy := range base.Policies {
+			if ids[policy.ID] {
+				return nil, nil, fmt.Errorf("policy %q of the base configuration is duplicated in service %q", policy.ID, config.Service)
+			}
+			policies = append(policies, policy)
+		}
+		tags := Tags{}
+		for tag, members := range base.Tags {
+			tags[tag] = append(Principals{}, members...)
+		}
+		for tag, members := range config.Tags {
+			tags[tag] = append(tags[tag], members...)
+		}
+		// Copy, so that the loaded configurations are left untouched.
+		config.Policies = policies
+		config.Tags = tags
+		services[i] = config
+	}
+	return services, base, nil
+}
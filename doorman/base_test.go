@@ -0,0 +1,106 @@
+package doorman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeBase(t *testing.T) {
+	base := ServiceConfig{
+		Source:  "base.yaml",
+		Service: BaseService,
+		Tags: Tags{
+			"admins": Principals{"userid:maria"},
+		},
+		Policies: Policies{
+			Policy{
+				ID:         "superadmins",
+				Principals: Principals{"tag:admins"},
+				Actions:    []string{"<.*>"},
+				Resources:  []string{"<.*>"},
+				Effect:     "allow",
+			},
+		},
+	}
+	a := ServiceConfig{
+		Source:  "a.yaml",
+		Service: "a",
+		Tags: Tags{
+			"admins": Principals{"userid:bob"},
+		},
+		Policies: Policies{
+			Policy{
+				ID:         "readers",
+				Principals: Principals{"userid:<.*>"},
+				Actions:    []string{"read"},
+				Resources:  []string{"<.*>"},
+				Effect:     "allow",
+			},
+		},
+	}
+
+	merged, b, err := ServicesConfig{a, base}.MergeBase()
+	require.Nil(t, err)
+	assert.Equal(t, "base.yaml", b.Source)
+	require.Equal(t, 1, len(merged))
+	assert.Equal(t, Principals{"userid:maria", "userid:bob"}, merged[0].Tags["admins"])
+	require.Equal(t, 2, len(merged[0].Policies))
+	assert.Equal(t, "superadmins", merged[0].Policies[1].ID)
+	// The original configuration is left untouched.
+	assert.Equal(t, 1, len(a.Policies))
+	assert.Equal(t, Principals{"userid:bob"}, a.Tags["admins"])
+
+	// Without base, the configurations are unchanged.
+	merged, b, err = ServicesConfig{a}.MergeBase()
+	require.Nil(t, err)
+	assert.Nil(t, b)
+	assert.Equal(t, ServicesConfig{a}, merged)
+
+	_, _, err = ServicesConfig{a, base, base}.MergeBase()
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "duplicated base configuration")
+
+	a.Policies[0].ID = "superadmins"
+	_, _, err = ServicesConfig{a, base}.MergeBase()
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "policy \"superadmins\" of the base configuration is duplicated in service \"a\"")
+}
+
+func TestLoadPoliciesBase(t *testing.T) {
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{Source: "a.yaml", Service: "a"},
+		ServiceConfig{Source: "b.yaml", Service: "b"},
+		ServiceConfig{
+			Source:  "base.yaml",
+			Service: BaseService,
+			Tags: Tags{
+				"security": Principals{"userid:maria"},
+			},
+			Policies: Policies{
+				Policy{
+					ID:         "audit",
+					Principals: Principals{"tag:security"},
+					Actions:    []string{"audit"},
+					Resources:  []string{"<.*>"},
+					Effect:     "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+
+	for _, service := range []string{"a", "b"} {
+		assert.True(t, d.IsAllowed(service, &Request{
+			Principals: Principals{"userid:maria", "tag:security"},
+			Action:     "audit",
+			Resource:   "logs",
+		}))
+	}
+	// The base configuration is not a service.
+	_, ok := d.ServiceConfig(BaseService)
+	assert.False(t, ok)
+	assert.Contains(t, d.ConfigSources(), "base.yaml")
+}
@@ -0,0 +1,100 @@
+package doorman
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxBodySize is the maximum size of the requests bodies read to extract
+// context fields (see ServiceConfig.BodyFields).
+const MaxBodySize = 1 << 20
+
+// ParseJSONPath parses a JSONPath expression made of object fields and array
+// indexes (eg. `$.owner`, `$.items[0].amount`). The steps are returned as
+// strings (fields) and ints (indexes).
+func ParseJSONPath(path string) ([]interface{}, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("JSON path %q must start with `$`", path)
+	}
+	steps := []interface{}{}
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			field := rest[1 : end+1]
+			if field == "" || field == "*" {
+				return nil, fmt.Errorf("invalid field in JSON path %q", path)
+			}
+			steps = append(steps, field)
+			rest = rest[end+1:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed bracket in JSON path %q", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid index in JSON path %q", path)
+			}
+			steps = append(steps, index)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid JSON path %q", path)
+		}
+	}
+	return steps, nil
+}
+
+// BodyContext returns the context fields lifted from the JSON body, with the
+// mapping of JSON paths to context fields. Bodies that are not JSON, invalid
+// paths and missing values are ignored.
+func BodyContext(body []byte, mapping map[string]string) Context {
+	context := Context{}
+	if len(mapping) == 0 || len(body) == 0 {
+		return context
+	}
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return context
+	}
+	for path, field := range mapping {
+		steps, err := ParseJSONPath(path)
+		if err != nil {
+			continue
+		}
+		if value, ok := lookupJSONPath(document, steps); ok {
+			context[field] = value
+		}
+	}
+	return context
+}
+
+// lookupJSONPath returns the value at the steps of the document.
+func lookupJSONPath(document interface{}, steps []interface{}) (interface{}, bool) {
+	value := document
+	for _, step := range steps {
+		switch s := step.(type) {
+		case string:
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if value, ok = object[s]; !ok {
+				return nil, false
+			}
+		case int:
+			array, ok := value.([]interface{})
+			if !ok || s >= len(array) {
+				return nil, false
+			}
+			value = array[s]
+		}
+	}
+	return value, true
+}
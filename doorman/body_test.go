@@ -0,0 +1,40 @@
+package doorman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	steps, err := ParseJSONPath("$.items[0].owner")
+	require.Nil(t, err)
+	assert.Equal(t, []interface{}{"items", 0, "owner"}, steps)
+
+	steps, err = ParseJSONPath("$")
+	require.Nil(t, err)
+	assert.Equal(t, []interface{}{}, steps)
+
+	for _, path := range []string{"owner", "$..owner", "$.items[", "$.items[-1]", "$.items[*]", "$.*", "$owner"} {
+		_, err := ParseJSONPath(path)
+		assert.NotNil(t, err, path)
+	}
+}
+
+func TestBodyContext(t *testing.T) {
+	body := []byte(`{"owner": "ana", "amount": 42.5, "items": [{"sku": "a1"}], "draft": false}`)
+	context := BodyContext(body, map[string]string{
+		"$.owner":        "owner",
+		"$.amount":       "amount",
+		"$.items[0].sku": "sku",
+		"$.draft":        "draft",
+		"$.items[3].sku": "missing",
+		"$.owner.name":   "name",
+		"owner":          "invalid",
+	})
+	assert.Equal(t, Context{"owner": "ana", "amount": 42.5, "sku": "a1", "draft": false}, context)
+
+	assert.Equal(t, Context{}, BodyContext([]byte("owner=ana"), map[string]string{"$.owner": "owner"}))
+	assert.Equal(t, Context{}, BodyContext(body, nil))
+}
@@ -0,0 +1,48 @@
+package doorman
+
+import (
+	"sync"
+)
+
+// boundedCache keeps a bounded amount of entries. The oldest are evicted first.
+type boundedCache struct {
+	sync.Mutex
+	size    int
+	entries map[string]interface{}
+	keys    []string
+}
+
+func newBoundedCache(size int) *boundedCache {
+	return &boundedCache{
+		size:    size,
+		entries: map[string]interface{}{},
+		keys:    []string{},
+	}
+}
+
+func (c *boundedCache) set(key string, value interface{}) {
+	c.Lock()
+	defer c.Unlock()
+	if _, exists := c.entries[key]; !exists {
+		if len(c.keys) >= c.size {
+			delete(c.entries, c.keys[0])
+			c.keys = c.keys[1:]
+		}
+		c.keys = append(c.keys, key)
+	}
+	c.entries[key] = value
+}
+
+func (c *boundedCache) get(key string) (interface{}, bool) {
+	c.Lock()
+	defer c.Unlock()
+	value, found := c.entries[key]
+	return value, found
+}
+
+func (c *boundedCache) clear() {
+	c.Lock()
+	defer c.Unlock()
+	c.entries = map[string]interface{}{}
+	c.keys = []string{}
+}
@@ -0,0 +1,27 @@
+package doorman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoundedCache(t *testing.T) {
+	c := newBoundedCache(2)
+	c.set("a", true)
+	c.set("b", false)
+	c.set("a", false)
+	c.set("c", true)
+
+	_, found := c.get("a")
+	assert.False(t, found)
+	value, found := c.get("b")
+	assert.True(t, found)
+	assert.Equal(t, false, value)
+	value, _ = c.get("c")
+	assert.Equal(t, true, value)
+
+	c.clear()
+	_, found = c.get("c")
+	assert.False(t, found)
+}
@@ -0,0 +1,50 @@
+package doorman
+
+import (
+	"fmt"
+	"sort"
+)
+
+// UnmetClaims returns the names of the required claims of the service
+// configuration that the specified claims do not satisfy, sorted by name.
+//
+// A required claim without value must be present. Otherwise its value must be
+// equal, or contained in the claim when it is a list (eg. `amr: mfa`). With a
+// list of values, every value must be contained.
+func (c *ServiceConfig) UnmetClaims(claims map[string]interface{}) []string {
+	unmet := []string{}
+	for name, expected := range c.RequiredClaims {
+		value, ok := claims[name]
+		if !ok || value == nil || !claimContains(value, expected) {
+			unmet = append(unmet, name)
+		}
+	}
+	sort.Strings(unmet)
+	return unmet
+}
+
+// claimContains returns true if the claim value matches the expected value.
+// Values are compared by their string representation, since identity providers
+// do not agree on types (eg. `"true"` or `true`).
+func claimContains(value interface{}, expected interface{}) bool {
+	if expected == nil {
+		return true
+	}
+	if list, ok := expected.([]interface{}); ok {
+		for _, e := range list {
+			if !claimContains(value, e) {
+				return false
+			}
+		}
+		return true
+	}
+	if values, ok := value.([]interface{}); ok {
+		for _, v := range values {
+			if fmt.Sprint(v) == fmt.Sprint(expected) {
+				return true
+			}
+		}
+		return false
+	}
+	return fmt.Sprint(value) == fmt.Sprint(expected)
+}
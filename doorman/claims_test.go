@@ -0,0 +1,46 @@
+package doorman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmetClaims(t *testing.T) {
+	config := ServiceConfig{
+		RequiredClaims: map[string]interface{}{
+			"email_verified": true,
+			"amr":            "mfa",
+			"org_id":         nil,
+			"scope":          []interface{}{"read", "write"},
+			"level":          2,
+		},
+	}
+
+	assert.Equal(t, []string{}, config.UnmetClaims(map[string]interface{}{
+		"email_verified": true,
+		"amr":            []interface{}{"pwd", "mfa"},
+		"org_id":         "acme",
+		"scope":          []interface{}{"write", "read", "admin"},
+		"level":          2.0,
+	}))
+
+	// Types are not strict.
+	assert.Equal(t, []string{}, config.UnmetClaims(map[string]interface{}{
+		"email_verified": "true",
+		"amr":            "mfa",
+		"org_id":         0,
+		"scope":          []interface{}{"read", "write"},
+		"level":          "2",
+	}))
+
+	assert.Equal(t, []string{"amr", "email_verified", "level", "org_id", "scope"}, config.UnmetClaims(map[string]interface{}{
+		"email_verified": false,
+		"amr":            []interface{}{"pwd"},
+		"org_id":         nil,
+		"scope":          []interface{}{"read"},
+		"level":          1,
+	}))
+
+	assert.Equal(t, []string{}, (&ServiceConfig{}).UnmetClaims(nil))
+}
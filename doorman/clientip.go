@@ -0,0 +1,41 @@
+package doorman
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIPContextField is the request context field holding the IP address of
+// the client, set by Doorman (see ClientIP).
+const ClientIPContextField = "clientIP"
+
+// ClientIP returns the IP address of the client of the request. If the request
+// comes from one of the trusted proxies, the `X-Forwarded-For` header is read
+// from right to left, and the first address which is not a trusted proxy is
+// returned.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	ip := parseIP(r.RemoteAddr)
+	if ip == nil {
+		return r.RemoteAddr
+	}
+	if !containsIP(trustedProxies, ip) {
+		return ip.String()
+	}
+	var forwarded []string
+	for _, value := range r.Header[http.CanonicalHeaderKey("X-Forwarded-For")] {
+		forwarded = append(forwarded, strings.Split(value, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := parseIP(forwarded[i])
+		if hop == nil {
+			// Cannot be trusted further.
+			break
+		}
+		ip = hop
+		if !containsIP(trustedProxies, hop) {
+			break
+		}
+	}
+	return ip.String()
+}
@@ -0,0 +1,93 @@
+package doorman
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseCIDRs([]string{"10.0.0.0/8", "192.168.1.1"})
+	require.Nil(t, err)
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.7:4242"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	// Not from a trusted proxy: the header is ignored.
+	assert.Equal(t, "203.0.113.7", ClientIP(r, proxies))
+	assert.Equal(t, "203.0.113.7", ClientIP(r, nil))
+
+	r.RemoteAddr = "10.1.2.3:4242"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.7, 192.168.1.1")
+	r.Header.Add("X-Forwarded-For", "10.0.0.2")
+	// Spoofed entries on the left are ignored.
+	assert.Equal(t, "203.0.113.7", ClientIP(r, proxies))
+
+	// Only trusted proxies.
+	r.Header.Set("X-Forwarded-For", "10.0.0.2")
+	assert.Equal(t, "10.0.0.2", ClientIP(r, proxies))
+
+	// Invalid entries stop the walk.
+	r.Header.Set("X-Forwarded-For", "198.51.100.1, unknown")
+	assert.Equal(t, "10.1.2.3", ClientIP(r, proxies))
+
+	r.RemoteAddr = "pipe"
+	assert.Equal(t, "pipe", ClientIP(r, proxies))
+}
+
+func TestParseCIDRs(t *testing.T) {
+	networks, err := ParseCIDRs([]string{"10.0.0.0/8", " 2001:db8::1 ", "192.168.1.1"})
+	require.Nil(t, err)
+	assert.Equal(t, "10.0.0.0/8", networks[0].String())
+	assert.Equal(t, "2001:db8::1/128", networks[1].String())
+	assert.Equal(t, "192.168.1.1/32", networks[2].String())
+
+	_, err = ParseCIDRs([]string{"10.0.0.0/33"})
+	assert.Contains(t, err.Error(), "invalid CIDR \"10.0.0.0/33\"")
+}
+
+func TestCIDRsCondition(t *testing.T) {
+	var c CIDRsCondition
+	err := json.Unmarshal([]byte(`{"cidrs": ["10.0.0.0/8", "192.168.0.0/16"]}`), &c)
+	require.Nil(t, err)
+	assert.True(t, c.Fulfills("10.1.2.3", nil))
+	assert.True(t, c.Fulfills("192.168.4.2:4242", nil))
+	assert.False(t, c.Fulfills("172.16.0.1", nil))
+	assert.False(t, c.Fulfills("unknown", nil))
+	assert.False(t, c.Fulfills(42, nil))
+
+	// Not parsed.
+	assert.False(t, (&CIDRsCondition{CIDRs: []string{"10.0.0.0/8"}}).Fulfills("10.1.2.3", nil))
+
+	err = json.Unmarshal([]byte(`{"cidrs": ["10.0.0.0/8", "invalid"]}`), &c)
+	assert.Equal(t, "invalid CIDR \"invalid\"", err.Error())
+}
+
+func TestCIDRsConditionInvalid(t *testing.T) {
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Policies: Policies{
+				Policy{
+					ID:         "office",
+					Principals: Principals{"userid:bob"},
+					Actions:    []string{"read"},
+					Resources:  []string{"reports"},
+					Effect:     "allow",
+					Conditions: Conditions{
+						"remoteIP": Condition{
+							Type:    "CIDRsCondition",
+							Options: map[string]interface{}{"cidrs": []string{"10.0.0.0/33"}},
+						},
+					},
+				},
+			},
+		},
+	})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid CIDR \"10.0.0.0/33\"")
+}
@@ -0,0 +1,20 @@
+package doorman
+
+import (
+	"github.com/ory/ladon"
+)
+
+// RegisterCondition adds a custom condition type, that can be used in the
+// policies conditions. The factory returns an empty condition, whose fields are
+// unmarshalled from the condition options as JSON. It must be called before
+// loading policies.
+func RegisterCondition(name string, factory func() ladon.Condition) {
+	ladon.ConditionFactories[name] = factory
+}
+
+// IsConditionRegistered returns true if the condition type is known (built-in
+// Ladon and Doorman conditions, or registered with RegisterCondition).
+func IsConditionRegistered(name string) bool {
+	_, found := ladon.ConditionFactories[name]
+	return found
+}
@@ -0,0 +1,71 @@
+package doorman
+
+import (
+	"testing"
+
+	"github.com/ory/ladon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// evenCondition is fulfilled by the even numbers.
+type evenCondition struct {
+	Offset int `json:"offset"`
+}
+
+func (c *evenCondition) Fulfills(value interface{}, r *ladon.Request) bool {
+	n, ok := value.(int)
+	return ok && (n+c.Offset)%2 == 0
+}
+
+func (c *evenCondition) GetName() string {
+	return "EvenCondition"
+}
+
+func TestRegisterCondition(t *testing.T) {
+	assert.True(t, IsConditionRegistered("StringEqualCondition"))
+	assert.True(t, IsConditionRegistered("RecentAuthCondition"))
+	assert.False(t, IsConditionRegistered("EvenCondition"))
+
+	RegisterCondition("EvenCondition", func() ladon.Condition {
+		return new(evenCondition)
+	})
+	defer delete(ladon.ConditionFactories, "EvenCondition")
+	assert.True(t, IsConditionRegistered("EvenCondition"))
+
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Policies: Policies{
+				Policy{
+					ID:         "1",
+					Principals: []string{"<.*>"},
+					Actions:    []string{"read"},
+					Resources:  []string{"<.*>"},
+					Conditions: Conditions{
+						"page": Condition{
+							Type: "EvenCondition",
+							Options: map[string]interface{}{
+								"offset": 1,
+							},
+						},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+
+	request := func(page int) *Request {
+		return &Request{
+			Principals: Principals{"userid:bob"},
+			Action:     "read",
+			Resource:   "book",
+			Context:    Context{"page": page},
+		}
+	}
+	assert.True(t, d.IsAllowed("a", request(3)))
+	assert.False(t, d.IsAllowed("a", request(4)))
+}
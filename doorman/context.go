@@ -0,0 +1,60 @@
+package doorman
+
+import (
+	"sort"
+	"strings"
+)
+
+// Reserved namespaces of the requests context. Their fields are only set by
+// Doorman: callers cannot supply them (eg. to spoof `request.remoteIP`).
+const (
+	// RequestContextNamespace holds the transport attributes (`request.remoteIP`, `request.service`).
+	RequestContextNamespace = "request."
+	// SubjectContextNamespace holds the authentication attributes (`subject.authTime`, `subject.tenant`).
+	SubjectContextNamespace = "subject."
+	// ResourceContextNamespace holds the resource attributes.
+	ResourceContextNamespace = "resource."
+	// EnvContextNamespace holds the environment attributes.
+	EnvContextNamespace = "env."
+)
+
+var reservedContextNamespaces = []string{
+	RequestContextNamespace,
+	SubjectContextNamespace,
+	ResourceContextNamespace,
+	EnvContextNamespace,
+}
+
+// IsReservedContextField returns true if the field belongs to a reserved namespace.
+func IsReservedContextField(field string) bool {
+	for _, namespace := range reservedContextNamespaces {
+		if strings.HasPrefix(field, namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReservedFields returns the sorted fields of the context that belong to a
+// reserved namespace.
+func (c Context) ReservedFields() []string {
+	fields := []string{}
+	for field := range c {
+		if IsReservedContextField(field) {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// SetTransport sets the transport fields of the context: the `remoteIP` and
+// `clientIP` fields, and the `request.remoteIP`, `request.clientIP` and
+// `request.service` ones.
+func (c Context) SetTransport(service string, remoteIP string, clientIP string) {
+	c["remoteIP"] = remoteIP
+	c[RequestContextNamespace+"remoteIP"] = remoteIP
+	c[ClientIPContextField] = clientIP
+	c[RequestContextNamespace+"clientIP"] = clientIP
+	c[RequestContextNamespace+"service"] = service
+}
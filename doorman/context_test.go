@@ -0,0 +1,34 @@
+package doorman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReservedContextFields(t *testing.T) {
+	assert.True(t, IsReservedContextField("request.remoteIP"))
+	assert.True(t, IsReservedContextField("env.time"))
+	assert.False(t, IsReservedContextField("remoteIP"))
+	assert.False(t, IsReservedContextField("requester"))
+
+	c := Context{
+		"subject.tenant":   "acme",
+		"request.remoteIP": "10.0.0.1",
+		"planet":           "mars",
+	}
+	assert.Equal(t, []string{"request.remoteIP", "subject.tenant"}, c.ReservedFields())
+	assert.Equal(t, []string{}, Context{}.ReservedFields())
+}
+
+func TestContextSetTransport(t *testing.T) {
+	c := Context{}
+	c.SetTransport("https://api.corp.com", "10.0.0.1", "203.0.113.7")
+	assert.Equal(t, Context{
+		"remoteIP":         "10.0.0.1",
+		"request.remoteIP": "10.0.0.1",
+		"clientIP":         "203.0.113.7",
+		"request.clientIP": "203.0.113.7",
+		"request.service":  "https://api.corp.com",
+	}, c)
+}
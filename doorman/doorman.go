@@ -6,6 +6,8 @@ package doorman
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/mozilla/doorman/authn"
 )
@@ -22,6 +24,13 @@ type Condition struct {
 // Conditions is a collection of conditions.
 type Conditions map[string]Condition
 
+// Obligation is a requirement that the caller must enforce when the request is
+// allowed by the policy (eg. log a reason, mask a field).
+type Obligation struct {
+	Type    string
+	Options map[string]interface{}
+}
+
 // Policy represents an access control.
 type Policy struct {
 	ID          string
@@ -31,36 +40,296 @@ type Policy struct {
 	Resources   []string
 	Actions     []string
 	Conditions  Conditions
+	// Exclude are principals carved out of the policy (eg. `userid:bob` among
+	// `group:devs`), whatever their other principals.
+	Exclude []string
+	// Obligations are returned with the requests allowed by the policy.
+	Obligations []Obligation
+	// ValidFrom and ValidUntil bound the validity of the policy (eg. temporary
+	// access grants). Outside of it, the policy is loaded but skipped.
+	ValidFrom  time.Time `yaml:"validFrom"`
+	ValidUntil time.Time `yaml:"validUntil"`
+	// AllowBroad acknowledges that the policy is intentionally broad (eg. allows
+	// every action on every resource), which is otherwise refused when loaded.
+	AllowBroad bool `yaml:"allowBroad"`
 }
 
 // Policies is a collection of policies.
 type Policies []Policy
 
+// TenantConfig specifies where the tenant of the caller is read from.
+type TenantConfig struct {
+	// Claim is the name of the authentication claim holding the tenant.
+	Claim string
+	// Header is the name of the request header holding the tenant.
+	Header string
+}
+
+// Enabled returns true if a tenant source was specified.
+func (t TenantConfig) Enabled() bool {
+	return t.Claim != "" || t.Header != ""
+}
+
+// TokenConfig specifies where the token is read from, when the requests have no
+// `Authorization` header (eg. browser apps, WebSocket handshakes).
+type TokenConfig struct {
+	// Header is the name of a custom request header.
+	Header string
+	// Cookie is the name of the cookie.
+	Cookie string
+	// Query is the name of the querystring parameter (eg. `access_token`).
+	Query string
+}
+
+// Extractors returns the token extractors, in order of precedence.
+func (t TokenConfig) Extractors() []authn.TokenExtractor {
+	var extractors []authn.TokenExtractor
+	if t.Header != "" {
+		extractors = append(extractors, authn.TokenFromHeader(t.Header))
+	}
+	if t.Cookie != "" {
+		extractors = append(extractors, authn.TokenFromCookie(t.Cookie))
+	}
+	if t.Query != "" {
+		extractors = append(extractors, authn.TokenFromQuery(t.Query))
+	}
+	return extractors
+}
+
+// APIKeysConfig specifies where the API keys of machine clients are looked up.
+type APIKeysConfig struct {
+	// File is a YAML file with the keys names, values and groups.
+	File string
+	// Env is the environment variable with the `{name}={key}` entries.
+	Env string
+	// Store is the name of a store registered with authn.RegisterAPIKeyStore().
+	Store string
+}
+
+// Enabled returns true if an API keys store was specified.
+func (c APIKeysConfig) Enabled() bool {
+	return c.File != "" || c.Env != "" || c.Store != ""
+}
+
+// Behaviors when an internal error occurs while checking an authorization request.
+const (
+	// OnErrorDeny denies the request (default).
+	OnErrorDeny = "deny"
+	// OnErrorAllow allows the request and logs a warning.
+	OnErrorAllow = "allow"
+	// OnErrorStale serves the last decision taken for the same request, or denies it.
+	OnErrorStale = "stale"
+)
+
+// Outcomes of the requests during maintenance.
+const (
+	// MaintenanceAllow allows the requests.
+	MaintenanceAllow = "allow"
+	// MaintenanceDeny denies the requests.
+	MaintenanceDeny = "deny"
+)
+
+// Verbosities of the decisions logs.
+const (
+	// DecisionLogNone logs no decision.
+	DecisionLogNone = "none"
+	// DecisionLogDenials only logs the denied requests.
+	DecisionLogDenials = "denials"
+	// DecisionLogAll logs every decision, without the requests context.
+	DecisionLogAll = "all"
+	// DecisionLogContext logs every decision with the requests context (default).
+	DecisionLogContext = "context"
+)
+
+// MaintenanceConfig specifies the decisions forced while a service is in
+// maintenance (eg. during incidents), regardless of its policies.
+type MaintenanceConfig struct {
+	// Enabled puts the service in maintenance when loaded.
+	Enabled bool
+	// Allow lists the actions that are allowed (`*` wildcards are supported).
+	Allow []string
+	// Deny lists the actions that are denied (`*` wildcards are supported).
+	Deny []string
+	// Default is the outcome of the other actions: `allow`, `deny`, or empty to
+	// check the policies.
+	Default string
+}
+
+// RateLimitConfig limits the authorization requests of each user of a service
+// (`userid:` principal), with a token bucket.
+type RateLimitConfig struct {
+	// Rate is the number of requests per second refilled in the bucket (0: unlimited).
+	Rate float64
+	// Burst is the size of the bucket, ie. the number of requests accepted at
+	// once (default: the rate, and at least 1).
+	Burst int
+}
+
 // ServiceConfig represents the policies file content.
 type ServiceConfig struct {
+	// Version is the schema version of the policies file.
+	Version          int
 	Source           string
 	Service          string
 	IdentityProvider string `yaml:"identityProvider"`
-	Tags             Tags
-	Policies         Policies
+	// IdentityProviders are other trusted identity providers. The token issuer
+	// determines which one validates it.
+	IdentityProviders []string `yaml:"identityProviders"`
+	// JWKSFile is a local file with the identity provider public keys (eg. offline).
+	JWKSFile string `yaml:"jwksFile"`
+	// JWKSURI is the location of the identity provider public keys, instead of
+	// the one of its OpenID configuration.
+	JWKSURI string `yaml:"jwksURI"`
+	// IssuerAliases are other accepted values of the tokens `iss` claim (eg.
+	// while the identity provider domain is renamed).
+	IssuerAliases []string `yaml:"issuerAliases"`
+	// ClaimsNamespace is the URL prefix of the custom claims holding the email,
+	// groups and roles (eg. `https://example.com/` with Auth0).
+	ClaimsNamespace string `yaml:"claimsNamespace"`
+	// SigningAlgorithms are the accepted signing algorithms of the tokens of the
+	// identity provider (eg. `ES256`), instead of its default one.
+	SigningAlgorithms []string `yaml:"signingAlgorithms"`
+	// APIKeys specifies the API keys stores of machine clients.
+	APIKeys APIKeysConfig `yaml:"apiKeys"`
+	// ClientCertificates enables the authentication with the TLS client
+	// certificates verified by the server, alone or in addition to tokens.
+	ClientCertificates bool `yaml:"clientCertificates"`
+	// Token specifies where the token is read from, besides the `Authorization` header.
+	Token TokenConfig
+	// Claims maps authentication claims to principals prefixes (eg. `roles: role`
+	// turns the values of the `roles` claim into `role:{value}` principals).
+	Claims map[string]string
+	// RequiredClaims are claims that the tokens must have to be accepted (eg.
+	// `email_verified: true`, `amr: mfa`). See UnmetClaims().
+	RequiredClaims map[string]interface{} `yaml:"requiredClaims"`
+	Tenant         TenantConfig
+	OnError        string `yaml:"onError"`
+	// DenyPrecedence denies the requests if any principal is explicitly denied,
+	// even if another principal is allowed.
+	DenyPrecedence bool `yaml:"denyPrecedence"`
+	Matcher        MatcherConfig
+	Maintenance    MaintenanceConfig
+	RateLimit      RateLimitConfig `yaml:"rateLimit"`
+	// DecisionLog is the verbosity of the decisions logs (see DecisionLogNone, …).
+	DecisionLog string `yaml:"decisionLog"`
+	Baggage     map[string]string
+	// BodyFields maps JSON paths of the protected requests bodies to context
+	// fields (eg. `$.owner: owner`), with the reverse proxy and the Envoy
+	// external authorization.
+	BodyFields map[string]string `yaml:"bodyFields"`
+	Includes   []string
+	// Overlays are files that patch the policies, tags and variables per
+	// environment (eg. `overlays/${ENVIRONMENT}.yaml`).
+	Overlays  []string
+	Variables map[string]interface{}
+	Tags      Tags
+	Policies  Policies
+	// Scopes are shorthands for the policies that allow OAuth scopes (see ScopeGrant).
+	Scopes map[string]ScopeGrant
+	// TagSources maps tags members to the file they were included from, when
+	// different from Source.
+	TagSources map[string]map[string]string `yaml:"-" json:"-"`
+}
+
+// TagMatch explains why a tag principal was added.
+type TagMatch struct {
+	// Tag is the added principal (eg. `tag:admins`).
+	Tag string
+	// Member is the tag member that matched.
+	Member string
+	// Principal is the specified principal that matched the member.
+	Principal string
+	// Source is the file where the member is defined.
+	Source string
 }
 
 // GetTags returns the tags principals for the ones specified.
 func (c *ServiceConfig) GetTags(principals Principals) Principals {
 	result := Principals{}
-	for tag, members := range c.Tags {
-		for _, member := range members {
-			for _, principal := range principals {
-				if principal == member {
-					prefixed := fmt.Sprintf("tag:%s", tag)
-					result = append(result, prefixed)
+	for _, match := range c.ExplainTags(principals) {
+		result = append(result, match.Tag)
+	}
+	return result
+}
+
+// ExplainTags returns the tags matches for the principals specified. Tags can
+// have other tags as members (eg. `tag:admins` in `superusers`): the matched tags
+// are added to the principals until no other tag matches, which also stops on
+// cycles. The principals excluded from a tag (eg. `exclude:userid:bob`) never get
+// it. The principals expressions of the policies (eg. `tag:employees AND
+// tag:oncall`) are then added if the principals fulfill them.
+func (c *ServiceConfig) ExplainTags(principals Principals) []TagMatch {
+	result := []TagMatch{}
+	// Users can have hundreds of principals (eg. groups), avoid nested loops.
+	set := make(map[string]bool, len(principals))
+	specified := make(map[string]bool, len(principals))
+	for _, principal := range principals {
+		set[principal] = true
+		specified[principal] = true
+	}
+	matched := map[string]bool{}
+	for changed := true; changed; {
+		changed = false
+		for tag, members := range c.Tags {
+			if matched[tag] {
+				continue
+			}
+			excluded := false
+			for _, principal := range c.Tags.exclusions(tag) {
+				excluded = excluded || specified[principal]
+			}
+			if excluded {
+				continue
+			}
+			for _, member := range members {
+				if set[member] && !strings.HasPrefix(member, excludePrefix) {
+					result = append(result, TagMatch{
+						Tag:       fmt.Sprintf("tag:%s", tag),
+						Member:    member,
+						Principal: member,
+						Source:    c.TagSource(tag, member),
+					})
+					matched[tag] = true
 				}
 			}
+			if matched[tag] {
+				set[fmt.Sprintf("tag:%s", tag)] = true
+				changed = true
+			}
+		}
+	}
+	for _, expression := range c.principalsExpressions() {
+		if e, err := parsePrincipalsExpression(expression); err == nil && e.eval(set) {
+			result = append(result, TagMatch{
+				Tag:       expression,
+				Member:    expression,
+				Principal: expression,
+				Source:    c.Source,
+			})
 		}
 	}
 	return result
 }
 
+// TagSource returns the file where the tag member is defined.
+func (c *ServiceConfig) TagSource(tag string, member string) string {
+	if source, ok := c.TagSources[tag][member]; ok {
+		return source
+	}
+	return c.Source
+}
+
+// SetTagSource records the file where the tag member is defined.
+func (c *ServiceConfig) SetTagSource(tag string, member string, source string) {
+	if c.TagSources == nil {
+		c.TagSources = map[string]map[string]string{}
+	}
+	if c.TagSources[tag] == nil {
+		c.TagSources[tag] = map[string]string{}
+	}
+	c.TagSources[tag][member] = source
+}
+
 // ServicesConfig is the whole set of policies files.
 type ServicesConfig []ServiceConfig
 
@@ -98,16 +367,159 @@ func (r *Request) Roles() Principals {
 	return p
 }
 
+// Result is the outcome of an authorization request.
+type Result struct {
+	Allowed bool
+	// Reason is set on denials, when the client can do something about it
+	// (eg. ReasonReauthenticate).
+	Reason string
+	// Obligations are the obligations of the policies that allowed the request.
+	Obligations []Obligation
+}
+
+// ReasonReauthenticate means that the request would be allowed if the user
+// authenticated again (see RecentAuthCondition).
+const ReasonReauthenticate = "reauthentication_required"
+
+// Decision is the record of an authorization decision.
+type Decision struct {
+	// ID is the unique identifier of the decision (empty if unknown).
+	ID         string
+	Time       time.Time
+	Service    string
+	Principals Principals
+	Action     string
+	Resource   string
+	RemoteIP   string
+	Allowed    bool
+	// Maintenance is true if the decision was forced by the maintenance mode.
+	Maintenance bool
+	// Policies are the IDs of the policies that decided.
+	Policies []string
+	// Reason is the reason of the denial, if any (see Result).
+	Reason string
+	// Obligations are the obligations of the policies that allowed the request.
+	Obligations []Obligation
+}
+
+// LoadStatus is the outcome of the policies loads.
+type LoadStatus struct {
+	// LoadedAt is the time of the last successful load (zero if never loaded).
+	LoadedAt time.Time
+	// Error is the error of the last load, if it failed. The policies of the
+	// previous successful load are still used.
+	Error    error
+	FailedAt time.Time
+}
+
+// ResourcePattern is a resource of a policy (eg. `records/<[0-9]+>`).
+type ResourcePattern struct {
+	Pattern string
+	// Policy is the ID of the policy.
+	Policy string
+}
+
+// ResourcePatterns are the resources of the policies that match some principals
+// and action (see Doorman.AllowedResources).
+type ResourcePatterns struct {
+	Allowed []ResourcePattern
+	// Denied are the resources of the deny policies: the resources matching both
+	// an allowed and a denied pattern can be denied.
+	Denied []ResourcePattern
+}
+
+// ResidualCondition is a policy condition that could not be evaluated without
+// the resource (eg. on `resource.owner`), left to the caller.
+type ResidualCondition struct {
+	// Field is the context field of the condition.
+	Field string
+	// Type is the condition type (eg. `MatchPrincipalsCondition`).
+	Type    string
+	Options map[string]interface{}
+}
+
+// FilterClause is a policy that matches some principals and action, and applies
+// to the resources matching one of its patterns and all its residual conditions.
+type FilterClause struct {
+	// Policy is the ID of the policy.
+	Policy    string
+	Resources []string
+	// Principals are the request principals matched by the policy (eg. the
+	// subjects of `MatchPrincipalsCondition`).
+	Principals Principals
+	Conditions []ResidualCondition
+}
+
+// DataFilter is the result of the partial evaluation of a request without
+// resource (see Doorman.PartialEvaluate): a resource is allowed if it matches
+// any allowed clause and no denied clause.
+type DataFilter struct {
+	Allowed []FilterClause
+	Denied  []FilterClause
+}
+
+// PrincipalGrant is a principal of a policy (eg. `tag:admins`, `userid:<.*>`).
+type PrincipalGrant struct {
+	Principal string
+	// Policy is the ID of the policy.
+	Policy string
+	// Members are the members of the tag, for the tags principals.
+	Members Principals
+	// Conditional is true if the policy has conditions, which depend on the requests context.
+	Conditional bool
+}
+
+// PrincipalGrants are the principals of the policies that match some action
+// and resource (see Doorman.WhoCan).
+type PrincipalGrants struct {
+	Allowed []PrincipalGrant
+	// Denied are the principals of the deny policies.
+	Denied []PrincipalGrant
+}
+
+// DecisionRecorder receives the authorization decisions (eg. for analytics).
+type DecisionRecorder interface {
+	Record(decision Decision)
+}
+
 // Doorman is the backend in charge of checking requests against policies.
 type Doorman interface {
 	// LoadPolicies is responsible for loading the services configuration into memory.
 	LoadPolicies(configs ServicesConfig) error
+	// LoadStatus returns the outcome of the policies loads.
+	LoadStatus() LoadStatus
 	// ConfigSources returns the list of configuration sources.
 	ConfigSources() []string
 	// Authenticator by service
 	Authenticator(service string) (authn.Authenticator, error)
+	// Services returns the names of the loaded services.
+	Services() []string
+	// ServiceConfig returns the configuration of the specified service.
+	ServiceConfig(service string) (ServiceConfig, bool)
 	// ExpandPrincipals looks up and add extra principals to the ones specified.
 	ExpandPrincipals(service string, principals Principals) Principals
+	// ExplainPrincipals is like ExpandPrincipals, but also returns why each tag was added.
+	ExplainPrincipals(service string, principals Principals) (Principals, []TagMatch)
 	// IsAllowed is responsible for deciding if the specified authorization is allowed for the specified service.
 	IsAllowed(service string, request *Request) bool
+	// Check is like IsAllowed, but also returns the reason of the denial and the obligations of the decision.
+	Check(service string, request *Request) Result
+	// IsAllowedBatch decides the specified authorization requests for the specified service, in order.
+	IsAllowedBatch(service string, requests []*Request) []Decision
+	// AllowedResources returns the resources patterns of the policies matching the request principals and action.
+	AllowedResources(service string, request *Request) (ResourcePatterns, error)
+	// PartialEvaluate returns the conditions on the resources that the request principals can access with the action.
+	PartialEvaluate(service string, request *Request) (DataFilter, error)
+	// WhoCan returns the principals of the policies matching the action on the resource.
+	WhoCan(service string, action string, resource string) (PrincipalGrants, error)
+	// SetMaintenance enables or disables the maintenance mode of the specified service.
+	SetMaintenance(service string, enabled bool) error
+	// Maintenance returns true if the specified service is in maintenance.
+	Maintenance(service string) bool
+	// SetDecisionLog changes the verbosity of the decisions logs of the specified service.
+	SetDecisionLog(service string, verbosity string) error
+	// DecisionLog returns the verbosity of the decisions logs of the specified service.
+	DecisionLog(service string) string
+	// ClearDecisionCache forgets the cached decisions (eg. after the relationship tuples changed).
+	ClearDecisionCache()
 }
@@ -1,11 +1,16 @@
 package doorman
 
 import (
-	"encoding/json"
 	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ory/ladon"
 	manager "github.com/ory/ladon/manager/memory"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/mozilla/doorman/authn"
@@ -13,29 +18,80 @@ import (
 
 const maxInt int64 = 1<<63 - 1
 
+// snapshot is an immutable set of loaded services. It is never modified once
+// published: changes are made on a copy which then replaces the current one.
+type snapshot struct {
+	services       map[string]ServiceConfig
+	ladons         map[string]*ladon.Ladon
+	authenticators map[string]authn.Authenticator
+	// identityProviders are the cached authenticators used by each service
+	// (see authn.RetainAuthenticators).
+	identityProviders map[string][]authn.Authenticator
+	checksums         map[string]string
+	// baseSource is the source of the base configuration, if any.
+	baseSource string
+}
+
 // LadonDoorman is the backend in charge of checking requests against policies.
 type LadonDoorman struct {
 	_auditLogger *auditLogger
+	stale        *boundedCache
+	// cache holds the recent decisions, if enabled (see SetDecisionCache).
+	cache *ttlDecisionsCache
+	// maintenance holds the maintenance mode overrides by service.
+	maintenance sync.Map
+	// decisionLog holds the decisions logs verbosity overrides by service.
+	decisionLog sync.Map
+	// enrichers compute the requests context fields (see AddContextEnricher).
+	enrichers []ContextEnricher
+	// attributesProviders enrich the requests contexts (see AddAttributesProvider).
+	attributesProviders []AttributesProvider
+	// relations holds the relationship tuples (see SetRelationStore).
+	relations RelationStore
 
-	services       map[string]ServiceConfig
-	ladons         map[string]*ladon.Ladon
-	authenticators map[string]authn.Authenticator
+	// current holds the *snapshot used to answer requests.
+	current atomic.Value
+	// writeLock serializes the snapshot changes, made on copies of the current one.
+	writeLock sync.Mutex
+
+	// loadStatus is the outcome of the policies loads.
+	loadStatus     LoadStatus
+	loadStatusLock sync.Mutex
 }
 
 // NewDefaultLadon instantiates a new doorman.
 func NewDefaultLadon() *LadonDoorman {
 	w := &LadonDoorman{
+		stale: newBoundedCache(maxStaleDecisions),
+	}
+	w.current.Store(&snapshot{
 		services:       map[string]ServiceConfig{},
 		ladons:         map[string]*ladon.Ladon{},
 		authenticators: map[string]authn.Authenticator{},
-	}
+		checksums:      map[string]string{},
+	})
 	return w
 }
 
+// snapshot returns the current set of loaded services. Readers should obtain it
+// once and use it for the whole request, to be consistent across reloads.
+func (doorman *LadonDoorman) snapshot() *snapshot {
+	return doorman.current.Load().(*snapshot)
+}
+
+// ConfigSources returns the list of distinct sources the services were loaded from.
 func (doorman *LadonDoorman) ConfigSources() []string {
 	var l []string
-	for _, c := range doorman.services {
-		l = append(l, c.Source)
+	seen := map[string]bool{}
+	s := doorman.snapshot()
+	for _, c := range s.services {
+		if !seen[c.Source] {
+			seen[c.Source] = true
+			l = append(l, c.Source)
+		}
+	}
+	if s.baseSource != "" && !seen[s.baseSource] {
+		l = append(l, s.baseSource)
 	}
 	return l
 }
@@ -43,21 +99,99 @@ func (doorman *LadonDoorman) ConfigSources() []string {
 // SetAuthenticator allows to manually set an authenticator instance associated to
 // a domain.
 func (doorman *LadonDoorman) SetAuthenticator(service string, a authn.Authenticator) {
-	doorman.authenticators[service] = a
+	doorman.writeLock.Lock()
+	defer doorman.writeLock.Unlock()
+
+	s := doorman.snapshot()
+	authenticators := map[string]authn.Authenticator{}
+	for k, v := range s.authenticators {
+		authenticators[k] = v
+	}
+	authenticators[service] = a
+	doorman.current.Store(&snapshot{
+		services:          s.services,
+		ladons:            s.ladons,
+		authenticators:    authenticators,
+		identityProviders: s.identityProviders,
+		checksums:         s.checksums,
+		baseSource:        s.baseSource,
+	})
 }
 
 func (doorman *LadonDoorman) auditLogger() *auditLogger {
 	if doorman._auditLogger == nil {
 		doorman._auditLogger = newAuditLogger()
+		doorman._auditLogger.verbosity = doorman.DecisionLog
 	}
 	return doorman._auditLogger
 }
 
-// LoadPolicies instantiates Ladon objects from doorman's.
+// SetAuditOutput changes the destination of the audit logs (default: stdout).
+func (doorman *LadonDoorman) SetAuditOutput(out io.Writer) {
+	doorman.auditLogger().logger.Out = out
+}
+
+// AddDecisionRecorder registers a recorder that will receive every decision. It
+// must be called before serving requests.
+func (doorman *LadonDoorman) AddDecisionRecorder(r DecisionRecorder) {
+	a := doorman.auditLogger()
+	a.recorders = append(a.recorders, r)
+}
+
+// LoadPolicies instantiates Ladon objects from doorman's. Services whose configuration
+// did not change since the last load are kept as is, with their authenticator.
 func (doorman *LadonDoorman) LoadPolicies(configs ServicesConfig) error {
+	err := doorman.loadPolicies(configs)
+
+	if err == nil && doorman.cache != nil {
+		doorman.cache.clear()
+	}
+
+	doorman.loadStatusLock.Lock()
+	defer doorman.loadStatusLock.Unlock()
+	if err != nil {
+		doorman.loadStatus.Error = err
+		doorman.loadStatus.FailedAt = time.Now()
+	} else {
+		doorman.loadStatus.Error = nil
+		doorman.loadStatus.LoadedAt = time.Now()
+	}
+	return err
+}
+
+// LoadStatus returns the outcome of the policies loads.
+func (doorman *LadonDoorman) LoadStatus() LoadStatus {
+	doorman.loadStatusLock.Lock()
+	defer doorman.loadStatusLock.Unlock()
+	return doorman.loadStatus
+}
+
+func (doorman *LadonDoorman) loadPolicies(configs ServicesConfig) error {
+	doorman.writeLock.Lock()
+	defer doorman.writeLock.Unlock()
+
+	current := doorman.snapshot()
+
+	configs, base, err := configs.MergeBase()
+	if err != nil {
+		return err
+	}
+	baseSource := ""
+	if base != nil {
+		baseSource = base.Source
+	}
+
+	// Skip everything if the configurations are the same as the loaded ones.
+	checksums := checksumConfigs(configs)
+	if sameChecksums(current.checksums, checksums) {
+		log.Debugf("Policies unchanged, skip reload.")
+		return nil
+	}
+
 	// First, load each configuration file.
 	newLadons := map[string]*ladon.Ladon{}
 	newAuthenticators := map[string]authn.Authenticator{}
+	newIdentityProviders := map[string][]authn.Authenticator{}
 	newConfigs := map[string]ServiceConfig{}
 
 	for _, config := range configs {
@@ -66,80 +200,227 @@ func (doorman *LadonDoorman) LoadPolicies(configs ServicesConfig) error {
 			return fmt.Errorf("duplicated service %q (source %q)", config.Service, config.Source)
 		}
 
-		if config.IdentityProvider != "" {
-			log.Infof("Authentication enabled for %q using %q", config.Service, config.IdentityProvider)
-			v, err := authn.NewAuthenticator(config.IdentityProvider)
-			if err != nil {
-				return err
-			}
-			newAuthenticators[config.Service] = v
-		} else {
-			log.Warningf("No authentication enabled for %q.", config.Service)
-		}
-
-		newLadons[config.Service] = &ladon.Ladon{
-			Manager:     manager.NewMemoryManager(),
-			AuditLogger: doorman.auditLogger(),
-		}
-		for _, pol := range config.Policies {
-			log.Debugf("Load policy %q: %s", pol.ID, pol.Description)
-
-			var conditions = ladon.Conditions{}
-			for field, cond := range pol.Conditions {
-				factory, found := ladon.ConditionFactories[cond.Type]
-				if !found {
-					return fmt.Errorf("unknown condition type %s", cond.Type)
-				}
-				c := factory()
-				if len(cond.Options) > 0 {
-					// Leverage Ladon JSON unmarshall code to instantiate conditions.
-					str, _ := json.Marshal(cond.Options)
-					if err := json.Unmarshal(str, c); err != nil {
-						return err
-					}
-				}
-				conditions.AddCondition(field, c)
+		sum := checksums[config.Service]
+		if l, ok := current.ladons[config.Service]; ok && sum != "" && current.checksums[config.Service] == sum {
+			log.Debugf("Service %q unchanged, keep it.", config.Service)
+			newLadons[config.Service] = l
+			if a, ok := current.authenticators[config.Service]; ok {
+				newAuthenticators[config.Service] = a
 			}
+			newIdentityProviders[config.Service] = current.identityProviders[config.Service]
+			newConfigs[config.Service] = config
+			continue
+		}
 
-			policy := &ladon.DefaultPolicy{
-				ID:          pol.ID,
-				Description: pol.Description,
-				Subjects:    pol.Principals,
-				Effect:      pol.Effect,
-				Resources:   pol.Resources,
-				Actions:     pol.Actions,
-				Conditions:  conditions,
-			}
-			err := newLadons[config.Service].Manager.Create(policy)
-			if err != nil {
-				return err
-			}
+		l, a, providers, err := doorman.loadService(config)
+		if err != nil {
+			return err
 		}
+		newLadons[config.Service] = l
+		if a != nil {
+			newAuthenticators[config.Service] = a
+		}
+		newIdentityProviders[config.Service] = providers
 		newConfigs[config.Service] = config
 	}
 	// Only if everything went well, replace existing services with new ones.
-	doorman.services = newConfigs
-	doorman.ladons = newLadons
-	doorman.authenticators = newAuthenticators
+	doorman.current.Store(&snapshot{
+		services:          newConfigs,
+		ladons:            newLadons,
+		authenticators:    newAuthenticators,
+		identityProviders: newIdentityProviders,
+		checksums:         checksums,
+		baseSource:        baseSource,
+	})
+	// Stop the authenticators that the previous services were the last to use.
+	var used []authn.Authenticator
+	for _, providers := range newIdentityProviders {
+		used = append(used, providers...)
+	}
+	authn.RetainAuthenticators(doorman, used)
 	return nil
 }
 
+// loadService instantiates the Ladon object and the authenticator of a service.
+// The cached identity providers authenticators that it uses are returned too.
+func (doorman *LadonDoorman) loadService(config ServiceConfig) (*ladon.Ladon, authn.Authenticator, []authn.Authenticator, error) {
+	if errs := config.Validate(); len(errs) > 0 {
+		return nil, nil, nil, errs[0].serviceError(config.Service)
+	}
+
+	var authenticators, providers []authn.Authenticator
+	if config.APIKeys.Enabled() {
+		a, err := newAPIKeyAuthenticator(config.APIKeys)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s for service %q", err, config.Service)
+		}
+		authenticators = append(authenticators, a)
+	}
+	if config.IdentityProvider != "" {
+		log.Infof("Authentication enabled for %q using %q", config.Service, config.IdentityProvider)
+		v, err := authn.NewAuthenticatorWithOptions(config.IdentityProvider, authn.AuthenticatorOptions{
+			JWKSFile:          config.JWKSFile,
+			JWKSURI:           config.JWKSURI,
+			IssuerAliases:     config.IssuerAliases,
+			ClaimsNamespace:   config.ClaimsNamespace,
+			SigningAlgorithms: config.SigningAlgorithms,
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		providers = append(providers, v)
+	}
+	for _, idP := range config.IdentityProviders {
+		log.Infof("Authentication enabled for %q using %q", config.Service, idP)
+		v, err := authn.NewAuthenticator(idP)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		providers = append(providers, v)
+	}
+	authenticators = append(authenticators, providers...)
+	var authenticator authn.Authenticator
+	if len(authenticators) > 0 {
+		authenticator = authn.NewMultiAuthenticator(authenticators...)
+	}
+	if config.ClientCertificates {
+		log.Infof("Authentication enabled for %q using client certificates", config.Service)
+		authenticator = authn.NewCertificateAuthenticator(authenticator)
+	}
+	if authenticator == nil {
+		log.Warningf("No authentication enabled for %q.", config.Service)
+	} else {
+		authenticator = authn.NewTokenExtractorAuthenticator(authenticator, config.Token.Extractors()...)
+	}
+
+	l := &ladon.Ladon{
+		Manager:     manager.NewMemoryManager(),
+		AuditLogger: doorman.auditLogger(),
+	}
+	// The configuration was validated.
+	if matcher, _ := NewMatcher(config.Matcher); matcher != nil {
+		l.Matcher = matcher
+	}
+	for _, pol := range append(append(Policies{}, config.Policies...), config.ScopePolicies()...) {
+		log.Debugf("Load policy %q: %s", pol.ID, pol.Description)
+		conditions, _ := newConditions(pol)
+		if len(pol.Exclude) > 0 {
+			conditions.AddCondition(exclusionContextField, &excludedPrincipalsCondition{Principals: pol.Exclude})
+		}
+		if !pol.ValidFrom.IsZero() || !pol.ValidUntil.IsZero() {
+			conditions.AddCondition(validityContextField, &validityCondition{ValidFrom: pol.ValidFrom, ValidUntil: pol.ValidUntil})
+			now := time.Now()
+			if !pol.ValidUntil.IsZero() && !now.Before(pol.ValidUntil) {
+				log.Warningf("Policy %q of service %q expired at %s", pol.ID, config.Service, pol.ValidUntil.Format(time.RFC3339))
+			} else if now.Before(pol.ValidFrom) {
+				log.Warningf("Policy %q of service %q is not active until %s", pol.ID, config.Service, pol.ValidFrom.Format(time.RFC3339))
+			}
+		}
+
+		policy := &ladon.DefaultPolicy{
+			ID:          pol.ID,
+			Description: pol.Description,
+			Subjects:    pol.Principals,
+			Effect:      pol.Effect,
+			Resources:   pol.Resources,
+			Actions:     pol.Actions,
+			Conditions:  conditions,
+		}
+		if err := l.Manager.Create(policy); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return l, authenticator, providers, nil
+}
+
+// newAPIKeyAuthenticator instantiates the stores of the configuration.
+func newAPIKeyAuthenticator(config APIKeysConfig) (authn.Authenticator, error) {
+	var stores []authn.APIKeyStore
+	if config.File != "" {
+		store, err := authn.NewAPIKeysFile(config.File)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, store)
+	}
+	if config.Env != "" {
+		store, err := authn.NewAPIKeysEnv(config.Env)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, store)
+	}
+	if config.Store != "" {
+		store, err := authn.RegisteredAPIKeyStore(config.Store)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, store)
+	}
+	return authn.NewAPIKeyAuthenticator(stores...), nil
+}
+
 // Authenticator returns the authenticator for the specified service or nil.
 func (doorman *LadonDoorman) Authenticator(service string) (authn.Authenticator, error) {
-	v, ok := doorman.authenticators[service]
+	v, ok := doorman.snapshot().authenticators[service]
 	if !ok {
 		return nil, fmt.Errorf("unknown service %q", service)
 	}
 	return v, nil
 }
 
+// ForService returns a view of this doorman restricted to the specified service.
+func (doorman *LadonDoorman) ForService(service string) *ServiceDoorman {
+	return ForService(doorman, service)
+}
+
+// Services returns the sorted names of the loaded services.
+func (doorman *LadonDoorman) Services() []string {
+	services := []string{}
+	for service := range doorman.snapshot().services {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	return services
+}
+
+// ServiceConfig returns the configuration of the specified service.
+func (doorman *LadonDoorman) ServiceConfig(service string) (ServiceConfig, bool) {
+	c, ok := doorman.snapshot().services[service]
+	return c, ok
+}
+
 // IsAllowed is responsible for deciding if subject can perform action on a resource with a context.
 func (doorman *LadonDoorman) IsAllowed(service string, request *Request) bool {
+	return doorman.Check(service, request).Allowed
+}
+
+// Check decides the request like IsAllowed, and returns the reason of the
+// denial and the obligations of the allowing policies.
+// Panics (eg. in custom conditions or decision recorders) are handled like internal
+// errors, according to the service `onError` setting.
+func (doorman *LadonDoorman) Check(service string, request *Request) (result Result) {
+	// The same snapshot is used for the whole request, even if reloaded meanwhile.
+	s := doorman.snapshot()
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			onError := s.services[service].OnError
+			result = Result{Allowed: doorman.onInternalError(service, onError, request, newPanicError(recovered))}
+		}
+	}()
+
+	doorman.enrichContext(service, request)
+
 	// Instantiate objects from the ladon API.
 	context := ladon.Context{}
 	for key, value := range request.Context {
 		context[key] = value
 	}
+	if doorman.relations != nil {
+		context[relationsContextField] = doorman.relations
+	}
+	context[decisionLogContextField] = doorman.decisionLogVerbosity(s, service)
 
 	r := &ladon.Request{
 		Resource: request.Resource,
@@ -147,30 +428,155 @@ func (doorman *LadonDoorman) IsAllowed(service string, request *Request) bool {
 		Context:  context,
 	}
 
-	l, ok := doorman.ladons[service]
+	l, ok := s.ladons[service]
 	if !ok {
 		// Explicitly log denied request using audit logger.
-		doorman.auditLogger().logRequest(false, r, ladon.Policies{})
-		return false
+		doorman.auditLogger().logRequest(r, Result{}, nil)
+		return Result{}
 	}
 
-	// For each principal, use it as the subject and query ladon backend.
-	for _, principal := range request.Principals {
+	if allowed, forced := doorman.isAllowedInMaintenance(s, service, r); forced {
+		return Result{Allowed: allowed}
+	}
+
+	onError := s.services[service].OnError
+	if err := doorman.fetchAttributes(service, request, context); err != nil {
+		return Result{Allowed: doorman.onInternalError(service, onError, request, err)}
+	}
+	config := s.services[service]
+	var policies []string
+	var err error
+	if doorman.cache != nil && !timeDependent(config) {
+		result, policies, err = doorman.decideCached(l, r, config, request)
+	} else {
+		result, policies, err = decide(l, r, config, request)
+	}
+	if err != nil {
+		return Result{Allowed: doorman.onInternalError(service, onError, request, err)}
+	}
+	if onError == OnErrorStale {
+		doorman.stale.set(decisionKey(service, request), result.Allowed)
+	}
+	doorman.auditLogger().logRequest(r, result, policies)
+	return result
+}
+
+// decide decides the request with ladon, and returns the reason of the denial
+// or the obligations of the allowing policies, with the IDs of the policies
+// that decided.
+func decide(l *ladon.Ladon, r *ladon.Request, config ServiceConfig, request *Request) (Result, []string, error) {
+	allowed, policies, err := isAllowed(l, r, request.Principals, config.DenyPrecedence)
+	if err != nil {
+		return Result{}, nil, err
+	}
+	result := Result{Allowed: allowed}
+	if allowed {
+		if obligations := config.Obligations(policies); len(obligations) > 0 {
+			result.Obligations = obligations
+		}
+	} else if reauthenticate, _ := r.Context[reauthenticateContextField].(bool); reauthenticate && len(policies) == 0 {
+		// Explicit denials do not depend on the authentication time.
+		result.Reason = ReasonReauthenticate
+	}
+	return result, policies, nil
+}
+
+// IsAllowedBatch decides the requests one by one, and returns the decisions in
+// the same order.
+func (doorman *LadonDoorman) IsAllowedBatch(service string, requests []*Request) []Decision {
+	decisions := make([]Decision, len(requests))
+	for i, request := range requests {
+		result := doorman.Check(service, request)
+		decisionID, _ := request.Context["_decisionID"].(string)
+		remoteIP, _ := request.Context["remoteIP"].(string)
+		decisions[i] = Decision{
+			ID:          decisionID,
+			Time:        time.Now(),
+			Service:     service,
+			Principals:  request.Principals,
+			Action:      request.Action,
+			Resource:    request.Resource,
+			RemoteIP:    remoteIP,
+			Allowed:     result.Allowed,
+			Reason:      result.Reason,
+			Obligations: result.Obligations,
+		}
+	}
+	return decisions
+}
+
+// isAllowed queries the ladon backend using each principal as the subject. Denials
+// are not errors: only internal failures (including panics) are returned. The
+// request is allowed if any principal is allowed, unless denyPrecedence is true
+// and any principal is explicitly denied. The IDs of the policies that decided
+// are returned with the decision.
+func isAllowed(l *ladon.Ladon, r *ladon.Request, principals Principals, denyPrecedence bool) (allowed bool, policies []string, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			allowed, policies = false, nil
+			err = newPanicError(recovered)
+		}
+	}()
+
+	// For the policies exclusions.
+	r.Context[exclusionContextField] = principals
+	// The audit logger keeps the policies that decided each evaluation.
+	deciders := &decidingPolicies{}
+	r.Context[decidersContextField] = deciders
+	defer delete(r.Context, decidersContextField)
+
+	if denyPrecedence {
+		denied, err := forcedDenial(l, r, principals)
+		if err != nil {
+			return false, nil, err
+		}
+		if denied {
+			return false, deciders.ids(false), nil
+		}
+	}
+
+	forced := false
+	for _, principal := range principals {
 		r.Subject = principal
-		if err := l.IsAllowed(r); err == nil {
-			return true
+		err := l.IsAllowed(r)
+		if err == nil {
+			return true, deciders.ids(true), nil
+		}
+		cause := errors.Cause(err)
+		if cause != ladon.ErrRequestDenied && cause != ladon.ErrRequestForcefullyDenied {
+			return false, nil, err
 		}
+		forced = forced || cause == ladon.ErrRequestForcefullyDenied
 	}
-	return false
+	if forced {
+		// Authenticating again would not change the decision.
+		delete(r.Context, reauthenticateContextField)
+	}
+	return false, deciders.ids(false), nil
 }
 
 // ExpandPrincipals will match the tags defined in the configuration for this service
 // against each of the specified principals.
 func (doorman *LadonDoorman) ExpandPrincipals(service string, principals Principals) Principals {
-	c, ok := doorman.services[service]
+	c, ok := doorman.snapshot().services[service]
 	if !ok {
 		return principals
 	}
 
 	return append(principals, c.GetTags(principals)...)
 }
+
+// ExplainPrincipals will match the tags like ExpandPrincipals, and return the members
+// and files that caused each match.
+func (doorman *LadonDoorman) ExplainPrincipals(service string, principals Principals) (Principals, []TagMatch) {
+	c, ok := doorman.snapshot().services[service]
+	if !ok {
+		return principals, []TagMatch{}
+	}
+
+	matches := c.ExplainTags(principals)
+	for _, match := range matches {
+		principals = append(principals, match.Tag)
+	}
+	return principals, matches
+}
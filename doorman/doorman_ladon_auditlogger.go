@@ -2,6 +2,7 @@ package doorman
 
 import (
 	"os"
+	"time"
 
 	"github.com/ory/ladon"
 	"github.com/sirupsen/logrus"
@@ -9,7 +10,10 @@ import (
 )
 
 type auditLogger struct {
-	logger *logrus.Logger
+	logger    *logrus.Logger
+	recorders []DecisionRecorder
+	// verbosity returns the decisions logs verbosity of a service (default: everything).
+	verbosity func(service string) string
 }
 
 func newAuditLogger() *auditLogger {
@@ -22,62 +26,103 @@ func newAuditLogger() *auditLogger {
 	return &auditLogger{logger: authzLog}
 }
 
-func (a *auditLogger) logRequest(allowed bool, r *ladon.Request, policies ladon.Policies) {
-	policiesNames := []string{}
-	for _, p := range policies {
-		policiesNames = append(policiesNames, p.GetID())
-	}
+// logRequest logs the decision of the request, and passes it to the recorders,
+// with the IDs of the policies that decided.
+func (a *auditLogger) logRequest(r *ladon.Request, result Result, policies []string) {
+	allowed := result.Allowed
+	policiesNames := append([]string{}, policies...)
 
 	// Remove custom values out of context for nicer logging (were set in handler)
 	var principals Principals
 	var service string
 	var remoteIP string
+	var decisionID string
+	var maintenance bool
+	var verbosity string
 	context := map[string]interface{}{}
 	for k, v := range r.Context {
 		if k == "_principals" {
-			principals = v.(Principals)
+			principals, _ = v.(Principals)
 		} else if k == "_service" {
-			service = v.(string)
+			service, _ = v.(string)
 		} else if k == "remoteIP" {
-			remoteIP = v.(string)
+			remoteIP, _ = v.(string)
+		} else if k == "_decisionID" {
+			decisionID, _ = v.(string)
+		} else if k == maintenanceContextField {
+			maintenance, _ = v.(bool)
+		} else if k == decisionLogContextField {
+			verbosity, _ = v.(string)
+		} else if k == reauthenticateContextField || k == exclusionContextField || k == validityContextField || k == relationsContextField {
+			continue
 		} else {
 			context[k] = v
 		}
 	}
 
-	a.logger.WithFields(
-		logrus.Fields{
-			"allowed":    allowed,
-			"principals": principals,
-			"service":    service,
-			"remoteIP":   remoteIP,
-			"policies":   policiesNames,
-			"action":     r.Action,
-			"resource":   r.Resource,
-			"context":    context,
-		},
-	).Info("")
-}
+	for _, recorder := range a.recorders {
+		recorder.Record(Decision{
+			ID:          decisionID,
+			Time:        time.Now(),
+			Allowed:     allowed,
+			Maintenance: maintenance,
+			Principals:  principals,
+			Service:     service,
+			RemoteIP:    remoteIP,
+			Policies:    policiesNames,
+			Action:      r.Action,
+			Resource:    r.Resource,
+			Reason:      result.Reason,
+			Obligations: result.Obligations,
+		})
+	}
 
-// LogRejectedAccessRequest is called by Ladon when a request is denied.
-func (a *auditLogger) LogRejectedAccessRequest(request *ladon.Request, pool ladon.Policies, deciders ladon.Policies) {
-	// Since we iterate on principals to test individual subjects, when a request is denied
-	// we want to log the last one only, ie. when r.subject == last(principals)
-	principals := request.Context["_principals"].(Principals)
-	if request.Subject != principals[len(principals)-1] {
+	// The recorders receive every decision, regardless of the verbosity.
+	if verbosity == "" {
+		verbosity = DecisionLogContext
+		if a.verbosity != nil {
+			verbosity = a.verbosity(service)
+		}
+	}
+	switch verbosity {
+	case DecisionLogNone:
 		return
+	case DecisionLogDenials:
+		if allowed {
+			return
+		}
 	}
 
-	if len(deciders) > 0 {
-		// Explicitly denied by the last one.
-		a.logRequest(false, request, deciders[len(deciders)-1:])
-	} else {
-		// No matching policy.
-		a.logRequest(false, request, deciders)
+	fields := logrus.Fields{
+		"decisionID":  decisionID,
+		"allowed":     allowed,
+		"maintenance": maintenance,
+		"reason":      result.Reason,
+		"principals":  principals,
+		"service":     service,
+		"remoteIP":    remoteIP,
+		"policies":    policiesNames,
+		"action":      r.Action,
+		"resource":    r.Resource,
+	}
+	if verbosity != DecisionLogAll {
+		fields["context"] = context
+	}
+	a.logger.WithFields(fields).Info("")
+}
+
+// LogRejectedAccessRequest is called by Ladon when a request is denied. The
+// deciding policies are kept for isAllowed, which returns them once every
+// principal was evaluated.
+func (a *auditLogger) LogRejectedAccessRequest(request *ladon.Request, pool ladon.Policies, deciders ladon.Policies) {
+	if d, ok := request.Context[decidersContextField].(*decidingPolicies); ok {
+		d.policies = deciders
 	}
 }
 
 // LogGrantedAccessRequest is called by Ladon when a request is granted.
 func (a *auditLogger) LogGrantedAccessRequest(request *ladon.Request, pool ladon.Policies, deciders ladon.Policies) {
-	a.logRequest(true, request, deciders)
+	if d, ok := request.Context[decidersContextField].(*decidingPolicies); ok {
+		d.policies = deciders
+	}
 }
@@ -0,0 +1,118 @@
+package doorman
+
+import (
+	"time"
+
+	"github.com/ory/ladon"
+)
+
+// DefaultDecisionCacheSize is the number of decisions cached if unspecified.
+const DefaultDecisionCacheSize = 10000
+
+// SetDecisionCache enables the cache of the decisions, for services asking the
+// same questions repeatedly. Decisions are kept for ttl, and the oldest ones
+// are evicted beyond size entries. The cache is emptied when the policies are
+// reloaded. A zero ttl disables it. It must be called before serving requests.
+//
+// The decisions of the services whose policies depend on the time (see
+// timeDependent) are never cached, since the same request can be decided
+// differently a moment later.
+func (doorman *LadonDoorman) SetDecisionCache(ttl time.Duration, size int) {
+	if ttl <= 0 {
+		doorman.cache = nil
+		return
+	}
+	if size <= 0 {
+		size = DefaultDecisionCacheSize
+	}
+	doorman.cache = newTTLDecisionsCache(ttl, size)
+}
+
+// ClearDecisionCache forgets the cached decisions, when something they depend
+// on changed outside of the policies (eg. the relationship tuples).
+func (doorman *LadonDoorman) ClearDecisionCache() {
+	if doorman.cache != nil {
+		doorman.cache.clear()
+	}
+}
+
+// timeDependentConditions are the conditions whose outcome changes over time
+// for the same request.
+var timeDependentConditions = map[string]bool{
+	new(TimeWindowCondition).GetName(): true,
+	new(RecentAuthCondition).GetName(): true,
+}
+
+// timeDependent returns true if a policy of the service has a validity period
+// or a time dependent condition (eg. time window, authentication age).
+func timeDependent(config ServiceConfig) bool {
+	for _, policy := range config.Policies {
+		if !policy.ValidFrom.IsZero() || !policy.ValidUntil.IsZero() {
+			return true
+		}
+		for _, condition := range policy.Conditions {
+			if timeDependentConditions[condition.Type] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cachedDecision is a decision, with the information needed to log it again.
+type cachedDecision struct {
+	result   Result
+	policies []string
+	expires  time.Time
+}
+
+// ttlDecisionsCache keeps a bounded amount of decisions, for a limited time.
+// The oldest are evicted first.
+type ttlDecisionsCache struct {
+	ttl       time.Duration
+	decisions *boundedCache
+}
+
+func newTTLDecisionsCache(ttl time.Duration, size int) *ttlDecisionsCache {
+	return &ttlDecisionsCache{
+		ttl:       ttl,
+		decisions: newBoundedCache(size),
+	}
+}
+
+func (c *ttlDecisionsCache) set(key string, decision cachedDecision) {
+	decision.expires = time.Now().Add(c.ttl)
+	c.decisions.set(key, decision)
+}
+
+func (c *ttlDecisionsCache) get(key string) (cachedDecision, bool) {
+	value, found := c.decisions.get(key)
+	if !found {
+		return cachedDecision{}, false
+	}
+	decision := value.(cachedDecision)
+	if time.Now().After(decision.expires) {
+		return cachedDecision{}, false
+	}
+	return decision, true
+}
+
+func (c *ttlDecisionsCache) clear() {
+	c.decisions.clear()
+}
+
+// decideCached serves the request decision from the cache if found. Otherwise,
+// decide is used, and its decision is cached.
+func (doorman *LadonDoorman) decideCached(l *ladon.Ladon, r *ladon.Request, config ServiceConfig, request *Request) (Result, []string, error) {
+	key := decisionKey(config.Service, request)
+	if decision, found := doorman.cache.get(key); found {
+		return decision.result, decision.policies, nil
+	}
+
+	result, policies, err := decide(l, r, config, request)
+	if err != nil {
+		return Result{}, nil, err
+	}
+	doorman.cache.set(key, cachedDecision{result: result, policies: policies})
+	return result, policies, nil
+}
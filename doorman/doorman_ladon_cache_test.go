@@ -0,0 +1,132 @@
+package doorman
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecisionCache(t *testing.T) {
+	d := sampleDoorman()
+	d.SetDecisionCache(time.Hour, 2)
+	spy := &decisionsSpy{}
+	d.AddDecisionRecorder(spy)
+
+	request := func() *Request {
+		return &Request{
+			Principals: Principals{"userid:foo"},
+			Action:     "update",
+			Resource:   "pto",
+			Context:    Context{"_decisionID": "abc"},
+		}
+	}
+	assert.True(t, d.IsAllowed("https://sample.yaml", request()))
+	key := decisionKey("https://sample.yaml", request())
+	cached, found := d.cache.get(key)
+	assert.True(t, found)
+	assert.Equal(t, []string{"1"}, cached.policies)
+
+	// Served from the cache, and recorded like the original decision.
+	d.cache.set(key, cachedDecision{result: Result{Allowed: false}, policies: []string{"2"}})
+	assert.False(t, d.IsAllowed("https://sample.yaml", request()))
+	assert.Equal(t, 2, len(spy.decisions))
+	assert.Equal(t, []string{"2"}, spy.decisions[1].Policies)
+	assert.Equal(t, "abc", spy.decisions[1].ID)
+
+	// Oldest decisions are evicted.
+	d.IsAllowed("https://sample.yaml", &Request{Principals: Principals{"userid:bar"}, Action: "read"})
+	d.IsAllowed("https://sample.yaml", &Request{Principals: Principals{"userid:baz"}, Action: "read"})
+	_, found = d.cache.get(key)
+	assert.False(t, found)
+
+	// Reloading the policies empties the cache.
+	d.IsAllowed("https://sample.yaml", request())
+	d.LoadPolicies(sampleConfigs)
+	_, found = d.cache.get(key)
+	assert.False(t, found)
+
+	// Decisions expire.
+	d.SetDecisionCache(time.Nanosecond, 0)
+	assert.Equal(t, DefaultDecisionCacheSize, d.cache.decisions.size)
+	d.IsAllowed("https://sample.yaml", request())
+	time.Sleep(time.Millisecond)
+	_, found = d.cache.get(key)
+	assert.False(t, found)
+
+	d.SetDecisionCache(0, 0)
+	assert.Nil(t, d.cache)
+}
+
+func TestDecisionCacheReason(t *testing.T) {
+	d := NewDefaultLadon()
+	d.SetDecisionCache(time.Hour, 0)
+	d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Policies: Policies{
+				Policy{
+					ID:         "1",
+					Principals: Principals{"userid:alice"},
+					Actions:    []string{"delete"},
+					Resources:  []string{"<.*>"},
+					Conditions: Conditions{
+						AuthTimeContextField: Condition{
+							Type:    "RecentAuthCondition",
+							Options: map[string]interface{}{"maxAge": "5m"},
+						},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	})
+	for i := 0; i < 2; i++ {
+		r := &Request{
+			Principals: Principals{"userid:alice"},
+			Action:     "delete",
+			Resource:   "a",
+			Context:    Context{AuthTimeContextField: time.Now().Add(-time.Hour).Unix()},
+		}
+		result := d.Check("a", r)
+		assert.False(t, result.Allowed)
+		assert.Equal(t, ReasonReauthenticate, result.Reason)
+	}
+}
+
+func TestDecisionCacheTimeDependent(t *testing.T) {
+	d := NewDefaultLadon()
+	d.SetDecisionCache(time.Hour, 0)
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Policies: Policies{
+				Policy{
+					ID:         "1",
+					Principals: Principals{"userid:ana"},
+					Actions:    []string{"read"},
+					Resources:  []string{"reports"},
+					Effect:     "allow",
+					ValidUntil: time.Now().Add(time.Hour),
+				},
+			},
+		},
+	})
+	assert.Nil(t, err)
+
+	request := &Request{Principals: Principals{"userid:ana"}, Action: "read", Resource: "reports"}
+	assert.True(t, d.IsAllowed("a", request))
+	_, found := d.cache.get(decisionKey("a", request))
+	assert.False(t, found)
+}
+
+func TestTimeDependent(t *testing.T) {
+	assert.False(t, timeDependent(ServiceConfig{Policies: Policies{{ID: "1"}}}))
+	assert.True(t, timeDependent(ServiceConfig{Policies: Policies{{ID: "1", ValidFrom: time.Now()}}}))
+	assert.True(t, timeDependent(ServiceConfig{Policies: Policies{
+		{ID: "1", Conditions: Conditions{"window": Condition{Type: "TimeWindowCondition"}}},
+	}}))
+	assert.True(t, timeDependent(ServiceConfig{Policies: Policies{
+		{ID: "1", Conditions: Conditions{"authTime": Condition{Type: "RecentAuthCondition"}}},
+	}}))
+}
@@ -0,0 +1,41 @@
+package doorman
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// checksum returns a fingerprint of the service configuration content, or an
+// empty string if it could not be computed.
+func checksum(config ServiceConfig) string {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// checksumConfigs returns the fingerprints of the configurations by service.
+func checksumConfigs(configs ServicesConfig) map[string]string {
+	checksums := map[string]string{}
+	for _, config := range configs {
+		checksums[config.Service] = checksum(config)
+	}
+	return checksums
+}
+
+// sameChecksums returns true if both sets of fingerprints are identical. Empty
+// fingerprints never match.
+func sameChecksums(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for service, sum := range b {
+		if sum == "" || a[service] != sum {
+			return false
+		}
+	}
+	return true
+}
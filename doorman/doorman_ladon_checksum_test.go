@@ -0,0 +1,65 @@
+package doorman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksum(t *testing.T) {
+	a := ServiceConfig{Service: "a"}
+	assert.Equal(t, checksum(a), checksum(ServiceConfig{Service: "a"}))
+	assert.NotEqual(t, checksum(a), checksum(ServiceConfig{Service: "a", OnError: "allow"}))
+
+	// Not serializable.
+	bad := ServiceConfig{
+		Variables: map[string]interface{}{
+			"nested": func() {},
+		},
+	}
+	assert.Equal(t, "", checksum(bad))
+	assert.False(t, sameChecksums(checksumConfigs(ServicesConfig{bad}), checksumConfigs(ServicesConfig{bad})))
+}
+
+func TestLoadPoliciesUnchanged(t *testing.T) {
+	doorman := sampleDoorman()
+	before := doorman.snapshot()
+
+	// Same policies: nothing is rebuilt.
+	err := doorman.LoadPolicies(sampleConfigs)
+	assert.Nil(t, err)
+	assert.True(t, before == doorman.snapshot())
+
+	// Changed policies.
+	changed := ServicesConfig{sampleConfigs[0]}
+	changed[0].Tags = Tags{"admins": Principals{"userid:bob"}}
+	err = doorman.LoadPolicies(changed)
+	assert.Nil(t, err)
+	assert.False(t, before == doorman.snapshot())
+}
+
+func TestLoadPoliciesDifferential(t *testing.T) {
+	doorman := sampleDoorman()
+	other := ServiceConfig{
+		Service: "https://other.com",
+		Tags:    Tags{"admins": Principals{"userid:bob"}},
+	}
+	err := doorman.LoadPolicies(ServicesConfig{sampleConfigs[0], other})
+	assert.Nil(t, err)
+	sample := doorman.snapshot().ladons["https://sample.yaml"]
+	before := doorman.snapshot().ladons["https://other.com"]
+
+	// Only the changed service is re-created.
+	other.Tags = Tags{"admins": Principals{"userid:alice"}}
+	err = doorman.LoadPolicies(ServicesConfig{sampleConfigs[0], other})
+	assert.Nil(t, err)
+	assert.True(t, sample == doorman.snapshot().ladons["https://sample.yaml"])
+	assert.False(t, before == doorman.snapshot().ladons["https://other.com"])
+	assert.Equal(t, other, doorman.snapshot().services["https://other.com"])
+
+	// Removed services are dropped.
+	err = doorman.LoadPolicies(ServicesConfig{other})
+	assert.Nil(t, err)
+	_, ok := doorman.snapshot().ladons["https://sample.yaml"]
+	assert.False(t, ok)
+}
@@ -0,0 +1,77 @@
+package doorman
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/ory/ladon"
+)
+
+// AuthTimeContextField is the request context field holding the time when the
+// user authenticated (`auth_time` claim, as UNIX timestamp).
+const AuthTimeContextField = "auth_time"
+
+// reauthenticateContextField flags the requests that failed a RecentAuthCondition.
+const reauthenticateContextField = "_reauthenticate"
+
+// RecentAuthCondition is a condition which is fulfilled if the user authenticated
+// recently (eg. for destructive operations).
+type RecentAuthCondition struct {
+	// MaxAge is the maximum delay since the authentication (eg. `15m`).
+	MaxAge string `json:"maxAge"`
+}
+
+// Fulfills returns true if the given value (ie. the authentication time) is within
+// the maximum delay. Otherwise, the request is flagged so that the client can be
+// told to authenticate again.
+func (c *RecentAuthCondition) Fulfills(value interface{}, r *ladon.Request) bool {
+	maxAge, err := time.ParseDuration(c.MaxAge)
+	authTime, ok := unixTime(value)
+	if err == nil && ok && time.Since(authTime) <= maxAge {
+		return true
+	}
+	if r.Context != nil {
+		r.Context[reauthenticateContextField] = true
+	}
+	return false
+}
+
+// GetName returns the condition's name.
+func (c *RecentAuthCondition) GetName() string {
+	return "RecentAuthCondition"
+}
+
+// unixTime reads a UNIX timestamp, as decoded from JSON or claims.
+func unixTime(value interface{}) (time.Time, bool) {
+	var seconds int64
+	switch v := value.(type) {
+	case float64:
+		seconds = int64(v)
+	case int64:
+		seconds = v
+	case int:
+		seconds = int64(v)
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		seconds = n
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		seconds = n
+	default:
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0), true
+}
+
+func init() {
+	RegisterCondition(new(RecentAuthCondition).GetName(), func() ladon.Condition {
+		return new(RecentAuthCondition)
+	})
+}
@@ -0,0 +1,97 @@
+package doorman
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ory/ladon"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecentAuthCondition(t *testing.T) {
+	c := &RecentAuthCondition{MaxAge: "15m"}
+	recent := time.Now().Add(-5 * time.Minute).Unix()
+	old := time.Now().Add(-1 * time.Hour).Unix()
+
+	for _, value := range []interface{}{float64(recent), recent, int(recent), json.Number(fmt.Sprint(recent)), fmt.Sprint(recent)} {
+		r := &ladon.Request{Context: ladon.Context{}}
+		assert.True(t, c.Fulfills(value, r))
+		assert.Nil(t, r.Context[reauthenticateContextField])
+	}
+
+	for _, value := range []interface{}{float64(old), nil, "yesterday", true} {
+		r := &ladon.Request{Context: ladon.Context{}}
+		assert.False(t, c.Fulfills(value, r))
+		assert.Equal(t, true, r.Context[reauthenticateContextField])
+	}
+
+	// Bad max age.
+	c = &RecentAuthCondition{MaxAge: "a while"}
+	assert.False(t, c.Fulfills(recent, &ladon.Request{}))
+}
+
+func TestRecentAuthReason(t *testing.T) {
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Policies: Policies{
+				Policy{
+					ID:         "1",
+					Principals: []string{"<.*>"},
+					Actions:    []string{"delete"},
+					Resources:  []string{"<.*>"},
+					Conditions: Conditions{
+						AuthTimeContextField: Condition{
+							Type: "RecentAuthCondition",
+							Options: map[string]interface{}{
+								"maxAge": "15m",
+							},
+						},
+					},
+					Effect: "allow",
+				},
+				Policy{
+					ID:         "2",
+					Principals: []string{"userid:bob"},
+					Actions:    []string{"<.*>"},
+					Resources:  []string{"<.*>"},
+					Effect:     "deny",
+				},
+			},
+		},
+	})
+	assert.Nil(t, err)
+	recorder := &decisionsSpy{}
+	d.AddDecisionRecorder(recorder)
+
+	request := func(principal string, authTime time.Duration) *Request {
+		return &Request{
+			Principals: Principals{principal},
+			Action:     "delete",
+			Resource:   "article",
+			Context: Context{
+				AuthTimeContextField: float64(time.Now().Add(-authTime).Unix()),
+			},
+		}
+	}
+
+	result := d.Check("a", request("userid:alice", 5*time.Minute))
+	assert.True(t, result.Allowed)
+	assert.Equal(t, "", result.Reason)
+
+	r := request("userid:alice", time.Hour)
+	result = d.Check("a", r)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, ReasonReauthenticate, result.Reason)
+	assert.Equal(t, ReasonReauthenticate, recorder.decisions[1].Reason)
+	// The request is left untouched.
+	assert.Len(t, r.Context, 1)
+
+	// Explicitly denied anyway.
+	result = d.Check("a", request("userid:bob", time.Hour))
+	assert.False(t, result.Allowed)
+	assert.Equal(t, "", result.Reason)
+}
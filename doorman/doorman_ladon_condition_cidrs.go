@@ -0,0 +1,100 @@
+package doorman
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ory/ladon"
+)
+
+// CIDRsCondition is a condition which is fulfilled if the given value (ie. an
+// IP address) is in one of the ranges (eg. offices and VPN networks). The
+// ranges are parsed once, when the policies are loaded.
+type CIDRsCondition struct {
+	CIDRs []string `json:"cidrs"`
+
+	networks []*net.IPNet
+}
+
+// UnmarshalJSON reads and parses the ranges, so that the invalid ones are
+// rejected when the policies are loaded.
+func (c *CIDRsCondition) UnmarshalJSON(data []byte) error {
+	type condition CIDRsCondition
+	var raw condition
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	networks, err := ParseCIDRs(raw.CIDRs)
+	if err != nil {
+		return err
+	}
+	c.CIDRs, c.networks = raw.CIDRs, networks
+	return nil
+}
+
+// Fulfills returns true if the IP address is in one of the ranges. Addresses
+// with a port (eg. `10.0.0.1:4242`) are accepted.
+func (c *CIDRsCondition) Fulfills(value interface{}, r *ladon.Request) bool {
+	s, ok := value.(string)
+	if !ok {
+		return false
+	}
+	ip := parseIP(s)
+	if ip == nil {
+		return false
+	}
+	return containsIP(c.networks, ip)
+}
+
+// GetName returns the condition's name.
+func (c *CIDRsCondition) GetName() string {
+	return "CIDRsCondition"
+}
+
+func init() {
+	RegisterCondition(new(CIDRsCondition).GetName(), func() ladon.Condition {
+		return new(CIDRsCondition)
+	})
+}
+
+// ParseCIDRs parses a list of ranges in CIDR notation (eg. `10.0.0.0/8`).
+// Single IP addresses are accepted too.
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if ip := net.ParseIP(cidr); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", cidr)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// parseIP reads an IP address, with or without port.
+func parseIP(s string) net.IP {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	return net.ParseIP(strings.TrimSpace(s))
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -31,7 +31,7 @@ func (c *MatchPrincipalsCondition) GetName() string {
 }
 
 func init() {
-	ladon.ConditionFactories[new(MatchPrincipalsCondition).GetName()] = func() ladon.Condition {
+	RegisterCondition(new(MatchPrincipalsCondition).GetName(), func() ladon.Condition {
 		return new(MatchPrincipalsCondition)
-	}
+	})
 }
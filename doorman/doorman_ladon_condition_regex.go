@@ -0,0 +1,81 @@
+package doorman
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+
+	"github.com/ory/ladon"
+)
+
+// Limits of the regular expressions of the RegexCondition.
+const (
+	// MaxRegexLength is the maximum length of the patterns.
+	MaxRegexLength = 1024
+	// MaxRegexInstructions is the maximum size of the compiled patterns (eg. nested repetitions).
+	MaxRegexInstructions = 10000
+)
+
+// RegexCondition is a condition which is fulfilled if the given value matches
+// the regular expression (eg. `^release/.*`). Unlike Ladon StringMatchCondition,
+// the expression is compiled once, when the policies are loaded.
+type RegexCondition struct {
+	Pattern string `json:"pattern"`
+
+	re *regexp.Regexp
+}
+
+// UnmarshalJSON reads and compiles the pattern, so that the invalid or too
+// complex ones are rejected when the policies are loaded.
+func (c *RegexCondition) UnmarshalJSON(data []byte) error {
+	type condition RegexCondition
+	var raw condition
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	re, err := compileRegex(raw.Pattern)
+	if err != nil {
+		return err
+	}
+	c.Pattern, c.re = raw.Pattern, re
+	return nil
+}
+
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) > MaxRegexLength {
+		return nil, fmt.Errorf("pattern longer than %d characters", MaxRegexLength)
+	}
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %s", pattern, err)
+	}
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %s", pattern, err)
+	}
+	if len(prog.Inst) > MaxRegexInstructions {
+		return nil, fmt.Errorf("pattern %q is too complex", pattern)
+	}
+	return regexp.Compile(pattern)
+}
+
+// Fulfills returns true if the given value is a string matching the pattern.
+func (c *RegexCondition) Fulfills(value interface{}, r *ladon.Request) bool {
+	s, ok := value.(string)
+	if !ok || c.re == nil {
+		return false
+	}
+	return c.re.MatchString(s)
+}
+
+// GetName returns the condition's name.
+func (c *RegexCondition) GetName() string {
+	return "RegexCondition"
+}
+
+func init() {
+	RegisterCondition(new(RegexCondition).GetName(), func() ladon.Condition {
+		return new(RegexCondition)
+	})
+}
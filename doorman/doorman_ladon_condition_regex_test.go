@@ -0,0 +1,83 @@
+package doorman
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ory/ladon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegexCondition(t *testing.T) {
+	var c RegexCondition
+	err := json.Unmarshal([]byte(`{"pattern": "^release/.*"}`), &c)
+	require.Nil(t, err)
+
+	assert.True(t, c.Fulfills("release/1.2", &ladon.Request{}))
+	assert.False(t, c.Fulfills("feature/release/1.2", &ladon.Request{}))
+	assert.False(t, c.Fulfills(42, &ladon.Request{}))
+	assert.False(t, c.Fulfills(nil, &ladon.Request{}))
+
+	// Not compiled.
+	assert.False(t, (&RegexCondition{Pattern: ".*"}).Fulfills("a", &ladon.Request{}))
+}
+
+func TestRegexConditionInvalid(t *testing.T) {
+	for pattern, message := range map[string]string{
+		"release/(":                    "invalid pattern \"release/(\"",
+		strings.Repeat("a", 2000):      "pattern longer than 1024 characters",
+		"((a{1,100}){1,100}){1,100}":   "invalid pattern",
+		strings.Repeat(`\w{1000}`, 11): "is too complex",
+	} {
+		var c RegexCondition
+		options, _ := json.Marshal(map[string]string{"pattern": pattern})
+		err := json.Unmarshal(options, &c)
+		require.NotNil(t, err, pattern)
+		assert.Contains(t, err.Error(), message)
+	}
+}
+
+func TestRegexPolicies(t *testing.T) {
+	d := NewDefaultLadon()
+	load := func(pattern string) error {
+		return d.LoadPolicies(ServicesConfig{
+			ServiceConfig{
+				Service: "a",
+				Policies: Policies{
+					Policy{
+						ID:         "1",
+						Principals: []string{"<.*>"},
+						Actions:    []string{"deploy"},
+						Resources:  []string{"<.*>"},
+						Conditions: Conditions{
+							"branch": Condition{
+								Type: "RegexCondition",
+								Options: map[string]interface{}{
+									"pattern": pattern,
+								},
+							},
+						},
+						Effect: "allow",
+					},
+				},
+			},
+		})
+	}
+	require.Nil(t, load("^release/.*"))
+	request := func(branch string) *Request {
+		return &Request{
+			Principals: Principals{"userid:bob"},
+			Action:     "deploy",
+			Resource:   "app",
+			Context:    Context{"branch": branch},
+		}
+	}
+	assert.True(t, d.IsAllowed("a", request("release/1.2")))
+	assert.False(t, d.IsAllowed("a", request("master")))
+
+	err := load("release/[")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid pattern \"release/[\"")
+}
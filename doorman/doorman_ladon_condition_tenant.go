@@ -0,0 +1,34 @@
+package doorman
+
+import (
+	"github.com/ory/ladon"
+)
+
+// TenantContextField is the request context field holding the caller's tenant.
+const TenantContextField = "tenant"
+
+// MatchTenantCondition is a condition which is fulfilled if the given value string
+// is the tenant of the caller.
+type MatchTenantCondition struct{}
+
+// Fulfills returns true if the given value (eg. the resource's tenant) is equal
+// to the caller's tenant from the request context.
+func (c *MatchTenantCondition) Fulfills(value interface{}, r *ladon.Request) bool {
+	tenant, ok := r.Context[TenantContextField].(string)
+	if !ok || tenant == "" {
+		return false
+	}
+	s, ok := value.(string)
+	return ok && s == tenant
+}
+
+// GetName returns the condition's name.
+func (c *MatchTenantCondition) GetName() string {
+	return "MatchTenantCondition"
+}
+
+func init() {
+	RegisterCondition(new(MatchTenantCondition).GetName(), func() ladon.Condition {
+		return new(MatchTenantCondition)
+	})
+}
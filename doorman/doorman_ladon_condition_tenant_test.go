@@ -0,0 +1,45 @@
+package doorman
+
+import (
+	"testing"
+
+	"github.com/ory/ladon"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchTenantCondition(t *testing.T) {
+	c := &MatchTenantCondition{}
+	r := &ladon.Request{
+		Context: ladon.Context{
+			TenantContextField: "acme",
+		},
+	}
+	assert.True(t, c.Fulfills("acme", r))
+	assert.False(t, c.Fulfills("globex", r))
+	assert.False(t, c.Fulfills(42, r))
+
+	// Caller without tenant.
+	r = &ladon.Request{
+		Context: ladon.Context{},
+	}
+	assert.False(t, c.Fulfills("", r))
+}
+
+func TestTenantConfig(t *testing.T) {
+	d := NewDefaultLadon()
+	d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Tenant: TenantConfig{
+				Header: "X-Tenant",
+			},
+		},
+	})
+	c, ok := d.ServiceConfig("a")
+	assert.True(t, ok)
+	assert.True(t, c.Tenant.Enabled())
+	assert.Equal(t, "X-Tenant", c.Tenant.Header)
+	c, ok = d.ServiceConfig("unknown")
+	assert.False(t, ok)
+	assert.False(t, c.Tenant.Enabled())
+}
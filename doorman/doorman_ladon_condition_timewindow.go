@@ -0,0 +1,179 @@
+package doorman
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ory/ladon"
+)
+
+// TimeContextField is the suggested request context field for the time window
+// conditions. It is reserved, hence cannot be supplied by the callers.
+const TimeContextField = EnvContextNamespace + "time"
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// TimeWindow is a weekly range of time (eg. `mon-thu` from `09:00-17:00`).
+type TimeWindow struct {
+	// Days are the comma separated days or ranges of days (eg. `mon-thu,sat`).
+	// All days if empty.
+	Days string `json:"days,omitempty"`
+	// Hours is the range of hours (eg. `09:00-17:00`). When the end is before
+	// the start, the window ends the next day (eg. `22:00-02:00`). The whole day
+	// if empty.
+	Hours string `json:"hours,omitempty"`
+
+	days  [7]bool
+	start time.Duration
+	end   time.Duration
+}
+
+// UnmarshalJSON reads and validates the window, so that the invalid ones are
+// rejected when the policies are loaded.
+func (w *TimeWindow) UnmarshalJSON(data []byte) error {
+	type window TimeWindow
+	var raw window
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	w.Days, w.Hours = raw.Days, raw.Hours
+	return w.parse()
+}
+
+func (w *TimeWindow) parse() error {
+	if strings.TrimSpace(w.Days) == "" {
+		w.days = [7]bool{true, true, true, true, true, true, true}
+	} else {
+		w.days = [7]bool{}
+		for _, part := range strings.Split(w.Days, ",") {
+			bounds := strings.SplitN(strings.TrimSpace(part), "-", 2)
+			first, ok := weekdays[strings.ToLower(bounds[0])]
+			if !ok {
+				return fmt.Errorf("invalid days %q", w.Days)
+			}
+			last := first
+			if len(bounds) == 2 {
+				if last, ok = weekdays[strings.ToLower(bounds[1])]; !ok {
+					return fmt.Errorf("invalid days %q", w.Days)
+				}
+			}
+			// Ranges may wrap around the week (eg. `fri-mon`).
+			for d := first; ; d = (d + 1) % 7 {
+				w.days[d] = true
+				if d == last {
+					break
+				}
+			}
+		}
+	}
+
+	w.start, w.end = 0, 24*time.Hour
+	if strings.TrimSpace(w.Hours) != "" {
+		bounds := strings.SplitN(w.Hours, "-", 2)
+		if len(bounds) != 2 {
+			return fmt.Errorf("invalid hours %q", w.Hours)
+		}
+		var err error
+		if w.start, err = parseClock(bounds[0]); err != nil {
+			return fmt.Errorf("invalid hours %q", w.Hours)
+		}
+		if w.end, err = parseClock(bounds[1]); err != nil {
+			return fmt.Errorf("invalid hours %q", w.Hours)
+		}
+	}
+	return nil
+}
+
+// parseClock reads a time of the day (eg. `09:30`), as the duration since midnight.
+func parseClock(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "24:00" {
+		return 24 * time.Hour, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// contains returns true if the time is inside the window.
+func (w *TimeWindow) contains(t time.Time) bool {
+	clock := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if w.start <= w.end {
+		return w.days[t.Weekday()] && w.start <= clock && clock < w.end
+	}
+	// Overnight: the window started the day before.
+	if clock >= w.start {
+		return w.days[t.Weekday()]
+	}
+	return clock < w.end && w.days[(t.Weekday()+6)%7]
+}
+
+// TimeWindowCondition is a condition which is fulfilled if the request time is
+// inside one of the windows (eg. deploys allowed from Monday to Thursday during
+// office hours).
+type TimeWindowCondition struct {
+	Windows []TimeWindow `json:"windows"`
+	// Timezone is the location of the windows hours (eg. `Europe/Paris`, default: UTC).
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// UnmarshalJSON reads and validates the condition options.
+func (c *TimeWindowCondition) UnmarshalJSON(data []byte) error {
+	type condition TimeWindowCondition
+	var raw condition
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if _, err := time.LoadLocation(raw.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q", raw.Timezone)
+	}
+	*c = TimeWindowCondition(raw)
+	return nil
+}
+
+// Fulfills returns true if the current time is inside one of the windows. If the
+// given value is a time (UNIX timestamp or RFC 3339), it is used instead.
+func (c *TimeWindowCondition) Fulfills(value interface{}, r *ladon.Request) bool {
+	location, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return false
+	}
+	now, ok := unixTime(value)
+	if s, isString := value.(string); isString && !ok {
+		now, err = time.Parse(time.RFC3339, s)
+		ok = err == nil
+	}
+	if !ok {
+		now = time.Now()
+	}
+	now = now.In(location)
+	for i := range c.Windows {
+		if c.Windows[i].contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetName returns the condition's name.
+func (c *TimeWindowCondition) GetName() string {
+	return "TimeWindowCondition"
+}
+
+func init() {
+	RegisterCondition(new(TimeWindowCondition).GetName(), func() ladon.Condition {
+		return new(TimeWindowCondition)
+	})
+}
@@ -0,0 +1,123 @@
+package doorman
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ory/ladon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeWindowCondition(t *testing.T) {
+	var c TimeWindowCondition
+	err := json.Unmarshal([]byte(`{
+		"timezone": "Europe/Paris",
+		"windows": [
+			{"days": "mon-thu", "hours": "09:00-17:00"},
+			{"days": "sat", "hours": "22:00-02:00"}
+		]
+	}`), &c)
+	require.Nil(t, err)
+
+	paris, _ := time.LoadLocation("Europe/Paris")
+	at := func(s string) int64 {
+		t, _ := time.ParseInLocation("2006-01-02 15:04", s, paris)
+		return t.Unix()
+	}
+
+	// 2018-03-05 is a Monday.
+	assert.True(t, c.Fulfills(at("2018-03-05 09:00"), &ladon.Request{}))
+	assert.True(t, c.Fulfills(at("2018-03-08 16:59"), &ladon.Request{}))
+	assert.False(t, c.Fulfills(at("2018-03-08 17:00"), &ladon.Request{}))
+	assert.False(t, c.Fulfills(at("2018-03-05 08:59"), &ladon.Request{}))
+	assert.False(t, c.Fulfills(at("2018-03-09 10:00"), &ladon.Request{}))
+	// Overnight window.
+	assert.True(t, c.Fulfills(at("2018-03-10 23:00"), &ladon.Request{}))
+	assert.True(t, c.Fulfills(at("2018-03-11 01:00"), &ladon.Request{}))
+	assert.False(t, c.Fulfills(at("2018-03-11 03:00"), &ladon.Request{}))
+	assert.False(t, c.Fulfills(at("2018-03-10 01:00"), &ladon.Request{}))
+	// RFC 3339 and timezone conversion.
+	assert.True(t, c.Fulfills("2018-03-05T08:30:00Z", &ladon.Request{}))
+	assert.False(t, c.Fulfills("2018-03-05T08:30:00+01:00", &ladon.Request{}))
+
+	// Current time when not specified.
+	always := TimeWindowCondition{Windows: []TimeWindow{{}}}
+	always.Windows[0].parse()
+	assert.True(t, always.Fulfills(nil, &ladon.Request{}))
+	never := TimeWindowCondition{}
+	assert.False(t, never.Fulfills(nil, &ladon.Request{}))
+}
+
+func TestTimeWindowConditionInvalid(t *testing.T) {
+	for options, message := range map[string]string{
+		`{"windows": [{"days": "monday"}]}`:           "invalid days \"monday\"",
+		`{"windows": [{"days": "mon-sunday"}]}`:       "invalid days \"mon-sunday\"",
+		`{"windows": [{"hours": "09:00"}]}`:           "invalid hours \"09:00\"",
+		`{"windows": [{"hours": "9am-5pm"}]}`:         "invalid hours \"9am-5pm\"",
+		`{"timezone": "Mars/Olympus", "windows": []}`: "invalid timezone \"Mars/Olympus\"",
+	} {
+		var c TimeWindowCondition
+		err := json.Unmarshal([]byte(options), &c)
+		require.NotNil(t, err)
+		assert.Equal(t, message, err.Error())
+	}
+}
+
+func TestTimeWindowPolicies(t *testing.T) {
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Policies: Policies{
+				Policy{
+					ID:         "1",
+					Principals: []string{"<.*>"},
+					Actions:    []string{"deploy"},
+					Resources:  []string{"<.*>"},
+					Conditions: Conditions{
+						TimeContextField: Condition{
+							Type: "TimeWindowCondition",
+							Options: map[string]interface{}{
+								"windows": []map[string]string{
+									{"days": "fri-thu"},
+								},
+							},
+						},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	assert.True(t, d.IsAllowed("a", &Request{Principals: Principals{"userid:bob"}, Action: "deploy", Resource: "app"}))
+
+	err = d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Policies: Policies{
+				Policy{
+					ID:         "1",
+					Principals: []string{"<.*>"},
+					Actions:    []string{"deploy"},
+					Resources:  []string{"<.*>"},
+					Conditions: Conditions{
+						TimeContextField: Condition{
+							Type: "TimeWindowCondition",
+							Options: map[string]interface{}{
+								"windows": []map[string]string{
+									{"hours": "17:00"},
+								},
+							},
+						},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid hours \"17:00\"")
+}
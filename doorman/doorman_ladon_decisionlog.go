@@ -0,0 +1,54 @@
+package doorman
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// decisionLogContextField holds the decisions logs verbosity of the request,
+// for the audit logger.
+const decisionLogContextField = "_decisionLog"
+
+// validDecisionLog returns an error if the verbosity is unknown.
+func validDecisionLog(verbosity string) error {
+	switch verbosity {
+	case "", DecisionLogNone, DecisionLogDenials, DecisionLogAll, DecisionLogContext:
+		return nil
+	}
+	return fmt.Errorf("unknown decision log verbosity %q", verbosity)
+}
+
+// SetDecisionLog changes the verbosity of the decisions logs of the service. It
+// overrides the configuration, and is kept across reloads.
+func (doorman *LadonDoorman) SetDecisionLog(service string, verbosity string) error {
+	if _, ok := doorman.snapshot().services[service]; !ok {
+		return fmt.Errorf("unknown service %q", service)
+	}
+	if err := validDecisionLog(verbosity); err != nil {
+		return err
+	}
+	if verbosity == "" {
+		doorman.decisionLog.Delete(service)
+	} else {
+		doorman.decisionLog.Store(service, verbosity)
+	}
+	log.Infof("Decision log verbosity of %q set to %q", service, doorman.DecisionLog(service))
+	return nil
+}
+
+// DecisionLog returns the verbosity of the decisions logs of the service.
+func (doorman *LadonDoorman) DecisionLog(service string) string {
+	return doorman.decisionLogVerbosity(doorman.snapshot(), service)
+}
+
+// decisionLogVerbosity returns the verbosity of the decisions logs of the service of the snapshot.
+func (doorman *LadonDoorman) decisionLogVerbosity(s *snapshot, service string) string {
+	if verbosity, ok := doorman.decisionLog.Load(service); ok {
+		return verbosity.(string)
+	}
+	if verbosity := s.services[service].DecisionLog; verbosity != "" {
+		return verbosity
+	}
+	return DecisionLogContext
+}
@@ -0,0 +1,115 @@
+package doorman
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDecisionLog(t *testing.T) {
+	d := NewDefaultLadon()
+	d.LoadPolicies(ServicesConfig{
+		ServiceConfig{Service: "a", DecisionLog: DecisionLogDenials},
+		ServiceConfig{Service: "b"},
+	})
+	assert.Equal(t, DecisionLogDenials, d.DecisionLog("a"))
+	assert.Equal(t, DecisionLogContext, d.DecisionLog("b"))
+
+	err := d.SetDecisionLog("unknown", DecisionLogNone)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unknown service")
+	err = d.SetDecisionLog("a", "verbose")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unknown decision log verbosity")
+
+	// Overrides are kept across reloads.
+	require.Nil(t, d.SetDecisionLog("b", DecisionLogNone))
+	d.LoadPolicies(ServicesConfig{
+		ServiceConfig{Service: "a", DecisionLog: DecisionLogDenials},
+		ServiceConfig{Service: "b", DecisionLog: DecisionLogAll},
+	})
+	assert.Equal(t, DecisionLogNone, d.DecisionLog("b"))
+
+	// An empty value restores the configuration.
+	require.Nil(t, d.SetDecisionLog("b", ""))
+	assert.Equal(t, DecisionLogAll, d.DecisionLog("b"))
+
+	err = d.LoadPolicies(ServicesConfig{ServiceConfig{Service: "c", DecisionLog: "verbose"}})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "for service \"c\"")
+}
+
+func TestDecisionLogVerbosity(t *testing.T) {
+	d := NewDefaultLadon()
+	d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Policies: Policies{
+				Policy{
+					ID:         "1",
+					Principals: []string{"userid:alice"},
+					Actions:    []string{"read"},
+					Resources:  []string{"<.*>"},
+					Effect:     "allow",
+				},
+			},
+		},
+	})
+	recorder := &decisionsSpy{}
+	d.AddDecisionRecorder(recorder)
+
+	var buf bytes.Buffer
+	d.SetAuditOutput(&buf)
+	defer d.SetAuditOutput(os.Stdout)
+
+	check := func(action string) {
+		d.IsAllowed("a", &Request{
+			Principals: Principals{"userid:alice"},
+			Action:     action,
+			Resource:   "pto",
+			Context: Context{
+				"_service":    "a",
+				"_principals": Principals{"userid:alice"},
+				"planet":      "mars",
+			},
+		})
+	}
+	lines := func() []string {
+		defer buf.Reset()
+		if buf.Len() == 0 {
+			return []string{}
+		}
+		return strings.Split(strings.TrimSpace(buf.String()), "\n")
+	}
+
+	check("read")
+	check("write")
+	logs := lines()
+	require.Equal(t, 2, len(logs))
+	assert.Contains(t, logs[0], "mars")
+
+	d.SetDecisionLog("a", DecisionLogAll)
+	check("read")
+	logs = lines()
+	require.Equal(t, 1, len(logs))
+	assert.NotContains(t, logs[0], "mars")
+
+	d.SetDecisionLog("a", DecisionLogDenials)
+	check("read")
+	check("write")
+	logs = lines()
+	require.Equal(t, 1, len(logs))
+	assert.Contains(t, logs[0], "\"allowed\":false")
+
+	d.SetDecisionLog("a", DecisionLogNone)
+	check("read")
+	check("write")
+	assert.Equal(t, 0, len(lines()))
+
+	// Recorders receive every decision.
+	assert.Equal(t, 7, len(recorder.decisions))
+}
@@ -0,0 +1,89 @@
+package doorman
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"runtime/debug"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxStaleDecisions is the number of decisions kept to be served on internal errors.
+const maxStaleDecisions = 10000
+
+// PanicError is the internal error of a recovered panic (eg. in a custom
+// condition or decision recorder).
+type PanicError struct {
+	// Value is the value passed to panic().
+	Value interface{}
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+func newPanicError(recovered interface{}) *PanicError {
+	return &PanicError{Value: recovered, Stack: debug.Stack()}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// onInternalError decides the outcome of a request that could not be checked,
+// according to the service `onError` setting.
+func (doorman *LadonDoorman) onInternalError(service string, onError string, request *Request, err error) bool {
+	fields := log.Fields{
+		"service":  service,
+		"action":   request.Action,
+		"resource": request.Resource,
+		"onError":  onError,
+		"error":    err.Error(),
+	}
+	if panicErr, ok := err.(*PanicError); ok {
+		fields["stack"] = string(panicErr.Stack)
+	}
+
+	switch onError {
+	case OnErrorAllow:
+		log.WithFields(fields).Warningf("Request allowed despite internal error: %s", err)
+		return true
+	case OnErrorStale:
+		if allowed, found := doorman.stale.get(decisionKey(service, request)); found {
+			log.WithFields(fields).Warningf("Stale decision served after internal error: %s", err)
+			return allowed.(bool)
+		}
+	}
+	log.WithFields(fields).Errorf("Request denied because of internal error: %s", err)
+	return false
+}
+
+// portContextFields are the transport context fields whose port is ignored in
+// the decisions keys: the clients connect from ephemeral ports, and the
+// conditions only consider the IP address (see CIDRsCondition).
+var portContextFields = map[string]bool{
+	"remoteIP":                           true,
+	RequestContextNamespace + "remoteIP": true,
+}
+
+// decisionKey identifies an authorization request. The internal `_` context
+// fields (eg. decision ID) and the clients ports are ignored.
+func decisionKey(service string, request *Request) string {
+	fields := Context{}
+	for k, v := range request.Context {
+		if strings.HasPrefix(k, "_") {
+			continue
+		}
+		if s, ok := v.(string); ok && portContextFields[k] {
+			if host, _, err := net.SplitHostPort(s); err == nil {
+				v = host
+			}
+		}
+		fields[k] = v
+	}
+	context, err := json.Marshal(fields)
+	if err != nil {
+		context = []byte(fmt.Sprintf("%v", request.Context))
+	}
+	return fmt.Sprintf("%s|%q|%s|%s|%s", service, request.Principals, request.Action, request.Resource, context)
+}
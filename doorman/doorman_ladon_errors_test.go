@@ -0,0 +1,168 @@
+package doorman
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ory/ladon"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// panicCondition is a condition that crashes.
+type panicCondition struct{}
+
+func (c *panicCondition) Fulfills(value interface{}, r *ladon.Request) bool {
+	if value == "crash" {
+		panic("boom")
+	}
+	return true
+}
+
+func (c *panicCondition) GetName() string {
+	return "panicCondition"
+}
+
+func init() {
+	ladon.ConditionFactories[new(panicCondition).GetName()] = func() ladon.Condition {
+		return new(panicCondition)
+	}
+}
+
+func failingDoorman(onError string) *LadonDoorman {
+	d := NewDefaultLadon()
+	d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			OnError: onError,
+			Policies: Policies{
+				Policy{
+					ID:         "1",
+					Principals: []string{"userid:alice"},
+					Actions:    []string{"read"},
+					Resources:  []string{"<.*>"},
+					Conditions: Conditions{
+						"status": Condition{
+							Type: "panicCondition",
+						},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	})
+	return d
+}
+
+func TestOnErrorValues(t *testing.T) {
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			OnError: "maybe",
+		},
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unknown onError value \"maybe\"")
+}
+
+func TestOnErrorBehaviors(t *testing.T) {
+	ok := &Request{
+		Principals: Principals{"userid:alice"},
+		Action:     "read",
+		Resource:   "doc",
+		Context:    Context{"status": "fine"},
+	}
+	crash := &Request{
+		Principals: Principals{"userid:alice"},
+		Action:     "read",
+		Resource:   "doc",
+		Context:    Context{"status": "crash"},
+	}
+
+	// Deny by default.
+	d := failingDoorman("")
+	assert.True(t, d.IsAllowed("a", ok))
+	assert.False(t, d.IsAllowed("a", crash))
+
+	// Allow with warning.
+	d = failingDoorman(OnErrorAllow)
+	assert.True(t, d.IsAllowed("a", crash))
+
+	// Stale decision, denied if unknown.
+	d = failingDoorman(OnErrorStale)
+	assert.False(t, d.IsAllowed("a", crash))
+	d.stale.set(decisionKey("a", crash), true)
+	assert.True(t, d.IsAllowed("a", crash))
+}
+
+func TestOnErrorStaleClientPort(t *testing.T) {
+	request := func(status string, remoteIP string) *Request {
+		return &Request{
+			Principals: Principals{"userid:alice"},
+			Action:     "read",
+			Resource:   "doc",
+			Context:    Context{"status": status, "remoteIP": remoteIP},
+		}
+	}
+	d := failingDoorman(OnErrorStale)
+	d.stale.set(decisionKey("a", request("crash", "10.0.0.1:50001")), true)
+	// Served to the same client, from another connection.
+	assert.True(t, d.IsAllowed("a", request("crash", "10.0.0.1:50002")))
+	assert.False(t, d.IsAllowed("a", request("crash", "10.0.0.2:50001")))
+}
+
+// panicRecorder is a decision recorder that crashes.
+type panicRecorder struct{}
+
+func (r *panicRecorder) Record(decision Decision) {
+	panic("recorder is broken")
+}
+
+func TestOnErrorPanics(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	request := &Request{
+		Principals: Principals{"userid:alice"},
+		Action:     "read",
+		Resource:   "doc",
+		Context:    Context{"status": "crash"},
+	}
+	d := failingDoorman("")
+	assert.False(t, d.IsAllowed("a", request))
+	assert.Contains(t, buf.String(), "panic: boom")
+	assert.Contains(t, buf.String(), "stack=")
+
+	// Outside of the policies evaluation.
+	d = failingDoorman(OnErrorAllow)
+	d.SetAuditOutput(ioutil.Discard)
+	d.AddDecisionRecorder(&panicRecorder{})
+	d.SetMaintenance("a", true)
+	assert.True(t, d.IsAllowed("a", request))
+	assert.False(t, d.IsAllowed("unknown", request))
+	assert.Contains(t, buf.String(), "panic: recorder is broken")
+}
+
+func TestDecisionKey(t *testing.T) {
+	request := func(remoteIP string, decisionID string) *Request {
+		return &Request{
+			Principals: Principals{"userid:alice"},
+			Action:     "read",
+			Resource:   "doc",
+			Context: Context{
+				"remoteIP":                           remoteIP,
+				RequestContextNamespace + "remoteIP": remoteIP,
+				"_decisionID":                        decisionID,
+			},
+		}
+	}
+	key := decisionKey("a", request("10.0.0.1:50001", "abc"))
+	assert.Equal(t, key, decisionKey("a", request("10.0.0.1:50002", "def")))
+	assert.Equal(t, key, decisionKey("a", request("10.0.0.1", "")))
+	assert.NotEqual(t, key, decisionKey("a", request("10.0.0.2:50001", "abc")))
+	assert.NotEqual(t, key, decisionKey("b", request("10.0.0.1:50001", "abc")))
+}
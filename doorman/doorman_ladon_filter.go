@@ -0,0 +1,77 @@
+package doorman
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// PartialEvaluate evaluates the policies that match the principals and the action
+// of the request, without resource. The conditions on the fields of the request
+// context are checked, and those on the missing fields (eg. `resource.owner`)
+// are returned as residual conditions, to be translated by the caller (eg. into
+// a database query).
+func (doorman *LadonDoorman) PartialEvaluate(service string, request *Request) (DataFilter, error) {
+	result := DataFilter{
+		Allowed: []FilterClause{},
+		Denied:  []FilterClause{},
+	}
+	policies, r, matcher, err := doorman.requestPolicies(service, request)
+	if err != nil {
+		return result, err
+	}
+
+	for _, policy := range policies {
+		clause := FilterClause{
+			Policy:     policy.GetID(),
+			Resources:  policy.GetResources(),
+			Principals: Principals{},
+			Conditions: []ResidualCondition{},
+		}
+		fulfilled := true
+		for field, condition := range policy.GetConditions() {
+			if value, known := r.Context[field]; known {
+				if !condition.Fulfills(value, r) {
+					fulfilled = false
+					break
+				}
+				continue
+			}
+			// Read the options back from the condition fields.
+			options := map[string]interface{}{}
+			if data, err := json.Marshal(condition); err == nil {
+				json.Unmarshal(data, &options)
+			}
+			clause.Conditions = append(clause.Conditions, ResidualCondition{
+				Field:   field,
+				Type:    condition.GetName(),
+				Options: options,
+			})
+		}
+		if !fulfilled {
+			continue
+		}
+		for _, principal := range request.Principals {
+			matches, err := matcher.Matches(policy, policy.GetSubjects(), principal)
+			if err != nil {
+				return result, err
+			}
+			if matches {
+				clause.Principals = append(clause.Principals, principal)
+			}
+		}
+		sort.Slice(clause.Conditions, func(i, j int) bool {
+			return clause.Conditions[i].Field < clause.Conditions[j].Field
+		})
+		if policy.AllowAccess() {
+			result.Allowed = append(result.Allowed, clause)
+		} else {
+			result.Denied = append(result.Denied, clause)
+		}
+	}
+	for _, clauses := range [][]FilterClause{result.Allowed, result.Denied} {
+		sort.SliceStable(clauses, func(i, j int) bool {
+			return clauses[i].Policy < clauses[j].Policy
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,106 @@
+package doorman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartialEvaluate(t *testing.T) {
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Tags: Tags{
+				"admins": Principals{"userid:maria"},
+			},
+			Policies: Policies{
+				Policy{
+					ID:         "owners",
+					Principals: Principals{"userid:<.*>", "tag:admins"},
+					Actions:    []string{"read"},
+					Resources:  []string{"documents/<.*>"},
+					Conditions: Conditions{
+						"resource.owner": Condition{
+							Type: "MatchPrincipalsCondition",
+						},
+					},
+					Effect: "allow",
+				},
+				Policy{
+					ID:         "admins",
+					Principals: Principals{"tag:admins"},
+					Actions:    []string{"read"},
+					Resources:  []string{"<.*>"},
+					Effect:     "allow",
+				},
+				Policy{
+					ID:         "staging",
+					Principals: Principals{"userid:<.*>"},
+					Actions:    []string{"read"},
+					Resources:  []string{"staging"},
+					Conditions: Conditions{
+						"env": Condition{
+							Type:    "StringEqualCondition",
+							Options: map[string]interface{}{"equals": "stage"},
+						},
+					},
+					Effect: "allow",
+				},
+				Policy{
+					ID:         "secrets",
+					Principals: Principals{"userid:<.*>"},
+					Actions:    []string{"read"},
+					Resources:  []string{"documents/<.*>"},
+					Conditions: Conditions{
+						"resource.classification": Condition{
+							Type:    "StringEqualCondition",
+							Options: map[string]interface{}{"equals": "secret"},
+						},
+					},
+					Effect: "deny",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+
+	filter, err := d.PartialEvaluate("a", &Request{
+		Principals: Principals{"userid:alice", "email:alice@corp.com"},
+		Action:     "read",
+		Context:    Context{"env": "prod"},
+	})
+	require.Nil(t, err)
+	// The conditions on the context are checked.
+	require.Equal(t, 1, len(filter.Allowed))
+	assert.Equal(t, FilterClause{
+		Policy:     "owners",
+		Resources:  []string{"documents/<.*>"},
+		Principals: Principals{"userid:alice"},
+		Conditions: []ResidualCondition{
+			{Field: "resource.owner", Type: "MatchPrincipalsCondition", Options: map[string]interface{}{}},
+		},
+	}, filter.Allowed[0])
+	require.Equal(t, 1, len(filter.Denied))
+	assert.Equal(t, "secrets", filter.Denied[0].Policy)
+	assert.Equal(t, []ResidualCondition{
+		{Field: "resource.classification", Type: "StringEqualCondition", Options: map[string]interface{}{"equals": "secret"}},
+	}, filter.Denied[0].Conditions)
+
+	filter, err = d.PartialEvaluate("a", &Request{
+		Principals: Principals{"userid:maria", "tag:admins"},
+		Action:     "read",
+	})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(filter.Allowed))
+	assert.Equal(t, "admins", filter.Allowed[0].Policy)
+	assert.Equal(t, []ResidualCondition{}, filter.Allowed[0].Conditions)
+	assert.Equal(t, Principals{"userid:maria", "tag:admins"}, filter.Allowed[1].Principals)
+	// Without the field in the context, the condition is left to the caller.
+	assert.Equal(t, "staging", filter.Allowed[2].Policy)
+	assert.Equal(t, "env", filter.Allowed[2].Conditions[0].Field)
+
+	_, err = d.PartialEvaluate("b", &Request{Action: "read"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,71 @@
+package doorman
+
+import (
+	"fmt"
+
+	"github.com/ory/ladon"
+	log "github.com/sirupsen/logrus"
+)
+
+// maintenanceContextField flags the requests decided by the maintenance mode,
+// for the audit logger.
+const maintenanceContextField = "_maintenance"
+
+// maintenanceActions matches the actions of the maintenance configuration.
+var maintenanceActions, _ = newGlobMatcher(MatcherConfig{})
+
+// SetMaintenance enables or disables the maintenance mode of the service. It
+// overrides the configuration, and is kept across reloads.
+func (doorman *LadonDoorman) SetMaintenance(service string, enabled bool) error {
+	if _, ok := doorman.snapshot().services[service]; !ok {
+		return fmt.Errorf("unknown service %q", service)
+	}
+	doorman.maintenance.Store(service, enabled)
+	log.Warningf("Maintenance mode of %q set to %v", service, enabled)
+	return nil
+}
+
+// Maintenance returns true if the service is in maintenance.
+func (doorman *LadonDoorman) Maintenance(service string) bool {
+	return doorman.maintenanceEnabled(doorman.snapshot(), service)
+}
+
+// maintenanceEnabled returns true if the service of the snapshot is in maintenance.
+func (doorman *LadonDoorman) maintenanceEnabled(s *snapshot, service string) bool {
+	if enabled, ok := doorman.maintenance.Load(service); ok {
+		return enabled.(bool)
+	}
+	return s.services[service].Maintenance.Enabled
+}
+
+// maintenanceDecision returns the decision forced by the maintenance
+// configuration for the action, if any. Denials take precedence.
+func maintenanceDecision(config MaintenanceConfig, action string) (allowed bool, forced bool) {
+	if denied, _ := maintenanceActions.Matches(nil, config.Deny, action); denied {
+		return false, true
+	}
+	if granted, _ := maintenanceActions.Matches(nil, config.Allow, action); granted {
+		return true, true
+	}
+	switch config.Default {
+	case MaintenanceAllow:
+		return true, true
+	case MaintenanceDeny:
+		return false, true
+	}
+	return false, false
+}
+
+// isAllowedInMaintenance decides the request if the service is in maintenance,
+// and logs it distinctly in the audit logs.
+func (doorman *LadonDoorman) isAllowedInMaintenance(s *snapshot, service string, r *ladon.Request) (allowed bool, forced bool) {
+	if !doorman.maintenanceEnabled(s, service) {
+		return false, false
+	}
+	allowed, forced = maintenanceDecision(s.services[service].Maintenance, r.Action)
+	if forced {
+		r.Context[maintenanceContextField] = true
+		doorman.auditLogger().logRequest(r, Result{Allowed: allowed}, nil)
+	}
+	return allowed, forced
+}
@@ -0,0 +1,155 @@
+package doorman
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type decisionsSpy struct {
+	decisions []Decision
+}
+
+func (s *decisionsSpy) Record(decision Decision) {
+	s.decisions = append(s.decisions, decision)
+}
+
+func maintenanceDoorman(maintenance MaintenanceConfig) *LadonDoorman {
+	d := NewDefaultLadon()
+	d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service:     "a",
+			Maintenance: maintenance,
+			Policies: Policies{
+				Policy{
+					ID:         "1",
+					Principals: []string{"userid:alice"},
+					Actions:    []string{"<.*>"},
+					Resources:  []string{"<.*>"},
+					Effect:     "allow",
+					AllowBroad: true,
+				},
+			},
+		},
+	})
+	return d
+}
+
+func TestMaintenanceDefaultValues(t *testing.T) {
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service:     "a",
+			Maintenance: MaintenanceConfig{Default: "maybe"},
+		},
+	})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unknown maintenance default value \"maybe\"")
+}
+
+func TestMaintenanceDecisions(t *testing.T) {
+	d := maintenanceDoorman(MaintenanceConfig{
+		Enabled: true,
+		Allow:   []string{"read", "list:*"},
+		Deny:    []string{"*:delete", "list:secrets"},
+	})
+	assert.True(t, d.Maintenance("a"))
+
+	check := func(principal string, action string) bool {
+		return d.IsAllowed("a", &Request{
+			Principals: Principals{principal},
+			Action:     action,
+			Resource:   "any",
+			Context:    Context{},
+		})
+	}
+
+	// Listed actions are forced.
+	assert.True(t, check("userid:bob", "read"))
+	assert.True(t, check("userid:bob", "list:users"))
+	assert.False(t, check("userid:alice", "list:secrets"))
+	assert.False(t, check("userid:alice", "users:delete"))
+	// Others are checked against policies.
+	assert.True(t, check("userid:alice", "write"))
+	assert.False(t, check("userid:bob", "write"))
+
+	// Disabled at runtime.
+	require.Nil(t, d.SetMaintenance("a", false))
+	assert.False(t, d.Maintenance("a"))
+	assert.False(t, check("userid:bob", "read"))
+	assert.True(t, check("userid:alice", "users:delete"))
+}
+
+func TestMaintenanceDefault(t *testing.T) {
+	d := maintenanceDoorman(MaintenanceConfig{
+		Allow:   []string{"read"},
+		Default: MaintenanceDeny,
+	})
+	request := func(action string) *Request {
+		return &Request{
+			Principals: Principals{"userid:alice"},
+			Action:     action,
+			Context:    Context{},
+		}
+	}
+	assert.False(t, d.Maintenance("a"))
+	assert.True(t, d.IsAllowed("a", request("write")))
+
+	require.Nil(t, d.SetMaintenance("a", true))
+	assert.True(t, d.IsAllowed("a", request("read")))
+	assert.False(t, d.IsAllowed("a", request("write")))
+}
+
+func TestSetMaintenance(t *testing.T) {
+	d := maintenanceDoorman(MaintenanceConfig{})
+
+	err := d.SetMaintenance("unknown", true)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unknown service")
+	assert.False(t, d.Maintenance("unknown"))
+
+	// Overrides are kept across reloads.
+	require.Nil(t, d.SetMaintenance("a", true))
+	d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+		},
+	})
+	assert.True(t, d.Maintenance("a"))
+}
+
+func TestMaintenanceAuditLogger(t *testing.T) {
+	d := maintenanceDoorman(MaintenanceConfig{
+		Enabled: true,
+		Deny:    []string{"write"},
+	})
+	recorder := &decisionsSpy{}
+	d.AddDecisionRecorder(recorder)
+
+	var buf bytes.Buffer
+	d.SetAuditOutput(&buf)
+	defer d.SetAuditOutput(os.Stdout)
+
+	d.IsAllowed("a", &Request{
+		Principals: Principals{"userid:alice"},
+		Action:     "write",
+		Context:    Context{},
+	})
+	assert.Contains(t, buf.String(), "\"allowed\":false")
+	assert.Contains(t, buf.String(), "\"maintenance\":true")
+	assert.NotContains(t, buf.String(), "_maintenance")
+	require.Equal(t, 1, len(recorder.decisions))
+	assert.True(t, recorder.decisions[0].Maintenance)
+
+	// Decisions of policies are not flagged.
+	buf.Reset()
+	d.IsAllowed("a", &Request{
+		Principals: Principals{"userid:alice"},
+		Action:     "read",
+		Context:    Context{},
+	})
+	assert.Contains(t, buf.String(), "\"maintenance\":false")
+}
@@ -0,0 +1,53 @@
+package doorman
+
+import (
+	"github.com/ory/ladon"
+	"github.com/pkg/errors"
+)
+
+// decidersContextField holds the policies that decided the last evaluation of
+// the ladon request (see isAllowed).
+const decidersContextField = "_deciders"
+
+type decidingPolicies struct {
+	policies ladon.Policies
+}
+
+// ids returns the IDs of the policies that allowed the request, or of the last
+// one that explicitly denied it.
+func (d *decidingPolicies) ids(allowed bool) []string {
+	policies := d.policies
+	if !allowed && len(policies) > 0 {
+		policies = policies[len(policies)-1:]
+	}
+	ids := []string{}
+	for _, p := range policies {
+		ids = append(ids, p.GetID())
+	}
+	return ids
+}
+
+// forcedDenial checks whether one of the principals is explicitly denied. The
+// policy that denied it is then left in the request deciders.
+func forcedDenial(l *ladon.Ladon, r *ladon.Request, principals Principals) (bool, error) {
+	for _, principal := range principals {
+		r.Subject = principal
+		err := l.IsAllowed(r)
+		if err == nil {
+			continue
+		}
+		cause := errors.Cause(err)
+		if cause == ladon.ErrRequestDenied {
+			continue
+		}
+		if cause != ladon.ErrRequestForcefullyDenied {
+			return false, err
+		}
+		// Authenticating again would not change the decision.
+		delete(r.Context, reauthenticateContextField)
+		return true, nil
+	}
+	// The principals are evaluated again.
+	delete(r.Context, reauthenticateContextField)
+	return false, nil
+}
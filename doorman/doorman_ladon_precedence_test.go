@@ -0,0 +1,67 @@
+package doorman
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDenyPrecedence(t *testing.T) {
+	config := ServiceConfig{
+		Service: "a",
+		Tags: Tags{
+			"contractors": Principals{"userid:bob"},
+		},
+		Policies: Policies{
+			Policy{
+				ID:         "staff",
+				Principals: []string{"group:staff"},
+				Actions:    []string{"read"},
+				Resources:  []string{"<.*>"},
+				Effect:     "allow",
+			},
+			Policy{
+				ID:         "contractors",
+				Principals: []string{"tag:contractors"},
+				Actions:    []string{"read"},
+				Resources:  []string{"payroll"},
+				Effect:     "deny",
+			},
+		},
+	}
+	request := func(resource string) *Request {
+		return &Request{
+			Principals: Principals{"group:staff", "userid:bob", "tag:contractors"},
+			Action:     "read",
+			Resource:   resource,
+			Context:    Context{"_principals": Principals{"group:staff", "userid:bob", "tag:contractors"}},
+		}
+	}
+
+	// By default, any allowed principal is enough.
+	d := NewDefaultLadon()
+	require.Nil(t, d.LoadPolicies(ServicesConfig{config}))
+	assert.True(t, d.IsAllowed("a", request("payroll")))
+
+	config.DenyPrecedence = true
+	for _, ttl := range []time.Duration{0, time.Hour} {
+		d = NewDefaultLadon()
+		d.SetDecisionCache(ttl, 10)
+		require.Nil(t, d.LoadPolicies(ServicesConfig{config}))
+		spy := &decisionsSpy{}
+		d.AddDecisionRecorder(spy)
+
+		assert.False(t, d.IsAllowed("a", request("payroll")))
+		assert.False(t, d.IsAllowed("a", request("payroll")))
+		assert.True(t, d.IsAllowed("a", request("reports")))
+		// Only the final decisions are recorded.
+		require.Equal(t, 3, len(spy.decisions))
+		assert.False(t, spy.decisions[0].Allowed)
+		assert.Equal(t, []string{"contractors"}, spy.decisions[0].Policies)
+		assert.Equal(t, []string{"contractors"}, spy.decisions[1].Policies)
+		assert.True(t, spy.decisions[2].Allowed)
+		assert.Equal(t, []string{"staff"}, spy.decisions[2].Policies)
+	}
+}
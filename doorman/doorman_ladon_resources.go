@@ -0,0 +1,132 @@
+package doorman
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ory/ladon"
+)
+
+// AllowedResources returns the resources patterns of the policies that match the
+// principals and the action of the request. The policies conditions are checked
+// with the request context, without resource.
+func (doorman *LadonDoorman) AllowedResources(service string, request *Request) (ResourcePatterns, error) {
+	result := ResourcePatterns{
+		Allowed: []ResourcePattern{},
+		Denied:  []ResourcePattern{},
+	}
+	policies, r, _, err := doorman.requestPolicies(service, request)
+	if err != nil {
+		return result, err
+	}
+
+	for _, policy := range policies {
+		fulfilled := true
+		for field, condition := range policy.GetConditions() {
+			if !condition.Fulfills(r.Context[field], r) {
+				fulfilled = false
+				break
+			}
+		}
+		if !fulfilled {
+			continue
+		}
+		for _, resource := range policy.GetResources() {
+			pattern := ResourcePattern{Pattern: resource, Policy: policy.GetID()}
+			if policy.AllowAccess() {
+				result.Allowed = append(result.Allowed, pattern)
+			} else {
+				result.Denied = append(result.Denied, pattern)
+			}
+		}
+	}
+	for _, patterns := range [][]ResourcePattern{result.Allowed, result.Denied} {
+		sort.SliceStable(patterns, func(i, j int) bool {
+			return patterns[i].Policy < patterns[j].Policy
+		})
+	}
+	return result, nil
+}
+
+// requestPolicies returns the policies that match the principals and the action
+// of the request, along with the ladon request (without resource) to check their
+// conditions and the service matcher. The policies that are expired or not active
+// yet are skipped. There are none if the maintenance mode denies the action.
+func (doorman *LadonDoorman) requestPolicies(service string, request *Request) (ladon.Policies, *ladon.Request, Matcher, error) {
+	s := doorman.snapshot()
+	l, ok := s.ladons[service]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unknown service %q", service)
+	}
+	if doorman.Maintenance(service) {
+		if allowed, forced := maintenanceDecision(s.services[service].Maintenance, request.Action); forced && !allowed {
+			return nil, nil, nil, nil
+		}
+	}
+
+	policies, err := l.Manager.GetAll(0, maxInt)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	doorman.enrichContext(service, request)
+	context := ladon.Context{}
+	for key, value := range request.Context {
+		context[key] = value
+	}
+	if err := doorman.fetchAttributes(service, request, context); err != nil {
+		return nil, nil, nil, err
+	}
+	context[exclusionContextField] = request.Principals
+	now := time.Now()
+	context[validityContextField] = now
+	if doorman.relations != nil {
+		context[relationsContextField] = doorman.relations
+	}
+	r := &ladon.Request{
+		Action:  request.Action,
+		Context: context,
+	}
+
+	matcher := ladonMatcher(l)
+	var matching ladon.Policies
+	for _, policy := range policies {
+		if !activeLadonPolicy(policy, now) {
+			continue
+		}
+		matches, err := matchesRequest(matcher, policy, request.Principals, request.Action)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if matches {
+			matching = append(matching, policy)
+		}
+	}
+	return matching, r, matcher, nil
+}
+
+// ladonMatcher returns the matcher of the service policies.
+func ladonMatcher(l *ladon.Ladon) Matcher {
+	if l.Matcher != nil {
+		return l.Matcher
+	}
+	return ladon.DefaultMatcher
+}
+
+// matchesRequest returns true if the policy matches the action and one of the principals.
+func matchesRequest(matcher Matcher, policy ladon.Policy, principals Principals, action string) (bool, error) {
+	matches, err := matcher.Matches(policy, policy.GetActions(), action)
+	if err != nil || !matches {
+		return false, err
+	}
+	for _, principal := range principals {
+		matches, err := matcher.Matches(policy, policy.GetSubjects(), principal)
+		if err != nil {
+			return false, err
+		}
+		if matches {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -2,11 +2,27 @@ package doorman
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"sort"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	jose "gopkg.in/square/go-jose.v2"
+	jwt "gopkg.in/square/go-jose.v2/jwt"
+
+	"github.com/mozilla/doorman/authn"
 )
 
 var sampleConfigs ServicesConfig
@@ -159,6 +175,24 @@ func TestBadServicesConfig(t *testing.T) {
 	})
 	assert.NotNil(t, err)
 
+	// Bad JWT issuer among several
+	err = d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service:           "a",
+			IdentityProviders: []string{"https://auth.mozilla.auth0.com/", "http://perlin-pinpin"},
+		},
+	})
+	assert.NotNil(t, err)
+
+	// Local keys without JWT issuer
+	err = d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service:  "a",
+			JWKSFile: "jwks.json",
+		},
+	})
+	assert.NotNil(t, err)
+
 	// Unknown condition type
 	err = d.LoadPolicies(ServicesConfig{
 		ServiceConfig{
@@ -181,12 +215,12 @@ func TestBadServicesConfig(t *testing.T) {
 
 func TestLoadPoliciesTwice(t *testing.T) {
 	doorman := sampleDoorman()
-	loaded, _ := doorman.ladons["https://sample.yaml"].Manager.GetAll(0, maxInt)
+	loaded, _ := doorman.snapshot().ladons["https://sample.yaml"].Manager.GetAll(0, maxInt)
 	assert.Equal(t, 6, len(loaded))
 
 	// Second load.
 	doorman.LoadPolicies(sampleConfigs)
-	loaded, _ = doorman.ladons["https://sample.yaml"].Manager.GetAll(0, maxInt)
+	loaded, _ = doorman.snapshot().ladons["https://sample.yaml"].Manager.GetAll(0, maxInt)
 	assert.Equal(t, 6, len(loaded))
 
 	// Load bad policies, does not affect existing.
@@ -196,8 +230,228 @@ func TestLoadPoliciesTwice(t *testing.T) {
 		},
 	})
 	assert.Contains(t, err.Error(), "\"http://perlin-pinpin\" does not use the https:// scheme")
-	_, ok := doorman.ladons["https://sample.yaml"]
+	_, ok := doorman.snapshot().ladons["https://sample.yaml"]
+	assert.True(t, ok)
+}
+
+func TestLoadStatus(t *testing.T) {
+	doorman := NewDefaultLadon()
+	assert.True(t, doorman.LoadStatus().LoadedAt.IsZero())
+
+	doorman.LoadPolicies(sampleConfigs)
+	status := doorman.LoadStatus()
+	assert.False(t, status.LoadedAt.IsZero())
+	assert.Nil(t, status.Error)
+
+	doorman.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			IdentityProvider: "http://perlin-pinpin",
+		},
+	})
+	failed := doorman.LoadStatus()
+	assert.Equal(t, status.LoadedAt, failed.LoadedAt)
+	assert.Contains(t, failed.Error.Error(), "does not use the https:// scheme")
+	assert.False(t, failed.FailedAt.IsZero())
+
+	// Errors are cleared by the next successful load.
+	doorman.LoadPolicies(sampleConfigs)
+	assert.Nil(t, doorman.LoadStatus().Error)
+	assert.Equal(t, []string{"https://sample.yaml"}, doorman.Services())
+}
+
+func TestLoadPoliciesSnapshot(t *testing.T) {
+	doorman := sampleDoorman()
+	before := doorman.snapshot()
+
+	// Authenticators changes do not alter the existing snapshot.
+	doorman.SetAuthenticator("https://other", nil)
+	_, ok := before.authenticators["https://other"]
+	assert.False(t, ok)
+	_, err := doorman.Authenticator("https://other")
+	assert.Nil(t, err)
+
+	// Reloading replaces the snapshot as a whole.
+	doorman.LoadPolicies(ServicesConfig{})
+	_, ok = before.ladons["https://sample.yaml"]
 	assert.True(t, ok)
+	_, ok = doorman.snapshot().ladons["https://sample.yaml"]
+	assert.False(t, ok)
+}
+
+func TestSetAuthenticatorConcurrently(t *testing.T) {
+	doorman := sampleDoorman()
+
+	// No change is lost.
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			doorman.SetAuthenticator(fmt.Sprintf("https://service-%d", i), nil)
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		doorman.LoadPolicies(sampleConfigs)
+	}()
+	wg.Wait()
+
+	for i := 0; i < 50; i++ {
+		_, ok := doorman.snapshot().authenticators[fmt.Sprintf("https://service-%d", i)]
+		assert.True(t, ok)
+	}
+}
+
+func TestLoadIdentityProviders(t *testing.T) {
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service:           "a",
+			IdentityProvider:  "https://auth.mozilla.auth0.com/",
+			IdentityProviders: []string{"https://accounts.google.com"},
+		},
+	})
+	require.Nil(t, err)
+	a, err := d.Authenticator("a")
+	require.Nil(t, err)
+	assert.NotNil(t, a)
+}
+
+func TestReloadAuthenticatorOptions(t *testing.T) {
+	d := NewDefaultLadon()
+	config := ServiceConfig{
+		Service:          "a",
+		IdentityProvider: "https://auth.corp.com/",
+	}
+	require.Nil(t, d.LoadPolicies(ServicesConfig{config}))
+	before, _ := d.Authenticator("a")
+
+	// The validators are swapped when their configuration changes.
+	config.JWKSURI = "https://keys.corp.com/jwks.json"
+	config.IssuerAliases = []string{"auth.corp.com"}
+	require.Nil(t, d.LoadPolicies(ServicesConfig{config}))
+	after, _ := d.Authenticator("a")
+	assert.NotEqual(t, before, after)
+
+	// The previous ones are not cached anymore.
+	options := authn.AuthenticatorOptions{JWKSURI: config.JWKSURI, IssuerAliases: config.IssuerAliases}
+	previous := d.snapshot().identityProviders["a"][0]
+	config.IssuerAliases = nil
+	require.Nil(t, d.LoadPolicies(ServicesConfig{config}))
+	renewed, _ := authn.NewAuthenticatorWithOptions(config.IdentityProvider, options)
+	assert.False(t, previous == renewed)
+
+	config.IdentityProvider = ""
+	err := d.LoadPolicies(ServicesConfig{config})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "without identityProvider")
+}
+
+func TestLoadAuthenticatorPerService(t *testing.T) {
+	// Each service is validated with its own issuer, keys and algorithms.
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwksFile := func(key interface{}) string {
+		content, _ := json.Marshal(map[string]interface{}{
+			"keys": []jose.JSONWebKey{{Key: key, KeyID: "1"}},
+		})
+		f, _ := ioutil.TempFile("", "jwks-*.json")
+		f.Write(content)
+		f.Close()
+		return f.Name()
+	}
+	rsaFile, ecFile := jwksFile(&rsaKey.PublicKey), jwksFile(&ecKey.PublicKey)
+	defer os.Remove(rsaFile)
+	defer os.Remove(ecFile)
+
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service:          "https://legacy.corp.com",
+			IdentityProvider: "https://auth.corp.com/",
+			JWKSFile:         rsaFile,
+		},
+		ServiceConfig{
+			Service:           "https://api.corp.com",
+			IdentityProvider:  "https://idp.corp.com/",
+			JWKSFile:          ecFile,
+			SigningAlgorithms: []string{"ES256"},
+		},
+	})
+	require.Nil(t, err)
+
+	sign := func(algorithm jose.SignatureAlgorithm, key interface{}, issuer string, audience string) string {
+		signer, _ := jose.NewSigner(jose.SigningKey{Algorithm: algorithm, Key: key}, (&jose.SignerOptions{}).WithHeader("kid", "1"))
+		token, _ := jwt.Signed(signer).Claims(map[string]interface{}{
+			"iss": issuer,
+			"aud": audience,
+			"sub": "ana",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}).CompactSerialize()
+		return token
+	}
+	validate := func(service string, token string) error {
+		a, err := d.Authenticator(service)
+		require.Nil(t, err)
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Origin", service)
+		r.Header.Set("Authorization", "Bearer "+token)
+		_, err = a.ValidateRequest(r)
+		return err
+	}
+
+	assert.Nil(t, validate("https://legacy.corp.com", sign(jose.RS256, rsaKey, "https://auth.corp.com/", "https://legacy.corp.com")))
+	assert.Nil(t, validate("https://api.corp.com", sign(jose.ES256, ecKey, "https://idp.corp.com/", "https://api.corp.com")))
+
+	// Tokens of the other service identity provider are rejected.
+	assert.NotNil(t, validate("https://api.corp.com", sign(jose.RS256, rsaKey, "https://auth.corp.com/", "https://api.corp.com")))
+	assert.NotNil(t, validate("https://legacy.corp.com", sign(jose.ES256, ecKey, "https://idp.corp.com/", "https://legacy.corp.com")))
+}
+
+func TestLoadClientCertificates(t *testing.T) {
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service:            "a",
+			ClientCertificates: true,
+		},
+	})
+	require.Nil(t, err)
+	a, err := d.Authenticator("a")
+	require.Nil(t, err)
+	assert.NotNil(t, a)
+}
+
+func TestLoadTokenExtractors(t *testing.T) {
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service:          "a",
+			IdentityProvider: "https://auth.mozilla.auth0.com/",
+			Token:            TokenConfig{Cookie: "session", Query: "access_token"},
+		},
+	})
+	require.Nil(t, err)
+	a, err := d.Authenticator("a")
+	require.Nil(t, err)
+	assert.Contains(t, fmt.Sprintf("%T", a), "tokenExtractorAuthenticator")
+
+	assert.Equal(t, 0, len(TokenConfig{}.Extractors()))
+	assert.Equal(t, 3, len(TokenConfig{Header: "X-Token", Cookie: "session", Query: "access_token"}.Extractors()))
+}
+
+func TestConfigSources(t *testing.T) {
+	d := NewDefaultLadon()
+	d.LoadPolicies(ServicesConfig{
+		ServiceConfig{Source: "a.yaml", Service: "a"},
+		ServiceConfig{Source: "a.yaml", Service: "b"},
+		ServiceConfig{Source: "c.yaml", Service: "c"},
+	})
+	sources := d.ConfigSources()
+	assert.Equal(t, 2, len(sources))
+	assert.Contains(t, sources, "a.yaml")
+	assert.Contains(t, sources, "c.yaml")
 }
 
 func TestIsAllowed(t *testing.T) {
@@ -217,6 +471,29 @@ func TestIsAllowed(t *testing.T) {
 	assert.False(t, allowed)
 }
 
+func TestIsAllowedBatch(t *testing.T) {
+	doorman := sampleDoorman()
+
+	decisions := doorman.IsAllowedBatch("https://sample.yaml", []*Request{
+		{Principals: Principals{"userid:foo"}, Action: "update", Resource: "a"},
+		{Principals: Principals{"userid:foo"}, Action: "delete", Resource: "b"},
+		{Principals: Principals{"userid:foo"}, Action: "update", Resource: "c", Context: Context{"remoteIP": "10.0.0.1"}},
+	})
+	require.Len(t, decisions, 3)
+	assert.True(t, decisions[0].Allowed)
+	assert.Equal(t, "a", decisions[0].Resource)
+	assert.False(t, decisions[1].Allowed)
+	assert.Equal(t, "delete", decisions[1].Action)
+	assert.True(t, decisions[2].Allowed)
+	assert.Equal(t, "10.0.0.1", decisions[2].RemoteIP)
+	assert.Equal(t, "https://sample.yaml", decisions[2].Service)
+
+	decisions = doorman.ForService("https://bad.service").IsAllowedBatch([]*Request{
+		{Principals: Principals{"userid:foo"}, Action: "update", Resource: "a"},
+	})
+	assert.False(t, decisions[0].Allowed)
+}
+
 func TestExpandPrincipals(t *testing.T) {
 	doorman := sampleDoorman()
 
@@ -225,6 +502,121 @@ func TestExpandPrincipals(t *testing.T) {
 	assert.Equal(t, principals, Principals{"userid:maria", "tag:admins"})
 }
 
+// manyPrincipals returns principals of a user with n groups.
+func manyPrincipals(n int) Principals {
+	principals := Principals{"userid:foo", "email:foo@bar.com"}
+	for i := 0; i < n; i++ {
+		principals = append(principals, fmt.Sprintf("group:group-%d", i))
+	}
+	return principals
+}
+
+func BenchmarkIsAllowedManyPrincipals(b *testing.B) {
+	doorman := sampleDoorman()
+	doorman.auditLogger().logger.Out = ioutil.Discard
+	request := &Request{
+		// Last principal is the one allowed.
+		Principals: append(manyPrincipals(500), "group:admins"),
+		Action:     "create",
+		Resource:   "pto",
+		Context: Context{
+			"domain": "pto.mozilla.org",
+		},
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !doorman.IsAllowed("https://sample.yaml", request) {
+			b.Fatal("should be allowed")
+		}
+	}
+}
+
+func BenchmarkExpandPrincipalsManyPrincipals(b *testing.B) {
+	doorman := sampleDoorman()
+	principals := manyPrincipals(500)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		doorman.ExpandPrincipals("https://sample.yaml", principals)
+	}
+}
+
+func TestExplainPrincipals(t *testing.T) {
+	doorman := NewDefaultLadon()
+	config := ServiceConfig{
+		Source:  "service.yaml",
+		Service: "a",
+		Tags: Tags{
+			"admins": Principals{"userid:maria"},
+			"staff":  Principals{"group:staff"},
+		},
+	}
+	config.SetTagSource("staff", "group:staff", "shared/staff.yaml")
+	doorman.LoadPolicies(ServicesConfig{config})
+
+	principals, matches := doorman.ExplainPrincipals("a", Principals{"group:staff"})
+	assert.Equal(t, Principals{"group:staff", "tag:staff"}, principals)
+	assert.Equal(t, []TagMatch{{
+		Tag:       "tag:staff",
+		Member:    "group:staff",
+		Principal: "group:staff",
+		Source:    "shared/staff.yaml",
+	}}, matches)
+
+	_, matches = doorman.ExplainPrincipals("a", Principals{"userid:maria"})
+	require.Equal(t, 1, len(matches))
+	assert.Equal(t, "service.yaml", matches[0].Source)
+
+	// Unknown service.
+	principals, matches = doorman.ExplainPrincipals("b", Principals{"userid:maria"})
+	assert.Equal(t, Principals{"userid:maria"}, principals)
+	assert.Equal(t, 0, len(matches))
+}
+
+func TestExpandPrincipalsNestedTags(t *testing.T) {
+	doorman := NewDefaultLadon()
+	err := doorman.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Tags: Tags{
+				"admins":     Principals{"userid:maria", "group:ops"},
+				"superusers": Principals{"tag:admins", "userid:bob"},
+				"everyone":   Principals{"tag:superusers", "tag:staff"},
+				"staff":      Principals{"group:staff"},
+			},
+		},
+	})
+	require.Nil(t, err)
+
+	principals := doorman.ExpandPrincipals("a", Principals{"group:ops"})
+	sort.Strings(principals)
+	assert.Equal(t, Principals{"group:ops", "tag:admins", "tag:everyone", "tag:superusers"}, principals)
+
+	principals = doorman.ExpandPrincipals("a", Principals{"userid:bob"})
+	sort.Strings(principals)
+	assert.Equal(t, Principals{"tag:everyone", "tag:superusers", "userid:bob"}, principals)
+
+	_, matches := doorman.ExplainPrincipals("a", Principals{"group:staff"})
+	require.Equal(t, 2, len(matches))
+	assert.Equal(t, "tag:staff", matches[0].Tag)
+	assert.Equal(t, TagMatch{Tag: "tag:everyone", Member: "tag:staff", Principal: "tag:staff"}, matches[1])
+}
+
+func TestLoadPoliciesTagsCycle(t *testing.T) {
+	doorman := NewDefaultLadon()
+	err := doorman.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Tags: Tags{
+				"a": Principals{"tag:b"},
+				"b": Principals{"userid:maria", "tag:c"},
+				"c": Principals{"tag:b"},
+			},
+		},
+	})
+	require.NotNil(t, err)
+	assert.Equal(t, "tags cycle b -> c -> b for service \"a\"", err.Error())
+}
+
 func TestDoormanAllowed(t *testing.T) {
 	doorman := sampleDoorman()
 
@@ -347,10 +739,8 @@ func TestDoormanAuditLogger(t *testing.T) {
 	doorman := sampleDoorman()
 
 	var buf bytes.Buffer
-	doorman.auditLogger().logger.Out = &buf
-	defer func() {
-		doorman.auditLogger().logger.Out = os.Stdout
-	}()
+	doorman.SetAuditOutput(&buf)
+	defer doorman.SetAuditOutput(os.Stdout)
 
 	// Logs when service is bad.
 	doorman.IsAllowed("bad service", &Request{})
@@ -380,4 +770,17 @@ func TestDoormanAuditLogger(t *testing.T) {
 	})
 	assert.Contains(t, buf.String(), "\"allowed\":true")
 	assert.Contains(t, buf.String(), "\"policies\":[\"1\"]")
+
+	// Logs decision ID.
+	buf.Reset()
+	doorman.IsAllowed(service, &Request{
+		Principals: Principals{"userid:foo"},
+		Action:     "update",
+		Resource:   "server.org/blocklist:onecrl",
+		Context: Context{
+			"_decisionID": "abc",
+		},
+	})
+	assert.Contains(t, buf.String(), "\"decisionID\":\"abc\"")
+	assert.NotContains(t, buf.String(), "_decisionID")
 }
@@ -0,0 +1,77 @@
+package doorman
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WhoCan returns the principals of the policies that match the action on the
+// resource (eg. for access reviews). The members of the tags principals are
+// listed too. The policies that are expired or not active yet are skipped. The
+// other policies conditions cannot be checked without request context: their
+// principals are flagged as conditional.
+func (doorman *LadonDoorman) WhoCan(service string, action string, resource string) (PrincipalGrants, error) {
+	result := PrincipalGrants{
+		Allowed: []PrincipalGrant{},
+		Denied:  []PrincipalGrant{},
+	}
+	s := doorman.snapshot()
+	l, ok := s.ladons[service]
+	if !ok {
+		return result, fmt.Errorf("unknown service %q", service)
+	}
+	config := s.services[service]
+
+	policies, err := l.Manager.GetAll(0, maxInt)
+	if err != nil {
+		return result, err
+	}
+	matcher := ladonMatcher(l)
+	now := time.Now()
+	for _, policy := range policies {
+		if !activeLadonPolicy(policy, now) {
+			continue
+		}
+		matches, err := matcher.Matches(policy, policy.GetActions(), action)
+		if err != nil {
+			return result, err
+		}
+		if !matches {
+			continue
+		}
+		if matches, err = matcher.Matches(policy, policy.GetResources(), resource); err != nil {
+			return result, err
+		}
+		if !matches {
+			continue
+		}
+		conditions := len(policy.GetConditions())
+		if _, ok := policy.GetConditions()[validityContextField]; ok {
+			// Already checked.
+			conditions--
+		}
+		for _, principal := range policy.GetSubjects() {
+			grant := PrincipalGrant{
+				Principal:   principal,
+				Policy:      policy.GetID(),
+				Conditional: conditions > 0,
+			}
+			if tag := strings.TrimPrefix(principal, tagPrefix); tag != principal && !IsPrincipalsExpression(principal) {
+				grant.Members = config.Tags.Members(tag)
+			}
+			if policy.AllowAccess() {
+				result.Allowed = append(result.Allowed, grant)
+			} else {
+				result.Denied = append(result.Denied, grant)
+			}
+		}
+	}
+	for _, grants := range [][]PrincipalGrant{result.Allowed, result.Denied} {
+		sort.SliceStable(grants, func(i, j int) bool {
+			return grants[i].Policy < grants[j].Policy
+		})
+	}
+	return result, nil
+}
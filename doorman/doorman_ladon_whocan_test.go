@@ -0,0 +1,67 @@
+package doorman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWhoCan(t *testing.T) {
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Tags: Tags{
+				"admins":     Principals{"userid:maria", "tag:superusers"},
+				"superusers": Principals{"userid:bob"},
+			},
+			Policies: Policies{
+				Policy{
+					ID:         "readers",
+					Principals: []string{"group:staff", "tag:admins"},
+					Actions:    []string{"read"},
+					Resources:  []string{"articles/<.*>"},
+					Effect:     "allow",
+				},
+				Policy{
+					ID:         "owners",
+					Principals: []string{"userid:<.*>"},
+					Actions:    []string{"<.*>"},
+					Resources:  []string{"articles/<.*>"},
+					Conditions: Conditions{
+						"owner": Condition{
+							Type: "MatchPrincipalsCondition",
+						},
+					},
+					Effect: "allow",
+				},
+				Policy{
+					ID:         "contractors",
+					Principals: []string{"group:contractors"},
+					Actions:    []string{"<.*>"},
+					Resources:  []string{"articles/drafts/<.*>"},
+					Effect:     "deny",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+
+	grants, err := d.WhoCan("a", "read", "articles/42")
+	require.Nil(t, err)
+	assert.Equal(t, []PrincipalGrant{
+		{Principal: "userid:<.*>", Policy: "owners", Conditional: true},
+		{Principal: "group:staff", Policy: "readers"},
+		{Principal: "tag:admins", Policy: "readers", Members: Principals{"userid:maria", "userid:bob"}},
+	}, grants.Allowed)
+	assert.Equal(t, []PrincipalGrant{}, grants.Denied)
+
+	grants, err = d.WhoCan("a", "delete", "articles/drafts/1")
+	require.Nil(t, err)
+	assert.Equal(t, 1, len(grants.Allowed))
+	assert.Equal(t, []PrincipalGrant{{Principal: "group:contractors", Policy: "contractors"}}, grants.Denied)
+
+	_, err = d.WhoCan("b", "read", "articles/42")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,60 @@
+package doorman
+
+import (
+	"github.com/mozilla/doorman/authn"
+)
+
+// ServiceDoorman is a view of a Doorman restricted to a single service, for
+// applications that only ever check requests for their own service.
+type ServiceDoorman struct {
+	Doorman Doorman
+	Service string
+}
+
+// ForService returns a view of the specified Doorman restricted to the service.
+func ForService(d Doorman, service string) *ServiceDoorman {
+	return &ServiceDoorman{
+		Doorman: d,
+		Service: service,
+	}
+}
+
+// Authenticator returns the authenticator of the service.
+func (s *ServiceDoorman) Authenticator() (authn.Authenticator, error) {
+	return s.Doorman.Authenticator(s.Service)
+}
+
+// ExpandPrincipals looks up and add extra principals to the ones specified.
+func (s *ServiceDoorman) ExpandPrincipals(principals Principals) Principals {
+	return s.Doorman.ExpandPrincipals(s.Service, principals)
+}
+
+// ExplainPrincipals looks up extra principals and returns why each tag was added.
+func (s *ServiceDoorman) ExplainPrincipals(principals Principals) (Principals, []TagMatch) {
+	return s.Doorman.ExplainPrincipals(s.Service, principals)
+}
+
+// IsAllowed is responsible for deciding if the specified authorization is allowed for the service.
+func (s *ServiceDoorman) IsAllowed(request *Request) bool {
+	return s.Doorman.IsAllowed(s.Service, request)
+}
+
+// IsAllowedBatch decides the authorization requests for the service, in order.
+func (s *ServiceDoorman) IsAllowedBatch(requests []*Request) []Decision {
+	return s.Doorman.IsAllowedBatch(s.Service, requests)
+}
+
+// AllowedResources returns the resources patterns of the service policies matching the request.
+func (s *ServiceDoorman) AllowedResources(request *Request) (ResourcePatterns, error) {
+	return s.Doorman.AllowedResources(s.Service, request)
+}
+
+// PartialEvaluate returns the data filter of the service policies matching the request.
+func (s *ServiceDoorman) PartialEvaluate(request *Request) (DataFilter, error) {
+	return s.Doorman.PartialEvaluate(s.Service, request)
+}
+
+// WhoCan returns the principals of the service policies matching the action on the resource.
+func (s *ServiceDoorman) WhoCan(action string, resource string) (PrincipalGrants, error) {
+	return s.Doorman.WhoCan(s.Service, action, resource)
+}
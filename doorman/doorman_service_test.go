@@ -0,0 +1,33 @@
+package doorman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForService(t *testing.T) {
+	d := sampleDoorman()
+	s := d.ForService("https://sample.yaml")
+
+	principals := s.ExpandPrincipals(Principals{"userid:maria"})
+	assert.Equal(t, Principals{"userid:maria", "tag:admins"}, principals)
+
+	assert.True(t, s.IsAllowed(&Request{
+		Principals: principals,
+		Action:     "update",
+		Resource:   "pto",
+	}))
+	assert.False(t, d.ForService("https://bad.service").IsAllowed(&Request{
+		Principals: principals,
+		Action:     "update",
+		Resource:   "pto",
+	}))
+
+	_, err := s.Authenticator()
+	assert.NotNil(t, err) // No identity provider.
+	d.SetAuthenticator("https://sample.yaml", nil)
+	a, err := s.Authenticator()
+	assert.Nil(t, err)
+	assert.Nil(t, a)
+}
@@ -0,0 +1,53 @@
+package doorman
+
+import (
+	"strings"
+	"time"
+)
+
+// ResourceSegmentsContextField is the context field set by ResourceSegmentsEnricher.
+const ResourceSegmentsContextField = ResourceContextNamespace + "segments"
+
+// ContextEnricher computes context fields from the request (eg. the geolocation
+// of the client IP). The returned fields are merged into the request context.
+type ContextEnricher func(service string, request *Request) Context
+
+// AddContextEnricher appends an enricher to the chain run before every request is
+// checked. The enrichers run in the order they were added, and each sees the
+// fields of the previous ones. It must be called before serving requests.
+func (doorman *LadonDoorman) AddContextEnricher(e ContextEnricher) {
+	doorman.enrichers = append(doorman.enrichers, e)
+}
+
+// enrichContext runs the enrichers chain on the request.
+func (doorman *LadonDoorman) enrichContext(service string, request *Request) {
+	for _, enrich := range doorman.enrichers {
+		fields := enrich(service, request)
+		if len(fields) == 0 {
+			continue
+		}
+		if request.Context == nil {
+			request.Context = Context{}
+		}
+		for field, value := range fields {
+			request.Context[field] = value
+		}
+	}
+}
+
+// TimeEnricher sets the time of the request (as UNIX timestamp) in the
+// `env.time` field (see TimeWindowCondition).
+func TimeEnricher(service string, request *Request) Context {
+	return Context{TimeContextField: time.Now().Unix()}
+}
+
+// ResourceSegmentsEnricher splits the resource by the separator, into the
+// `resource.segments` field (eg. `["documents", "42"]`).
+func ResourceSegmentsEnricher(separator string) ContextEnricher {
+	return func(service string, request *Request) Context {
+		if request.Resource == "" {
+			return nil
+		}
+		return Context{ResourceSegmentsContextField: strings.Split(request.Resource, separator)}
+	}
+}
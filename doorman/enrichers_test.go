@@ -0,0 +1,83 @@
+package doorman
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextEnrichers(t *testing.T) {
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Policies: Policies{
+				Policy{
+					ID:         "owners",
+					Principals: Principals{"userid:alice", "userid:bob"},
+					Actions:    []string{"delete"},
+					Resources:  []string{"<.*>"},
+					Conditions: Conditions{
+						"resource.owner": Condition{
+							Type: "MatchPrincipalsCondition",
+						},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+
+	var order []string
+	d.AddContextEnricher(ResourceSegmentsEnricher("/"))
+	d.AddContextEnricher(func(service string, r *Request) Context {
+		order = append(order, "owner")
+		// The fields of the previous enrichers are available.
+		segments := r.Context[ResourceSegmentsContextField].([]string)
+		return Context{"resource.owner": "userid:" + segments[1]}
+	})
+	d.AddContextEnricher(func(service string, r *Request) Context {
+		order = append(order, "noop")
+		return nil
+	})
+
+	r := &Request{Principals: Principals{"userid:alice"}, Action: "delete", Resource: "users/alice/doc1"}
+	assert.True(t, d.IsAllowed("a", r))
+	assert.Equal(t, []string{"users", "alice", "doc1"}, r.Context[ResourceSegmentsContextField])
+	assert.Equal(t, "userid:alice", r.Context["resource.owner"])
+
+	assert.False(t, d.IsAllowed("a", &Request{Principals: Principals{"userid:bob"}, Action: "delete", Resource: "users/alice/doc1"}))
+	assert.Equal(t, []string{"owner", "noop", "owner", "noop"}, order)
+}
+
+func TestContextEnricherPanics(t *testing.T) {
+	d := NewDefaultLadon()
+	require.Nil(t, d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			OnError: OnErrorAllow,
+			Policies: Policies{
+				Policy{ID: "1", Principals: Principals{"userid:alice"}, Actions: []string{"read"}, Resources: []string{"<.*>"}, Effect: "deny"},
+			},
+		},
+	}))
+	d.AddContextEnricher(func(service string, r *Request) Context {
+		panic("boom")
+	})
+	// Panics are internal errors.
+	assert.True(t, d.IsAllowed("a", &Request{Principals: Principals{"userid:alice"}, Action: "read", Resource: "a"}))
+}
+
+func TestTimeEnricher(t *testing.T) {
+	fields := TimeEnricher("a", &Request{})
+	assert.InDelta(t, time.Now().Unix(), fields[TimeContextField], 1)
+}
+
+func TestResourceSegmentsEnricher(t *testing.T) {
+	enrich := ResourceSegmentsEnricher(":")
+	assert.Equal(t, Context{ResourceSegmentsContextField: []string{"repo", "doorman"}}, enrich("a", &Request{Resource: "repo:doorman"}))
+	assert.Nil(t, enrich("a", &Request{}))
+}
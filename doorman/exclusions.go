@@ -0,0 +1,69 @@
+package doorman
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ory/ladon"
+)
+
+// excludePrefix is the prefix of the tags members that are carved out of the tag
+// (eg. `exclude:userid:bob`).
+const excludePrefix = "exclude:"
+
+// exclusionContextField holds the request principals, for the policies exclusions.
+const exclusionContextField = "_exclusion"
+
+// exclusions returns the principals excluded from the tag.
+func (t Tags) exclusions(tag string) Principals {
+	excluded := Principals{}
+	for _, member := range t[tag] {
+		if principal := strings.TrimPrefix(member, excludePrefix); principal != member {
+			excluded = append(excluded, principal)
+		}
+	}
+	return excluded
+}
+
+// ValidateExclusions returns an error if a tag excludes other tags, since the
+// exclusions of the tags only apply to the specified principals.
+func (t Tags) ValidateExclusions() error {
+	names := make([]string, 0, len(t))
+	for name := range t {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, tag := range names {
+		for _, principal := range t.exclusions(tag) {
+			if strings.HasPrefix(principal, tagPrefix) {
+				return fmt.Errorf("tag %q cannot exclude %q", tag, principal)
+			}
+		}
+	}
+	return nil
+}
+
+// excludedPrincipalsCondition is fulfilled if none of the request principals is
+// excluded from the policy. It is added to the policies with exclusions.
+type excludedPrincipalsCondition struct {
+	Principals []string `json:"principals"`
+}
+
+// Fulfills returns false if one of the principals is excluded.
+func (c *excludedPrincipalsCondition) Fulfills(value interface{}, r *ladon.Request) bool {
+	principals, _ := value.(Principals)
+	for _, principal := range principals {
+		for _, excluded := range c.Principals {
+			if principal == excluded {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// GetName returns the condition's name.
+func (c *excludedPrincipalsCondition) GetName() string {
+	return "ExcludedPrincipalsCondition"
+}
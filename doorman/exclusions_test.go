@@ -0,0 +1,75 @@
+package doorman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagsExclusions(t *testing.T) {
+	config := ServiceConfig{
+		Tags: Tags{
+			"devs":    Principals{"group:devs", "exclude:userid:bob"},
+			"leads":   Principals{"userid:bob"},
+			"coders":  Principals{"tag:devs", "tag:leads"},
+			"interns": Principals{"group:interns"},
+		},
+	}
+	assert.Equal(t, Principals{"tag:devs", "tag:coders"}, config.GetTags(Principals{"userid:alice", "group:devs"}))
+	// Bob is a member of coders through another tag.
+	assert.Equal(t, Principals{"tag:leads", "tag:coders"}, config.GetTags(Principals{"userid:bob", "group:devs"}))
+	assert.Equal(t, Principals{"group:devs", "userid:bob"}, config.Tags.Members("coders"))
+
+	assert.Nil(t, config.Tags.ValidateExclusions())
+	config.Tags["interns"] = Principals{"group:interns", "exclude:tag:devs"}
+	err := config.Tags.ValidateExclusions()
+	require.NotNil(t, err)
+	assert.Equal(t, "tag \"interns\" cannot exclude \"tag:devs\"", err.Error())
+
+	d := NewDefaultLadon()
+	err = d.LoadPolicies(ServicesConfig{ServiceConfig{Service: "a", Tags: config.Tags}})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "for service \"a\"")
+}
+
+func TestPoliciesExclusions(t *testing.T) {
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Tags: Tags{
+				"contractors": Principals{"userid:carol"},
+			},
+			Policies: Policies{
+				Policy{
+					ID:         "deploy",
+					Principals: Principals{"group:devs"},
+					Exclude:    []string{"userid:bob", "tag:contractors"},
+					Actions:    []string{"deploy"},
+					Resources:  []string{"<.*>"},
+					Effect:     "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+
+	deploy := func(principals ...string) *Request {
+		return &Request{
+			Principals: d.ExpandPrincipals("a", principals),
+			Action:     "deploy",
+			Resource:   "prod",
+		}
+	}
+	assert.True(t, d.IsAllowed("a", deploy("userid:alice", "group:devs")))
+	assert.False(t, d.IsAllowed("a", deploy("userid:bob", "group:devs")))
+	assert.False(t, d.IsAllowed("a", deploy("userid:carol", "group:devs")))
+
+	patterns, err := d.AllowedResources("a", deploy("userid:bob", "group:devs"))
+	require.Nil(t, err)
+	assert.Equal(t, 0, len(patterns.Allowed))
+	patterns, err = d.AllowedResources("a", deploy("userid:alice", "group:devs"))
+	require.Nil(t, err)
+	assert.Equal(t, 1, len(patterns.Allowed))
+}
@@ -0,0 +1,66 @@
+package doorman
+
+import (
+	"sync"
+)
+
+// DecisionHistory keeps the most recent decisions in memory, in a ring buffer,
+// to look up what a principal tried recently. It implements DecisionRecorder.
+type DecisionHistory struct {
+	sync.RWMutex
+	decisions []Decision
+	next      int
+	full      bool
+}
+
+// NewDecisionHistory returns a history of the specified number of decisions.
+func NewDecisionHistory(size int) *DecisionHistory {
+	return &DecisionHistory{decisions: make([]Decision, size)}
+}
+
+// Record adds the decision, and drops the oldest one if the history is full.
+func (h *DecisionHistory) Record(decision Decision) {
+	h.Lock()
+	defer h.Unlock()
+	if len(h.decisions) == 0 {
+		return
+	}
+	h.decisions[h.next] = decision
+	h.next = (h.next + 1) % len(h.decisions)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Recent returns the decisions of the specified principal, the most recent
+// first. The principals expanded from tags and groups match too (eg. `group:ops`
+// lists the decisions of its members). A limit of 0 returns every decision.
+func (h *DecisionHistory) Recent(principal string, limit int) []Decision {
+	h.RLock()
+	defer h.RUnlock()
+	count := h.next
+	if h.full {
+		count = len(h.decisions)
+	}
+	recent := []Decision{}
+	for i := 1; i <= count; i++ {
+		decision := h.decisions[(h.next-i+len(h.decisions))%len(h.decisions)]
+		if !hasPrincipal(decision.Principals, principal) {
+			continue
+		}
+		recent = append(recent, decision)
+		if limit > 0 && len(recent) >= limit {
+			break
+		}
+	}
+	return recent
+}
+
+func hasPrincipal(principals Principals, principal string) bool {
+	for _, p := range principals {
+		if p == principal {
+			return true
+		}
+	}
+	return false
+}
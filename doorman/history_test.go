@@ -0,0 +1,71 @@
+package doorman
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecisionHistory(t *testing.T) {
+	h := NewDecisionHistory(3)
+	assert.Equal(t, []Decision{}, h.Recent("userid:ana", 0))
+
+	h.Record(Decision{ID: "1", Principals: Principals{"userid:ana", "group:ops"}})
+	h.Record(Decision{ID: "2", Principals: Principals{"userid:bob", "group:ops"}})
+	h.Record(Decision{ID: "3", Principals: Principals{"userid:ana"}})
+
+	ids := func(decisions []Decision) []string {
+		ids := []string{}
+		for _, d := range decisions {
+			ids = append(ids, d.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"3", "1"}, ids(h.Recent("userid:ana", 0)))
+	assert.Equal(t, []string{"3"}, ids(h.Recent("userid:ana", 1)))
+	assert.Equal(t, []string{"2", "1"}, ids(h.Recent("group:ops", 0)))
+
+	// The oldest decisions are dropped.
+	h.Record(Decision{ID: "4", Principals: Principals{"userid:bob"}})
+	assert.Equal(t, []string{"3"}, ids(h.Recent("userid:ana", 0)))
+	assert.Equal(t, []string{"4", "2"}, ids(h.Recent("userid:bob", 0)))
+
+	// Empty history.
+	h = NewDecisionHistory(0)
+	h.Record(Decision{ID: "1", Principals: Principals{"userid:ana"}})
+	assert.Equal(t, []Decision{}, h.Recent("userid:ana", 0))
+}
+
+func TestDecisionHistoryRecorder(t *testing.T) {
+	d := NewDefaultLadon()
+	d.SetAuditOutput(ioutil.Discard)
+	h := NewDecisionHistory(10)
+	d.AddDecisionRecorder(h)
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Policies: Policies{
+				{ID: "1", Principals: []string{"userid:ana"}, Actions: []string{"read"}, Resources: []string{"<.*>"}, Effect: "allow"},
+			},
+		},
+	})
+	require.Nil(t, err)
+
+	principals := Principals{"userid:ana"}
+	for _, action := range []string{"read", "write"} {
+		d.IsAllowed("a", &Request{
+			Principals: principals,
+			Action:     action,
+			Resource:   "reports",
+			Context:    Context{"_service": "a", "_principals": principals},
+		})
+	}
+	recent := h.Recent("userid:ana", 0)
+	require.Len(t, recent, 2)
+	assert.Equal(t, "write", recent[0].Action)
+	assert.False(t, recent[0].Allowed)
+	assert.Equal(t, "read", recent[1].Action)
+	assert.True(t, recent[1].Allowed)
+}
@@ -0,0 +1,149 @@
+package doorman
+
+import (
+	"fmt"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mozilla/doorman/authn"
+)
+
+// PrincipalsBuilder adds or rewrites the principals of the authenticated users,
+// before they are set in context (eg. to map legacy user IDs).
+type PrincipalsBuilder interface {
+	// BuildPrincipals returns the principals of the user, from those extracted
+	// from its claims. An error rejects the request.
+	BuildPrincipals(r *http.Request, service string, userInfo *authn.UserInfo, principals Principals) (Principals, error)
+}
+
+// PrincipalsBuilderFunc is an adapter to use ordinary functions as PrincipalsBuilder.
+type PrincipalsBuilderFunc func(r *http.Request, service string, userInfo *authn.UserInfo, principals Principals) (Principals, error)
+
+// BuildPrincipals calls f(r, service, userInfo, principals).
+func (f PrincipalsBuilderFunc) BuildPrincipals(r *http.Request, service string, userInfo *authn.UserInfo, principals Principals) (Principals, error) {
+	return f(r, service, userInfo, principals)
+}
+
+// IdentitySettings configure how the identity of the authenticated users is
+// built, by the Gin API and the standard middleware alike.
+type IdentitySettings struct {
+	// MaxGroups is the maximum number of groups turned into principals (0 means unlimited).
+	MaxGroups int
+	// GroupsResolver obtains the groups out-of-band when the identity provider
+	// signals an overage, or when the token carries more than MaxGroups groups.
+	GroupsResolver authn.GroupsResolver
+	// PrincipalsBuilder is invoked after the principals are extracted from the claims.
+	PrincipalsBuilder PrincipalsBuilder
+}
+
+// Identity is the authenticated caller of a service.
+type Identity struct {
+	// UserInfo is nil if authentication is disabled for the service.
+	UserInfo   *authn.UserInfo
+	Principals Principals
+	// Tenant is empty if no tenant is configured for the service.
+	Tenant string
+}
+
+// Identity returns the identity of the caller of the service, from its user
+// info (nil if authentication is disabled for the service). The groups are
+// resolved and capped, the principals are built from the user info and the
+// claims mapped by the service, and rewritten by the builder if any.
+func (s IdentitySettings) Identity(r *http.Request, service string, config ServiceConfig, userInfo *authn.UserInfo) (*Identity, error) {
+	identity := &Identity{}
+	if userInfo != nil {
+		userInfo = s.resolveGroups(userInfo)
+		principals := PrincipalsFromUserInfo(userInfo)
+		principals = append(principals, config.ClaimsPrincipals(userInfo.Claims)...)
+		if s.PrincipalsBuilder != nil {
+			var err error
+			principals, err = s.PrincipalsBuilder.BuildPrincipals(r, service, userInfo, principals)
+			if err != nil {
+				return nil, err
+			}
+		}
+		identity.UserInfo = userInfo
+		identity.Principals = principals
+	}
+	if config.Tenant.Enabled() {
+		identity.Tenant = config.Tenant.FromRequest(r, userInfo)
+	}
+	return identity, nil
+}
+
+// resolveGroups returns the user info with its groups resolved and capped
+// according to the settings.
+func (s IdentitySettings) resolveGroups(userInfo *authn.UserInfo) *authn.UserInfo {
+	exceeded := s.MaxGroups > 0 && len(userInfo.Groups) > s.MaxGroups
+	if !userInfo.GroupsOverage && !exceeded {
+		return userInfo
+	}
+	resolved := *userInfo
+	if s.GroupsResolver != nil {
+		groups, err := s.callGroupsResolver(userInfo)
+		if err != nil {
+			log.Warningf("Could not resolve groups of %q: %s", userInfo.ID, err)
+		} else {
+			resolved.Groups = groups
+			resolved.GroupsOverage = false
+		}
+	}
+	if s.MaxGroups > 0 && len(resolved.Groups) > s.MaxGroups {
+		log.Warningf("User %q has %d groups, only the first %d are kept", userInfo.ID, len(resolved.Groups), s.MaxGroups)
+		resolved.Groups = resolved.Groups[:s.MaxGroups]
+	}
+	return &resolved
+}
+
+// callGroupsResolver calls the groups resolver. Its panics are turned into errors,
+// hence the groups of the token are kept.
+func (s IdentitySettings) callGroupsResolver(userInfo *authn.UserInfo) (groups []string, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			groups, err = nil, fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	return s.GroupsResolver.ResolveGroups(userInfo)
+}
+
+// FromRequest reads the caller's tenant from the authentication claims, or from
+// the request headers if not found.
+func (t TenantConfig) FromRequest(r *http.Request, userInfo *authn.UserInfo) string {
+	if t.Claim != "" && userInfo != nil {
+		if tenant, ok := userInfo.Claims[t.Claim].(string); ok && tenant != "" {
+			return tenant
+		}
+	}
+	if t.Header != "" {
+		return r.Header.Get(t.Header)
+	}
+	return ""
+}
+
+// IsAllowedAs checks the request on behalf of the identity (see RequestAs).
+func (s *ServiceDoorman) IsAllowedAs(identity *Identity, request *Request) bool {
+	return s.IsAllowed(s.RequestAs(identity, request))
+}
+
+// RequestAs returns a copy of the request on behalf of the identity. Its
+// principals are the identity ones, with its tenant, expanded with the service
+// tags and the request roles.
+func (s *ServiceDoorman) RequestAs(identity *Identity, request *Request) *Request {
+	r := *request
+	r.Context = Context{}
+	for key, value := range request.Context {
+		r.Context[key] = value
+	}
+	principals := append(Principals{}, identity.Principals...)
+	if identity.Tenant != "" {
+		principals = append(principals, fmt.Sprintf("tenant:%s", identity.Tenant))
+		r.Context[TenantContextField] = identity.Tenant
+		r.Context[SubjectContextNamespace+"tenant"] = identity.Tenant
+	}
+	r.Principals = s.ExpandPrincipals(principals)
+	r.Principals = append(r.Principals, r.Roles()...)
+	r.Context["_service"] = s.Service
+	r.Context["_principals"] = r.Principals
+	return &r
+}
@@ -0,0 +1,168 @@
+package doorman
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/authn"
+)
+
+func manyGroups(n int) []string {
+	groups := []string{}
+	for i := 0; i < n; i++ {
+		groups = append(groups, fmt.Sprintf("group-%d", i))
+	}
+	return groups
+}
+
+func TestResolveGroups(t *testing.T) {
+	s := IdentitySettings{}
+
+	// Unchanged by default.
+	userInfo := &authn.UserInfo{ID: "ldap|user", Groups: manyGroups(300)}
+	assert.Equal(t, userInfo, s.resolveGroups(userInfo))
+
+	// Capped.
+	s.MaxGroups = 100
+	resolved := s.resolveGroups(userInfo)
+	assert.Equal(t, 100, len(resolved.Groups))
+	assert.Equal(t, "group-99", resolved.Groups[99])
+	assert.Equal(t, 300, len(userInfo.Groups))
+
+	// Resolved out-of-band on overage.
+	s.GroupsResolver = authn.GroupsResolverFunc(func(u *authn.UserInfo) ([]string, error) {
+		return []string{"a", "b"}, nil
+	})
+	userInfo = &authn.UserInfo{ID: "ldap|user", GroupsOverage: true}
+	resolved = s.resolveGroups(userInfo)
+	assert.Equal(t, []string{"a", "b"}, resolved.Groups)
+	assert.False(t, resolved.GroupsOverage)
+
+	// Resolved groups are capped too.
+	s.GroupsResolver = authn.GroupsResolverFunc(func(u *authn.UserInfo) ([]string, error) {
+		return manyGroups(200), nil
+	})
+	resolved = s.resolveGroups(userInfo)
+	assert.Equal(t, 100, len(resolved.Groups))
+
+	// Token groups are kept if resolution fails.
+	s.GroupsResolver = authn.GroupsResolverFunc(func(u *authn.UserInfo) ([]string, error) {
+		return nil, fmt.Errorf("unreachable")
+	})
+	userInfo = &authn.UserInfo{ID: "ldap|user", Groups: manyGroups(150)}
+	resolved = s.resolveGroups(userInfo)
+	assert.Equal(t, 100, len(resolved.Groups))
+
+	// Or if the resolver panics.
+	s.GroupsResolver = authn.GroupsResolverFunc(func(u *authn.UserInfo) ([]string, error) {
+		panic("boom")
+	})
+	resolved = s.resolveGroups(userInfo)
+	assert.Equal(t, 100, len(resolved.Groups))
+}
+
+func TestIdentity(t *testing.T) {
+	config := ServiceConfig{
+		Claims: map[string]string{"team": "team:"},
+		Tenant: TenantConfig{Claim: "org", Header: "X-Tenant"},
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Tenant", "initech")
+	userInfo := &authn.UserInfo{
+		ID:     "ana",
+		Groups: []string{"a", "b"},
+		Claims: map[string]interface{}{"team": "ops", "org": "acme"},
+	}
+
+	s := IdentitySettings{MaxGroups: 1}
+	identity, err := s.Identity(r, "https://api.corp.com", config, userInfo)
+	require.Nil(t, err)
+	assert.Equal(t, Principals{"userid:ana", "group:a", "team:ops"}, identity.Principals)
+	assert.Equal(t, []string{"a"}, identity.UserInfo.Groups)
+	assert.Equal(t, "acme", identity.Tenant)
+
+	// Rewritten by the builder.
+	s.PrincipalsBuilder = PrincipalsBuilderFunc(func(r *http.Request, service string, userInfo *authn.UserInfo, principals Principals) (Principals, error) {
+		return append(principals, "service:"+service), nil
+	})
+	identity, err = s.Identity(r, "https://api.corp.com", config, userInfo)
+	require.Nil(t, err)
+	assert.Equal(t, Principals{"userid:ana", "group:a", "team:ops", "service:https://api.corp.com"}, identity.Principals)
+
+	s.PrincipalsBuilder = PrincipalsBuilderFunc(func(r *http.Request, service string, userInfo *authn.UserInfo, principals Principals) (Principals, error) {
+		return nil, fmt.Errorf("unknown user")
+	})
+	_, err = s.Identity(r, "https://api.corp.com", config, userInfo)
+	assert.Equal(t, "unknown user", err.Error())
+
+	// Without authentication, the tenant is read from the headers.
+	identity, err = s.Identity(r, "https://api.corp.com", config, nil)
+	require.Nil(t, err)
+	assert.Nil(t, identity.UserInfo)
+	assert.Nil(t, identity.Principals)
+	assert.Equal(t, "initech", identity.Tenant)
+}
+
+func TestIsAllowedAs(t *testing.T) {
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Policies: Policies{
+				Policy{
+					ID:         "1",
+					Principals: Principals{"tenant:acme"},
+					Actions:    []string{"read"},
+					Resources:  []string{"reports"},
+					Effect:     "allow",
+					Conditions: Conditions{
+						"resourceTenant": Condition{Type: "MatchTenantCondition"},
+					},
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	s := ForService(d, "a")
+
+	request := &Request{Action: "read", Resource: "reports", Context: Context{"resourceTenant": "acme"}}
+	assert.True(t, s.IsAllowedAs(&Identity{Principals: Principals{"userid:ana"}, Tenant: "acme"}, request))
+	assert.False(t, s.IsAllowedAs(&Identity{Principals: Principals{"userid:ana"}, Tenant: "initech"}, request))
+	assert.False(t, s.IsAllowedAs(&Identity{Principals: Principals{"userid:ana"}}, request))
+	// The specified request is left intact.
+	assert.Nil(t, request.Principals)
+	assert.Equal(t, Context{"resourceTenant": "acme"}, request.Context)
+}
+
+func TestRequestAs(t *testing.T) {
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Tags: Tags{
+				"admins": Principals{"userid:ana"},
+			},
+		},
+	})
+	require.Nil(t, err)
+	s := ForService(d, "a")
+
+	r := s.RequestAs(&Identity{Principals: Principals{"userid:ana"}, Tenant: "acme"}, &Request{Action: "read"})
+	assert.Equal(t, Principals{"userid:ana", "tenant:acme", "tag:admins"}, r.Principals)
+	assert.Equal(t, "acme", r.Context[TenantContextField])
+	assert.Equal(t, "a", r.Context["_service"])
+	assert.Equal(t, r.Principals, r.Context["_principals"])
+}
+
+func BenchmarkBuildPrincipalsManyGroups(b *testing.B) {
+	userInfo := &authn.UserInfo{ID: "ldap|user", Email: "user@corp.com", Groups: manyGroups(500)}
+	s := IdentitySettings{}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		PrincipalsFromUserInfo(s.resolveGroups(userInfo))
+	}
+}
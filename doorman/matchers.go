@@ -0,0 +1,203 @@
+package doorman
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ory/ladon"
+)
+
+// Matchers types.
+const (
+	// MatcherRegexp matches the values with the regular expressions between delimiters (default).
+	MatcherRegexp = "regexp"
+	// MatcherGlob matches the values with `*` (any characters) and `?` (any character) wildcards.
+	MatcherGlob = "glob"
+	// MatcherExact matches the values that are strictly equal.
+	MatcherExact = "exact"
+)
+
+// MatcherConfig specifies how principals, actions and resources of the policies are matched.
+type MatcherConfig struct {
+	// Type is the name of the matcher (eg. `regexp`, `glob`, `exact`).
+	Type string
+	// CaseInsensitive ignores case when comparing values.
+	CaseInsensitive bool `yaml:"caseInsensitive"`
+	// Delimiters are the two characters surrounding regular expressions (default: `<>`).
+	Delimiters string
+	// Separators are the characters of the segments of the values (eg. `/:`), that
+	// the glob `*` and `?` wildcards do not match. `**` matches them.
+	Separators string
+}
+
+// IsDefault returns true if the config is the Ladon default matcher.
+func (c MatcherConfig) IsDefault() bool {
+	return (c.Type == "" || c.Type == MatcherRegexp) && !c.CaseInsensitive && c.Delimiters == "" && c.Separators == ""
+}
+
+// Matcher is in charge of matching a request value (needle) with the values of a policy (haystack).
+// It has the same signature as Ladon matchers.
+type Matcher interface {
+	Matches(p ladon.Policy, haystack []string, needle string) (bool, error)
+}
+
+// MatcherFactory instantiates a matcher from its configuration.
+type MatcherFactory func(config MatcherConfig) (Matcher, error)
+
+var matcherFactories = map[string]MatcherFactory{
+	MatcherRegexp: newRegexpMatcher,
+	MatcherGlob:   newGlobMatcher,
+	MatcherExact:  newExactMatcher,
+}
+
+// RegisterMatcher adds a custom matcher type, that can be used in the services
+// configurations. It must be called before loading policies.
+func RegisterMatcher(name string, factory MatcherFactory) {
+	matcherFactories[name] = factory
+}
+
+// NewMatcher instantiates the matcher of the configuration. It returns nil with
+// the default configuration, to rely on Ladon default matcher.
+func NewMatcher(config MatcherConfig) (Matcher, error) {
+	if config.IsDefault() {
+		return nil, nil
+	}
+	name := config.Type
+	if name == "" {
+		name = MatcherRegexp
+	}
+	factory, ok := matcherFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown matcher type %q", name)
+	}
+	return factory(config)
+}
+
+// patternsMatcher compiles the policies values into regular expressions, and
+// keeps them in cache.
+type patternsMatcher struct {
+	compile func(value string) (*regexp.Regexp, error)
+	cache   sync.Map
+}
+
+func (m *patternsMatcher) Matches(p ladon.Policy, haystack []string, needle string) (bool, error) {
+	for _, value := range haystack {
+		var re *regexp.Regexp
+		if cached, ok := m.cache.Load(value); ok {
+			re = cached.(*regexp.Regexp)
+		} else {
+			compiled, err := m.compile(value)
+			if err != nil {
+				return false, err
+			}
+			m.cache.Store(value, compiled)
+			re = compiled
+		}
+		if re.MatchString(needle) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// caseFlag returns the regexp flag to ignore case, if enabled.
+func caseFlag(config MatcherConfig) string {
+	if config.CaseInsensitive {
+		return "(?i)"
+	}
+	return ""
+}
+
+func newRegexpMatcher(config MatcherConfig) (Matcher, error) {
+	if config.Separators != "" {
+		return nil, fmt.Errorf("matcher separators are only supported by the glob matcher")
+	}
+	delimiters := config.Delimiters
+	if delimiters == "" {
+		delimiters = "<>"
+	}
+	if len(delimiters) != 2 || delimiters[0] == delimiters[1] {
+		return nil, fmt.Errorf("invalid matcher delimiters %q", config.Delimiters)
+	}
+	start, end := delimiters[0], delimiters[1]
+	flag := caseFlag(config)
+
+	compile := func(value string) (*regexp.Regexp, error) {
+		var pattern strings.Builder
+		rest := value
+		for {
+			i := strings.IndexByte(rest, start)
+			if i < 0 {
+				pattern.WriteString(regexp.QuoteMeta(rest))
+				break
+			}
+			j := strings.IndexByte(rest[i:], end)
+			if j < 0 {
+				return nil, fmt.Errorf("unbalanced delimiters in %q", value)
+			}
+			pattern.WriteString(regexp.QuoteMeta(rest[:i]))
+			pattern.WriteString("(" + rest[i+1:i+j] + ")")
+			rest = rest[i+j+1:]
+		}
+		return regexp.Compile(flag + "^" + pattern.String() + "$")
+	}
+	return &patternsMatcher{compile: compile}, nil
+}
+
+func newGlobMatcher(config MatcherConfig) (Matcher, error) {
+	flag := caseFlag(config)
+	// Without separators, the wildcards match any character.
+	segment := "."
+	if config.Separators != "" {
+		var class strings.Builder
+		for _, r := range config.Separators {
+			class.WriteString(`\x{` + strconv.FormatInt(int64(r), 16) + `}`)
+		}
+		segment = "[^" + class.String() + "]"
+	}
+	compile := func(value string) (*regexp.Regexp, error) {
+		var pattern strings.Builder
+		runes := []rune(value)
+		for i := 0; i < len(runes); i++ {
+			switch runes[i] {
+			case '*':
+				if i+1 < len(runes) && runes[i+1] == '*' {
+					pattern.WriteString(".*")
+					i++
+				} else {
+					pattern.WriteString(segment + "*")
+				}
+			case '?':
+				pattern.WriteString(segment)
+			default:
+				pattern.WriteString(regexp.QuoteMeta(string(runes[i])))
+			}
+		}
+		return regexp.Compile(flag + "^" + pattern.String() + "$")
+	}
+	return &patternsMatcher{compile: compile}, nil
+}
+
+// exactMatcher matches the values that are equal.
+type exactMatcher struct {
+	caseInsensitive bool
+}
+
+func newExactMatcher(config MatcherConfig) (Matcher, error) {
+	if config.Separators != "" {
+		return nil, fmt.Errorf("matcher separators are only supported by the glob matcher")
+	}
+	return &exactMatcher{caseInsensitive: config.CaseInsensitive}, nil
+}
+
+func (m *exactMatcher) Matches(p ladon.Policy, haystack []string, needle string) (bool, error) {
+	for _, value := range haystack {
+		if value == needle || (m.caseInsensitive && strings.EqualFold(value, needle)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,134 @@
+package doorman
+
+import (
+	"testing"
+
+	"github.com/ory/ladon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMatcher(t *testing.T) {
+	m, err := NewMatcher(MatcherConfig{})
+	require.Nil(t, err)
+	assert.Nil(t, m)
+	m, err = NewMatcher(MatcherConfig{Type: "regexp"})
+	require.Nil(t, err)
+	assert.Nil(t, m)
+
+	_, err = NewMatcher(MatcherConfig{Type: "fuzzy"})
+	require.NotNil(t, err)
+	assert.Equal(t, "unknown matcher type \"fuzzy\"", err.Error())
+
+	_, err = NewMatcher(MatcherConfig{Delimiters: "{"})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid matcher delimiters")
+
+	for _, config := range []MatcherConfig{{Separators: "/"}, {Type: "exact", Separators: "/"}} {
+		_, err = NewMatcher(config)
+		require.NotNil(t, err)
+		assert.Equal(t, "matcher separators are only supported by the glob matcher", err.Error())
+	}
+}
+
+func TestMatchers(t *testing.T) {
+	p := &ladon.DefaultPolicy{}
+	for _, test := range []struct {
+		config   MatcherConfig
+		haystack []string
+		needle   string
+		expected bool
+	}{
+		{MatcherConfig{Type: "exact"}, []string{"a", "b"}, "b", true},
+		{MatcherConfig{Type: "exact"}, []string{"<.*>"}, "b", false},
+		{MatcherConfig{Type: "exact"}, []string{"Pto"}, "pto", false},
+		{MatcherConfig{Type: "exact", CaseInsensitive: true}, []string{"Pto"}, "pto", true},
+		{MatcherConfig{Type: "glob"}, []string{"bucket/*"}, "bucket/a/b", true},
+		{MatcherConfig{Type: "glob"}, []string{"bucket/?"}, "bucket/ab", false},
+		{MatcherConfig{Type: "glob"}, []string{"bucket.*"}, "bucketA", false},
+		{MatcherConfig{Type: "glob"}, []string{"arn:aws:s3:::*"}, "arn:aws:s3:::doorman", true},
+		{MatcherConfig{Type: "glob", CaseInsensitive: true}, []string{"Bucket/*"}, "bucket/a", true},
+		{MatcherConfig{Type: "glob"}, []string{"bucket/**"}, "bucket/a/b", true},
+		{MatcherConfig{Type: "glob", Separators: "/"}, []string{"bucket/*"}, "bucket/a", true},
+		{MatcherConfig{Type: "glob", Separators: "/"}, []string{"bucket/*"}, "bucket/a/b", false},
+		{MatcherConfig{Type: "glob", Separators: "/"}, []string{"bucket/*/records/?"}, "bucket/a/records/1", true},
+		{MatcherConfig{Type: "glob", Separators: "/"}, []string{"bucket/?"}, "bucket//", false},
+		{MatcherConfig{Type: "glob", Separators: "/"}, []string{"bucket/**"}, "bucket/a/b", true},
+		{MatcherConfig{Type: "glob", Separators: "/"}, []string{"bucket/**/records"}, "bucket/a/b/records", true},
+		{MatcherConfig{Type: "glob", Separators: ":/"}, []string{"arn:aws:s3:::*"}, "arn:aws:s3:::doorman", true},
+		{MatcherConfig{Type: "glob", Separators: ":/"}, []string{"arn:aws:s3:::*"}, "arn:aws:s3:::doorman/key", false},
+		{MatcherConfig{Type: "glob", Separators: ":/"}, []string{"arn:aws:*:::doorman"}, "arn:aws:s3:::doorman", true},
+		{MatcherConfig{Type: "glob", Separators: "]^-\\"}, []string{"a*"}, "ab-c", false},
+		{MatcherConfig{Type: "glob", Separators: "]^-\\"}, []string{"a*"}, "abc", true},
+		{MatcherConfig{CaseInsensitive: true}, []string{"Bucket/<[a-z]+>"}, "bucket/ABC", true},
+		{MatcherConfig{Delimiters: "{}"}, []string{"records/{[0-9]+}"}, "records/42", true},
+		{MatcherConfig{Delimiters: "{}"}, []string{"records/{[0-9]+}"}, "records/abc", false},
+		{MatcherConfig{Delimiters: "{}"}, []string{"<a>"}, "<a>", true},
+	} {
+		m, err := NewMatcher(test.config)
+		require.Nil(t, err)
+		matches, err := m.Matches(p, test.haystack, test.needle)
+		require.Nil(t, err)
+		assert.Equal(t, test.expected, matches, "%+v %s %s", test.config, test.haystack, test.needle)
+	}
+
+	m, _ := NewMatcher(MatcherConfig{Delimiters: "{}"})
+	_, err := m.Matches(p, []string{"a{b"}, "ab")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unbalanced delimiters")
+}
+
+type prefixMatcher struct{}
+
+func (m *prefixMatcher) Matches(p ladon.Policy, haystack []string, needle string) (bool, error) {
+	for _, h := range haystack {
+		if len(needle) >= len(h) && needle[:len(h)] == h {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestLoadPoliciesMatcher(t *testing.T) {
+	RegisterMatcher("prefix", func(config MatcherConfig) (Matcher, error) {
+		return &prefixMatcher{}, nil
+	})
+	defer delete(matcherFactories, "prefix")
+
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "https://sample.yaml",
+			Matcher: MatcherConfig{Type: "prefix"},
+			Policies: Policies{
+				Policy{
+					ID:         "1",
+					Principals: []string{"userid:"},
+					Actions:    []string{"read"},
+					Resources:  []string{"bucket/"},
+					Effect:     "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	assert.True(t, d.IsAllowed("https://sample.yaml", &Request{
+		Principals: Principals{"userid:maria"},
+		Action:     "read",
+		Resource:   "bucket/records",
+	}))
+	assert.False(t, d.IsAllowed("https://sample.yaml", &Request{
+		Principals: Principals{"userid:maria"},
+		Action:     "read",
+		Resource:   "other/records",
+	}))
+
+	err = d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "https://sample.yaml",
+			Matcher: MatcherConfig{Type: "fuzzy"},
+		},
+	})
+	require.NotNil(t, err)
+	assert.Equal(t, "unknown matcher type \"fuzzy\" for service \"https://sample.yaml\"", err.Error())
+}
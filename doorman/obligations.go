@@ -0,0 +1,31 @@
+package doorman
+
+import (
+	"fmt"
+)
+
+// ValidateObligations returns an error if an obligation of the policy has no type.
+func (p *Policy) ValidateObligations() error {
+	for _, obligation := range p.Obligations {
+		if obligation.Type == "" {
+			return fmt.Errorf("obligation without type")
+		}
+	}
+	return nil
+}
+
+// Obligations returns the obligations of the specified policies, in the order
+// of the configuration.
+func (c *ServiceConfig) Obligations(ids []string) []Obligation {
+	selected := map[string]bool{}
+	for _, id := range ids {
+		selected[id] = true
+	}
+	obligations := []Obligation{}
+	for i := range c.Policies {
+		if selected[c.Policies[i].ID] {
+			obligations = append(obligations, c.Policies[i].Obligations...)
+		}
+	}
+	return obligations
+}
@@ -0,0 +1,103 @@
+package doorman
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyValidateObligations(t *testing.T) {
+	p := Policy{Obligations: []Obligation{{Type: "log"}}}
+	assert.Nil(t, p.ValidateObligations())
+	p.Obligations = append(p.Obligations, Obligation{Options: map[string]interface{}{"field": "email"}})
+	assert.Equal(t, "obligation without type", p.ValidateObligations().Error())
+}
+
+func TestObligations(t *testing.T) {
+	mask := Obligation{Type: "mask", Options: map[string]interface{}{"field": "email"}}
+	config := ServiceConfig{
+		Service: "a",
+		Policies: Policies{
+			Policy{
+				ID:          "analysts",
+				Principals:  Principals{"group:analysts"},
+				Actions:     []string{"read"},
+				Resources:   []string{"<.*>"},
+				Effect:      "allow",
+				Obligations: []Obligation{mask},
+			},
+			Policy{
+				ID:         "admins",
+				Principals: Principals{"group:admins"},
+				Actions:    []string{"read"},
+				Resources:  []string{"<.*>"},
+				Effect:     "allow",
+			},
+			Policy{
+				ID:          "archives",
+				Principals:  Principals{"group:analysts"},
+				Actions:     []string{"read"},
+				Resources:   []string{"archive"},
+				Effect:      "allow",
+				Obligations: []Obligation{{Type: "log"}},
+			},
+		},
+	}
+	assert.Equal(t, []Obligation{mask, {Type: "log"}}, config.Obligations([]string{"archives", "admins", "analysts"}))
+
+	for _, ttl := range []time.Duration{0, time.Minute} {
+		d := NewDefaultLadon()
+		d.SetDecisionCache(ttl, 10)
+		require.Nil(t, d.LoadPolicies(ServicesConfig{config}))
+		recorder := &decisionsSpy{}
+		d.AddDecisionRecorder(recorder)
+
+		for i := 0; i < 2; i++ {
+			r := &Request{Principals: Principals{"group:analysts"}, Action: "read", Resource: "archive"}
+			result := d.Check("a", r)
+			require.True(t, result.Allowed)
+			assert.Equal(t, []Obligation{mask, {Type: "log"}}, result.Obligations)
+			// The request is left untouched.
+			assert.Nil(t, r.Context)
+			// The recorders get them too, even when cached.
+			assert.Equal(t, []Obligation{mask, {Type: "log"}}, recorder.decisions[i].Obligations)
+		}
+
+		result := d.Check("a", &Request{Principals: Principals{"group:admins"}, Action: "read", Resource: "archive"})
+		require.True(t, result.Allowed)
+		assert.Nil(t, result.Obligations)
+
+		// Denied requests have none.
+		result = d.Check("a", &Request{Principals: Principals{"group:analysts"}, Action: "write", Resource: "archive"})
+		require.False(t, result.Allowed)
+		assert.Nil(t, result.Obligations)
+
+		decisions := d.IsAllowedBatch("a", []*Request{
+			{Principals: Principals{"group:analysts"}, Action: "read", Resource: "report"},
+		})
+		assert.Equal(t, []Obligation{mask}, decisions[0].Obligations)
+	}
+}
+
+func TestObligationWithoutType(t *testing.T) {
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Policies: Policies{
+				Policy{
+					ID:          "analysts",
+					Principals:  Principals{"group:analysts"},
+					Actions:     []string{"read"},
+					Resources:   []string{"<.*>"},
+					Effect:      "allow",
+					Obligations: []Obligation{{}},
+				},
+			},
+		},
+	})
+	require.NotNil(t, err)
+	assert.Equal(t, "obligation without type in policy \"analysts\" of service \"a\"", err.Error())
+}
@@ -0,0 +1,112 @@
+package doorman
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mozilla/doorman/authn"
+)
+
+// PrincipalsFromUserInfo builds the principals of an authenticated user (eg.
+// `userid:{id}`, `email:{email}`, `group:{name}`, …) or machine client (`apikey:{name}`,
+// `cert:{common name}`, `spiffe://{trust domain}/{path}`, `client:{id}`, `scope:{name}`).
+func PrincipalsFromUserInfo(userInfo *authn.UserInfo) Principals {
+	var principals Principals
+	if userInfo.APIKey != "" {
+		// Machine clients are not users.
+		apikey := fmt.Sprintf("apikey:%s", userInfo.APIKey)
+		principals = append(principals, apikey)
+	} else if userInfo.ID != "" {
+		userid := fmt.Sprintf("userid:%s", userInfo.ID)
+		principals = append(principals, userid)
+	}
+
+	// Main email (no alias)
+	if userInfo.Email != "" {
+		email := fmt.Sprintf("email:%s", userInfo.Email)
+		principals = append(principals, email)
+	}
+
+	// Organization domain
+	if userInfo.Domain != "" {
+		domain := fmt.Sprintf("domain:%s", userInfo.Domain)
+		principals = append(principals, domain)
+	}
+
+	// Kubernetes service account
+	if userInfo.ServiceAccount != "" {
+		sa := fmt.Sprintf("sa:%s", userInfo.ServiceAccount)
+		principals = append(principals, sa)
+	}
+
+	// TLS client certificate
+	if userInfo.Certificate != "" {
+		cert := fmt.Sprintf("cert:%s", userInfo.Certificate)
+		principals = append(principals, cert)
+	}
+	if userInfo.SPIFFEID != "" {
+		principals = append(principals, userInfo.SPIFFEID)
+	}
+
+	// OAuth client and scopes (eg. client credentials tokens)
+	if userInfo.ClientID != "" {
+		client := fmt.Sprintf("client:%s", userInfo.ClientID)
+		principals = append(principals, client)
+	}
+	for _, scope := range userInfo.Scopes {
+		prefixed := fmt.Sprintf("scope:%s", scope)
+		principals = append(principals, prefixed)
+	}
+
+	// Groups
+	for _, group := range userInfo.Groups {
+		prefixed := fmt.Sprintf("group:%s", group)
+		principals = append(principals, prefixed)
+	}
+
+	// Roles
+	for _, role := range userInfo.Roles {
+		prefixed := fmt.Sprintf("role:%s", role)
+		principals = append(principals, prefixed)
+	}
+	return principals
+}
+
+// ClaimsPrincipals builds the principals of the claims mapped in the service
+// configuration. Claims values can be strings or lists of strings.
+func (c *ServiceConfig) ClaimsPrincipals(claims map[string]interface{}) Principals {
+	principals := Principals{}
+	names := make([]string, 0, len(c.Claims))
+	for name := range c.Claims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prefix := strings.TrimSuffix(c.Claims[name], ":")
+		var values []interface{}
+		switch v := claims[name].(type) {
+		case string:
+			values = []interface{}{v}
+		case []interface{}:
+			values = v
+		}
+		for _, value := range values {
+			if s, ok := value.(string); ok && s != "" {
+				principals = append(principals, fmt.Sprintf("%s:%s", prefix, s))
+			}
+		}
+	}
+	return principals
+}
+
+// IsAllowedIdentity checks the request on behalf of an identity that was not
+// authenticated over HTTP (eg. message consumers, scheduled jobs). The request
+// principals are built from the identity and expanded with the service tags.
+func (s *ServiceDoorman) IsAllowedIdentity(userInfo *authn.UserInfo, request *Request) bool {
+	principals := PrincipalsFromUserInfo(userInfo)
+	if config, ok := s.Doorman.ServiceConfig(s.Service); ok {
+		principals = append(principals, config.ClaimsPrincipals(userInfo.Claims)...)
+	}
+	return s.IsAllowedAs(&Identity{UserInfo: userInfo, Principals: principals}, request)
+}
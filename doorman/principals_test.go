@@ -0,0 +1,85 @@
+package doorman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mozilla/doorman/authn"
+)
+
+func TestPrincipalsFromUserInfo(t *testing.T) {
+	principals := PrincipalsFromUserInfo(&authn.UserInfo{
+		ID:     "ada",
+		Email:  "ada@lau.co",
+		Domain: "lau.co",
+		Groups: []string{"scientists"},
+		Roles:  []string{"editor"},
+	})
+	assert.Equal(t, Principals{"userid:ada", "email:ada@lau.co", "domain:lau.co", "group:scientists", "role:editor"}, principals)
+
+	assert.Equal(t, Principals{"userid:cron"}, PrincipalsFromUserInfo(&authn.UserInfo{ID: "cron"}))
+
+	principals = PrincipalsFromUserInfo(&authn.UserInfo{
+		ID:             "system:serviceaccount:billing:worker",
+		ServiceAccount: "billing/worker",
+	})
+	assert.Equal(t, Principals{"userid:system:serviceaccount:billing:worker", "sa:billing/worker"}, principals)
+
+	principals = PrincipalsFromUserInfo(&authn.UserInfo{
+		ID:     "deploy-bot",
+		APIKey: "deploy-bot",
+		Groups: []string{"deployers"},
+	})
+	assert.Equal(t, Principals{"apikey:deploy-bot", "group:deployers"}, principals)
+
+	principals = PrincipalsFromUserInfo(&authn.UserInfo{
+		Certificate: "billing",
+		SPIFFEID:    "spiffe://example.org/ns/prod/sa/billing",
+	})
+	assert.Equal(t, Principals{"cert:billing", "spiffe://example.org/ns/prod/sa/billing"}, principals)
+
+	principals = PrincipalsFromUserInfo(&authn.UserInfo{ID: "ada", Certificate: "laptop-42"})
+	assert.Equal(t, Principals{"userid:ada", "cert:laptop-42"}, principals)
+
+	principals = PrincipalsFromUserInfo(&authn.UserInfo{
+		ID:       "billing@clients",
+		ClientID: "billing",
+		Scopes:   []string{"read:invoices", "write:invoices"},
+	})
+	assert.Equal(t, Principals{"userid:billing@clients", "client:billing", "scope:read:invoices", "scope:write:invoices"}, principals)
+}
+
+func TestClaimsPrincipals(t *testing.T) {
+	config := &ServiceConfig{
+		Claims: map[string]string{
+			"roles":                  "role",
+			"https://corp.com/teams": "team:",
+			"missing":                "missing",
+		},
+	}
+	principals := config.ClaimsPrincipals(map[string]interface{}{
+		"roles":                  []interface{}{"editor", 42, ""},
+		"https://corp.com/teams": "platform",
+		"other":                  "value",
+	})
+	assert.Equal(t, Principals{"team:platform", "role:editor"}, principals)
+
+	assert.Equal(t, Principals{}, (&ServiceConfig{}).ClaimsPrincipals(map[string]interface{}{"roles": "editor"}))
+}
+
+func TestIsAllowedIdentity(t *testing.T) {
+	s := sampleDoorman().ForService("https://sample.yaml")
+
+	request := &Request{
+		Action:   "update",
+		Resource: "pto",
+		Context:  Context{"planet": "earth"},
+	}
+	// Principals are expanded with tags.
+	assert.True(t, s.IsAllowedIdentity(authn.TrustedIdentity("maria"), request))
+	assert.False(t, s.IsAllowedIdentity(authn.TrustedIdentity("bob"), request))
+	// The specified request is left intact.
+	assert.Nil(t, request.Principals)
+	assert.Equal(t, Context{"planet": "earth"}, request.Context)
+}
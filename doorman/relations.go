@@ -0,0 +1,180 @@
+package doorman
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ory/ladon"
+)
+
+// MaxRelationDepth is the maximum nesting of the subjects sets (eg. the members
+// of a group that is editor of a document), to stop on cycles.
+const MaxRelationDepth = 8
+
+// relationsContextField holds the relations store of the request.
+const relationsContextField = "_relations"
+
+// Relation is a relationship tuple between an object and a subject (eg.
+// `doc:42#editor@userid:alice`). The subject can be the set of subjects having a
+// relation with another object (eg. `doc:42#editor@group:eng#member`).
+type Relation struct {
+	Object   string
+	Relation string
+	Subject  string
+}
+
+// ParseRelation reads a relationship tuple (`object#relation@subject`).
+func ParseRelation(s string) (Relation, error) {
+	at := strings.Index(s, "@")
+	hash := strings.Index(s, "#")
+	if at < 0 || hash < 0 || hash > at {
+		return Relation{}, fmt.Errorf("invalid relation %q (expected `object#relation@subject`)", s)
+	}
+	r := Relation{Object: s[:hash], Relation: s[hash+1 : at], Subject: s[at+1:]}
+	if r.Object == "" || r.Relation == "" || r.Subject == "" {
+		return Relation{}, fmt.Errorf("invalid relation %q (expected `object#relation@subject`)", s)
+	}
+	return r, nil
+}
+
+// String returns the tuple notation of the relation.
+func (r Relation) String() string {
+	return fmt.Sprintf("%s#%s@%s", r.Object, r.Relation, r.Subject)
+}
+
+// RelationStore holds the relationship tuples.
+type RelationStore interface {
+	Write(relations ...Relation) error
+	Delete(relations ...Relation) error
+	// Subjects returns the subjects having the relation with the object.
+	Subjects(object string, relation string) ([]string, error)
+}
+
+// MemoryRelationStore keeps the relationship tuples in memory.
+type MemoryRelationStore struct {
+	sync.RWMutex
+	subjects map[string]map[string]bool
+}
+
+// NewMemoryRelationStore returns an empty store.
+func NewMemoryRelationStore() *MemoryRelationStore {
+	return &MemoryRelationStore{subjects: map[string]map[string]bool{}}
+}
+
+// Write adds the relations. Existing ones are ignored.
+func (s *MemoryRelationStore) Write(relations ...Relation) error {
+	s.Lock()
+	defer s.Unlock()
+	for _, r := range relations {
+		key := r.Object + "#" + r.Relation
+		if s.subjects[key] == nil {
+			s.subjects[key] = map[string]bool{}
+		}
+		s.subjects[key][r.Subject] = true
+	}
+	return nil
+}
+
+// Delete removes the relations. Unknown ones are ignored.
+func (s *MemoryRelationStore) Delete(relations ...Relation) error {
+	s.Lock()
+	defer s.Unlock()
+	for _, r := range relations {
+		key := r.Object + "#" + r.Relation
+		delete(s.subjects[key], r.Subject)
+		if len(s.subjects[key]) == 0 {
+			delete(s.subjects, key)
+		}
+	}
+	return nil
+}
+
+// Subjects returns the sorted subjects having the relation with the object.
+func (s *MemoryRelationStore) Subjects(object string, relation string) ([]string, error) {
+	s.RLock()
+	defer s.RUnlock()
+	subjects := []string{}
+	for subject := range s.subjects[object+"#"+relation] {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+	return subjects, nil
+}
+
+// CheckRelation returns true if one of the principals has the relation with the
+// object, directly or through the subjects sets.
+func CheckRelation(store RelationStore, object string, relation string, principals Principals) (bool, error) {
+	return checkRelation(store, object, relation, principals, 0)
+}
+
+func checkRelation(store RelationStore, object string, relation string, principals Principals, depth int) (bool, error) {
+	if depth >= MaxRelationDepth {
+		return false, nil
+	}
+	subjects, err := store.Subjects(object, relation)
+	if err != nil {
+		return false, err
+	}
+	var sets []string
+	for _, subject := range subjects {
+		if strings.Contains(subject, "#") {
+			sets = append(sets, subject)
+			continue
+		}
+		for _, principal := range principals {
+			if subject == principal {
+				return true, nil
+			}
+		}
+	}
+	for _, set := range sets {
+		hash := strings.LastIndex(set, "#")
+		found, err := checkRelation(store, set[:hash], set[hash+1:], principals, depth+1)
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+// SetRelationStore enables the relationship tuples for the RelationCondition. It
+// must be called before serving requests.
+func (doorman *LadonDoorman) SetRelationStore(store RelationStore) {
+	doorman.relations = store
+}
+
+// RelationCondition is a condition which is fulfilled if the subject has the
+// relation with the object (eg. `editor` of `doc:42`), according to the
+// relationship tuples. The object is the value of the context field (which
+// should be reserved, eg. `resource.object`), or the resource if the context has
+// none.
+type RelationCondition struct {
+	Relation string `json:"relation"`
+}
+
+// Fulfills returns true if the request subject has the relation with the object.
+func (c *RelationCondition) Fulfills(value interface{}, r *ladon.Request) bool {
+	store, ok := r.Context[relationsContextField].(RelationStore)
+	if !ok {
+		return false
+	}
+	object, _ := value.(string)
+	if object == "" {
+		object = r.Resource
+	}
+	found, err := CheckRelation(store, object, c.Relation, Principals{r.Subject})
+	return err == nil && found
+}
+
+// GetName returns the condition's name.
+func (c *RelationCondition) GetName() string {
+	return "RelationCondition"
+}
+
+func init() {
+	RegisterCondition(new(RelationCondition).GetName(), func() ladon.Condition {
+		return new(RelationCondition)
+	})
+}
@@ -0,0 +1,95 @@
+package doorman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRelation(t *testing.T) {
+	r, err := ParseRelation("doc:42#editor@group:eng#member")
+	require.Nil(t, err)
+	assert.Equal(t, Relation{Object: "doc:42", Relation: "editor", Subject: "group:eng#member"}, r)
+	assert.Equal(t, "doc:42#editor@group:eng#member", r.String())
+
+	for _, s := range []string{"doc:42", "doc:42#editor", "doc:42@userid:alice", "#editor@userid:alice", "doc:42#@userid:alice", "doc:42#editor@"} {
+		_, err := ParseRelation(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestCheckRelation(t *testing.T) {
+	store := NewMemoryRelationStore()
+	store.Write(
+		Relation{"doc:42", "editor", "userid:alice"},
+		Relation{"doc:42", "editor", "group:eng#member"},
+		Relation{"group:eng", "member", "userid:bob"},
+		// Cycles are stopped.
+		Relation{"group:a", "member", "group:b#member"},
+		Relation{"group:b", "member", "group:a#member"},
+	)
+
+	for _, test := range []struct {
+		object    string
+		relation  string
+		principal string
+		expected  bool
+	}{
+		{"doc:42", "editor", "userid:alice", true},
+		{"doc:42", "editor", "userid:bob", true},
+		{"doc:42", "viewer", "userid:alice", false},
+		{"doc:42", "editor", "userid:carol", false},
+		{"group:a", "member", "userid:alice", false},
+	} {
+		found, err := CheckRelation(store, test.object, test.relation, Principals{test.principal})
+		require.Nil(t, err)
+		assert.Equal(t, test.expected, found, test)
+	}
+
+	store.Delete(Relation{"group:eng", "member", "userid:bob"})
+	found, _ := CheckRelation(store, "doc:42", "editor", Principals{"userid:bob"})
+	assert.False(t, found)
+	subjects, _ := store.Subjects("doc:42", "editor")
+	assert.Equal(t, []string{"group:eng#member", "userid:alice"}, subjects)
+}
+
+func TestRelationCondition(t *testing.T) {
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Policies: Policies{
+				Policy{
+					ID:         "editors",
+					Principals: Principals{"<.*>"},
+					Actions:    []string{"write"},
+					Resources:  []string{"doc:<.*>"},
+					Conditions: Conditions{
+						"resource.object": Condition{
+							Type:    "RelationCondition",
+							Options: map[string]interface{}{"relation": "editor"},
+						},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	write := func(principal string, resource string, context Context) *Request {
+		return &Request{Principals: Principals{principal}, Action: "write", Resource: resource, Context: context}
+	}
+
+	// Without store, nothing is related.
+	assert.False(t, d.IsAllowed("a", write("userid:alice", "doc:42", nil)))
+
+	store := NewMemoryRelationStore()
+	store.Write(Relation{"doc:42", "editor", "userid:alice"})
+	d.SetRelationStore(store)
+	assert.True(t, d.IsAllowed("a", write("userid:alice", "doc:42", nil)))
+	assert.False(t, d.IsAllowed("a", write("userid:bob", "doc:42", nil)))
+	assert.False(t, d.IsAllowed("a", write("userid:alice", "doc:43", nil)))
+	// The object can be read from the context (eg. set by an enricher).
+	assert.True(t, d.IsAllowed("a", write("userid:alice", "doc:43", Context{"resource.object": "doc:42"})))
+}
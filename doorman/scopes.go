@@ -0,0 +1,41 @@
+package doorman
+
+import (
+	"fmt"
+	"sort"
+)
+
+// scopePrefix is the prefix of the OAuth scopes principals (eg. `scope:read:records`).
+const scopePrefix = "scope:"
+
+// ScopeGrant is the actions on the resources granted by an OAuth scope, as a
+// shorthand for a policy (eg. `read:records` grants `GET` on `/records/*`).
+type ScopeGrant struct {
+	Actions   []string
+	Resources []string
+}
+
+// ScopePolicies returns the policies of the scopes grants, allowing the
+// `scope:` principals. Their IDs are the principals.
+func (c *ServiceConfig) ScopePolicies() Policies {
+	scopes := make([]string, 0, len(c.Scopes))
+	for scope := range c.Scopes {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+
+	policies := Policies{}
+	for _, scope := range scopes {
+		grant := c.Scopes[scope]
+		principal := scopePrefix + scope
+		policies = append(policies, Policy{
+			ID:          principal,
+			Description: fmt.Sprintf("Granted by the %q scope", scope),
+			Principals:  []string{principal},
+			Actions:     grant.Actions,
+			Resources:   grant.Resources,
+			Effect:      "allow",
+		})
+	}
+	return policies
+}
@@ -0,0 +1,46 @@
+package doorman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopePolicies(t *testing.T) {
+	config := ServiceConfig{
+		Service: "a",
+		Matcher: MatcherConfig{Type: "glob"},
+		Scopes: map[string]ScopeGrant{
+			"read:records": {
+				Actions:   []string{"GET"},
+				Resources: []string{"/records/*"},
+			},
+			"admin": {
+				Actions:   []string{"*"},
+				Resources: []string{"*"},
+			},
+		},
+	}
+	policies := config.ScopePolicies()
+	require.Equal(t, 2, len(policies))
+	assert.Equal(t, Policy{
+		ID:          "scope:read:records",
+		Description: "Granted by the \"read:records\" scope",
+		Principals:  []string{"scope:read:records"},
+		Actions:     []string{"GET"},
+		Resources:   []string{"/records/*"},
+		Effect:      "allow",
+	}, policies[1])
+	assert.Equal(t, "scope:admin", policies[0].ID)
+
+	d := NewDefaultLadon()
+	require.Nil(t, d.LoadPolicies(ServicesConfig{config}))
+	request := func(scope string, action string, resource string) *Request {
+		return &Request{Principals: Principals{"client:worker", scope}, Action: action, Resource: resource}
+	}
+	assert.True(t, d.IsAllowed("a", request("scope:read:records", "GET", "/records/42")))
+	assert.False(t, d.IsAllowed("a", request("scope:read:records", "POST", "/records/42")))
+	assert.False(t, d.IsAllowed("a", request("scope:read:records", "GET", "/users/42")))
+	assert.True(t, d.IsAllowed("a", request("scope:admin", "POST", "/users/42")))
+}
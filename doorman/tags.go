@@ -0,0 +1,84 @@
+package doorman
+
+import (
+	"sort"
+	"strings"
+)
+
+// tagPrefix is the prefix of the tags principals (eg. `tag:admins`).
+const tagPrefix = "tag:"
+
+// Members returns the members of the tag, with the members of its nested tags
+// instead of the `tag:` references, and without the exclusions.
+func (t Tags) Members(tag string) Principals {
+	members := Principals{}
+	visited := map[string]bool{}
+	var walk func(tag string)
+	walk = func(tag string) {
+		if visited[tag] {
+			return
+		}
+		visited[tag] = true
+		for _, member := range t[tag] {
+			if nested := strings.TrimPrefix(member, tagPrefix); nested != member {
+				walk(nested)
+				continue
+			}
+			if strings.HasPrefix(member, excludePrefix) {
+				continue
+			}
+			members = append(members, member)
+		}
+	}
+	walk(tag)
+	return members
+}
+
+// Cycle returns the tags that reference each other (eg. `admins`, `superusers`,
+// `admins`), or nil if the tags have no cycle.
+func (t Tags) Cycle() []string {
+	names := make([]string, 0, len(t))
+	for name := range t {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Depth-first search, with the tags of the current path and the ones done.
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	path := []string{}
+	var visit func(tag string) []string
+	visit = func(tag string) []string {
+		switch state[tag] {
+		case visiting:
+			for i, name := range path {
+				if name == tag {
+					return append(append([]string{}, path[i:]...), tag)
+				}
+			}
+		case done:
+			return nil
+		}
+		state[tag] = visiting
+		path = append(path, tag)
+		for _, member := range t[tag] {
+			if nested := strings.TrimPrefix(member, tagPrefix); nested != member {
+				if cycle := visit(nested); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[tag] = done
+		return nil
+	}
+	for _, name := range names {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package doorman
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Operators of the principals expressions (eg. `tag:employees AND tag:oncall`).
+const (
+	andOperator = "AND"
+	orOperator  = "OR"
+)
+
+// IsPrincipalsExpression returns true if the policy principal is a boolean
+// combination of principals (eg. `tag:employees AND (tag:oncall OR group:sre)`).
+// AND takes precedence over OR.
+func IsPrincipalsExpression(principal string) bool {
+	for _, token := range tokenizeExpression(principal) {
+		if token == andOperator || token == orOperator {
+			return true
+		}
+	}
+	return false
+}
+
+// principalsExpression is a parsed principals expression.
+type principalsExpression interface {
+	// eval returns true if the principals fulfill the expression.
+	eval(principals map[string]bool) bool
+}
+
+type principalOperand string
+
+func (p principalOperand) eval(principals map[string]bool) bool {
+	return principals[string(p)]
+}
+
+type andExpression []principalsExpression
+
+func (e andExpression) eval(principals map[string]bool) bool {
+	for _, operand := range e {
+		if !operand.eval(principals) {
+			return false
+		}
+	}
+	return true
+}
+
+type orExpression []principalsExpression
+
+func (e orExpression) eval(principals map[string]bool) bool {
+	for _, operand := range e {
+		if operand.eval(principals) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenizeExpression splits the expression into principals, operators and parentheses.
+func tokenizeExpression(s string) []string {
+	s = strings.Replace(s, "(", " ( ", -1)
+	s = strings.Replace(s, ")", " ) ", -1)
+	return strings.Fields(s)
+}
+
+// ValidatePrincipalsExpression returns an error if the principals expression is
+// invalid (eg. `tag:employees AND`).
+func ValidatePrincipalsExpression(s string) error {
+	_, err := parsePrincipalsExpression(s)
+	return err
+}
+
+func parsePrincipalsExpression(s string) (principalsExpression, error) {
+	p := &expressionParser{tokens: tokenizeExpression(s)}
+	e, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid principals expression %q: %s", s, err)
+	}
+	return e, nil
+}
+
+// expressionParser is a recursive descent parser of the principals expressions.
+type expressionParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *expressionParser) next() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *expressionParser) parseOr() (principalsExpression, error) {
+	operands := orExpression{}
+	for {
+		operand, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+		if p.next() != orOperator {
+			break
+		}
+		p.pos++
+	}
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+	return operands, nil
+}
+
+func (p *expressionParser) parseAnd() (principalsExpression, error) {
+	operands := andExpression{}
+	for {
+		operand, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+		if p.next() != andOperator {
+			break
+		}
+		p.pos++
+	}
+	if len(operands) == 1 {
+		return operands[0], nil
+	}
+	return operands, nil
+}
+
+func (p *expressionParser) parseOperand() (principalsExpression, error) {
+	token := p.next()
+	switch token {
+	case "":
+		return nil, fmt.Errorf("unexpected end")
+	case andOperator, orOperator, ")":
+		return nil, fmt.Errorf("unexpected %q", token)
+	case "(":
+		p.pos++
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return e, nil
+	}
+	p.pos++
+	return principalOperand(token), nil
+}
+
+// principalsExpressions returns the distinct principals expressions of the policies.
+func (c *ServiceConfig) principalsExpressions() []string {
+	expressions := []string{}
+	seen := map[string]bool{}
+	for _, policy := range c.Policies {
+		for _, principal := range policy.Principals {
+			if !seen[principal] && IsPrincipalsExpression(principal) {
+				seen[principal] = true
+				expressions = append(expressions, principal)
+			}
+		}
+	}
+	return expressions
+}
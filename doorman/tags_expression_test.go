@@ -0,0 +1,84 @@
+package doorman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrincipalsExpressions(t *testing.T) {
+	assert.True(t, IsPrincipalsExpression("tag:employees AND tag:oncall"))
+	assert.True(t, IsPrincipalsExpression("(tag:a)OR tag:b"))
+	assert.False(t, IsPrincipalsExpression("tag:employees"))
+	assert.False(t, IsPrincipalsExpression("userid:ANDREW"))
+
+	principals := map[string]bool{"tag:employees": true, "group:sre": true}
+	for expression, expected := range map[string]bool{
+		"tag:employees AND tag:oncall":                  false,
+		"tag:employees OR tag:oncall":                   true,
+		"tag:employees AND (tag:oncall OR group:sre)":   true,
+		"tag:oncall AND tag:employees OR group:sre":     true,
+		"tag:oncall AND (tag:employees OR group:sre)":   false,
+		"((tag:employees)) AND ((group:sre))":           true,
+		"tag:contractors OR tag:oncall OR tag:partners": false,
+	} {
+		e, err := parsePrincipalsExpression(expression)
+		require.Nil(t, err)
+		assert.Equal(t, expected, e.eval(principals), expression)
+	}
+
+	for expression, message := range map[string]string{
+		"tag:a AND":            "unexpected end",
+		"OR tag:a":             "unexpected \"OR\"",
+		"tag:a AND (tag:b":     "missing closing parenthesis",
+		"tag:a OR tag:b)":      "unexpected \")\"",
+		"tag:a tag:b OR tag:c": "unexpected \"tag:b\"",
+	} {
+		err := ValidatePrincipalsExpression(expression)
+		require.NotNil(t, err, expression)
+		assert.Contains(t, err.Error(), message)
+	}
+}
+
+func TestExpandPrincipalsExpressions(t *testing.T) {
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "a",
+			Tags: Tags{
+				"employees": Principals{"group:staff"},
+				"oncall":    Principals{"userid:maria"},
+			},
+			Policies: Policies{
+				Policy{
+					ID:         "pager",
+					Principals: Principals{"tag:employees AND tag:oncall"},
+					Actions:    []string{"acknowledge"},
+					Resources:  []string{"alerts"},
+					Effect:     "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+
+	principals := d.ExpandPrincipals("a", Principals{"userid:maria", "group:staff"})
+	assert.Equal(t, "tag:employees AND tag:oncall", principals[len(principals)-1])
+	assert.True(t, d.IsAllowed("a", &Request{Principals: principals, Action: "acknowledge", Resource: "alerts"}))
+
+	principals = d.ExpandPrincipals("a", Principals{"userid:maria"})
+	assert.Equal(t, Principals{"userid:maria", "tag:oncall"}, principals)
+	assert.False(t, d.IsAllowed("a", &Request{Principals: principals, Action: "acknowledge", Resource: "alerts"}))
+
+	err = d.LoadPolicies(ServicesConfig{
+		ServiceConfig{
+			Service: "b",
+			Policies: Policies{
+				Policy{ID: "1", Principals: Principals{"tag:a OR"}, Effect: "allow"},
+			},
+		},
+	})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid principals expression \"tag:a OR\": unexpected end in policy \"1\" of service \"b\"")
+}
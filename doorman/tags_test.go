@@ -0,0 +1,34 @@
+package doorman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagsMembers(t *testing.T) {
+	tags := Tags{
+		"admins":     Principals{"userid:maria", "tag:superusers"},
+		"superusers": Principals{"userid:bob", "tag:admins", "tag:unknown"},
+	}
+	assert.Equal(t, Principals{"userid:maria", "userid:bob"}, tags.Members("admins"))
+	assert.Equal(t, Principals{"userid:bob", "userid:maria"}, tags.Members("superusers"))
+	assert.Equal(t, Principals{}, tags.Members("unknown"))
+}
+
+func TestTagsCycle(t *testing.T) {
+	assert.Nil(t, Tags{}.Cycle())
+	assert.Nil(t, Tags{
+		"admins":     Principals{"userid:maria"},
+		"superusers": Principals{"tag:admins"},
+		"everyone":   Principals{"tag:admins", "tag:superusers"},
+	}.Cycle())
+	assert.Equal(t, []string{"admins", "admins"}, Tags{
+		"admins": Principals{"tag:admins"},
+	}.Cycle())
+	assert.Equal(t, []string{"a", "b", "c", "a"}, Tags{
+		"a": Principals{"tag:b"},
+		"b": Principals{"tag:c"},
+		"c": Principals{"userid:maria", "tag:a"},
+	}.Cycle())
+}
@@ -0,0 +1,214 @@
+package doorman
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ory/ladon"
+
+	"github.com/mozilla/doorman/authn"
+)
+
+// ConfigError is a problem that prevents a service configuration from being loaded.
+type ConfigError struct {
+	// Policy is empty if the problem concerns the whole service.
+	Policy  string
+	Message string
+}
+
+// serviceError returns the error of the problem, for the service.
+func (e ConfigError) serviceError(service string) error {
+	if e.Policy != "" {
+		return fmt.Errorf("%s in policy %q of service %q", e.Message, e.Policy, service)
+	}
+	return fmt.Errorf("%s for service %q", e.Message, service)
+}
+
+// Validate returns every problem that prevents the service configuration from
+// being loaded. The conditions of the policies are instantiated with their options.
+func (c *ServiceConfig) Validate() []ConfigError {
+	errs := []ConfigError{}
+	fail := func(policy string, format string, a ...interface{}) {
+		errs = append(errs, ConfigError{Policy: policy, Message: fmt.Sprintf(format, a...)})
+	}
+
+	switch c.OnError {
+	case "", OnErrorDeny, OnErrorAllow, OnErrorStale:
+	default:
+		fail("", "unknown onError value %q", c.OnError)
+	}
+	switch c.Maintenance.Default {
+	case "", MaintenanceAllow, MaintenanceDeny:
+	default:
+		fail("", "unknown maintenance default value %q", c.Maintenance.Default)
+	}
+	if err := validDecisionLog(c.DecisionLog); err != nil {
+		fail("", "%s", err)
+	}
+	if cycle := c.Tags.Cycle(); cycle != nil {
+		fail("", "tags cycle %s", strings.Join(cycle, " -> "))
+	}
+	if err := c.Tags.ValidateExclusions(); err != nil {
+		fail("", "%s", err)
+	}
+	if c.IdentityProvider == "" {
+		if c.JWKSFile != "" {
+			fail("", "jwksFile without identityProvider")
+		}
+		if c.JWKSURI != "" {
+			fail("", "jwksURI without identityProvider")
+		}
+		if len(c.IssuerAliases) > 0 {
+			fail("", "issuerAliases without identityProvider")
+		}
+		if c.ClaimsNamespace != "" {
+			fail("", "claimsNamespace without identityProvider")
+		}
+		if len(c.SigningAlgorithms) > 0 {
+			fail("", "signingAlgorithms without identityProvider")
+		}
+	}
+	if c.APIKeys.Store != "" {
+		if _, err := authn.RegisteredAPIKeyStore(c.APIKeys.Store); err != nil {
+			fail("", "%s", err)
+		}
+	}
+	if _, err := NewMatcher(c.Matcher); err != nil {
+		fail("", "%s", err)
+	}
+	for claim, prefix := range c.Claims {
+		switch strings.TrimSuffix(prefix, ":") {
+		case "":
+			fail("", "empty principal prefix for claim %q", claim)
+		case "tag":
+			fail("", "claim %q cannot be mapped to tags", claim)
+		}
+	}
+	for _, algorithm := range c.SigningAlgorithms {
+		if !authn.IsSigningAlgorithm(algorithm) {
+			fail("", "unsupported signing algorithm %q (use one of %s)", algorithm, strings.Join(authn.SigningAlgorithms, ", "))
+		}
+	}
+	for claim, value := range c.RequiredClaims {
+		if _, ok := value.(map[interface{}]interface{}); ok {
+			fail("", "required claim %q must be a value or a list of values", claim)
+		}
+	}
+	for entry, field := range c.Baggage {
+		if IsReservedContextField(field) || strings.HasPrefix(field, "_") {
+			fail("", "baggage entry %q cannot be mapped to reserved context field %q", entry, field)
+		}
+	}
+	for path, field := range c.BodyFields {
+		if _, err := ParseJSONPath(path); err != nil {
+			fail("", "%s", err)
+		}
+		if IsReservedContextField(field) || strings.HasPrefix(field, "_") {
+			fail("", "body path %q cannot be mapped to reserved context field %q", path, field)
+		}
+	}
+	if c.RateLimit.Rate < 0 || c.RateLimit.Burst < 0 {
+		fail("", "negative rate limit")
+	}
+	for _, pol := range c.ScopePolicies() {
+		if len(pol.Actions) == 0 || len(pol.Resources) == 0 {
+			fail(pol.ID, "scope without actions or resources")
+		}
+	}
+
+	ids := map[string]bool{}
+	for _, pol := range c.Policies {
+		if ids[pol.ID] {
+			fail(pol.ID, "duplicated policy ID")
+		}
+		ids[pol.ID] = true
+		if len(pol.Principals) == 0 {
+			fail(pol.ID, "empty principals")
+		}
+		if !pol.ValidFrom.IsZero() && !pol.ValidUntil.IsZero() && !pol.ValidUntil.After(pol.ValidFrom) {
+			fail(pol.ID, "validUntil is not after validFrom")
+		}
+		if len(pol.Obligations) > 0 && pol.Effect == "deny" {
+			fail(pol.ID, "obligations are only returned with allow decisions")
+		}
+		if reason := c.broadPolicy(pol); reason != "" {
+			fail(pol.ID, "policy %s (set `allowBroad: true` if intended)", reason)
+		}
+	}
+	for _, pol := range append(append(Policies{}, c.Policies...), c.ScopePolicies()...) {
+		for _, principal := range pol.Principals {
+			if IsPrincipalsExpression(principal) {
+				if err := ValidatePrincipalsExpression(principal); err != nil {
+					fail(pol.ID, "%s", err)
+				}
+			}
+		}
+		if err := pol.ValidateObligations(); err != nil {
+			fail(pol.ID, "%s", err)
+		}
+		if _, err := newConditions(pol); err != nil {
+			fail(pol.ID, "%s", err)
+		}
+	}
+	return errs
+}
+
+// newConditions instantiates the Ladon conditions of the policy.
+func newConditions(pol Policy) (ladon.Conditions, error) {
+	var conditions = ladon.Conditions{}
+	for field, cond := range pol.Conditions {
+		factory, found := ladon.ConditionFactories[cond.Type]
+		if !found {
+			return nil, fmt.Errorf("unknown condition type %q for field %q", cond.Type, field)
+		}
+		c := factory()
+		if len(cond.Options) > 0 {
+			// Leverage Ladon JSON unmarshall code to instantiate conditions.
+			str, _ := json.Marshal(cond.Options)
+			if err := json.Unmarshal(str, c); err != nil {
+				return nil, fmt.Errorf("invalid options of condition %q for field %q: %s", cond.Type, field, err)
+			}
+		}
+		conditions.AddCondition(field, c)
+	}
+	return conditions, nil
+}
+
+// wildcardRegexp matches the patterns that match anything (eg. `<.*>`, `*`), with
+// an optional principal prefix (eg. `userid:<.*>`).
+var wildcardRegexp = regexp.MustCompile(`^([a-z]+:)?(<\.[*+]>|\*+)$`)
+
+// broadPolicy returns why the policy is overly broad, or an empty string. Policies
+// that deny or have conditions are never broad.
+func (c *ServiceConfig) broadPolicy(policy Policy) string {
+	if policy.AllowBroad || policy.Effect != "allow" || len(policy.Conditions) > 0 {
+		return ""
+	}
+	for _, principal := range policy.Principals {
+		if wildcardRegexp.MatchString(principal) {
+			return fmt.Sprintf("allows any principal (%q)", principal)
+		}
+		if strings.HasPrefix(principal, "tag:") {
+			for _, member := range c.Tags.Members(strings.TrimPrefix(principal, "tag:")) {
+				if wildcardRegexp.MatchString(member) {
+					return fmt.Sprintf("allows any principal (%q in %q)", member, principal)
+				}
+			}
+		}
+	}
+	if anyWildcard(policy.Actions) && anyWildcard(policy.Resources) {
+		return "allows every action on every resource"
+	}
+	return ""
+}
+
+func anyWildcard(values []string) bool {
+	for _, value := range values {
+		if wildcardRegexp.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package doorman
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceConfigValidate(t *testing.T) {
+	config := ServiceConfig{
+		Service:  "a",
+		OnError:  "retry",
+		JWKSFile: "keys.json",
+		Policies: Policies{
+			Policy{
+				ID:         "1",
+				Principals: Principals{"userid:bob"},
+				Conditions: Conditions{
+					"branch": Condition{
+						Type:    "RegexCondition",
+						Options: map[string]interface{}{"pattern": "release/("},
+					},
+				},
+			},
+		},
+	}
+	errs := config.Validate()
+	require.Equal(t, 3, len(errs))
+	assert.Equal(t, ConfigError{Message: "unknown onError value \"retry\""}, errs[0])
+	assert.Equal(t, ConfigError{Message: "jwksFile without identityProvider"}, errs[1])
+	assert.Equal(t, "1", errs[2].Policy)
+	assert.Contains(t, errs[2].Message, "invalid options of condition \"RegexCondition\" for field \"branch\"")
+
+	// The loading fails on the first problem.
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{config})
+	assert.Equal(t, "unknown onError value \"retry\" for service \"a\"", err.Error())
+
+	config.OnError = ""
+	config.JWKSFile = ""
+	err = d.LoadPolicies(ServicesConfig{config})
+	assert.Contains(t, err.Error(), "in policy \"1\" of service \"a\"")
+}
+
+func TestServiceConfigValidatePolicies(t *testing.T) {
+	config := ServiceConfig{
+		Service:   "a",
+		RateLimit: RateLimitConfig{Rate: -1},
+		Baggage:   map[string]string{"client.ip": "request.remoteIP"},
+		Policies: Policies{
+			Policy{ID: "1", Principals: Principals{"userid:bob"}},
+			Policy{ID: "1"},
+			Policy{
+				ID:          "2",
+				Principals:  Principals{"userid:bob"},
+				Effect:      "deny",
+				Obligations: []Obligation{{Type: "log"}},
+				ValidFrom:   time.Date(2018, 3, 2, 0, 0, 0, 0, time.UTC),
+				ValidUntil:  time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+	errs := config.Validate()
+	require.Equal(t, 6, len(errs))
+	assert.Equal(t, "baggage entry \"client.ip\" cannot be mapped to reserved context field \"request.remoteIP\"", errs[0].Message)
+	assert.Equal(t, "negative rate limit", errs[1].Message)
+	assert.Equal(t, ConfigError{Policy: "1", Message: "duplicated policy ID"}, errs[2])
+	assert.Equal(t, ConfigError{Policy: "1", Message: "empty principals"}, errs[3])
+	assert.Equal(t, ConfigError{Policy: "2", Message: "validUntil is not after validFrom"}, errs[4])
+	assert.Equal(t, ConfigError{Policy: "2", Message: "obligations are only returned with allow decisions"}, errs[5])
+
+	// The policies are refused at load.
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{config})
+	assert.Equal(t, "baggage entry \"client.ip\" cannot be mapped to reserved context field \"request.remoteIP\" for service \"a\"", err.Error())
+}
+
+func TestServiceConfigValidateBroadPolicies(t *testing.T) {
+	validate := func(principal, action, resource string, change func(*Policy)) []ConfigError {
+		config := ServiceConfig{
+			Service: "abc",
+			Tags:    Tags{"everyone": {"userid:ana", "email:<.*>"}},
+			Policies: Policies{
+				Policy{
+					ID:         "1",
+					Principals: []string{principal},
+					Actions:    []string{action},
+					Resources:  []string{resource},
+					Effect:     "allow",
+				},
+			},
+		}
+		if change != nil {
+			change(&config.Policies[0])
+		}
+		return config.Validate()
+	}
+
+	errs := validate("group:admins", "<.*>", "<.*>", nil)
+	require.Equal(t, 1, len(errs))
+	assert.Equal(t, ConfigError{Policy: "1", Message: "policy allows every action on every resource (set `allowBroad: true` if intended)"}, errs[0])
+
+	errs = validate("userid:<.*>", "read", "articles", nil)
+	require.Equal(t, 1, len(errs))
+	assert.Contains(t, errs[0].Message, "allows any principal (\"userid:<.*>\")")
+
+	errs = validate("tag:everyone", "read", "articles", nil)
+	require.Equal(t, 1, len(errs))
+	assert.Contains(t, errs[0].Message, "allows any principal (\"email:<.*>\" in \"tag:everyone\")")
+
+	// Narrow enough.
+	assert.Empty(t, validate("group:admins", "read", "<.*>", nil))
+	assert.Empty(t, validate("group:admins", "*", "articles/<.*>", nil))
+
+	// Denials, conditions and acknowledged policies.
+	assert.Empty(t, validate("<.*>", "<.*>", "<.*>", func(p *Policy) { p.Effect = "deny" }))
+	assert.Empty(t, validate("<.*>", "<.*>", "<.*>", func(p *Policy) {
+		p.Conditions = Conditions{"planet": Condition{Type: "StringEqualCondition"}}
+	}))
+	assert.Empty(t, validate("<.*>", "<.*>", "<.*>", func(p *Policy) { p.AllowBroad = true }))
+
+	// The loading fails.
+	d := NewDefaultLadon()
+	err := d.LoadPolicies(ServicesConfig{{
+		Service:  "abc",
+		Policies: Policies{{ID: "1", Principals: []string{"<.*>"}, Actions: []string{"read"}, Resources: []string{"a"}, Effect: "allow"}},
+	}})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "allows any principal")
+}
@@ -0,0 +1,57 @@
+package doorman
+
+import (
+	"time"
+
+	"github.com/ory/ladon"
+)
+
+// validityContextField holds the time the policies validity is checked at.
+const validityContextField = "_validity"
+
+// Active returns true if the policy is valid at the specified time.
+func (p *Policy) Active(now time.Time) bool {
+	return (p.ValidFrom.IsZero() || !now.Before(p.ValidFrom)) &&
+		(p.ValidUntil.IsZero() || now.Before(p.ValidUntil))
+}
+
+// InactivePolicies returns the IDs of the policies that are expired or not
+// active yet at the specified time.
+func (c *ServiceConfig) InactivePolicies(now time.Time) []string {
+	ids := []string{}
+	for i := range c.Policies {
+		if !c.Policies[i].Active(now) {
+			ids = append(ids, c.Policies[i].ID)
+		}
+	}
+	return ids
+}
+
+// activeLadonPolicy returns true if the Ladon policy has no validity
+// condition, or if it is valid at the specified time.
+func activeLadonPolicy(policy ladon.Policy, now time.Time) bool {
+	validity, ok := policy.GetConditions()[validityContextField]
+	return !ok || validity.Fulfills(now, nil)
+}
+
+// validityCondition is fulfilled during the validity of the policy. It is added
+// to the policies with validity timestamps.
+type validityCondition struct {
+	ValidFrom  time.Time `json:"validFrom"`
+	ValidUntil time.Time `json:"validUntil"`
+}
+
+// Fulfills returns true if the given time (default: now) is inside the validity.
+func (c *validityCondition) Fulfills(value interface{}, r *ladon.Request) bool {
+	now, ok := value.(time.Time)
+	if !ok {
+		now = time.Now()
+	}
+	p := Policy{ValidFrom: c.ValidFrom, ValidUntil: c.ValidUntil}
+	return p.Active(now)
+}
+
+// GetName returns the condition's name.
+func (c *validityCondition) GetName() string {
+	return "ValidityCondition"
+}
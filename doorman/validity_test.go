@@ -0,0 +1,83 @@
+package doorman
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyActive(t *testing.T) {
+	now := time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+	p := Policy{}
+	assert.True(t, p.Active(now))
+	p.ValidFrom = now
+	assert.True(t, p.Active(now))
+	assert.False(t, p.Active(now.Add(-time.Second)))
+	p.ValidUntil = now.Add(time.Hour)
+	assert.True(t, p.Active(now.Add(59*time.Minute)))
+	assert.False(t, p.Active(now.Add(time.Hour)))
+}
+
+func TestTimeBoundPolicies(t *testing.T) {
+	now := time.Now()
+	config := ServiceConfig{
+		Service: "a",
+		Policies: Policies{
+			Policy{
+				ID:         "expired",
+				Principals: Principals{"userid:maria"},
+				Actions:    []string{"read"},
+				Resources:  []string{"<.*>"},
+				Effect:     "allow",
+				ValidUntil: now.Add(-time.Hour),
+			},
+			Policy{
+				ID:         "temporary",
+				Principals: Principals{"userid:bob"},
+				Actions:    []string{"read"},
+				Resources:  []string{"<.*>"},
+				Effect:     "allow",
+				ValidFrom:  now.Add(-time.Hour),
+				ValidUntil: now.Add(time.Hour),
+			},
+			Policy{
+				ID:         "upcoming",
+				Principals: Principals{"userid:alice"},
+				Actions:    []string{"read"},
+				Resources:  []string{"<.*>"},
+				Effect:     "allow",
+				ValidFrom:  now.Add(time.Hour),
+			},
+		},
+	}
+	assert.Equal(t, []string{"expired", "upcoming"}, config.InactivePolicies(now))
+
+	d := NewDefaultLadon()
+	require.Nil(t, d.LoadPolicies(ServicesConfig{config}))
+	read := func(principal string) *Request {
+		return &Request{Principals: Principals{principal}, Action: "read", Resource: "a"}
+	}
+	assert.False(t, d.IsAllowed("a", read("userid:maria")))
+	assert.True(t, d.IsAllowed("a", read("userid:bob")))
+	assert.False(t, d.IsAllowed("a", read("userid:alice")))
+
+	patterns, err := d.AllowedResources("a", read("userid:maria"))
+	require.Nil(t, err)
+	assert.Equal(t, 0, len(patterns.Allowed))
+	patterns, err = d.AllowedResources("a", read("userid:bob"))
+	require.Nil(t, err)
+	assert.Equal(t, 1, len(patterns.Allowed))
+
+	filter, err := d.PartialEvaluate("a", read("userid:alice"))
+	require.Nil(t, err)
+	assert.Equal(t, 0, len(filter.Allowed))
+	filter, err = d.PartialEvaluate("a", read("userid:bob"))
+	require.Nil(t, err)
+	assert.Equal(t, 1, len(filter.Allowed))
+
+	grants, err := d.WhoCan("a", "read", "a")
+	require.Nil(t, err)
+	assert.Equal(t, []PrincipalGrant{{Principal: "userid:bob", Policy: "temporary"}}, grants.Allowed)
+}
@@ -0,0 +1,78 @@
+// Package echoauth provides the Echo framework middlewares, which protect the
+// Echo routes with the same authentication and policies as the net/http ones.
+package echoauth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/doorman"
+	"github.com/mozilla/doorman/middleware"
+)
+
+// Middleware authenticates the requests for the service of their `Origin`
+// header, like middleware.Middleware.
+func Middleware(v authn.Authenticator, d doorman.Doorman) echo.MiddlewareFunc {
+	return echo.WrapMiddleware(middleware.Middleware(v, d))
+}
+
+// ServiceMiddleware authenticates the requests for the specified service, like
+// middleware.ServiceMiddleware.
+func ServiceMiddleware(v authn.Authenticator, s *doorman.ServiceDoorman) echo.MiddlewareFunc {
+	return echo.WrapMiddleware(middleware.ServiceMiddleware(v, s))
+}
+
+// Authorize rejects with a `403 Forbidden` the requests whose authenticated
+// user is not allowed to perform the action on the resource. The `:name`
+// segments of the resource are replaced by the route parameters (eg.
+// `records/:id`). It must be chained after Middleware or ServiceMiddleware.
+func Authorize(action string, resource string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			r := &doorman.Request{
+				Action:   action,
+				Resource: routeResource(c, resource),
+			}
+			if !middleware.IsAllowed(c.Request(), r) {
+				return echo.NewHTTPError(http.StatusForbidden, echo.Map{
+					"message": fmt.Sprintf("not allowed to %s %s", r.Action, r.Resource),
+					"reason":  "forbidden",
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+// PrincipalsFromContext returns the principals of the authenticated user. It
+// returns false if authentication is disabled for the service.
+func PrincipalsFromContext(c echo.Context) (doorman.Principals, bool) {
+	return middleware.PrincipalsFromContext(c.Request().Context())
+}
+
+// ClaimsFromContext returns the claims of the authenticated user (eg. `email`),
+// or an empty map if authentication is disabled for the service.
+func ClaimsFromContext(c echo.Context) map[string]interface{} {
+	return middleware.ClaimsFromContext(c.Request().Context())
+}
+
+// IsAllowed checks the request on behalf of the authenticated user, like
+// middleware.IsAllowed.
+func IsAllowed(c echo.Context, request *doorman.Request) bool {
+	return middleware.IsAllowed(c.Request(), request)
+}
+
+// routeResource replaces the `:name` segments of the resource by the route parameters.
+func routeResource(c echo.Context, resource string) string {
+	segments := strings.Split(resource, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = c.Param(segment[1:])
+		}
+	}
+	return strings.Join(segments, "/")
+}
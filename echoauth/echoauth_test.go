@@ -0,0 +1,124 @@
+package echoauth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/doorman"
+)
+
+type testAuthenticator struct {
+	userInfo *authn.UserInfo
+}
+
+func (v *testAuthenticator) ValidateRequest(r *http.Request) (*authn.UserInfo, error) {
+	return v.userInfo, nil
+}
+
+func sampleEcho(t *testing.T) (*echo.Echo, *doorman.Principals) {
+	d := doorman.NewDefaultLadon()
+	d.SetAuditOutput(ioutil.Discard)
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://records.corp.com",
+			Claims:  map[string]string{"team": "team:"},
+			Policies: doorman.Policies{
+				{
+					ID:         "1",
+					Principals: []string{"team:ops"},
+					Actions:    []string{"read"},
+					Resources:  []string{"records/42"},
+					Effect:     "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	v := &testAuthenticator{userInfo: &authn.UserInfo{
+		ID:     "ana",
+		Claims: map[string]interface{}{"team": "ops"},
+	}}
+
+	principals := &doorman.Principals{}
+	e := echo.New()
+	e.Use(Middleware(v, d))
+	e.GET("/records/:id", func(c echo.Context) error {
+		*principals, _ = PrincipalsFromContext(c)
+		return c.String(http.StatusOK, ClaimsFromContext(c)["team"].(string))
+	}, Authorize("read", "records/:id"))
+	return e, principals
+}
+
+func TestAuthorize(t *testing.T) {
+	e, principals := sampleEcho(t)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/records/42", nil)
+	r.Header.Set("Origin", "https://records.corp.com")
+	e.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ops", w.Body.String())
+	assert.Equal(t, doorman.Principals{"userid:ana", "team:ops"}, *principals)
+
+	// The resource is built from the route parameters.
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/records/43", nil)
+	r.Header.Set("Origin", "https://records.corp.com")
+	e.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, "not allowed to read records/43", body["message"])
+	assert.Equal(t, "forbidden", body["reason"])
+
+	// Without authentication.
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/records/42", nil)
+	e.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestServiceMiddleware(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	d.SetAuditOutput(ioutil.Discard)
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://records.corp.com",
+			Policies: doorman.Policies{
+				{
+					ID:         "1",
+					Principals: []string{"userid:ana"},
+					Actions:    []string{"delete"},
+					Resources:  []string{"records"},
+					Effect:     "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	v := &testAuthenticator{userInfo: &authn.UserInfo{ID: "ana"}}
+
+	var allowed, denied bool
+	e := echo.New()
+	e.Use(ServiceMiddleware(v, doorman.ForService(d, "https://records.corp.com")))
+	e.DELETE("/records", func(c echo.Context) error {
+		allowed = IsAllowed(c, &doorman.Request{Action: "delete", Resource: "records"})
+		denied = IsAllowed(c, &doorman.Request{Action: "delete", Resource: "reports"})
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("DELETE", "/records", nil)
+	e.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.True(t, allowed)
+	assert.False(t, denied)
+}
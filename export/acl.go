@@ -0,0 +1,298 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// ACL formats.
+const (
+	// ACLFormatS3 is the format of the S3 bucket policies.
+	ACLFormatS3 = "s3"
+	// ACLFormatGCS is the format of the GCS IAM policies.
+	ACLFormatGCS = "gcs"
+)
+
+// ACLMapping specifies how the principals, actions and resources of a service
+// translate into the identities, permissions and resources of a storage.
+type ACLMapping struct {
+	// Service is the service whose permissions are exported.
+	Service string
+	// Format is the ACL format (`s3` or `gcs`).
+	Format string
+	// Name is the name of the uploaded file (default: `acl/{format}.json`).
+	Name string
+	// Principals maps the principals to the storage identities (eg. `group:ops`
+	// to `arn:aws:iam::123456789012:role/ops` or `group:ops@corp.com`).
+	Principals map[string]string
+	// Actions maps the actions to the storage permissions (eg. `read` to
+	// `s3:GetObject` or `roles/storage.objectViewer`).
+	Actions map[string][]string
+	// Resources maps the resources to the storage resources (eg. `reports` to
+	// `arn:aws:s3:::reports/*` or `projects/_/buckets/reports`).
+	Resources map[string]string
+}
+
+// LoadACLMapping reads the mapping from a YAML file.
+func LoadACLMapping(filename string) (*ACLMapping, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read ACL mapping")
+	}
+	mapping := &ACLMapping{}
+	if err := yaml.Unmarshal(content, mapping); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to parse ACL mapping %q", filename))
+	}
+	if mapping.Service == "" {
+		return nil, fmt.Errorf("no service in ACL mapping %q", filename)
+	}
+	if _, err := NewACLEncoder(mapping.Format); err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// Grant is an effective permission, in the storage terms.
+type Grant struct {
+	Principal   string
+	Resource    string
+	Permissions []string
+}
+
+// ACLEncoder writes the grants in an ACL format.
+type ACLEncoder interface {
+	Encode(grants []Grant) ([]byte, error)
+}
+
+// NewACLEncoder returns the encoder of the specified format.
+func NewACLEncoder(format string) (ACLEncoder, error) {
+	switch format {
+	case ACLFormatS3:
+		return &S3BucketPolicyEncoder{}, nil
+	case ACLFormatGCS:
+		return &GCSIAMPolicyEncoder{}, nil
+	}
+	return nil, fmt.Errorf("unknown ACL format %q", format)
+}
+
+// S3BucketPolicyEncoder writes the grants as an S3 bucket policy, with one
+// statement per principal and resource.
+type S3BucketPolicyEncoder struct{}
+
+// Encode returns the bucket policy document.
+func (e *S3BucketPolicyEncoder) Encode(grants []Grant) ([]byte, error) {
+	type statement struct {
+		Sid       string
+		Effect    string
+		Principal map[string]string
+		Action    []string
+		Resource  string
+	}
+	statements := []statement{}
+	for i, grant := range grants {
+		statements = append(statements, statement{
+			Sid:       fmt.Sprintf("doorman%d", i+1),
+			Effect:    "Allow",
+			Principal: map[string]string{"AWS": grant.Principal},
+			Action:    grant.Permissions,
+			Resource:  grant.Resource,
+		})
+	}
+	return json.MarshalIndent(map[string]interface{}{
+		"Version":   "2012-10-17",
+		"Statement": statements,
+	}, "", "  ")
+}
+
+// GCSIAMPolicyEncoder writes the grants as a GCS IAM policy, with one binding
+// per role and resource. The resources are matched with IAM conditions.
+type GCSIAMPolicyEncoder struct{}
+
+// Encode returns the IAM policy document.
+func (e *GCSIAMPolicyEncoder) Encode(grants []Grant) ([]byte, error) {
+	type condition struct {
+		Title      string `json:"title"`
+		Expression string `json:"expression"`
+	}
+	type binding struct {
+		Role      string     `json:"role"`
+		Members   []string   `json:"members"`
+		Condition *condition `json:"condition,omitempty"`
+	}
+	bindings := []*binding{}
+	index := map[string]*binding{}
+	for _, grant := range grants {
+		for _, role := range grant.Permissions {
+			key := role + "\n" + grant.Resource
+			b, ok := index[key]
+			if !ok {
+				b = &binding{Role: role, Members: []string{}}
+				if grant.Resource != "" {
+					b.Condition = &condition{
+						Title:      fmt.Sprintf("doorman %s", grant.Resource),
+						Expression: fmt.Sprintf("resource.name.startsWith(%q)", grant.Resource),
+					}
+				}
+				index[key] = b
+				bindings = append(bindings, b)
+			}
+			b.Members = append(b.Members, grant.Principal)
+		}
+	}
+	return json.MarshalIndent(map[string]interface{}{
+		"version":  3,
+		"bindings": bindings,
+	}, "", "  ")
+}
+
+// ACLExporter materializes the effective permissions of a service into a
+// storage ACL format, and uploads it on an interval. The storage enforces the
+// same permissions as Doorman, which remains the source of truth.
+type ACLExporter struct {
+	// Doorman provides the current configuration of the service.
+	Doorman  doorman.Doorman
+	Mapping  *ACLMapping
+	Uploader Uploader
+	// Prefix is prepended to the file name (eg. `doorman/`).
+	Prefix string
+	// Interval is the delay between uploads (default: 5m).
+	Interval time.Duration
+
+	// checker evaluates the permissions without logging the decisions.
+	checker *doorman.LadonDoorman
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// Grants evaluates every mapped principal, action and resource with the
+// policies of the service. The requests have no context, hence the policies
+// with conditions never grant anything.
+func (e *ACLExporter) Grants() ([]Grant, error) {
+	service := e.Mapping.Service
+	config, ok := e.Doorman.ServiceConfig(service)
+	if !ok {
+		return nil, fmt.Errorf("unknown service %q", service)
+	}
+	if e.checker == nil {
+		e.checker = doorman.NewDefaultLadon()
+		e.checker.SetAuditOutput(ioutil.Discard)
+	}
+	// Skipped if the configuration did not change.
+	if err := e.checker.LoadPolicies(doorman.ServicesConfig{config}); err != nil {
+		return nil, err
+	}
+
+	grants := []Grant{}
+	for _, principal := range sortedKeys(e.Mapping.Principals) {
+		principals := e.checker.ExpandPrincipals(service, doorman.Principals{principal})
+		for _, resource := range sortedKeys(e.Mapping.Resources) {
+			permissions := []string{}
+			for _, action := range sortedKeys(e.Mapping.Actions) {
+				allowed := e.checker.IsAllowed(service, &doorman.Request{
+					Principals: principals,
+					Action:     action,
+					Resource:   resource,
+					Context: doorman.Context{
+						"_service":    service,
+						"_principals": principals,
+					},
+				})
+				if allowed {
+					permissions = append(permissions, e.Mapping.Actions[action]...)
+				}
+			}
+			if len(permissions) > 0 {
+				grants = append(grants, Grant{
+					Principal:   e.Mapping.Principals[principal],
+					Resource:    e.Mapping.Resources[resource],
+					Permissions: permissions,
+				})
+			}
+		}
+	}
+	return grants, nil
+}
+
+// Export computes the grants and uploads the ACL file.
+func (e *ACLExporter) Export() error {
+	encoder, err := NewACLEncoder(e.Mapping.Format)
+	if err != nil {
+		return err
+	}
+	grants, err := e.Grants()
+	if err != nil {
+		log.Errorf("Could not compute the ACL of %q: %s", e.Mapping.Service, err)
+		return err
+	}
+	content, err := encoder.Encode(grants)
+	if err != nil {
+		return err
+	}
+	name := e.Mapping.Name
+	if name == "" {
+		name = fmt.Sprintf("acl/%s.json", e.Mapping.Format)
+	}
+	name = e.Prefix + name
+	if err := e.Uploader.Upload(name, content); err != nil {
+		log.Errorf("Could not upload the ACL of %q to %q: %s", e.Mapping.Service, name, err)
+		return err
+	}
+	log.Debugf("Uploaded %d grants of %q to %q", len(grants), e.Mapping.Service, name)
+	return nil
+}
+
+// Start exports the ACL now and on every interval, until Stop is called.
+func (e *ACLExporter) Start() {
+	interval := e.Interval
+	if interval == 0 {
+		interval = 5 * time.Minute
+	}
+	e.done = make(chan struct{})
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		e.Export()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-e.done:
+				return
+			case <-ticker.C:
+				e.Export()
+			}
+		}
+	}()
+}
+
+// Stop stops the background exports.
+func (e *ACLExporter) Stop() {
+	close(e.done)
+	e.wg.Wait()
+}
+
+func sortedKeys(m interface{}) []string {
+	keys := []string{}
+	switch v := m.(type) {
+	case map[string]string:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case map[string][]string:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,175 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+func sampleACLDoorman(t *testing.T) doorman.Doorman {
+	d := doorman.NewDefaultLadon()
+	d.SetAuditOutput(ioutil.Discard)
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://reports",
+			Tags:    doorman.Tags{"auditors": {"userid:ana"}},
+			Policies: doorman.Policies{
+				{
+					ID:         "1",
+					Principals: []string{"group:ops"},
+					Actions:    []string{"<.*>"},
+					Resources:  []string{"reports"},
+					Effect:     "allow",
+				},
+				{
+					ID:         "2",
+					Principals: []string{"tag:auditors"},
+					Actions:    []string{"read"},
+					Resources:  []string{"<.*>"},
+					Effect:     "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	return d
+}
+
+func sampleACLMapping(format string) *ACLMapping {
+	return &ACLMapping{
+		Service: "https://reports",
+		Format:  format,
+		Principals: map[string]string{
+			"group:ops":  "ops",
+			"userid:ana": "ana",
+			"userid:bob": "bob",
+		},
+		Actions: map[string][]string{
+			"read":  {"get"},
+			"write": {"put", "delete"},
+		},
+		Resources: map[string]string{
+			"reports":  "bucket/reports/*",
+			"invoices": "bucket/invoices/*",
+		},
+	}
+}
+
+func TestLoadACLMapping(t *testing.T) {
+	_, err := LoadACLMapping("unknown.yaml")
+	assert.Contains(t, err.Error(), "failed to read ACL mapping")
+
+	for content, message := range map[string]string{
+		"service: [":          "failed to parse ACL mapping",
+		"format: s3":          "no service in ACL mapping",
+		"service: a\nformat:": `unknown ACL format ""`,
+	} {
+		tmpfile, _ := ioutil.TempFile("", "*.yaml")
+		defer os.Remove(tmpfile.Name())
+		tmpfile.Write([]byte(content))
+		tmpfile.Close()
+		_, err := LoadACLMapping(tmpfile.Name())
+		require.NotNil(t, err)
+		assert.Contains(t, err.Error(), message)
+	}
+
+	tmpfile, _ := ioutil.TempFile("", "*.yaml")
+	defer os.Remove(tmpfile.Name())
+	tmpfile.Write([]byte("service: a\nformat: gcs\nactions:\n  read: [roles/storage.objectViewer]\n"))
+	tmpfile.Close()
+	mapping, err := LoadACLMapping(tmpfile.Name())
+	require.Nil(t, err)
+	assert.Equal(t, []string{"roles/storage.objectViewer"}, mapping.Actions["read"])
+}
+
+func TestACLExporterGrants(t *testing.T) {
+	e := &ACLExporter{Doorman: sampleACLDoorman(t), Mapping: sampleACLMapping(ACLFormatS3)}
+
+	grants, err := e.Grants()
+	require.Nil(t, err)
+	assert.Equal(t, []Grant{
+		{Principal: "ops", Resource: "bucket/reports/*", Permissions: []string{"get", "put", "delete"}},
+		{Principal: "ana", Resource: "bucket/invoices/*", Permissions: []string{"get"}},
+		{Principal: "ana", Resource: "bucket/reports/*", Permissions: []string{"get"}},
+	}, grants)
+
+	e.Mapping.Service = "https://unknown"
+	_, err = e.Grants()
+	assert.Equal(t, `unknown service "https://unknown"`, err.Error())
+}
+
+func TestS3BucketPolicyEncoder(t *testing.T) {
+	content, err := (&S3BucketPolicyEncoder{}).Encode([]Grant{
+		{Principal: "arn:ops", Resource: "arn:reports", Permissions: []string{"s3:GetObject"}},
+	})
+	require.Nil(t, err)
+
+	var policy struct {
+		Version   string
+		Statement []map[string]interface{}
+	}
+	json.Unmarshal(content, &policy)
+	assert.Equal(t, "2012-10-17", policy.Version)
+	require.Len(t, policy.Statement, 1)
+	assert.Equal(t, "Allow", policy.Statement[0]["Effect"])
+	assert.Equal(t, map[string]interface{}{"AWS": "arn:ops"}, policy.Statement[0]["Principal"])
+	assert.Equal(t, []interface{}{"s3:GetObject"}, policy.Statement[0]["Action"])
+	assert.Equal(t, "arn:reports", policy.Statement[0]["Resource"])
+}
+
+func TestGCSIAMPolicyEncoder(t *testing.T) {
+	content, err := (&GCSIAMPolicyEncoder{}).Encode([]Grant{
+		{Principal: "group:ops@corp.com", Resource: "projects/_/buckets/reports", Permissions: []string{"roles/storage.objectViewer"}},
+		{Principal: "user:ana@corp.com", Resource: "projects/_/buckets/reports", Permissions: []string{"roles/storage.objectViewer"}},
+	})
+	require.Nil(t, err)
+
+	var policy struct {
+		Version  int
+		Bindings []struct {
+			Role      string
+			Members   []string
+			Condition map[string]string
+		}
+	}
+	json.Unmarshal(content, &policy)
+	assert.Equal(t, 3, policy.Version)
+	require.Len(t, policy.Bindings, 1)
+	assert.Equal(t, "roles/storage.objectViewer", policy.Bindings[0].Role)
+	assert.Equal(t, []string{"group:ops@corp.com", "user:ana@corp.com"}, policy.Bindings[0].Members)
+	assert.Equal(t, `resource.name.startsWith("projects/_/buckets/reports")`, policy.Bindings[0].Condition["expression"])
+}
+
+func TestACLExporterExport(t *testing.T) {
+	uploader := &memoryUploader{files: map[string][]byte{}}
+	e := &ACLExporter{
+		Doorman:  sampleACLDoorman(t),
+		Mapping:  sampleACLMapping(ACLFormatGCS),
+		Uploader: uploader,
+		Prefix:   "doorman/",
+	}
+
+	err := e.Export()
+	require.Nil(t, err)
+	assert.Contains(t, string(uploader.files["doorman/acl/gcs.json"]), `"role": "put"`)
+
+	e.Mapping.Name = "acl/reports.json"
+	uploader.err = fmt.Errorf("forbidden")
+	err = e.Export()
+	assert.Equal(t, "forbidden", err.Error())
+
+	uploader.err = nil
+	e.Interval = 10 * time.Millisecond
+	e.Start()
+	time.Sleep(30 * time.Millisecond)
+	e.Stop()
+	assert.Equal(t, 2, uploader.count())
+}
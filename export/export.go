@@ -0,0 +1,271 @@
+// Package export is in charge of shipping the authorization decisions records to
+// long-term storages (eg. S3, GCS) for historical analysis.
+//
+// Records are batched in memory and written as files on an interval. The file
+// format is pluggable: gzipped JSON lines and Parquet are supported out of the
+// box, and other formats can be plugged with an Encoder. The batches that fail
+// to upload are retried on the next interval.
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// Encoder writes a batch of decisions records in a file format.
+type Encoder interface {
+	// Extension is the files extension (eg. `parquet`).
+	Extension() string
+	// Encode writes the records.
+	Encode(w io.Writer, decisions []doorman.Decision) error
+}
+
+// Uploader stores the files.
+type Uploader interface {
+	Upload(name string, content []byte) error
+}
+
+// JSONLinesEncoder writes the records as gzipped JSON lines.
+type JSONLinesEncoder struct{}
+
+// Extension returns `jsonl.gz`.
+func (e *JSONLinesEncoder) Extension() string {
+	return "jsonl.gz"
+}
+
+// Encode writes one JSON object per record.
+func (e *JSONLinesEncoder) Encode(w io.Writer, decisions []doorman.Decision) error {
+	gz := gzip.NewWriter(w)
+	encoder := json.NewEncoder(gz)
+	for _, decision := range decisions {
+		if err := encoder.Encode(record{
+			ID:          decision.ID,
+			Time:        decision.Time.UTC().Format(time.RFC3339Nano),
+			Service:     decision.Service,
+			Principals:  decision.Principals,
+			Action:      decision.Action,
+			Resource:    decision.Resource,
+			RemoteIP:    decision.RemoteIP,
+			Allowed:     decision.Allowed,
+			Policies:    decision.Policies,
+			Maintenance: decision.Maintenance,
+		}); err != nil {
+			return err
+		}
+	}
+	return gz.Close()
+}
+
+// Decode reads the records written by Encode. Uncompressed JSON lines are
+// accepted too.
+func (e *JSONLinesEncoder) Decode(r io.Reader) ([]doorman.Decision, error) {
+	buffered := bufio.NewReader(r)
+	var reader io.Reader = buffered
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	decisions := []doorman.Decision{}
+	decoder := json.NewDecoder(reader)
+	for {
+		var rec record
+		if err := decoder.Decode(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid record #%d: %s", len(decisions)+1, err)
+		}
+		decision := doorman.Decision{
+			ID:          rec.ID,
+			Service:     rec.Service,
+			Principals:  rec.Principals,
+			Action:      rec.Action,
+			Resource:    rec.Resource,
+			RemoteIP:    rec.RemoteIP,
+			Allowed:     rec.Allowed,
+			Policies:    rec.Policies,
+			Maintenance: rec.Maintenance,
+		}
+		if rec.Time != "" {
+			t, err := time.Parse(time.RFC3339Nano, rec.Time)
+			if err != nil {
+				return nil, fmt.Errorf("invalid record #%d: %s", len(decisions)+1, err)
+			}
+			decision.Time = t
+		}
+		decisions = append(decisions, decision)
+	}
+	return decisions, nil
+}
+
+// record is the exported representation of a decision.
+type record struct {
+	ID          string   `json:"decision_id"`
+	Time        string   `json:"time"`
+	Service     string   `json:"service"`
+	Principals  []string `json:"principals"`
+	Action      string   `json:"action"`
+	Resource    string   `json:"resource"`
+	RemoteIP    string   `json:"remote_ip"`
+	Allowed     bool     `json:"allowed"`
+	Policies    []string `json:"policies"`
+	Maintenance bool     `json:"maintenance,omitempty"`
+}
+
+// Exporter batches the decisions records and uploads them on an interval. It
+// implements doorman.DecisionRecorder.
+type Exporter struct {
+	Encoder  Encoder
+	Uploader Uploader
+	// Prefix is prepended to the files names (eg. `doorman/`).
+	Prefix string
+	// Interval is the delay between uploads (default: 5m).
+	Interval time.Duration
+	// MaxRecords triggers an upload when reached (default: 100000).
+	MaxRecords int
+	// MaxFailedBatches is the number of batches kept for retry when the uploads
+	// fail (default: 10). The oldest are dropped first.
+	MaxFailedBatches int
+
+	sync.Mutex
+	pending  []doorman.Decision
+	failed   [][]doorman.Decision
+	done     chan struct{}
+	wg       sync.WaitGroup
+	sequence int64
+}
+
+// Record adds the decision to the current batch. The batch is uploaded in
+// background if full.
+func (e *Exporter) Record(decision doorman.Decision) {
+	e.Lock()
+	e.pending = append(e.pending, decision)
+	var batch []doorman.Decision
+	if len(e.pending) >= e.maxRecords() {
+		batch, e.pending = e.pending, nil
+	}
+	e.Unlock()
+	if batch != nil {
+		e.wg.Add(1)
+		go func() {
+			defer e.wg.Done()
+			e.upload(batch)
+		}()
+	}
+}
+
+func (e *Exporter) maxRecords() int {
+	if e.MaxRecords == 0 {
+		return 100000
+	}
+	return e.MaxRecords
+}
+
+// Start uploads the batches in background until Stop is called.
+func (e *Exporter) Start() {
+	interval := e.Interval
+	if interval == 0 {
+		interval = 5 * time.Minute
+	}
+	e.done = make(chan struct{})
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-e.done:
+				return
+			case <-ticker.C:
+				e.Flush()
+			}
+		}
+	}()
+}
+
+// Stop stops the background uploads, and uploads the pending records.
+func (e *Exporter) Stop() error {
+	close(e.done)
+	e.wg.Wait()
+	return e.Flush()
+}
+
+func (e *Exporter) maxFailedBatches() int {
+	if e.MaxFailedBatches == 0 {
+		return 10
+	}
+	return e.MaxFailedBatches
+}
+
+// Flush retries the batches that failed to upload, and uploads the pending
+// records. It returns the first upload error.
+func (e *Exporter) Flush() error {
+	e.Lock()
+	batches := e.failed
+	if len(e.pending) > 0 {
+		batches = append(batches, e.pending)
+	}
+	e.failed, e.pending = nil, nil
+	e.Unlock()
+
+	var err error
+	for _, batch := range batches {
+		if uerr := e.upload(batch); uerr != nil && err == nil {
+			err = uerr
+		}
+	}
+	return err
+}
+
+// requeue keeps the batch that failed to upload for the next flush.
+func (e *Exporter) requeue(batch []doorman.Decision) {
+	e.Lock()
+	defer e.Unlock()
+	e.failed = append(e.failed, batch)
+	if excess := len(e.failed) - e.maxFailedBatches(); excess > 0 {
+		dropped := 0
+		for _, b := range e.failed[:excess] {
+			dropped += len(b)
+		}
+		log.Errorf("Dropped %d decisions that failed to upload", dropped)
+		e.failed = e.failed[excess:]
+	}
+}
+
+func (e *Exporter) upload(batch []doorman.Decision) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := e.Encoder.Encode(&buf, batch); err != nil {
+		log.Errorf("Could not encode %d decisions: %s", len(batch), err)
+		return err
+	}
+	first := batch[0].Time.UTC()
+	sequence := atomic.AddInt64(&e.sequence, 1)
+	name := fmt.Sprintf("%s%s/%s-%d-%d.%s", e.Prefix, first.Format("2006/01/02"),
+		first.Format("150405"), first.UnixNano(), sequence, e.Encoder.Extension())
+	if err := e.Uploader.Upload(name, buf.Bytes()); err != nil {
+		log.Errorf("Could not upload %d decisions to %q, will retry: %s", len(batch), name, err)
+		e.requeue(batch)
+		return err
+	}
+	log.Debugf("Uploaded %d decisions to %q", len(batch), name)
+	return nil
+}
@@ -0,0 +1,270 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+type memoryUploader struct {
+	sync.Mutex
+	files map[string][]byte
+	err   error
+}
+
+func (m *memoryUploader) Upload(name string, content []byte) error {
+	m.Lock()
+	defer m.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.files[name] = content
+	return nil
+}
+
+func (m *memoryUploader) count() int {
+	m.Lock()
+	defer m.Unlock()
+	return len(m.files)
+}
+
+func sampleDecision(allowed bool) doorman.Decision {
+	return doorman.Decision{
+		ID:         "abc",
+		Time:       time.Date(2018, 3, 1, 10, 30, 0, 0, time.UTC),
+		Service:    "https://sample.yaml",
+		Principals: doorman.Principals{"userid:maria"},
+		Action:     "read",
+		Resource:   "pto",
+		Allowed:    allowed,
+		Policies:   []string{"1"},
+	}
+}
+
+func TestJSONLinesEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	err := (&JSONLinesEncoder{}).Encode(&buf, []doorman.Decision{sampleDecision(true), sampleDecision(false)})
+	require.Nil(t, err)
+
+	gz, err := gzip.NewReader(&buf)
+	require.Nil(t, err)
+	content, _ := ioutil.ReadAll(gz)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Equal(t, 2, len(lines))
+	var r record
+	json.Unmarshal([]byte(lines[1]), &r)
+	assert.Equal(t, "abc", r.ID)
+	assert.Equal(t, "2018-03-01T10:30:00Z", r.Time)
+	assert.Equal(t, []string{"userid:maria"}, r.Principals)
+	assert.False(t, r.Allowed)
+}
+
+func TestParquetEncoder(t *testing.T) {
+	encoder := &ParquetEncoder{}
+	assert.Equal(t, "parquet", encoder.Extension())
+
+	var buf bytes.Buffer
+	decision := sampleDecision(true)
+	decision.Policies = nil
+	err := encoder.Encode(&buf, []doorman.Decision{sampleDecision(false), decision})
+	require.Nil(t, err)
+
+	content := buf.Bytes()
+	assert.Equal(t, "PAR1", string(content[:4]))
+	assert.Equal(t, "PAR1", string(content[len(content)-4:]))
+	size := int(binary.LittleEndian.Uint32(content[len(content)-8:]))
+	footer := content[len(content)-8-size : len(content)-8]
+	for _, column := range []string{"decision_id", "time", "principals", "allowed", "policies"} {
+		assert.Contains(t, string(footer), column)
+	}
+
+	// The first page holds the plain encoded decisions IDs.
+	start := bytes.Index(content, []byte{0x1f, 0x8b})
+	require.True(t, start > 0)
+	gz, err := gzip.NewReader(bytes.NewReader(content[start:]))
+	require.Nil(t, err)
+	gz.Multistream(false)
+	page, _ := ioutil.ReadAll(gz)
+	assert.Equal(t, []byte("\x03\x00\x00\x00abc\x03\x00\x00\x00abc"), page)
+}
+
+func TestJSONLinesDecode(t *testing.T) {
+	encoder := &JSONLinesEncoder{}
+	var buf bytes.Buffer
+	err := encoder.Encode(&buf, []doorman.Decision{sampleDecision(true), sampleDecision(false)})
+	require.Nil(t, err)
+
+	decisions, err := encoder.Decode(&buf)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(decisions))
+	assert.Equal(t, sampleDecision(false), decisions[1])
+
+	// Uncompressed.
+	decisions, err = encoder.Decode(strings.NewReader(`{"service": "a", "principals": ["userid:bob"], "allowed": true}`))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(decisions))
+	assert.Equal(t, "a", decisions[0].Service)
+	assert.True(t, decisions[0].Allowed)
+
+	_, err = encoder.Decode(strings.NewReader("{}\n{\"time\": \"yesterday\"}"))
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid record #2")
+}
+
+func TestExporter(t *testing.T) {
+	uploader := &memoryUploader{files: map[string][]byte{}}
+	e := &Exporter{
+		Encoder:    &JSONLinesEncoder{},
+		Uploader:   uploader,
+		Prefix:     "doorman/",
+		Interval:   time.Hour,
+		MaxRecords: 2,
+	}
+	e.Start()
+
+	e.Record(sampleDecision(true))
+	assert.Equal(t, 0, uploader.count())
+	// Full batch is uploaded.
+	e.Record(sampleDecision(false))
+	e.Record(sampleDecision(true))
+
+	err := e.Stop()
+	require.Nil(t, err)
+	assert.Equal(t, 2, uploader.count())
+	for name := range uploader.files {
+		assert.True(t, strings.HasPrefix(name, "doorman/2018/03/01/103000-"), name)
+		assert.True(t, strings.HasSuffix(name, ".jsonl.gz"), name)
+	}
+
+	// Nothing to upload.
+	assert.Nil(t, e.Flush())
+
+	// Upload errors.
+	uploader.err = fmt.Errorf("boom")
+	e.Record(sampleDecision(true))
+	assert.NotNil(t, e.Flush())
+	assert.Equal(t, 2, uploader.count())
+	// The failed batch is retried on the next flush.
+	uploader.err = nil
+	assert.Nil(t, e.Flush())
+	assert.Equal(t, 3, uploader.count())
+}
+
+func TestExporterMaxFailedBatches(t *testing.T) {
+	uploader := &memoryUploader{files: map[string][]byte{}, err: fmt.Errorf("boom")}
+	e := &Exporter{
+		Encoder:          &JSONLinesEncoder{},
+		Uploader:         uploader,
+		MaxFailedBatches: 2,
+	}
+	for i := 0; i < 3; i++ {
+		e.Record(sampleDecision(true))
+		assert.NotNil(t, e.Flush())
+	}
+	// The oldest batch was dropped.
+	assert.Equal(t, 2, len(e.failed))
+
+	uploader.err = nil
+	e.Record(sampleDecision(false))
+	assert.Nil(t, e.Flush())
+	assert.Equal(t, 3, uploader.count())
+	assert.Equal(t, 0, len(e.failed))
+}
+
+func TestExporterInterval(t *testing.T) {
+	uploader := &memoryUploader{files: map[string][]byte{}}
+	e := &Exporter{
+		Encoder:  &JSONLinesEncoder{},
+		Uploader: uploader,
+		Interval: 10 * time.Millisecond,
+	}
+	e.Start()
+	defer e.Stop()
+	e.Record(sampleDecision(true))
+	for i := 0; i < 100 && uploader.count() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 1, uploader.count())
+}
+
+func TestDoormanRecorder(t *testing.T) {
+	uploader := &memoryUploader{files: map[string][]byte{}}
+	e := &Exporter{Encoder: &JSONLinesEncoder{}, Uploader: uploader}
+
+	d := doorman.NewDefaultLadon()
+	d.AddDecisionRecorder(e)
+	d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://sample.yaml",
+			Policies: doorman.Policies{
+				doorman.Policy{
+					ID:         "1",
+					Principals: []string{"userid:maria"},
+					Actions:    []string{"read"},
+					Resources:  []string{"<.*>"},
+					Effect:     "allow",
+				},
+			},
+		},
+	})
+	d.IsAllowed("https://sample.yaml", &doorman.Request{
+		Principals: doorman.Principals{"userid:maria"},
+		Action:     "read",
+		Resource:   "pto",
+		Context: doorman.Context{
+			"_service":    "https://sample.yaml",
+			"_principals": doorman.Principals{"userid:maria"},
+		},
+	})
+	assert.Equal(t, 1, len(e.pending))
+	assert.True(t, e.pending[0].Allowed)
+	assert.Equal(t, "https://sample.yaml", e.pending[0].Service)
+	assert.Equal(t, []string{"1"}, e.pending[0].Policies)
+}
+
+func TestHTTPUploader(t *testing.T) {
+	var received []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bucket/doorman/2018/a b.jsonl.gz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		received, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	u := &HTTPUploader{
+		Method: "PUT",
+		URL: func(name string) string {
+			return ts.URL + "/bucket/" + escapePath(name)
+		},
+	}
+	err := u.Upload("doorman/2018/a b.jsonl.gz", []byte("abc"))
+	require.Nil(t, err)
+	assert.Equal(t, "abc", string(received))
+
+	err = u.Upload("other", []byte("abc"))
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "status 404")
+}
+
+func TestBucketsUploaders(t *testing.T) {
+	s3 := NewS3Uploader("logs", "eu-west-1")
+	assert.Equal(t, "https://logs.s3.eu-west-1.amazonaws.com/doorman/a%20b", s3.URL("doorman/a b"))
+	gcs := NewGCSUploader("logs")
+	assert.Equal(t, "https://storage.googleapis.com/upload/storage/v1/b/logs/o?uploadType=media&name=doorman%2Fa+b", gcs.URL("doorman/a b"))
+}
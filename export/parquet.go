@@ -0,0 +1,337 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// Parquet physical types, repetitions, converted types, encodings and codecs
+// (see https://github.com/apache/parquet-format/blob/master/src/main/thrift/parquet.thrift).
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetRepeated = 2
+
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetGzip = 2
+
+	parquetDataPage = 0
+)
+
+// ParquetEncoder writes the records as a Parquet file, with a single row group
+// and one gzipped data page per column. The principals and policies are
+// repeated columns.
+type ParquetEncoder struct{}
+
+// Extension returns `parquet`.
+func (e *ParquetEncoder) Extension() string {
+	return "parquet"
+}
+
+// parquetColumn is a column of the records, with its values and levels.
+type parquetColumn struct {
+	name      string
+	kind      int
+	converted int
+	repeated  bool
+	values    []interface{}
+	// levels are the repetition and definition levels of the repeated columns.
+	repetitions []int
+	definitions []int
+}
+
+func (c *parquetColumn) add(value interface{}) {
+	c.values = append(c.values, value)
+}
+
+func (c *parquetColumn) addList(values []string) {
+	if len(values) == 0 {
+		c.repetitions = append(c.repetitions, 0)
+		c.definitions = append(c.definitions, 0)
+		return
+	}
+	for i, value := range values {
+		repetition := 1
+		if i == 0 {
+			repetition = 0
+		}
+		c.repetitions = append(c.repetitions, repetition)
+		c.definitions = append(c.definitions, 1)
+		c.values = append(c.values, value)
+	}
+}
+
+// numValues returns the number of values of the column, including the empty lists.
+func (c *parquetColumn) numValues() int {
+	if c.repeated {
+		return len(c.definitions)
+	}
+	return len(c.values)
+}
+
+// page returns the uncompressed data page: the levels of the repeated columns
+// followed by the plain encoded values.
+func (c *parquetColumn) page() []byte {
+	var buf bytes.Buffer
+	if c.repeated {
+		writeLevels(&buf, c.repetitions)
+		writeLevels(&buf, c.definitions)
+	}
+	if c.kind == parquetBoolean {
+		bits := make([]byte, (len(c.values)+7)/8)
+		for i, value := range c.values {
+			if value.(bool) {
+				bits[i/8] |= 1 << uint(i%8)
+			}
+		}
+		buf.Write(bits)
+		return buf.Bytes()
+	}
+	for _, value := range c.values {
+		switch v := value.(type) {
+		case int64:
+			binary.Write(&buf, binary.LittleEndian, v)
+		case string:
+			binary.Write(&buf, binary.LittleEndian, uint32(len(v)))
+			buf.WriteString(v)
+		}
+	}
+	return buf.Bytes()
+}
+
+// writeLevels writes the levels (0 or 1) with the RLE encoding, prefixed by their length.
+func writeLevels(w *bytes.Buffer, levels []int) {
+	var runs bytes.Buffer
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		writeUvarint(&runs, uint64(j-i)<<1)
+		runs.WriteByte(byte(levels[i]))
+		i = j
+	}
+	binary.Write(w, binary.LittleEndian, uint32(runs.Len()))
+	w.Write(runs.Bytes())
+}
+
+// Encode writes the records in the Parquet format.
+func (e *ParquetEncoder) Encode(w io.Writer, decisions []doorman.Decision) error {
+	columns := []*parquetColumn{
+		{name: "decision_id", kind: parquetByteArray, converted: parquetUTF8},
+		{name: "time", kind: parquetInt64, converted: parquetTimestampMicros},
+		{name: "service", kind: parquetByteArray, converted: parquetUTF8},
+		{name: "principals", kind: parquetByteArray, converted: parquetUTF8, repeated: true},
+		{name: "action", kind: parquetByteArray, converted: parquetUTF8},
+		{name: "resource", kind: parquetByteArray, converted: parquetUTF8},
+		{name: "remote_ip", kind: parquetByteArray, converted: parquetUTF8},
+		{name: "allowed", kind: parquetBoolean, converted: -1},
+		{name: "policies", kind: parquetByteArray, converted: parquetUTF8, repeated: true},
+		{name: "maintenance", kind: parquetBoolean, converted: -1},
+	}
+	for _, decision := range decisions {
+		columns[0].add(decision.ID)
+		columns[1].add(decision.Time.UnixNano() / 1000)
+		columns[2].add(decision.Service)
+		columns[3].addList(decision.Principals)
+		columns[4].add(decision.Action)
+		columns[5].add(decision.Resource)
+		columns[6].add(decision.RemoteIP)
+		columns[7].add(decision.Allowed)
+		columns[8].addList(decision.Policies)
+		columns[9].add(decision.Maintenance)
+	}
+
+	var file bytes.Buffer
+	file.WriteString("PAR1")
+	chunks := []func(t *thriftWriter){}
+	var totalSize int64
+	for _, column := range columns {
+		page := column.page()
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		gz.Write(page)
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		header := &thriftWriter{}
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(page)))
+		header.i32(3, int32(compressed.Len()))
+		header.structure(5, func(t *thriftWriter) {
+			t.i32(1, int32(column.numValues()))
+			t.i32(2, parquetPlain)
+			t.i32(3, parquetRLE)
+			t.i32(4, parquetRLE)
+		})
+		header.stop()
+
+		offset := int64(file.Len())
+		file.Write(header.Bytes())
+		file.Write(compressed.Bytes())
+		size := int64(header.Len() + len(page))
+		compressedSize := int64(header.Len() + compressed.Len())
+		totalSize += size
+
+		column := column
+		chunks = append(chunks, func(t *thriftWriter) {
+			t.i64(2, offset)
+			t.structure(3, func(t *thriftWriter) {
+				t.i32(1, int32(column.kind))
+				t.list(2, thriftI32, 2, func(t *thriftWriter) {
+					t.varint(parquetPlain)
+					t.varint(parquetRLE)
+				})
+				t.list(3, thriftBinary, 1, func(t *thriftWriter) {
+					t.text(column.name)
+				})
+				t.i32(4, parquetGzip)
+				t.i64(5, int64(column.numValues()))
+				t.i64(6, size)
+				t.i64(7, compressedSize)
+				t.i64(9, offset)
+			})
+		})
+	}
+
+	footer := &thriftWriter{}
+	footer.i32(1, 1)
+	footer.list(2, thriftStruct, len(columns)+1, func(t *thriftWriter) {
+		t.element(func(t *thriftWriter) {
+			t.binary(4, "decision")
+			t.i32(5, int32(len(columns)))
+		})
+		for _, column := range columns {
+			column := column
+			t.element(func(t *thriftWriter) {
+				t.i32(1, int32(column.kind))
+				repetition := parquetRequired
+				if column.repeated {
+					repetition = parquetRepeated
+				}
+				t.i32(3, int32(repetition))
+				t.binary(4, column.name)
+				if column.converted >= 0 {
+					t.i32(6, int32(column.converted))
+				}
+			})
+		}
+	})
+	footer.i64(3, int64(len(decisions)))
+	footer.list(4, thriftStruct, 1, func(t *thriftWriter) {
+		t.element(func(t *thriftWriter) {
+			t.list(1, thriftStruct, len(chunks), func(t *thriftWriter) {
+				for _, chunk := range chunks {
+					t.element(chunk)
+				}
+			})
+			t.i64(2, totalSize)
+			t.i64(3, int64(len(decisions)))
+		})
+	})
+	footer.binary(6, "doorman")
+	footer.stop()
+
+	file.Write(footer.Bytes())
+	binary.Write(&file, binary.LittleEndian, uint32(footer.Len()))
+	file.WriteString("PAR1")
+	_, err := w.Write(file.Bytes())
+	return err
+}
+
+// Thrift compact protocol types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter writes the Parquet metadata with the Thrift compact protocol.
+type thriftWriter struct {
+	bytes.Buffer
+	lastField int
+}
+
+func (t *thriftWriter) field(id int, kind byte) {
+	if delta := id - t.lastField; delta > 0 && delta <= 15 {
+		t.WriteByte(byte(delta<<4) | kind)
+	} else {
+		t.WriteByte(kind)
+		t.varint(int64(id))
+	}
+	t.lastField = id
+}
+
+func (t *thriftWriter) varint(v int64) {
+	// Zigzag encoding.
+	writeUvarint(&t.Buffer, uint64((v<<1)^(v>>63)))
+}
+
+func (t *thriftWriter) text(s string) {
+	writeUvarint(&t.Buffer, uint64(len(s)))
+	t.WriteString(s)
+}
+
+func (t *thriftWriter) i32(id int, v int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) i64(id int, v int64) {
+	t.field(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftWriter) binary(id int, s string) {
+	t.field(id, thriftBinary)
+	t.text(s)
+}
+
+func (t *thriftWriter) structure(id int, fields func(t *thriftWriter)) {
+	t.field(id, thriftStruct)
+	t.element(fields)
+}
+
+// element writes a nested struct, which has its own fields ids.
+func (t *thriftWriter) element(fields func(t *thriftWriter)) {
+	last := t.lastField
+	t.lastField = 0
+	fields(t)
+	t.stop()
+	t.lastField = last
+}
+
+func (t *thriftWriter) list(id int, kind byte, size int, elements func(t *thriftWriter)) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.WriteByte(byte(size<<4) | kind)
+	} else {
+		t.WriteByte(0xf0 | kind)
+		writeUvarint(&t.Buffer, uint64(size))
+	}
+	elements(t)
+}
+
+func (t *thriftWriter) stop() {
+	t.WriteByte(0)
+}
+
+func writeUvarint(w *bytes.Buffer, v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	w.Write(buf[:n])
+}
@@ -0,0 +1,79 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mozilla/doorman/config"
+)
+
+// HTTPUploader sends the files with HTTP requests.
+type HTTPUploader struct {
+	// Method is the HTTP method (eg. `PUT`).
+	Method string
+	// URL returns the destination URL of the file.
+	URL func(name string) string
+	// Auth authenticates the requests (optional).
+	Auth config.FetchAuthenticator
+}
+
+// Upload sends the file content.
+func (h *HTTPUploader) Upload(name string, content []byte) error {
+	uri := h.URL(name)
+	req, err := http.NewRequest(h.Method, uri, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if h.Auth != nil {
+		if err := h.Auth.Authenticate(req); err != nil {
+			return err
+		}
+	}
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("could not upload to %q (status %d)", uri, response.StatusCode)
+	}
+	return nil
+}
+
+// escapePath escapes the segments of the file name.
+func escapePath(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// NewS3Uploader returns an uploader to the S3 bucket, authenticated with the AWS
+// credentials from environment.
+func NewS3Uploader(bucket string, region string) *HTTPUploader {
+	return &HTTPUploader{
+		Method: "PUT",
+		URL: func(name string) string {
+			return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, escapePath(name))
+		},
+		Auth: &config.AWSSigV4Auth{Region: region, Service: "s3"},
+	}
+}
+
+// NewGCSUploader returns an uploader to the GCS bucket, authenticated with the
+// default service account.
+func NewGCSUploader(bucket string) *HTTPUploader {
+	return &HTTPUploader{
+		Method: "POST",
+		URL: func(name string) string {
+			return fmt.Sprintf("https://storage.googleapis.com/upload/storage/v1/b/%s/o?uploadType=media&name=%s",
+				url.PathEscape(bucket), url.QueryEscape(name))
+		},
+		Auth: &config.GCPMetadataAuth{},
+	}
+}
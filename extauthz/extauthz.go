@@ -0,0 +1,176 @@
+// Package extauthz implements the Envoy external authorization gRPC service, so
+// that the Envoy or Istio sidecars delegate the authorization to Doorman.
+package extauthz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/doorman"
+)
+
+// DefaultPrincipalsHeader is the header of the allowed requests with the caller
+// expanded principals, forwarded to the upstream service.
+const DefaultPrincipalsHeader = "X-Doorman-Principals"
+
+// Server implements the `envoy.service.auth.v3.Authorization` service. The
+// checked requests action is the lower-cased HTTP method (eg. `get`), and the
+// resource is the path without query string (eg. `/reports/42`).
+type Server struct {
+	Doorman doorman.Doorman
+	// Service is the audience of the checked requests. If empty, the scheme and
+	// host of the requests are used (eg. `https://api.service.org`).
+	Service string
+	// PrincipalsHeader is set with the principals of the allowed requests,
+	// separated with commas (default: `X-Doorman-Principals`).
+	PrincipalsHeader string
+	// Identities are the settings of the callers identity building (eg. maximum
+	// number of groups, principals builder), like with the HTTP middleware.
+	Identities doorman.IdentitySettings
+}
+
+// NewServer returns an authorization service relying on the specified Doorman.
+func NewServer(d doorman.Doorman) *Server {
+	return &Server{
+		Doorman:          d,
+		PrincipalsHeader: DefaultPrincipalsHeader,
+	}
+}
+
+// Register registers the authorization service on the gRPC server.
+func (s *Server) Register(server *grpc.Server) {
+	authv3.RegisterAuthorizationServer(server, s)
+}
+
+// Check authenticates the request with the authenticator of its service, and
+// checks the policies. The denied requests get a `401` or `403` response.
+func (s *Server) Check(ctx context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	attributes := req.GetAttributes().GetRequest().GetHttp()
+	if attributes == nil {
+		return nil, fmt.Errorf("missing HTTP request attributes")
+	}
+	service := s.service(attributes)
+	config, ok := s.Doorman.ServiceConfig(service)
+	if !ok {
+		return denied(code.Code_UNAUTHENTICATED, http.StatusUnauthorized, fmt.Sprintf("Unknown service %q", service)), nil
+	}
+	sd := doorman.ForService(s.Doorman, service)
+	httpReq := httpRequest(attributes, service)
+
+	// No authenticator configured for this service: the requests have no principals.
+	var userInfo *authn.UserInfo
+	authenticator, _ := sd.Authenticator()
+	if authenticator != nil {
+		var err error
+		userInfo, err = authenticator.ValidateRequest(httpReq)
+		if err != nil {
+			return denied(code.Code_UNAUTHENTICATED, http.StatusUnauthorized, err.Error()), nil
+		}
+		if unmet := config.UnmetClaims(userInfo.Claims); len(unmet) > 0 {
+			message := fmt.Sprintf("missing required claims: %s", strings.Join(unmet, ", "))
+			return denied(code.Code_PERMISSION_DENIED, http.StatusForbidden, message), nil
+		}
+	}
+	identity, err := s.Identities.Identity(httpReq, service, config, userInfo)
+	if err != nil {
+		return denied(code.Code_UNAUTHENTICATED, http.StatusUnauthorized, err.Error()), nil
+	}
+
+	remoteIP := req.GetAttributes().GetSource().GetAddress().GetSocketAddress().GetAddress()
+	request := &doorman.Request{
+		Action:   strings.ToLower(attributes.GetMethod()),
+		Resource: resourcePath(attributes.GetPath()),
+		// The body is sent by Envoy if `with_request_body` is configured.
+		Context: doorman.BodyContext([]byte(attributes.GetBody()), config.BodyFields),
+	}
+	// Envoy already honors its own `X-Forwarded-For` settings for the source address.
+	request.Context.SetTransport(service, remoteIP, remoteIP)
+	r := sd.RequestAs(identity, request)
+
+	if !sd.IsAllowed(r) {
+		log.Debugf("Request %s %s on %q denied", r.Action, r.Resource, service)
+		return denied(code.Code_PERMISSION_DENIED, http.StatusForbidden, "Forbidden"), nil
+	}
+
+	header := s.PrincipalsHeader
+	if header == "" {
+		header = DefaultPrincipalsHeader
+	}
+	return &authv3.CheckResponse{
+		Status: &status.Status{Code: int32(code.Code_OK)},
+		HttpResponse: &authv3.CheckResponse_OkResponse{
+			OkResponse: &authv3.OkHttpResponse{
+				Headers: []*corev3.HeaderValueOption{
+					{Header: &corev3.HeaderValue{Key: header, Value: strings.Join(r.Principals, ",")}},
+				},
+			},
+		},
+	}, nil
+}
+
+// service returns the audience of the request.
+func (s *Server) service(attributes *authv3.AttributeContext_HttpRequest) string {
+	if s.Service != "" {
+		return s.Service
+	}
+	scheme := attributes.GetScheme()
+	if scheme == "" {
+		scheme = "https"
+	}
+	audience := scheme + "://" + attributes.GetHost()
+	if normalized, err := authn.NormalizeAudience(audience); err == nil {
+		return normalized
+	}
+	return audience
+}
+
+// httpRequest builds the HTTP request validated by the authenticators, with
+// the headers of the checked request and the service as `Origin` header.
+func httpRequest(attributes *authv3.AttributeContext_HttpRequest, service string) *http.Request {
+	r, _ := http.NewRequest(attributes.GetMethod(), "/", nil)
+	for name, value := range attributes.GetHeaders() {
+		// Envoy pseudo-headers (eg. `:authority`) are not HTTP headers.
+		if !strings.HasPrefix(name, ":") {
+			r.Header.Set(name, value)
+		}
+	}
+	r.Header.Set("Origin", service)
+	return r
+}
+
+// resourcePath returns the path without its query string.
+func resourcePath(path string) string {
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
+
+// denied returns the response of a denied request, with a JSON body.
+func denied(c code.Code, httpStatus int, message string) *authv3.CheckResponse {
+	body, _ := json.Marshal(map[string]string{"message": message})
+	return &authv3.CheckResponse{
+		Status: &status.Status{Code: int32(c), Message: message},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{
+			DeniedResponse: &authv3.DeniedHttpResponse{
+				Status: &typev3.HttpStatus{Code: typev3.StatusCode(httpStatus)},
+				Headers: []*corev3.HeaderValueOption{
+					{Header: &corev3.HeaderValue{Key: "Content-Type", Value: "application/json"}},
+				},
+				Body: string(body),
+			},
+		},
+	}
+}
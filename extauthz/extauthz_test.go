@@ -0,0 +1,182 @@
+package extauthz
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/doorman"
+)
+
+type testAuthenticator struct{}
+
+func (v *testAuthenticator) ValidateRequest(r *http.Request) (*authn.UserInfo, error) {
+	if r.Header.Get("Origin") != "https://api.corp.com" {
+		return nil, fmt.Errorf("invalid audience")
+	}
+	switch r.Header.Get("Authorization") {
+	case "Bearer ana":
+		return &authn.UserInfo{ID: "ana"}, nil
+	case "Bearer bob":
+		return &authn.UserInfo{ID: "bob"}, nil
+	}
+	return nil, fmt.Errorf("invalid token")
+}
+
+func sampleDoorman(t *testing.T) doorman.Doorman {
+	d := doorman.NewDefaultLadon()
+	d.SetAuditOutput(ioutil.Discard)
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://api.corp.com",
+			Tags:    doorman.Tags{"admins": {"userid:ana"}},
+			Policies: doorman.Policies{
+				{
+					ID:         "1",
+					Principals: []string{"tag:admins"},
+					Actions:    []string{"delete"},
+					Resources:  []string{"/reports/<.*>"},
+					Effect:     "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	d.SetAuthenticator("https://api.corp.com", &testAuthenticator{})
+	return d
+}
+
+func checkRequest(host string, method string, path string, token string) *authv3.CheckRequest {
+	return &authv3.CheckRequest{
+		Attributes: &authv3.AttributeContext{
+			Request: &authv3.AttributeContext_Request{
+				Http: &authv3.AttributeContext_HttpRequest{
+					Scheme:  "https",
+					Host:    host,
+					Method:  method,
+					Path:    path,
+					Headers: map[string]string{"authorization": "Bearer " + token, ":authority": host},
+				},
+			},
+		},
+	}
+}
+
+func TestCheckAllowed(t *testing.T) {
+	s := NewServer(sampleDoorman(t))
+
+	resp, err := s.Check(context.Background(), checkRequest("API.corp.com:443", "DELETE", "/reports/42?force=1", "ana"))
+	require.Nil(t, err)
+	assert.Equal(t, int32(code.Code_OK), resp.Status.Code)
+	headers := resp.GetOkResponse().GetHeaders()
+	require.Len(t, headers, 1)
+	assert.Equal(t, "X-Doorman-Principals", headers[0].Header.Key)
+	assert.Equal(t, "userid:ana,tag:admins", headers[0].Header.Value)
+}
+
+func TestCheckDenied(t *testing.T) {
+	s := NewServer(sampleDoorman(t))
+
+	for _, test := range []struct {
+		req     *authv3.CheckRequest
+		code    code.Code
+		status  typev3.StatusCode
+		message string
+	}{
+		{checkRequest("unknown.corp.com", "GET", "/", "ana"), code.Code_UNAUTHENTICATED, typev3.StatusCode_Unauthorized, `Unknown service "https://unknown.corp.com"`},
+		{checkRequest("api.corp.com", "DELETE", "/reports/42", "unknown"), code.Code_UNAUTHENTICATED, typev3.StatusCode_Unauthorized, "invalid token"},
+		{checkRequest("api.corp.com", "DELETE", "/reports/42", "bob"), code.Code_PERMISSION_DENIED, typev3.StatusCode_Forbidden, "Forbidden"},
+		{checkRequest("api.corp.com", "GET", "/reports/42", "ana"), code.Code_PERMISSION_DENIED, typev3.StatusCode_Forbidden, "Forbidden"},
+	} {
+		resp, err := s.Check(context.Background(), test.req)
+		require.Nil(t, err)
+		assert.Equal(t, int32(test.code), resp.Status.Code)
+		assert.Equal(t, test.message, resp.Status.Message)
+		assert.Equal(t, test.status, resp.GetDeniedResponse().GetStatus().GetCode())
+		assert.Equal(t, fmt.Sprintf(`{"message":%q}`, test.message), resp.GetDeniedResponse().GetBody())
+	}
+
+	_, err := s.Check(context.Background(), &authv3.CheckRequest{})
+	assert.NotNil(t, err)
+}
+
+func TestCheckService(t *testing.T) {
+	s := NewServer(sampleDoorman(t))
+	s.Service = "https://api.corp.com"
+	s.PrincipalsHeader = "X-Principals"
+
+	resp, err := s.Check(context.Background(), checkRequest("10.0.0.1:8080", "DELETE", "/reports/42", "ana"))
+	require.Nil(t, err)
+	assert.Equal(t, int32(code.Code_OK), resp.Status.Code)
+	assert.Equal(t, "X-Principals", resp.GetOkResponse().GetHeaders()[0].Header.Key)
+}
+
+func TestCheckIdentities(t *testing.T) {
+	s := NewServer(sampleDoorman(t))
+	s.Identities.PrincipalsBuilder = doorman.PrincipalsBuilderFunc(func(r *http.Request, service string, userInfo *authn.UserInfo, principals doorman.Principals) (doorman.Principals, error) {
+		if userInfo.ID == "bob" {
+			return append(principals, "userid:ana"), nil
+		}
+		return principals, nil
+	})
+
+	// The admins policy requires the principal added by the builder.
+	resp, err := s.Check(context.Background(), checkRequest("api.corp.com", "DELETE", "/reports/42", "bob"))
+	require.Nil(t, err)
+	assert.Equal(t, int32(code.Code_OK), resp.Status.Code)
+	assert.Equal(t, "userid:bob,userid:ana,tag:admins", resp.GetOkResponse().GetHeaders()[0].Header.Value)
+
+	s.Identities.PrincipalsBuilder = doorman.PrincipalsBuilderFunc(func(r *http.Request, service string, userInfo *authn.UserInfo, principals doorman.Principals) (doorman.Principals, error) {
+		return nil, fmt.Errorf("unknown legacy user")
+	})
+	resp, err = s.Check(context.Background(), checkRequest("api.corp.com", "DELETE", "/reports/42", "ana"))
+	require.Nil(t, err)
+	assert.Equal(t, int32(code.Code_UNAUTHENTICATED), resp.Status.Code)
+	assert.Equal(t, "unknown legacy user", resp.Status.Message)
+}
+
+func TestCheckBodyFields(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	d.SetAuditOutput(ioutil.Discard)
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service:    "https://api.corp.com",
+			BodyFields: map[string]string{"$.report.owner": "owner"},
+			Policies: doorman.Policies{
+				{
+					ID:         "1",
+					Principals: []string{"userid:<.*>"},
+					Actions:    []string{"put"},
+					Resources:  []string{"/reports/<.*>"},
+					Conditions: doorman.Conditions{
+						"owner": doorman.Condition{Type: "MatchPrincipalsCondition"},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	d.SetAuthenticator("https://api.corp.com", &testAuthenticator{})
+	s := NewServer(d)
+
+	req := checkRequest("api.corp.com", "PUT", "/reports/42", "ana")
+	req.Attributes.Request.Http.Body = `{"report": {"owner": "userid:ana"}}`
+	resp, err := s.Check(context.Background(), req)
+	require.Nil(t, err)
+	assert.Equal(t, int32(code.Code_OK), resp.Status.Code)
+
+	req.Attributes.Request.Http.Body = `{"report": {"owner": "userid:bob"}}`
+	resp, err = s.Check(context.Background(), req)
+	require.Nil(t, err)
+	assert.Equal(t, int32(code.Code_PERMISSION_DENIED), resp.Status.Code)
+}
@@ -0,0 +1,158 @@
+// Package grpcauth provides gRPC server interceptors, which protect the gRPC
+// services with the same authentication and policies as the HTTP ones.
+package grpcauth
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/doorman"
+)
+
+// CallAction is the action of the authorization requests of the gRPC calls. The
+// resource is the full method name (eg. `/reports.Reports/Delete`).
+const CallAction = "call"
+
+// Identities are the settings of the callers identity building (eg. maximum
+// number of groups, principals builder), like with the HTTP middleware.
+var Identities = doorman.IdentitySettings{}
+
+type contextKey string
+
+const (
+	userInfoContextKey   contextKey = "userInfo"
+	principalsContextKey contextKey = "principals"
+)
+
+// UnaryServerInterceptor authenticates the unary calls for the service, and
+// checks that the caller is allowed to call the method.
+func UnaryServerInterceptor(s *doorman.ServiceDoorman) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authorize(ctx, s, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor authenticates the streaming calls for the service, and
+// checks that the caller is allowed to call the method.
+func StreamServerInterceptor(s *doorman.ServiceDoorman) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(ss.Context(), s, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// PrincipalsFromContext returns the principals of the caller, as checked against
+// the policies (ie. expanded with the service tags and the request roles).
+func PrincipalsFromContext(ctx context.Context) (doorman.Principals, bool) {
+	principals, ok := ctx.Value(principalsContextKey).(doorman.Principals)
+	return principals, ok
+}
+
+// UserInfoFromContext returns the user info of the authenticated caller, with
+// all its claims.
+func UserInfoFromContext(ctx context.Context) (*authn.UserInfo, bool) {
+	userInfo, ok := ctx.Value(userInfoContextKey).(*authn.UserInfo)
+	return userInfo, ok && userInfo != nil
+}
+
+// authorize authenticates the call and checks the policies of the service. It
+// returns the context with the caller user info and the checked principals.
+// Like with the HTTP API, a service without authenticator is called without
+// principals, and only its policies decide.
+func authorize(ctx context.Context, s *doorman.ServiceDoorman, method string) (context.Context, error) {
+	config, ok := s.Doorman.ServiceConfig(s.Service)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "unknown service %q", s.Service)
+	}
+	r := requestFromContext(ctx, s.Service)
+
+	var userInfo *authn.UserInfo
+	authenticator, _ := s.Authenticator()
+	if authenticator != nil {
+		var err error
+		userInfo, err = authenticator.ValidateRequest(r)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if unmet := config.UnmetClaims(userInfo.Claims); len(unmet) > 0 {
+			return nil, status.Errorf(codes.PermissionDenied, "missing required claims: %s", strings.Join(unmet, ", "))
+		}
+	}
+	identity, err := Identities.Identity(r, s.Service, config, userInfo)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+	request := &doorman.Request{Action: CallAction, Resource: method, Context: doorman.Context{}}
+	// The gRPC calls carry no forwarding headers, the peer is the client.
+	request.Context.SetTransport(s.Service, remoteIP, remoteIP)
+	checked := s.RequestAs(identity, request)
+	if !s.IsAllowed(checked) {
+		return nil, status.Errorf(codes.PermissionDenied, "not allowed to call %s", method)
+	}
+
+	ctx = context.WithValue(ctx, userInfoContextKey, identity.UserInfo)
+	ctx = context.WithValue(ctx, principalsContextKey, checked.Principals)
+	return ctx, nil
+}
+
+// requestFromContext builds the HTTP request validated by the authenticators,
+// with the metadata as headers, the peer address and TLS state, and the service
+// as `Origin` header.
+func requestFromContext(ctx context.Context, service string) *http.Request {
+	r, _ := http.NewRequest("POST", "/", nil)
+	r = r.WithContext(ctx)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for key, values := range md {
+			// gRPC pseudo-headers (eg. `:authority`) are not HTTP headers.
+			if strings.HasPrefix(key, ":") {
+				continue
+			}
+			for _, value := range values {
+				r.Header.Add(key, value)
+			}
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if p.Addr != nil {
+			r.RemoteAddr = p.Addr.String()
+		}
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			state := tlsInfo.State
+			r.TLS = &state
+		}
+	}
+	r.Header.Set("Origin", service)
+	return r
+}
+
+// serverStream overrides the context of the wrapped stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
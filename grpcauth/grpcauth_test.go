@@ -0,0 +1,220 @@
+package grpcauth
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/doorman"
+)
+
+type testAuthenticator struct{}
+
+func (v *testAuthenticator) ValidateRequest(r *http.Request) (*authn.UserInfo, error) {
+	if r.Header.Get("Origin") != "https://reports.corp.com" {
+		return nil, fmt.Errorf("invalid audience")
+	}
+	switch r.Header.Get("Authorization") {
+	case "Bearer ana":
+		return &authn.UserInfo{ID: "ana", Claims: map[string]interface{}{"email_verified": true}}, nil
+	case "Bearer bob":
+		return &authn.UserInfo{ID: "bob", Claims: map[string]interface{}{"email_verified": true}}, nil
+	case "Bearer unverified":
+		return &authn.UserInfo{ID: "ana"}, nil
+	}
+	return nil, fmt.Errorf("invalid token")
+}
+
+func sampleServiceDoorman(t *testing.T) *doorman.ServiceDoorman {
+	d := doorman.NewDefaultLadon()
+	d.SetAuditOutput(ioutil.Discard)
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service:        "https://reports.corp.com",
+			RequiredClaims: map[string]interface{}{"email_verified": true},
+			Policies: doorman.Policies{
+				{
+					ID:         "1",
+					Principals: []string{"userid:ana"},
+					Actions:    []string{"call"},
+					Resources:  []string{"/reports.Reports/<.*>"},
+					Effect:     "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	d.SetAuthenticator("https://reports.corp.com", &testAuthenticator{})
+	return doorman.ForService(d, "https://reports.corp.com")
+}
+
+func incomingContext(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor(sampleServiceDoorman(t))
+	info := &grpc.UnaryServerInfo{FullMethod: "/reports.Reports/Delete"}
+
+	var principals doorman.Principals
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		principals, _ = PrincipalsFromContext(ctx)
+		return "deleted", nil
+	}
+
+	resp, err := interceptor(incomingContext("ana"), nil, info, handler)
+	require.Nil(t, err)
+	assert.Equal(t, "deleted", resp)
+	assert.Equal(t, doorman.Principals{"userid:ana"}, principals)
+
+	for _, test := range []struct {
+		ctx     context.Context
+		method  string
+		code    codes.Code
+		message string
+	}{
+		{context.Background(), "/reports.Reports/Delete", codes.Unauthenticated, "invalid token"},
+		{incomingContext("unknown"), "/reports.Reports/Delete", codes.Unauthenticated, "invalid token"},
+		{incomingContext("unverified"), "/reports.Reports/Delete", codes.PermissionDenied, "missing required claims: email_verified"},
+		{incomingContext("bob"), "/reports.Reports/Delete", codes.PermissionDenied, "not allowed to call /reports.Reports/Delete"},
+		{incomingContext("ana"), "/invoices.Invoices/List", codes.PermissionDenied, "not allowed to call /invoices.Invoices/List"},
+	} {
+		_, err := interceptor(test.ctx, nil, &grpc.UnaryServerInfo{FullMethod: test.method}, handler)
+		require.NotNil(t, err)
+		assert.Equal(t, test.code, status.Code(err))
+		assert.Equal(t, test.message, status.Convert(err).Message())
+	}
+
+	// Unknown service.
+	s := sampleServiceDoorman(t)
+	interceptor = UnaryServerInterceptor(doorman.ForService(s.Doorman, "https://unknown"))
+	_, err = interceptor(incomingContext("ana"), nil, info, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	interceptor := StreamServerInterceptor(sampleServiceDoorman(t))
+	info := &grpc.StreamServerInfo{FullMethod: "/reports.Reports/Watch"}
+
+	var userInfo *authn.UserInfo
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		userInfo, _ = UserInfoFromContext(stream.Context())
+		return nil
+	}
+
+	err := interceptor(nil, &testServerStream{ctx: incomingContext("ana")}, info, handler)
+	require.Nil(t, err)
+	assert.Equal(t, "ana", userInfo.ID)
+
+	err = interceptor(nil, &testServerStream{ctx: incomingContext("bob")}, info, handler)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestAuthorizeWithoutAuthenticator(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	d.SetAuditOutput(ioutil.Discard)
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://public.corp.com",
+			Tenant:  doorman.TenantConfig{Header: "X-Tenant"},
+			Policies: doorman.Policies{
+				{
+					ID:         "1",
+					Principals: []string{"tenant:acme"},
+					Actions:    []string{"call"},
+					Resources:  []string{"/catalog.Catalog/List"},
+					Effect:     "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	s := doorman.ForService(d, "https://public.corp.com")
+
+	// The policies are still evaluated, with the tenant principal only.
+	acme := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant", "acme"))
+	ctx, err := authorize(acme, s, "/catalog.Catalog/List")
+	require.Nil(t, err)
+	_, ok := UserInfoFromContext(ctx)
+	assert.False(t, ok)
+	principals, _ := PrincipalsFromContext(ctx)
+	assert.Equal(t, doorman.Principals{"tenant:acme"}, principals)
+
+	_, err = authorize(acme, s, "/catalog.Catalog/Delete")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = authorize(context.Background(), s, "/catalog.Catalog/List")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestAuthorizeIdentities(t *testing.T) {
+	defer func(s doorman.IdentitySettings) { Identities = s }(Identities)
+	Identities.PrincipalsBuilder = doorman.PrincipalsBuilderFunc(func(r *http.Request, service string, userInfo *authn.UserInfo, principals doorman.Principals) (doorman.Principals, error) {
+		if userInfo.ID == "bob" {
+			return append(principals, "userid:ana"), nil
+		}
+		return principals, nil
+	})
+	s := sampleServiceDoorman(t)
+
+	ctx, err := authorize(incomingContext("bob"), s, "/reports.Reports/Delete")
+	require.Nil(t, err)
+	principals, _ := PrincipalsFromContext(ctx)
+	assert.Equal(t, doorman.Principals{"userid:bob", "userid:ana"}, principals)
+}
+
+func TestAuthorizeClientIP(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	d.SetAuditOutput(ioutil.Discard)
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://reports.corp.com",
+			Policies: doorman.Policies{
+				{
+					ID:         "office",
+					Principals: []string{"userid:ana"},
+					Actions:    []string{"call"},
+					Resources:  []string{"<.*>"},
+					Effect:     "allow",
+					Conditions: doorman.Conditions{
+						doorman.ClientIPContextField: {
+							Type:    "CIDRsCondition",
+							Options: map[string]interface{}{"cidrs": []string{"203.0.113.0/24"}},
+						},
+					},
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	d.SetAuthenticator("https://reports.corp.com", &testAuthenticator{})
+	s := doorman.ForService(d, "https://reports.corp.com")
+
+	office := peer.NewContext(incomingContext("ana"), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 4242}})
+	_, err = authorize(office, s, "/reports.Reports/Delete")
+	assert.Nil(t, err)
+
+	home := peer.NewContext(incomingContext("ana"), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("198.51.100.7"), Port: 4242}})
+	_, err = authorize(home, s, "/reports.Reports/Delete")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
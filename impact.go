@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mozilla/doorman/config"
+	"github.com/mozilla/doorman/doorman"
+	"github.com/mozilla/doorman/export"
+)
+
+// impactChange is a recorded request whose outcome changes with the candidate policies.
+type impactChange struct {
+	principal string
+	resource  string
+	action    string
+	service   string
+	before    bool
+	after     bool
+	count     int
+}
+
+// runImpact replays the recorded decisions (see the export of decisions) against
+// candidate policies, and reports the requests whose outcome would change.
+func runImpact(args []string, out io.Writer) error {
+	sources := []string{}
+	recordings := ""
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--recordings" && i+1 < len(args) {
+			recordings = args[i+1]
+			i++
+		} else {
+			sources = append(sources, args[i])
+		}
+	}
+	if len(sources) == 0 || recordings == "" {
+		return fmt.Errorf("usage: doorman impact <policies...> --recordings <file>")
+	}
+
+	log.SetLevel(log.WarnLevel)
+	configs, err := config.Load(sources)
+	if err != nil {
+		return err
+	}
+	d := doorman.NewDefaultLadon()
+	d.SetAuditOutput(ioutil.Discard)
+	if err := d.LoadPolicies(configs); err != nil {
+		return err
+	}
+	services := map[string]bool{}
+	for _, c := range configs {
+		services[c.Service] = true
+	}
+
+	f, err := os.Open(recordings)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	decisions, err := (&export.JSONLinesEncoder{}).Decode(f)
+	if err != nil {
+		return err
+	}
+
+	changes := map[string]*impactChange{}
+	replayed, skipped := 0, 0
+	for _, decision := range decisions {
+		// Decisions forced by the maintenance mode do not depend on policies.
+		if !services[decision.Service] || decision.Maintenance || len(decision.Principals) == 0 {
+			skipped++
+			continue
+		}
+		replayed++
+		allowed := d.IsAllowed(decision.Service, replayRequest(d, decision))
+		if allowed == decision.Allowed {
+			continue
+		}
+		principal := decision.Principals[0]
+		key := fmt.Sprintf("%s\n%s\n%s\n%s\n%t", principal, decision.Resource, decision.Action, decision.Service, allowed)
+		change, ok := changes[key]
+		if !ok {
+			change = &impactChange{
+				principal: principal,
+				resource:  decision.Resource,
+				action:    decision.Action,
+				service:   decision.Service,
+				before:    decision.Allowed,
+				after:     allowed,
+			}
+			changes[key] = change
+		}
+		change.count++
+	}
+
+	printImpact(out, changes)
+	fmt.Fprintf(out, "%d requests replayed, %d skipped, %d changes.\n", replayed, skipped, len(changes))
+	return nil
+}
+
+// replayRequest rebuilds the request of a recorded decision. The recorded tags
+// are dropped, since the candidate policies may define them differently. The
+// context is not recorded, hence the policies conditions see an empty context
+// (except for the remote IP).
+func replayRequest(d *doorman.LadonDoorman, decision doorman.Decision) *doorman.Request {
+	principals := doorman.Principals{}
+	for _, p := range decision.Principals {
+		if !strings.HasPrefix(p, "tag:") {
+			principals = append(principals, p)
+		}
+	}
+	principals = d.ExpandPrincipals(decision.Service, principals)
+	return &doorman.Request{
+		Principals: principals,
+		Action:     decision.Action,
+		Resource:   decision.Resource,
+		Context: doorman.Context{
+			"remoteIP":    decision.RemoteIP,
+			"_service":    decision.Service,
+			"_principals": principals,
+		},
+	}
+}
+
+// printImpact writes the changes grouped by principal and resource.
+func printImpact(out io.Writer, changes map[string]*impactChange) {
+	sorted := []*impactChange{}
+	for _, change := range changes {
+		sorted = append(sorted, change)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.principal != b.principal {
+			return a.principal < b.principal
+		}
+		if a.resource != b.resource {
+			return a.resource < b.resource
+		}
+		if a.action != b.action {
+			return a.action < b.action
+		}
+		if a.service != b.service {
+			return a.service < b.service
+		}
+		return a.before
+	})
+
+	outcome := map[bool]string{true: "allowed", false: "denied"}
+	principal, resource := "", ""
+	for i, change := range sorted {
+		if i == 0 || change.principal != principal {
+			principal, resource = change.principal, ""
+			fmt.Fprintf(out, "%s\n", principal)
+		}
+		if change.resource != resource {
+			resource = change.resource
+			fmt.Fprintf(out, "  %s\n", resource)
+		}
+		fmt.Fprintf(out, "    %s (%s): %s -> %s (%d requests)\n", change.action, change.service,
+			outcome[change.before], outcome[change.after], change.count)
+	}
+}
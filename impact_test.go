@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunImpact(t *testing.T) {
+	var out bytes.Buffer
+	err := runImpact([]string{"sample.yaml"}, &out)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "usage")
+
+	tmpfile, _ := ioutil.TempFile("", "*.jsonl")
+	defer os.Remove(tmpfile.Name())
+	tmpfile.Write([]byte(strings.Join([]string{
+		`{"service": "https://sample.yaml", "principals": ["userid:maria"], "action": "update", "resource": "pto", "allowed": false}`,
+		`{"service": "https://sample.yaml", "principals": ["userid:foo"], "action": "update", "resource": "pto", "allowed": true}`,
+		`{"service": "https://sample.yaml", "principals": ["userid:bob"], "action": "update", "resource": "pto", "allowed": true}`,
+		`{"service": "https://sample.yaml", "principals": ["userid:bob", "userid:foo"], "action": "update", "resource": "pto", "allowed": false}`,
+		`{"service": "https://sample.yaml", "principals": ["userid:bob"], "action": "update", "resource": "pto", "allowed": true}`,
+		// Tags are expanded again.
+		`{"service": "https://sample.yaml", "principals": ["userid:ana", "tag:admins"], "action": "update", "resource": "pto", "allowed": true}`,
+		// Skipped.
+		`{"service": "https://sample.yaml", "principals": ["userid:ana"], "action": "update", "resource": "pto", "allowed": false, "maintenance": true}`,
+		`{"service": "https://unknown", "principals": ["userid:ana"], "action": "update", "resource": "pto", "allowed": true}`,
+	}, "\n")))
+	tmpfile.Close()
+
+	err = runImpact([]string{"sample.yaml", "--recordings", tmpfile.Name()}, &out)
+	require.Nil(t, err)
+	assert.Equal(t, `userid:ana
+  pto
+    update (https://sample.yaml): allowed -> denied (1 requests)
+userid:bob
+  pto
+    update (https://sample.yaml): allowed -> denied (2 requests)
+    update (https://sample.yaml): denied -> allowed (1 requests)
+userid:maria
+  pto
+    update (https://sample.yaml): denied -> allowed (1 requests)
+6 requests replayed, 2 skipped, 4 changes.
+`, out.String())
+
+	err = runImpact([]string{"sample.yaml", "--recordings", "unknown.jsonl"}, &out)
+	assert.NotNil(t, err)
+}
@@ -3,19 +3,61 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 
 	"github.com/mozilla/doorman/api"
+	"github.com/mozilla/doorman/authn"
 	"github.com/mozilla/doorman/config"
 	"github.com/mozilla/doorman/doorman"
+	"github.com/mozilla/doorman/export"
+	"github.com/mozilla/doorman/extauthz"
+	"github.com/mozilla/doorman/middleware"
+	"github.com/mozilla/doorman/proxy"
 )
 
-func init() {
+// setupLoaders plugs the configuration loaders and decrypters. The settings are
+// read in init(), hence it must be called from main().
+func setupLoaders() {
 	config.AddLoader(&config.FileLoader{})
 	config.AddLoader(&config.GithubLoader{
 		Token: settings.GithubToken,
 	})
+	config.AddLoader(&config.EnvLoader{})
+	config.AddLoader(&config.VaultLoader{})
+	config.AddLoader(&config.BundleLoader{
+		PublicKeyFile: settings.BundlePublicKey,
+	})
+	setupDecrypters()
+}
+
+// setupDecrypters plugs the decrypters of the encrypted policies files.
+func setupDecrypters() {
+	if settings.PoliciesKey != "" {
+		config.AddDecrypter(&config.AESCipher{
+			Key: settings.PoliciesKey,
+		})
+	}
+	if settings.PoliciesSOPS {
+		config.AddDecrypter(&config.SOPSDecrypter{})
+	}
+	if settings.PoliciesAgeIdentity != "" {
+		config.AddDecrypter(&config.AgeDecrypter{
+			IdentityFile: settings.PoliciesAgeIdentity,
+		})
+	}
 }
 
 func setupRouter() (*gin.Engine, error) {
@@ -27,28 +69,331 @@ func setupRouter() (*gin.Engine, error) {
 	setupLogging()
 	r.Use(HTTPLoggerMiddleware())
 
-	// Load files (from folders, files, Github, etc.)
-	configs, err := config.Load(settings.Sources)
+	// Tenants accepted by the multi-tenant Azure AD identity providers.
+	authn.AzureAllowedTenants = settings.AzureTenants
+	// Identity providers keys are refreshed in background.
+	authn.JWKSRefreshInterval = settings.JWKSRefresh
+	authn.JWKSRefetchInterval = settings.JWKSRefetch
+	authn.ClockSkew = settings.ClockSkew
+
+	// Client IP addresses are read from the trusted proxies headers.
+	trustedProxies, err := doorman.ParseCIDRs(settings.TrustedProxies)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %s", err)
 	}
+	api.ClientIP.TrustedProxies = trustedProxies
+	middleware.TrustedProxies = trustedProxies
 
-	// Load into Doorman.
+	// Load files (from folders, files, Github, etc.) into Doorman.
 	d := doorman.NewDefaultLadon()
-	if err := d.LoadPolicies(configs); err != nil {
+	// Cache the decisions of the repeated requests.
+	d.SetDecisionCache(settings.DecisionCacheTTL, settings.DecisionCacheSize)
+	// Relationship tuples for the RelationCondition.
+	switch settings.RelationsStore {
+	case "":
+	case "memory":
+		store := doorman.NewMemoryRelationStore()
+		d.SetRelationStore(store)
+		api.Relations.Store = store
+	default:
+		return nil, fmt.Errorf("unknown RELATIONS_STORE %q", settings.RelationsStore)
+	}
+	// Enrich the requests with external attributes.
+	if settings.AttributesURL != "" {
+		var provider doorman.AttributesProvider = &doorman.HTTPAttributesProvider{URL: settings.AttributesURL}
+		if settings.AttributesCacheTTL > 0 {
+			provider = doorman.NewCachedAttributesProvider(provider, settings.AttributesCacheTTL, 0)
+		}
+		d.AddAttributesProvider(provider)
+	}
+	if len(settings.StandbySources) > 0 {
+		// The standby sources are activated if the primary ones fail.
+		standby := &config.Standby{
+			Primary:   settings.Sources,
+			Secondary: settings.StandbySources,
+			Threshold: settings.StandbyThreshold,
+		}
+		if err := standby.Load(d); err != nil {
+			return nil, err
+		}
+		api.Reload.Standby = standby
+	} else {
+		configs, err := config.Load(settings.Sources)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.LoadPolicies(configs); err != nil {
+			return nil, err
+		}
+	}
+
+	// Export decisions for analytics.
+	exporter, err := setupExporter()
+	if err != nil {
+		return nil, err
+	}
+	if exporter != nil {
+		d.AddDecisionRecorder(exporter)
+		exporter.Start()
+	}
+
+	// Keep the recent decisions for the history endpoint.
+	if settings.DecisionHistory > 0 {
+		history := doorman.NewDecisionHistory(settings.DecisionHistory)
+		d.AddDecisionRecorder(history)
+		api.History.Store = history
+	}
+
+	// Export effective permissions as storage ACLs.
+	aclExporter, err := setupACLExporter(d)
+	if err != nil {
 		return nil, err
 	}
+	if aclExporter != nil {
+		aclExporter.Start()
+	}
+
+	// Serve the Envoy external authorization service.
+	if settings.ExtAuthzPort != "" {
+		if _, err := serveExtAuthz(d, ":"+settings.ExtAuthzPort); err != nil {
+			return nil, err
+		}
+	}
+
+	// Protect the upstream service as a reverse proxy.
+	if settings.ProxyUpstream != "" {
+		if _, err := serveProxy(d, ":"+settings.ProxyPort, settings.ProxyUpstream); err != nil {
+			return nil, err
+		}
+	}
 
 	// Endpoints
+	api.Objectives = settings.Objectives
+	if settings.SessionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(settings.SessionKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SESSION_KEY: %s", err)
+		}
+		codec, err := authn.NewSessionCodec(key)
+		if err != nil {
+			return nil, err
+		}
+		api.Sessions.Codec = codec
+	}
+	api.Sessions.TTL = settings.SessionTTL
+	if settings.OktaGroups != "" {
+		filter, err := regexp.Compile(settings.OktaGroups)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OKTA_GROUPS_FILTER: %s", err)
+		}
+		authn.OktaGroupsFilter = filter
+	}
+	api.Groups.Max = settings.MaxGroups
+	middleware.Identities.MaxGroups = settings.MaxGroups
+	if settings.AudienceHeader != "" {
+		api.Audience.Header = settings.AudienceHeader
+	}
+	api.Audience.Fixed = settings.Audience
+	middleware.Audience = api.Audience
+	var templates *api.TemplateErrorRenderer
+	if settings.ErrorTemplatesFile != "" {
+		templates, err = api.LoadTemplateErrorRenderer(settings.ErrorTemplatesFile, settings.ErrorTemplatesLanguage)
+		if err != nil {
+			return nil, err
+		}
+		api.Errors.Renderer = templates
+	}
+	switch settings.ErrorFormat {
+	case "":
+	case "problem":
+		api.Errors.Renderer = &api.ProblemErrorRenderer{
+			TypeBaseURI: settings.ErrorTypeBaseURI,
+			Templates:   templates,
+		}
+	default:
+		return nil, fmt.Errorf("invalid ERROR_FORMAT %q (use `problem`)", settings.ErrorFormat)
+	}
+	if len(settings.InsecurePrincipals) > 0 {
+		log.Warningf("Development mode: unauthenticated requests are accepted as %q", settings.InsecurePrincipals)
+		api.Insecure.Principals = settings.InsecurePrincipals
+	}
+	api.Admin.Token = settings.AdminToken
 	api.SetupRoutes(r, d)
 
 	return r, nil
 }
 
+func setupUploader() export.Uploader {
+	if settings.ExportS3Bucket != "" {
+		return export.NewS3Uploader(settings.ExportS3Bucket, settings.ExportS3Region)
+	}
+	if settings.ExportGCSBucket != "" {
+		return export.NewGCSUploader(settings.ExportGCSBucket)
+	}
+	return nil
+}
+
+func setupExporter() (*export.Exporter, error) {
+	uploader := setupUploader()
+	if uploader == nil {
+		return nil, nil
+	}
+	var encoder export.Encoder
+	switch settings.ExportFormat {
+	case "", "jsonl":
+		encoder = &export.JSONLinesEncoder{}
+	case "parquet":
+		encoder = &export.ParquetEncoder{}
+	default:
+		return nil, fmt.Errorf("invalid EXPORT_FORMAT %q", settings.ExportFormat)
+	}
+	return &export.Exporter{
+		Encoder:  encoder,
+		Uploader: uploader,
+		Prefix:   "doorman/",
+		Interval: settings.ExportInterval,
+	}, nil
+}
+
+func setupACLExporter(d doorman.Doorman) (*export.ACLExporter, error) {
+	if settings.ExportACLMapping == "" {
+		return nil, nil
+	}
+	uploader := setupUploader()
+	if uploader == nil {
+		return nil, fmt.Errorf("EXPORT_ACL_MAPPING without EXPORT_S3_BUCKET nor EXPORT_GCS_BUCKET")
+	}
+	mapping, err := export.LoadACLMapping(settings.ExportACLMapping)
+	if err != nil {
+		return nil, err
+	}
+	return &export.ACLExporter{
+		Doorman:  d,
+		Mapping:  mapping,
+		Uploader: uploader,
+		Prefix:   "doorman/",
+		Interval: settings.ExportInterval,
+	}, nil
+}
+
+// serveExtAuthz serves the Envoy external authorization gRPC service in
+// background, and returns the listening address.
+func serveExtAuthz(d doorman.Doorman, address string) (net.Addr, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EXTAUTHZ_PORT: %s", err)
+	}
+	authz := extauthz.NewServer(d)
+	// With a fixed audience, the requests hosts are ignored.
+	authz.Service = settings.Audience
+	authz.Identities.MaxGroups = settings.MaxGroups
+	server := grpc.NewServer()
+	authz.Register(server)
+	log.Infof("Envoy external authorization service listening on %s", listener.Addr())
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			log.Errorf("Envoy external authorization service stopped: %s", err)
+		}
+	}()
+	return listener.Addr(), nil
+}
+
 func main() {
+	// Commands instead of the server:
+	// - `doorman repl [policies...]` starts the interactive prompt.
+	// - `doorman migrate [--dry-run] <files...>` upgrades policies files.
+	// - `doorman impact <policies...> --recordings <file>` replays recorded decisions.
+	setupLoaders()
+
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "repl":
+			err = runREPL(os.Args[2:], os.Stdin, os.Stdout)
+		case "migrate":
+			err = runMigrate(os.Args[2:], os.Stdout)
+		case "impact":
+			err = runImpact(os.Args[2:], os.Stdout)
+		default:
+			log.Fatalf("unknown command %q", os.Args[1])
+		}
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		return
+	}
+
 	r, err := setupRouter()
 	if err != nil {
 		log.Fatal(err.Error())
 	}
-	r.Run() // listen and serve on 0.0.0.0:$PORT (:8080)
+	if err := serve(r); err != nil {
+		log.Fatal(err.Error())
+	}
+}
+
+// serve listens on 0.0.0.0:$PORT (:8080), with TLS if a certificate is configured.
+func serve(r *gin.Engine) error {
+	if settings.TLSCertFile == "" {
+		return r.Run()
+	}
+	tlsConfig, err := tlsConfigFromSettings()
+	if err != nil {
+		return err
+	}
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	server := &http.Server{
+		Addr:      ":" + port,
+		Handler:   r,
+		TLSConfig: tlsConfig,
+	}
+	return server.ListenAndServeTLS(settings.TLSCertFile, settings.TLSKeyFile)
+}
+
+// tlsConfigFromSettings verifies the clients certificates if a CA is configured.
+// Clients without certificate are accepted, since they can use tokens.
+func tlsConfigFromSettings() (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if settings.TLSClientCAFile == "" {
+		return tlsConfig, nil
+	}
+	ca, err := ioutil.ReadFile(settings.TLSClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("invalid client CA file %q", settings.TLSClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return tlsConfig, nil
+}
+
+// serveProxy serves the authorizing reverse proxy to the upstream URL, for the
+// AUDIENCE service.
+func serveProxy(d doorman.Doorman, address string, upstream string) (net.Addr, error) {
+	if settings.Audience == "" {
+		return nil, fmt.Errorf("PROXY_UPSTREAM requires AUDIENCE to be set")
+	}
+	upstreamURL, err := url.Parse(upstream)
+	if err != nil || upstreamURL.Scheme == "" || upstreamURL.Host == "" {
+		return nil, fmt.Errorf("invalid PROXY_UPSTREAM %q", upstream)
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROXY_PORT: %s", err)
+	}
+	p := proxy.New(doorman.ForService(d, settings.Audience), upstreamURL)
+	p.TrustedProxies = api.ClientIP.TrustedProxies
+	log.Infof("Reverse proxy to %s listening on %s", upstreamURL, listener.Addr())
+	go func() {
+		if err := http.Serve(listener, p); err != nil {
+			log.Errorf("Reverse proxy stopped: %s", err)
+		}
+	}()
+	return listener.Addr(), nil
 }
@@ -1,18 +1,33 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/pem"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/grpc"
+
+	"github.com/mozilla/doorman/api"
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/config"
+	"github.com/mozilla/doorman/doorman"
 )
 
 func TestMain(m *testing.M) {
 	//Set Gin to Test Mode
 	gin.SetMode(gin.TestMode)
+	setupLoaders()
 	// Run the other tests
 	os.Exit(m.Run())
 }
@@ -31,6 +46,7 @@ service: a
 policies:
   -
     id: "1"
+    principals: ["userid:maria"]
     action: update
     conditions:
       owner:
@@ -39,7 +55,7 @@ policies:
 	settings.Sources = []string{tmpfile.Name()}
 	_, err = setupRouter()
 	require.NotNil(t, err)
-	assert.Equal(t, "unknown condition type fantastic", err.Error())
+	assert.Equal(t, "unknown condition type \"fantastic\" for field \"owner\" in policy \"1\" of service \"a\"", err.Error())
 
 	defer func() {
 		os.Remove(tmpfile.Name()) // clean up
@@ -50,6 +66,339 @@ policies:
 	settings.Sources = []string{"sample.yaml"}
 	r, err := setupRouter()
 	require.Nil(t, err)
-	assert.Equal(t, 7, len(r.Routes()))
+	assert.Equal(t, 17, len(r.Routes()))
 	assert.Equal(t, 3, len(r.RouterGroup.Handlers))
 }
+
+func TestSetupLoadersDecrypter(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	encrypted, _ := (&config.AESCipher{Key: key}).Encrypt([]byte("service: a\nidentityProvider:\npolicies:\n  - id: \"1\"\n"))
+	tmpfile, _ := ioutil.TempFile("", "encrypted")
+	defer os.Remove(tmpfile.Name())
+	tmpfile.Write(encrypted)
+	tmpfile.Close()
+
+	// The settings are read before the decrypters are registered.
+	settings.PoliciesKey = key
+	defer func() { settings.PoliciesKey = "" }()
+	setupDecrypters()
+
+	configs, err := config.Load([]string{tmpfile.Name()})
+	require.Nil(t, err)
+	assert.Equal(t, "a", configs[0].Service)
+}
+
+func TestSetupRouterSessionKey(t *testing.T) {
+	settings.Sources = []string{"sample.yaml"}
+	defer func() {
+		settings.Sources = []string{DefaultPoliciesFilename}
+		settings.SessionKey = ""
+		api.Sessions.Codec = nil
+	}()
+
+	settings.SessionKey = "$$$"
+	_, err := setupRouter()
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid SESSION_KEY")
+
+	settings.SessionKey = "YWJj"
+	_, err = setupRouter()
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "32 bytes")
+
+	settings.SessionKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	_, err = setupRouter()
+	require.Nil(t, err)
+	assert.NotNil(t, api.Sessions.Codec)
+}
+
+func TestSetupRouterOktaGroups(t *testing.T) {
+	settings.Sources = []string{"sample.yaml"}
+	defer func() {
+		settings.Sources = []string{DefaultPoliciesFilename}
+		settings.OktaGroups = ""
+		authn.OktaGroupsFilter = nil
+	}()
+
+	settings.OktaGroups = "(doorman"
+	_, err := setupRouter()
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid OKTA_GROUPS_FILTER")
+
+	settings.OktaGroups = "^doorman-"
+	_, err = setupRouter()
+	require.Nil(t, err)
+	assert.True(t, authn.OktaGroupsFilter.MatchString("doorman-admins"))
+}
+
+func TestSetupRouterErrorTemplates(t *testing.T) {
+	settings.Sources = []string{"sample.yaml"}
+	defer func() {
+		settings.Sources = []string{DefaultPoliciesFilename}
+		settings.ErrorTemplatesFile = ""
+		api.Errors.Renderer = nil
+	}()
+
+	settings.ErrorTemplatesFile = "unknown.yaml"
+	_, err := setupRouter()
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed to read errors templates")
+
+	tmpfile, _ := ioutil.TempFile("", "*.yaml")
+	defer os.Remove(tmpfile.Name())
+	tmpfile.Write([]byte("fr:\n  unauthenticated: Veuillez vous connecter\n"))
+	tmpfile.Close()
+	settings.ErrorTemplatesFile = tmpfile.Name()
+	_, err = setupRouter()
+	require.Nil(t, err)
+	assert.NotNil(t, api.Errors.Renderer)
+}
+
+func TestSetupRouterErrorFormat(t *testing.T) {
+	settings.Sources = []string{"sample.yaml"}
+	defer func() {
+		settings.Sources = []string{DefaultPoliciesFilename}
+		settings.ErrorFormat = ""
+		settings.ErrorTypeBaseURI = ""
+		api.Errors.Renderer = nil
+	}()
+
+	settings.ErrorFormat = "xml"
+	_, err := setupRouter()
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid ERROR_FORMAT \"xml\"")
+
+	settings.ErrorFormat = "problem"
+	settings.ErrorTypeBaseURI = "https://errors.corp.com/"
+	_, err = setupRouter()
+	require.Nil(t, err)
+	assert.Equal(t, "https://errors.corp.com/", api.Errors.Renderer.(*api.ProblemErrorRenderer).TypeBaseURI)
+}
+
+func TestSetupRouterTrustedProxies(t *testing.T) {
+	settings.Sources = []string{"sample.yaml"}
+	defer func() {
+		settings.Sources = []string{DefaultPoliciesFilename}
+		settings.TrustedProxies = nil
+		api.ClientIP.TrustedProxies = nil
+	}()
+
+	settings.TrustedProxies = []string{"10.0.0.0/8", "proxy"}
+	_, err := setupRouter()
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid TRUSTED_PROXIES: invalid CIDR \"proxy\"")
+
+	settings.TrustedProxies = []string{"10.0.0.0/8", "192.168.1.1"}
+	_, err = setupRouter()
+	require.Nil(t, err)
+	assert.Len(t, api.ClientIP.TrustedProxies, 2)
+}
+
+func TestSetupRouterDecisionHistory(t *testing.T) {
+	settings.Sources = []string{"sample.yaml"}
+	settings.DecisionHistory = 100
+	defer func() {
+		settings.Sources = []string{DefaultPoliciesFilename}
+		settings.DecisionHistory = 0
+		api.History.Store = nil
+	}()
+
+	r, err := setupRouter()
+	require.Nil(t, err)
+	assert.NotNil(t, api.History.Store)
+	assert.Equal(t, 18, len(r.Routes()))
+}
+
+func TestSetupRouterStandby(t *testing.T) {
+	settings.Sources = []string{"/tmp/unknown.yaml"}
+	settings.StandbySources = []string{"sample.yaml"}
+	defer func() {
+		settings.Sources = []string{DefaultPoliciesFilename}
+		settings.StandbySources = nil
+		api.Reload.Standby = nil
+	}()
+
+	_, err := setupRouter()
+	require.Nil(t, err)
+	require.NotNil(t, api.Reload.Standby)
+	assert.Equal(t, config.StandbySecondary, api.Reload.Standby.Status().Active)
+
+	settings.StandbySources = []string{"/tmp/unknown.yaml"}
+	_, err = setupRouter()
+	assert.NotNil(t, err)
+}
+
+func TestSetupExporter(t *testing.T) {
+	exporter, err := setupExporter()
+	require.Nil(t, err)
+	assert.Nil(t, exporter)
+
+	settings.ExportS3Bucket = "logs"
+	settings.ExportS3Region = "eu-west-1"
+	defer func() { settings.ExportS3Bucket = "" }()
+	exporter, err = setupExporter()
+	require.Nil(t, err)
+	require.NotNil(t, exporter)
+	assert.Equal(t, "doorman/", exporter.Prefix)
+	assert.Equal(t, "jsonl.gz", exporter.Encoder.Extension())
+
+	settings.ExportS3Bucket = ""
+	settings.ExportGCSBucket = "logs"
+	defer func() { settings.ExportGCSBucket = "" }()
+	exporter, err = setupExporter()
+	require.Nil(t, err)
+	assert.NotNil(t, exporter)
+
+	settings.ExportFormat = "parquet"
+	defer func() { settings.ExportFormat = "" }()
+	exporter, err = setupExporter()
+	require.Nil(t, err)
+	assert.Equal(t, "parquet", exporter.Encoder.Extension())
+
+	settings.ExportFormat = "csv"
+	_, err = setupExporter()
+	assert.Equal(t, "invalid EXPORT_FORMAT \"csv\"", err.Error())
+}
+
+func TestSetupACLExporter(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	exporter, err := setupACLExporter(d)
+	require.Nil(t, err)
+	assert.Nil(t, exporter)
+
+	settings.ExportACLMapping = "unknown.yaml"
+	defer func() { settings.ExportACLMapping = "" }()
+	_, err = setupACLExporter(d)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "without EXPORT_S3_BUCKET")
+
+	settings.ExportS3Bucket = "acl"
+	defer func() { settings.ExportS3Bucket = "" }()
+	_, err = setupACLExporter(d)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed to read ACL mapping")
+
+	tmpfile, _ := ioutil.TempFile("", "*.yaml")
+	defer os.Remove(tmpfile.Name())
+	tmpfile.Write([]byte("service: a\nformat: s3\n"))
+	tmpfile.Close()
+	settings.ExportACLMapping = tmpfile.Name()
+	exporter, err = setupACLExporter(d)
+	require.Nil(t, err)
+	assert.Equal(t, "a", exporter.Mapping.Service)
+}
+
+func TestServeExtAuthz(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	d.SetAuditOutput(ioutil.Discard)
+	require.Nil(t, d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://api.corp.com",
+			Policies: doorman.Policies{
+				{ID: "1", Principals: []string{"<.*>"}, Actions: []string{"get"}, Resources: []string{"<.*>"}, Effect: "allow", AllowBroad: true},
+			},
+		},
+	}))
+
+	_, err := serveExtAuthz(d, ":-1")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid EXTAUTHZ_PORT")
+
+	addr, err := serveExtAuthz(d, "127.0.0.1:0")
+	require.Nil(t, err)
+	conn, err := grpc.Dial(addr.String(), grpc.WithInsecure())
+	require.Nil(t, err)
+	defer conn.Close()
+
+	resp, err := authv3.NewAuthorizationClient(conn).Check(context.Background(), &authv3.CheckRequest{
+		Attributes: &authv3.AttributeContext{
+			Request: &authv3.AttributeContext_Request{
+				Http: &authv3.AttributeContext_HttpRequest{Host: "unknown.corp.com", Method: "GET", Path: "/"},
+			},
+		},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, int32(code.Code_UNAUTHENTICATED), resp.Status.Code)
+}
+
+func TestTLSConfig(t *testing.T) {
+	defer func() { settings.TLSClientCAFile = "" }()
+
+	tlsConfig, err := tlsConfigFromSettings()
+	require.Nil(t, err)
+	assert.Equal(t, tls.NoClientCert, tlsConfig.ClientAuth)
+
+	settings.TLSClientCAFile = "unknown.pem"
+	_, err = tlsConfigFromSettings()
+	assert.NotNil(t, err)
+
+	tmpfile, _ := ioutil.TempFile("", "*.pem")
+	defer os.Remove(tmpfile.Name())
+	settings.TLSClientCAFile = tmpfile.Name()
+	_, err = tlsConfigFromSettings()
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid client CA file")
+
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+	pem.Encode(tmpfile, &pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	tmpfile.Close()
+	tlsConfig, err = tlsConfigFromSettings()
+	require.Nil(t, err)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, tlsConfig.ClientAuth)
+	assert.NotNil(t, tlsConfig.ClientCAs)
+}
+
+func TestServeProxy(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	d.SetAuditOutput(ioutil.Discard)
+	require.Nil(t, d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://legacy.corp.com",
+			Tags:    doorman.Tags{"everyone": {"userid:ana"}},
+		},
+	}))
+
+	_, err := serveProxy(d, "127.0.0.1:0", "http://localhost:9999")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "PROXY_UPSTREAM requires AUDIENCE")
+
+	settings.Audience = "https://legacy.corp.com"
+	defer func() { settings.Audience = "" }()
+
+	_, err = serveProxy(d, "127.0.0.1:0", "localhost")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid PROXY_UPSTREAM")
+
+	_, err = serveProxy(d, ":-1", "http://localhost:9999")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid PROXY_PORT")
+
+	addr, err := serveProxy(d, "127.0.0.1:0", "http://localhost:9999")
+	require.Nil(t, err)
+	// No policies: every request is denied.
+	resp, err := http.Get("http://" + addr.String() + "/reports")
+	require.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestSetupRouterRelations(t *testing.T) {
+	settings.Sources = []string{"sample.yaml"}
+	defer func() {
+		settings.Sources = []string{DefaultPoliciesFilename}
+		settings.RelationsStore = ""
+		api.Relations.Store = nil
+	}()
+
+	settings.RelationsStore = "spanner"
+	_, err := setupRouter()
+	require.NotNil(t, err)
+	assert.Equal(t, "unknown RELATIONS_STORE \"spanner\"", err.Error())
+
+	settings.RelationsStore = "memory"
+	r, err := setupRouter()
+	require.Nil(t, err)
+	assert.NotNil(t, api.Relations.Store)
+	assert.Equal(t, 19, len(r.Routes()))
+}
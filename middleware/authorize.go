@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/mozilla/doorman/doorman"
+)
+
+// Authorize rejects with a `403 Forbidden` the requests whose authenticated
+// user is not allowed to perform the action on the resource. It must be
+// chained after Middleware or ServiceMiddleware.
+//
+// With the Echo framework, see the echoauth package.
+func Authorize(action string, resource string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !IsAllowed(r, &doorman.Request{Action: action, Resource: resource}) {
+				message := fmt.Sprintf("not allowed to %s %s", action, resource)
+				writeError(w, http.StatusForbidden, message, map[string]interface{}{
+					"reason": "forbidden",
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mozilla/doorman/authn"
+)
+
+func TestAuthorize(t *testing.T) {
+	s := sampleServiceDoorman(t)
+	v := &testAuthenticator{userInfo: &authn.UserInfo{
+		ID:     "ana",
+		Claims: map[string]interface{}{"email_verified": true},
+	}}
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("DELETE", "/reports", nil)
+	ServiceMiddleware(v, s)(Authorize("delete", "reports")(next)).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, called)
+
+	called = false
+	w = httptest.NewRecorder()
+	ServiceMiddleware(v, s)(Authorize("delete", "invoices")(next)).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.False(t, called)
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, "not allowed to delete invoices", body["message"])
+	assert.Equal(t, "forbidden", body["reason"])
+
+	// Without authentication.
+	w = httptest.NewRecorder()
+	Authorize("delete", "reports")(next).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.False(t, called)
+}
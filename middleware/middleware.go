@@ -0,0 +1,212 @@
+// Package middleware provides a standard net/http middleware, for the services
+// that embed Doorman without the Gin framework (eg. chi or plain net/http).
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/doorman"
+)
+
+type contextKey string
+
+const (
+	doormanContextKey  contextKey = "doorman"
+	identityContextKey contextKey = "identity"
+)
+
+// Identities are the settings of the users identity building (eg. maximum
+// number of groups, principals builder), like the Doorman API ones.
+// They must be set before serving requests.
+var Identities = doorman.IdentitySettings{}
+
+// Audience are the settings of the requests service location, like the Doorman
+// API ones (default: the `Origin` header).
+// They must be set before serving requests.
+var Audience = doorman.AudienceSettings{
+	Header: "Origin",
+}
+
+// TrustedProxies are the networks of the proxies whose `X-Forwarded-For` header
+// is trusted to obtain the client IP address (default: none, the header is ignored).
+// They must be set before serving requests.
+var TrustedProxies []*net.IPNet
+
+// Middleware authenticates the requests for their service (see Audience), and
+// sets the user info and principals in the requests context. If the
+// authenticator is nil, the one configured for the service in the policies is
+// used. The requests without service are rejected with a `400 Bad Request`,
+// those that fail authentication with a `401 Unauthorized`, and those without
+// the required claims of the service with a `403 Forbidden`.
+func Middleware(v authn.Authenticator, d doorman.Doorman) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			service := Audience.FromRequest(r)
+			if service == "" {
+				message := fmt.Sprintf("Missing `%s` request header", Audience.HeaderName())
+				writeError(w, http.StatusBadRequest, message, nil)
+				return
+			}
+			authenticate(w, r, next, v, doorman.ForService(d, service))
+		})
+	}
+}
+
+// ServiceMiddleware is like Middleware, but authenticates the requests for the
+// specified service, regardless of the audience settings.
+func ServiceMiddleware(v authn.Authenticator, s *doorman.ServiceDoorman) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authenticate(w, r, next, v, s)
+		})
+	}
+}
+
+// authenticate validates the request authentication for the service, and calls
+// the next handler with the identity of the user in context.
+func authenticate(w http.ResponseWriter, r *http.Request, next http.Handler, v authn.Authenticator, s *doorman.ServiceDoorman) {
+	ctx := context.WithValue(r.Context(), doormanContextKey, s)
+
+	config, ok := s.Doorman.ServiceConfig(s.Service)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, fmt.Sprintf("Unknown service %q", s.Service), nil)
+		return
+	}
+	authenticator := v
+	if authenticator == nil {
+		// Services without authentication have no authenticator.
+		authenticator, _ = s.Authenticator()
+	}
+
+	var userInfo *authn.UserInfo
+	// No authenticator configured for this service: the identity has no principals.
+	if authenticator != nil {
+		var err error
+		userInfo, err = authenticator.ValidateRequest(withOrigin(r, s.Service))
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err.Error(), nil)
+			return
+		}
+		if unmet := config.UnmetClaims(userInfo.Claims); len(unmet) > 0 {
+			message := fmt.Sprintf("missing required claims: %s", strings.Join(unmet, ", "))
+			writeError(w, http.StatusForbidden, message, map[string]interface{}{
+				"reason": "required_claims",
+				"claims": unmet,
+			})
+			return
+		}
+	}
+	identity, err := Identities.Identity(r, s.Service, config, userInfo)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+
+	ctx = context.WithValue(ctx, identityContextKey, identity)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// identityFromContext returns the identity of the authenticated user.
+func identityFromContext(ctx context.Context) (*doorman.Identity, bool) {
+	identity, ok := ctx.Value(identityContextKey).(*doorman.Identity)
+	return identity, ok && identity.UserInfo != nil
+}
+
+// PrincipalsFromContext returns the principals of the authenticated user. It
+// returns false if authentication is disabled for the service.
+func PrincipalsFromContext(ctx context.Context) (doorman.Principals, bool) {
+	identity, ok := identityFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	return identity.Principals, true
+}
+
+// UserInfoFromContext returns the user info of the authenticated user, with
+// all its claims.
+func UserInfoFromContext(ctx context.Context) (*authn.UserInfo, bool) {
+	identity, ok := identityFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	return identity.UserInfo, true
+}
+
+// ClaimsFromContext returns the claims of the authenticated user (eg. `email`),
+// or an empty map if authentication is disabled for the service.
+func ClaimsFromContext(ctx context.Context) map[string]interface{} {
+	if userInfo, ok := UserInfoFromContext(ctx); ok && userInfo.Claims != nil {
+		return userInfo.Claims
+	}
+	return map[string]interface{}{}
+}
+
+// TenantFromContext returns the tenant of the caller, or an empty string if no
+// tenant is configured for the service.
+func TenantFromContext(ctx context.Context) string {
+	if identity, ok := ctx.Value(identityContextKey).(*doorman.Identity); ok {
+		return identity.Tenant
+	}
+	return ""
+}
+
+// IsAllowed checks the request on behalf of the authenticated user, with the
+// service of the middleware. The principals are expanded with the user tenant,
+// the service tags and the request roles, and the remote and client IP addresses
+// are set in the request context (see TrustedProxies), like with the Doorman
+// API. It returns false if the request was not authenticated.
+func IsAllowed(r *http.Request, request *doorman.Request) bool {
+	s, ok := r.Context().Value(doormanContextKey).(*doorman.ServiceDoorman)
+	if !ok {
+		return false
+	}
+	identity, ok := identityFromContext(r.Context())
+	if !ok {
+		return false
+	}
+	checked := *request
+	checked.Context = doorman.Context{}
+	for key, value := range request.Context {
+		checked.Context[key] = value
+	}
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+	checked.Context.SetTransport(s.Service, remoteIP, doorman.ClientIP(r, TrustedProxies))
+	return s.IsAllowedAs(identity, &checked)
+}
+
+// withOrigin returns the request with the service as `Origin` header, since the
+// authenticators read the tokens audience from it, whatever the audience settings.
+func withOrigin(r *http.Request, service string) *http.Request {
+	if r.Header.Get("Origin") == service {
+		return r
+	}
+	clone := new(http.Request)
+	*clone = *r
+	clone.Header = http.Header{}
+	for k, v := range r.Header {
+		clone.Header[k] = v
+	}
+	clone.Header.Set("Origin", service)
+	return clone
+}
+
+// writeError writes the JSON error response, like the Doorman API.
+func writeError(w http.ResponseWriter, status int, message string, details map[string]interface{}) {
+	body := map[string]interface{}{}
+	for field, value := range details {
+		body[field] = value
+	}
+	body["message"] = message
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,317 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/doorman"
+)
+
+type testAuthenticator struct {
+	userInfo *authn.UserInfo
+	err      error
+	origin   string
+}
+
+func (v *testAuthenticator) ValidateRequest(r *http.Request) (*authn.UserInfo, error) {
+	v.origin = r.Header.Get("Origin")
+	return v.userInfo, v.err
+}
+
+func sampleServiceDoorman(t *testing.T) *doorman.ServiceDoorman {
+	d := doorman.NewDefaultLadon()
+	d.SetAuditOutput(ioutil.Discard)
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service:        "https://api.corp.com",
+			Claims:         map[string]string{"team": "team:"},
+			RequiredClaims: map[string]interface{}{"email_verified": true},
+			Tags:           doorman.Tags{"admins": {"userid:ana"}},
+			Policies: doorman.Policies{
+				{
+					ID:         "1",
+					Principals: []string{"tag:admins"},
+					Actions:    []string{"delete"},
+					Resources:  []string{"reports"},
+					Effect:     "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	return doorman.ForService(d, "https://api.corp.com")
+}
+
+func TestMiddleware(t *testing.T) {
+	s := sampleServiceDoorman(t)
+	v := &testAuthenticator{userInfo: &authn.UserInfo{
+		ID:     "ana",
+		Claims: map[string]interface{}{"email_verified": true, "team": "ops"},
+	}}
+
+	var principals doorman.Principals
+	var claims map[string]interface{}
+	var allowed, denied bool
+	handler := ServiceMiddleware(v, s)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principals, _ = PrincipalsFromContext(r.Context())
+		claims = ClaimsFromContext(r.Context())
+		allowed = IsAllowed(r, &doorman.Request{Action: "delete", Resource: "reports"})
+		denied = IsAllowed(r, &doorman.Request{Action: "delete", Resource: "invoices"})
+	}))
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/reports", nil)
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://api.corp.com", v.origin)
+	assert.Equal(t, doorman.Principals{"userid:ana", "team:ops"}, principals)
+	assert.Equal(t, "ops", claims["team"])
+	assert.True(t, allowed)
+	assert.False(t, denied)
+}
+
+func TestMiddlewareErrors(t *testing.T) {
+	s := sampleServiceDoorman(t)
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	for _, test := range []struct {
+		v       authn.Authenticator
+		status  int
+		message string
+	}{
+		{&testAuthenticator{err: fmt.Errorf("token expired")}, http.StatusUnauthorized, "token expired"},
+		{&testAuthenticator{userInfo: &authn.UserInfo{ID: "ana"}}, http.StatusForbidden, "missing required claims: email_verified"},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "/reports", nil)
+		ServiceMiddleware(test.v, s)(next).ServeHTTP(w, r)
+
+		assert.Equal(t, test.status, w.Code)
+		var body map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		assert.Equal(t, test.message, body["message"])
+		assert.False(t, called)
+	}
+
+	// Unknown service.
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/reports", nil)
+	ServiceMiddleware(nil, doorman.ForService(s.Doorman, "https://unknown"))(next).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestMiddlewareWithoutAuthentication(t *testing.T) {
+	// No authenticator in the policies of the service.
+	s := sampleServiceDoorman(t)
+
+	var ok bool
+	var claims map[string]interface{}
+	var allowed bool
+	handler := ServiceMiddleware(nil, s)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok = PrincipalsFromContext(r.Context())
+		claims = ClaimsFromContext(r.Context())
+		allowed = IsAllowed(r, &doorman.Request{Action: "delete", Resource: "reports"})
+	}))
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/reports", nil)
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, ok)
+	assert.Equal(t, map[string]interface{}{}, claims)
+	assert.False(t, allowed)
+}
+
+func TestMiddlewareOrigin(t *testing.T) {
+	s := sampleServiceDoorman(t)
+	v := &testAuthenticator{userInfo: &authn.UserInfo{
+		ID:     "ana",
+		Claims: map[string]interface{}{"email_verified": true},
+	}}
+	var allowed bool
+	handler := Middleware(v, s.Doorman)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed = IsAllowed(r, &doorman.Request{Action: "delete", Resource: "reports"})
+	}))
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/reports", nil)
+	r.Header.Set("Origin", "https://API.corp.com:443")
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://api.corp.com", v.origin)
+	assert.True(t, allowed)
+
+	// Missing origin.
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/reports", nil)
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Unknown service.
+	w = httptest.NewRecorder()
+	r.Header.Set("Origin", "https://unknown")
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestMiddlewareIdentities(t *testing.T) {
+	defer func(s doorman.IdentitySettings) { Identities = s }(Identities)
+	Identities.MaxGroups = 1
+	Identities.PrincipalsBuilder = doorman.PrincipalsBuilderFunc(func(r *http.Request, service string, userInfo *authn.UserInfo, principals doorman.Principals) (doorman.Principals, error) {
+		if userInfo.ID == "legacy-ana" {
+			principals = append(principals, "userid:ana")
+		}
+		return principals, nil
+	})
+
+	s := sampleServiceDoorman(t)
+	v := &testAuthenticator{userInfo: &authn.UserInfo{
+		ID:     "legacy-ana",
+		Groups: []string{"a", "b"},
+		Claims: map[string]interface{}{"email_verified": true},
+	}}
+	var principals doorman.Principals
+	var allowed bool
+	handler := ServiceMiddleware(v, s)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principals, _ = PrincipalsFromContext(r.Context())
+		allowed = IsAllowed(r, &doorman.Request{Action: "delete", Resource: "reports"})
+	}))
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/reports", nil)
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, doorman.Principals{"userid:legacy-ana", "group:a", "userid:ana"}, principals)
+	assert.True(t, allowed)
+
+	// The builder errors reject the requests.
+	Identities.PrincipalsBuilder = doorman.PrincipalsBuilderFunc(func(r *http.Request, service string, userInfo *authn.UserInfo, principals doorman.Principals) (doorman.Principals, error) {
+		return nil, fmt.Errorf("unknown user")
+	})
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestMiddlewareTenant(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	d.SetAuditOutput(ioutil.Discard)
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://api.corp.com",
+			Tenant:  doorman.TenantConfig{Claim: "org"},
+			Policies: doorman.Policies{
+				{
+					ID:         "1",
+					Principals: []string{"tenant:acme"},
+					Actions:    []string{"read"},
+					Resources:  []string{"reports"},
+					Effect:     "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	v := &testAuthenticator{userInfo: &authn.UserInfo{
+		ID:     "ana",
+		Claims: map[string]interface{}{"org": "acme"},
+	}}
+	var tenant string
+	var allowed bool
+	handler := ServiceMiddleware(v, doorman.ForService(d, "https://api.corp.com"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant = TenantFromContext(r.Context())
+		allowed = IsAllowed(r, &doorman.Request{Action: "read", Resource: "reports"})
+	}))
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/reports", nil)
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, "acme", tenant)
+	assert.True(t, allowed)
+}
+
+func TestMiddlewareAudience(t *testing.T) {
+	defer func(a doorman.AudienceSettings) { Audience = a }(Audience)
+	s := sampleServiceDoorman(t)
+	v := &testAuthenticator{userInfo: &authn.UserInfo{
+		ID:     "ana",
+		Claims: map[string]interface{}{"email_verified": true},
+	}}
+	handler := Middleware(v, s.Doorman)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	Audience.Header = "X-Doorman-Audience"
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/reports", nil)
+	r.Header.Set("Origin", "https://unknown")
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "X-Doorman-Audience")
+
+	r.Header.Set("X-Doorman-Audience", "https://api.corp.com")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	// The authenticators read the audience from `Origin`.
+	assert.Equal(t, "https://api.corp.com", v.origin)
+
+	Audience.Fixed = "https://api.corp.com"
+	r, _ = http.NewRequest("GET", "/reports", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestIsAllowedClientIP(t *testing.T) {
+	defer func(p []*net.IPNet) { TrustedProxies = p }(TrustedProxies)
+	d := doorman.NewDefaultLadon()
+	d.SetAuditOutput(ioutil.Discard)
+	require.Nil(t, d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://api.corp.com",
+			Policies: doorman.Policies{
+				{
+					ID:         "office",
+					Principals: []string{"userid:ana"},
+					Actions:    []string{"delete"},
+					Resources:  []string{"reports"},
+					Effect:     "allow",
+					Conditions: doorman.Conditions{
+						doorman.ClientIPContextField: {
+							Type:    "CIDRsCondition",
+							Options: map[string]interface{}{"cidrs": []string{"203.0.113.0/24"}},
+						},
+					},
+				},
+			},
+		},
+	}))
+	v := &testAuthenticator{userInfo: &authn.UserInfo{ID: "ana"}}
+	var allowed bool
+	handler := ServiceMiddleware(v, doorman.ForService(d, "https://api.corp.com"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed = IsAllowed(r, &doorman.Request{Action: "delete", Resource: "reports"})
+	}))
+
+	r, _ := http.NewRequest("GET", "/reports", nil)
+	r.RemoteAddr = "203.0.113.7:4242"
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.True(t, allowed)
+
+	r.RemoteAddr = "10.0.0.1:4242"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.False(t, allowed)
+
+	TrustedProxies, _ = doorman.ParseCIDRs([]string{"10.0.0.0/8"})
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.True(t, allowed)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mozilla/doorman/config"
+)
+
+// runMigrate upgrades the specified policies files to the current schema version,
+// and prints the transformations applied. With `--dry-run`, files are left untouched.
+func runMigrate(args []string, out io.Writer) error {
+	dryRun := false
+	filenames := []string{}
+	for _, arg := range args {
+		if arg == "--dry-run" || arg == "-n" {
+			dryRun = true
+		} else {
+			filenames = append(filenames, arg)
+		}
+	}
+	if len(filenames) == 0 {
+		return fmt.Errorf("usage: doorman migrate [--dry-run] <files...>")
+	}
+
+	for _, filename := range filenames {
+		report, err := config.MigrateFile(filename, dryRun)
+		if err != nil {
+			return err
+		}
+		if len(report) == 0 {
+			fmt.Fprintf(out, "%s: up to date\n", filename)
+			continue
+		}
+		fmt.Fprintf(out, "%s:\n", filename)
+		for _, line := range report {
+			fmt.Fprintf(out, "  - %s\n", line)
+		}
+	}
+	if dryRun {
+		fmt.Fprintln(out, "Dry run: no file was changed.")
+	}
+	return nil
+}
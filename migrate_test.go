@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunMigrate(t *testing.T) {
+	var out bytes.Buffer
+	err := runMigrate([]string{"--dry-run"}, &out)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "usage")
+
+	tmpfile, _ := ioutil.TempFile("", "*.yaml")
+	defer os.Remove(tmpfile.Name())
+	tmpfile.Write([]byte("audience: a\njwtIssuer:\n"))
+	tmpfile.Close()
+
+	err = runMigrate([]string{"-n", tmpfile.Name()}, &out)
+	require.Nil(t, err)
+	assert.Contains(t, out.String(), "  - renamed `audience` to `service` (1)")
+	assert.Contains(t, out.String(), "Dry run")
+
+	out.Reset()
+	err = runMigrate([]string{tmpfile.Name()}, &out)
+	require.Nil(t, err)
+	assert.NotContains(t, out.String(), "Dry run")
+
+	out.Reset()
+	err = runMigrate([]string{tmpfile.Name()}, &out)
+	require.Nil(t, err)
+	assert.Contains(t, out.String(), "up to date")
+}
@@ -0,0 +1,129 @@
+// Package proxy implements the authorizing reverse proxy, so that the services
+// that cannot be modified are protected by Doorman in front of them.
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mozilla/doorman/doorman"
+	"github.com/mozilla/doorman/middleware"
+)
+
+// DefaultPrincipalsHeader is the header of the forwarded requests with the
+// caller expanded principals.
+const DefaultPrincipalsHeader = "X-Doorman-Principals"
+
+// Proxy authenticates the requests for its service, checks the policies, and
+// forwards the allowed requests to the upstream service. The requests action is
+// the lower-cased HTTP method (eg. `get`), and the resource is the path (eg.
+// `/reports/42`).
+type Proxy struct {
+	Service *doorman.ServiceDoorman
+	// PrincipalsHeader is set with the principals of the forwarded requests,
+	// separated with commas (default: `X-Doorman-Principals`). The values sent
+	// by the callers are removed.
+	PrincipalsHeader string
+	// TrustedProxies are the networks of the proxies whose `X-Forwarded-For`
+	// header is trusted to obtain the client IP address.
+	TrustedProxies []*net.IPNet
+	handler        http.Handler
+	upstream       *httputil.ReverseProxy
+}
+
+// New returns a reverse proxy to the upstream URL for the specified service.
+func New(s *doorman.ServiceDoorman, upstream *url.URL) *Proxy {
+	p := &Proxy{
+		Service:          s,
+		PrincipalsHeader: DefaultPrincipalsHeader,
+		upstream:         httputil.NewSingleHostReverseProxy(upstream),
+	}
+	p.handler = middleware.ServiceMiddleware(nil, s)(http.HandlerFunc(p.forward))
+	return p
+}
+
+// ServeHTTP authenticates, authorizes and forwards the request.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.handler.ServeHTTP(w, r)
+}
+
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request) {
+	// No authenticator configured for this service: the requests have no principals.
+	principals, _ := middleware.PrincipalsFromContext(r.Context())
+	tenant := middleware.TenantFromContext(r.Context())
+	if tenant != "" {
+		principals = append(append(doorman.Principals{}, principals...), fmt.Sprintf("tenant:%s", tenant))
+	}
+
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+	request := &doorman.Request{
+		Principals: p.Service.ExpandPrincipals(principals),
+		Action:     strings.ToLower(r.Method),
+		Resource:   r.URL.Path,
+		Context:    doorman.Context{},
+	}
+	if config, ok := p.Service.Doorman.ServiceConfig(p.Service.Service); ok && len(config.BodyFields) > 0 {
+		request.Context = doorman.BodyContext(peekBody(r), config.BodyFields)
+	}
+	request.Principals = append(request.Principals, request.Roles()...)
+	request.Context["remoteIP"] = remoteIP
+	request.Context[doorman.RequestContextNamespace+"remoteIP"] = remoteIP
+	clientIP := doorman.ClientIP(r, p.TrustedProxies)
+	request.Context[doorman.ClientIPContextField] = clientIP
+	request.Context[doorman.RequestContextNamespace+"clientIP"] = clientIP
+	request.Context[doorman.RequestContextNamespace+"service"] = p.Service.Service
+	if tenant != "" {
+		request.Context[doorman.TenantContextField] = tenant
+		request.Context[doorman.SubjectContextNamespace+"tenant"] = tenant
+	}
+	request.Context["_service"] = p.Service.Service
+	request.Context["_principals"] = request.Principals
+
+	if !p.Service.IsAllowed(request) {
+		log.Debugf("Request %s %s on %q denied", request.Action, request.Resource, p.Service.Service)
+		message := fmt.Sprintf("not allowed to %s %s", request.Action, request.Resource)
+		writeError(w, http.StatusForbidden, message)
+		return
+	}
+
+	header := p.PrincipalsHeader
+	if header == "" {
+		header = DefaultPrincipalsHeader
+	}
+	r.Header.Set(header, strings.Join(request.Principals, ","))
+	p.upstream.ServeHTTP(w, r)
+}
+
+// peekBody returns the beginning of the request body (see doorman.MaxBodySize),
+// which is still entirely forwarded.
+func peekBody(r *http.Request) []byte {
+	if r.Body == nil {
+		return nil
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(r.Body, doorman.MaxBodySize))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	return body
+}
+
+// writeError writes the JSON error response, like the Doorman API.
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mozilla/doorman/authn"
+	"github.com/mozilla/doorman/doorman"
+)
+
+type testAuthenticator struct{}
+
+func (v *testAuthenticator) ValidateRequest(r *http.Request) (*authn.UserInfo, error) {
+	if r.Header.Get("Authorization") != "Bearer ana" {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return &authn.UserInfo{ID: "ana"}, nil
+}
+
+func TestProxy(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	d.SetAuditOutput(ioutil.Discard)
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service: "https://legacy.corp.com",
+			Tags:    doorman.Tags{"admins": {"userid:ana"}},
+			Policies: doorman.Policies{
+				{
+					ID:         "1",
+					Principals: []string{"tag:admins"},
+					Actions:    []string{"get"},
+					Resources:  []string{"/reports/<.*>"},
+					Effect:     "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	d.SetAuthenticator("https://legacy.corp.com", &testAuthenticator{})
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.URL.RequestURI(), r.Header.Get(DefaultPrincipalsHeader))
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	p := New(d.ForService("https://legacy.corp.com"), upstreamURL)
+	server := httptest.NewServer(p)
+	defer server.Close()
+
+	get := func(path string, token string) (int, string) {
+		r, _ := http.NewRequest("GET", server.URL+path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		// Spoofed principals are replaced.
+		r.Header.Set(DefaultPrincipalsHeader, "userid:root")
+		resp, err := http.DefaultClient.Do(r)
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := get("/reports/42?format=csv", "ana")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "/reports/42?format=csv userid:ana,tag:admins", body)
+
+	status, body = get("/admin", "ana")
+	assert.Equal(t, http.StatusForbidden, status)
+	var response map[string]string
+	json.Unmarshal([]byte(body), &response)
+	assert.Equal(t, "not allowed to get /admin", response["message"])
+
+	status, _ = get("/reports/42", "bob")
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestProxyBodyFields(t *testing.T) {
+	d := doorman.NewDefaultLadon()
+	d.SetAuditOutput(ioutil.Discard)
+	err := d.LoadPolicies(doorman.ServicesConfig{
+		doorman.ServiceConfig{
+			Service:    "https://legacy.corp.com",
+			BodyFields: map[string]string{"$.owner": "owner"},
+			Policies: doorman.Policies{
+				{
+					ID:         "1",
+					Principals: []string{"userid:<.*>"},
+					Actions:    []string{"post"},
+					Resources:  []string{"/reports"},
+					Conditions: doorman.Conditions{
+						"owner": doorman.Condition{Type: "MatchPrincipalsCondition"},
+					},
+					Effect: "allow",
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	d.SetAuthenticator("https://legacy.corp.com", &testAuthenticator{})
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+	server := httptest.NewServer(New(d.ForService("https://legacy.corp.com"), upstreamURL))
+	defer server.Close()
+
+	post := func(body string) (int, string) {
+		r, _ := http.NewRequest("POST", server.URL+"/reports", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer ana")
+		resp, err := http.DefaultClient.Do(r)
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		content, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(content)
+	}
+
+	// The body is forwarded entirely.
+	status, body := post(`{"owner": "userid:ana", "title": "Q3"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"owner": "userid:ana", "title": "Q3"}`, body)
+
+	status, _ = post(`{"owner": "userid:bob"}`)
+	assert.Equal(t, http.StatusForbidden, status)
+}
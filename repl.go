@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mozilla/doorman/config"
+	"github.com/mozilla/doorman/doorman"
+)
+
+const replHelp = `Commands:
+  services                                  list the loaded services
+  service <uri>                             select the service of the next commands
+  policies                                  list the policies of the service
+  check <principals> <action> <resource> [context]
+                                            check a request (principals are comma separated, context is JSON)
+  expand <principals>                       expand the principals with tags, and explain the matches
+  disable <policy id>                       ignore a policy
+  enable <policy id>                        restore a disabled policy
+  reload                                    reload the policies files
+  help                                      show this message
+  exit                                      quit
+`
+
+// decisionCapture keeps the last decision, to explain the checks.
+type decisionCapture struct {
+	last *doorman.Decision
+}
+
+func (d *decisionCapture) Record(decision doorman.Decision) {
+	d.last = &decision
+}
+
+// repl is an interactive prompt to author policies.
+type repl struct {
+	sources  []string
+	out      io.Writer
+	doorman  *doorman.LadonDoorman
+	capture  *decisionCapture
+	configs  doorman.ServicesConfig
+	service  string
+	disabled map[string]bool
+}
+
+func newREPL(sources []string, out io.Writer) (*repl, error) {
+	d := doorman.NewDefaultLadon()
+	d.SetAuditOutput(ioutil.Discard)
+	capture := &decisionCapture{}
+	d.AddDecisionRecorder(capture)
+	r := &repl{
+		sources:  sources,
+		out:      out,
+		doorman:  d,
+		capture:  capture,
+		disabled: map[string]bool{},
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload reads the policies files, and selects the first service if none is.
+func (r *repl) reload() error {
+	configs, err := config.Load(r.sources)
+	if err != nil {
+		return err
+	}
+	r.configs = configs
+	if _, ok := r.serviceConfig(r.service); !ok && len(configs) > 0 {
+		r.service = configs[0].Service
+	}
+	return r.apply()
+}
+
+// apply loads the policies into Doorman, without the disabled ones.
+func (r *repl) apply() error {
+	configs := doorman.ServicesConfig{}
+	for _, c := range r.configs {
+		enabled := doorman.Policies{}
+		for _, p := range c.Policies {
+			if !r.disabled[policyKey(c.Service, p.ID)] {
+				enabled = append(enabled, p)
+			}
+		}
+		c.Policies = enabled
+		configs = append(configs, c)
+	}
+	if err := r.doorman.LoadPolicies(configs); err != nil {
+		return err
+	}
+	// Authentication is irrelevant here: principals are always specified.
+	for _, c := range configs {
+		r.doorman.SetAuthenticator(c.Service, nil)
+	}
+	return nil
+}
+
+func (r *repl) serviceConfig(service string) (doorman.ServiceConfig, bool) {
+	for _, c := range r.configs {
+		if c.Service == service {
+			return c, true
+		}
+	}
+	return doorman.ServiceConfig{}, false
+}
+
+func policyKey(service string, id string) string {
+	return service + "#" + id
+}
+
+// run reads the commands until the input is closed.
+func (r *repl) run(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	fmt.Fprintf(r.out, "Service %q selected. Type `help` for the list of commands.\n", r.service)
+	for {
+		fmt.Fprint(r.out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(r.out)
+			return
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "exit" || line == "quit" {
+			return
+		}
+		if line == "" {
+			continue
+		}
+		if err := r.execute(line); err != nil {
+			fmt.Fprintf(r.out, "Error: %s\n", err)
+		}
+	}
+}
+
+// execute runs a single command.
+func (r *repl) execute(line string) error {
+	fields := strings.Fields(line)
+	command, args := fields[0], fields[1:]
+	switch command {
+	case "help":
+		fmt.Fprint(r.out, replHelp)
+	case "services":
+		for _, c := range r.configs {
+			fmt.Fprintf(r.out, "%s (%s)\n", c.Service, c.Source)
+		}
+	case "service":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: service <uri>")
+		}
+		if _, ok := r.serviceConfig(args[0]); !ok {
+			return fmt.Errorf("unknown service %q", args[0])
+		}
+		r.service = args[0]
+	case "policies":
+		c, _ := r.serviceConfig(r.service)
+		for _, p := range c.Policies {
+			state := "enabled"
+			if r.disabled[policyKey(r.service, p.ID)] {
+				state = "disabled"
+			}
+			fmt.Fprintf(r.out, "%s\t%s\t%s\t%s\n", p.ID, p.Effect, state, p.Description)
+		}
+	case "check":
+		return r.check(args, line)
+	case "expand":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: expand <principals>")
+		}
+		expanded, matches := r.doorman.ExplainPrincipals(r.service, splitPrincipals(args[0]))
+		fmt.Fprintf(r.out, "Principals: %s\n", strings.Join(expanded, ", "))
+		for _, m := range matches {
+			fmt.Fprintf(r.out, "  %s: %s (%s)\n", m.Tag, m.Member, m.Source)
+		}
+	case "disable", "enable":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: %s <policy id>", command)
+		}
+		c, _ := r.serviceConfig(r.service)
+		found := false
+		for _, p := range c.Policies {
+			found = found || p.ID == args[0]
+		}
+		if !found {
+			return fmt.Errorf("unknown policy %q", args[0])
+		}
+		key := policyKey(r.service, args[0])
+		if command == "disable" {
+			r.disabled[key] = true
+		} else {
+			delete(r.disabled, key)
+		}
+		return r.apply()
+	case "reload":
+		if err := r.reload(); err != nil {
+			return err
+		}
+		fmt.Fprintf(r.out, "Reloaded %d services.\n", len(r.configs))
+	default:
+		return fmt.Errorf("unknown command %q (type `help`)", command)
+	}
+	return nil
+}
+
+// check runs an authorization request and explains the decision.
+func (r *repl) check(args []string, line string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: check <principals> <action> <resource> [context]")
+	}
+	context := doorman.Context{}
+	if len(args) > 3 {
+		// The context is the rest of the line, spaces included.
+		raw := line[strings.Index(line, args[3]):]
+		if err := json.Unmarshal([]byte(raw), &context); err != nil {
+			return fmt.Errorf("invalid context: %s", err)
+		}
+	}
+
+	principals := splitPrincipals(args[0])
+	expanded := r.doorman.ExpandPrincipals(r.service, principals)
+	request := &doorman.Request{
+		Principals: expanded,
+		Action:     args[1],
+		Resource:   args[2],
+		Context:    context,
+	}
+	request.Principals = append(request.Principals, request.Roles()...)
+	request.Context["_service"] = r.service
+	request.Context["_principals"] = request.Principals
+
+	r.capture.last = nil
+	allowed := r.doorman.IsAllowed(r.service, request)
+	if allowed {
+		fmt.Fprintln(r.out, "Allowed")
+	} else {
+		fmt.Fprintln(r.out, "Denied")
+	}
+	fmt.Fprintf(r.out, "  principals: %s\n", strings.Join(request.Principals, ", "))
+	if r.capture.last != nil && len(r.capture.last.Policies) > 0 {
+		policies := append([]string{}, r.capture.last.Policies...)
+		sort.Strings(policies)
+		fmt.Fprintf(r.out, "  policies: %s\n", strings.Join(policies, ", "))
+	} else if !allowed {
+		fmt.Fprintln(r.out, "  no matching policy")
+	}
+	return nil
+}
+
+func splitPrincipals(value string) doorman.Principals {
+	principals := doorman.Principals{}
+	for _, p := range strings.Split(value, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			principals = append(principals, p)
+		}
+	}
+	return principals
+}
+
+// runREPL starts the interactive prompt on the specified policies, or on the
+// ones of the settings.
+func runREPL(sources []string, in io.Reader, out io.Writer) error {
+	log.SetLevel(log.WarnLevel)
+	if len(sources) == 0 {
+		sources = settings.Sources
+	}
+	r, err := newREPL(sources, out)
+	if err != nil {
+		return err
+	}
+	r.run(in)
+	return nil
+}
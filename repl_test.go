@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestREPL(t *testing.T) {
+	var out bytes.Buffer
+	r, err := newREPL([]string{"sample.yaml"}, &out)
+	require.Nil(t, err)
+	assert.Equal(t, "https://sample.yaml", r.service)
+
+	run := func(line string) string {
+		out.Reset()
+		err := r.execute(line)
+		require.Nil(t, err)
+		return out.String()
+	}
+
+	assert.Contains(t, run("services"), "https://sample.yaml (sample.yaml)")
+	assert.Contains(t, run("policies"), "1\tallow\tenabled")
+
+	// Tags are explained.
+	assert.Contains(t, run("expand userid:maria"), "tag:admins: userid:maria (sample.yaml)")
+
+	// Checks are explained.
+	output := run("check userid:maria update pto")
+	assert.Contains(t, output, "Allowed")
+	assert.Contains(t, output, "principals: userid:maria, tag:admins")
+	assert.Contains(t, output, "policies: 1")
+
+	// Context and roles.
+	output = run(`check userid:bob update pto {"roles": ["editor"]}`)
+	assert.Contains(t, output, "principals: userid:bob, role:editor")
+	output = run(`check userid:maria update pto {"planet": "mars"}`)
+	assert.Contains(t, output, "Denied")
+	assert.Contains(t, output, "policies: 2")
+	assert.Contains(t, run("check userid:bob delete pto"), "no matching policy")
+
+	// Policies can be toggled.
+	run("disable 1")
+	assert.Contains(t, run("policies"), "1\tallow\tdisabled")
+	assert.Contains(t, run("check userid:maria update pto"), "Denied")
+	run("enable 1")
+	assert.Contains(t, run("check userid:maria update pto"), "Allowed")
+
+	// Disabled policies are kept on reload.
+	run("disable 1")
+	assert.Contains(t, run("reload"), "Reloaded 1 services")
+	assert.Contains(t, run("check userid:maria update pto"), "Denied")
+
+	// Errors.
+	for line, message := range map[string]string{
+		"service https://unknown": "unknown service",
+		"disable 42":              "unknown policy",
+		"check userid:maria":      "usage: check",
+		"check a b c {not json}":  "invalid context",
+		"fly":                     "unknown command",
+		"expand":                  "usage: expand",
+	} {
+		err := r.execute(line)
+		require.NotNil(t, err)
+		assert.Contains(t, err.Error(), message)
+	}
+}
+
+func TestREPLRun(t *testing.T) {
+	var out bytes.Buffer
+	err := runREPL([]string{"sample.yaml"}, strings.NewReader("help\n\nfly\nexit\nservices\n"), &out)
+	require.Nil(t, err)
+	assert.Contains(t, out.String(), "Commands:")
+	assert.Contains(t, out.String(), "Error: unknown command \"fly\"")
+	// Stopped at exit.
+	assert.NotContains(t, out.String(), "(sample.yaml)")
+
+	err = runREPL([]string{"/unknown.yaml"}, strings.NewReader(""), &out)
+	require.NotNil(t, err)
+}
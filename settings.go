@@ -2,19 +2,82 @@ package main
 
 import (
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+
+	"github.com/mozilla/doorman/api"
+	"github.com/mozilla/doorman/authn"
 )
 
 // DefaultPoliciesFilename is the default policies filename.
 const DefaultPoliciesFilename string = "policies.yaml"
 
 var settings struct {
-	GithubToken string
-	Sources     []string
-	LogLevel    logrus.Level
+	GithubToken     string
+	BundlePublicKey string
+	PoliciesKey     string
+	SessionKey      string
+	SessionTTL      time.Duration
+	OktaGroups      string
+	ExportS3Bucket  string
+	ExportS3Region  string
+	ExportGCSBucket string
+	ExportInterval  time.Duration
+	// ExportACLMapping is the YAML file of the ACL exporter mapping.
+	ExportACLMapping string
+	Sources          []string
+	// StandbySources are pre-loaded, and activated if Sources fail.
+	StandbySources   []string
+	StandbyThreshold time.Duration
+	LogLevel         logrus.Level
+	Objectives       api.SLOObjectives
+	MaxGroups        int
+	// DecisionHistory is the number of decisions kept for the history endpoint.
+	DecisionHistory int
+	// DecisionCacheTTL enables the decisions cache (see doorman.SetDecisionCache).
+	DecisionCacheTTL  time.Duration
+	DecisionCacheSize int
+	AudienceHeader    string
+	// InsecurePrincipals enables the development mode (see api.Insecure).
+	InsecurePrincipals []string
+	Audience           string
+	AzureTenants       []string
+	JWKSRefresh        time.Duration
+	JWKSRefetch        time.Duration
+	ClockSkew          time.Duration
+	// ErrorTemplatesFile localizes the errors responses (see api.TemplateErrorRenderer).
+	ErrorTemplatesFile     string
+	ErrorTemplatesLanguage string
+	// ErrorFormat is the format of the errors responses (`problem` for RFC 7807).
+	ErrorFormat      string
+	ErrorTypeBaseURI string
+	TLSCertFile      string
+	TLSKeyFile       string
+	TLSClientCAFile  string
+	// ExtAuthzPort serves the Envoy external authorization service (see extauthz.Server).
+	ExtAuthzPort string
+	// ProxyUpstream enables the reverse proxy mode (see proxy.Proxy).
+	ProxyUpstream string
+	ProxyPort     string
+	// TrustedProxies are the networks whose `X-Forwarded-For` is trusted (see doorman.ClientIP).
+	TrustedProxies []string
+	// AttributesURL fetches the requests attributes (see doorman.HTTPAttributesProvider).
+	AttributesURL      string
+	AttributesCacheTTL time.Duration
+	// RelationsStore enables the relationship tuples (`memory`, see doorman.RelationStore).
+	RelationsStore string
+	// AdminToken protects the administration endpoints (see api.Admin).
+	AdminToken string
+	// PoliciesSOPS enables the decryption of the SOPS files with the `sops` command.
+	PoliciesSOPS bool
+	// PoliciesAgeIdentity enables the decryption of the age files with the `age` command.
+	PoliciesAgeIdentity string
+	// ExportFormat is the file format of the decisions exports (`jsonl` or `parquet`).
+	ExportFormat string
 }
 
 func sources() []string {
@@ -23,6 +86,11 @@ func sources() []string {
 	if env == "" {
 		env = DefaultPoliciesFilename
 	}
+	return splitSources(env)
+}
+
+// splitSources returns the space separated sources.
+func splitSources(env string) []string {
 	sources := strings.Split(env, " ")
 	// Filter empty strings
 	var r []string
@@ -54,8 +122,99 @@ func levelFromEnv() logrus.Level {
 	return logrus.DebugLevel
 }
 
+func objectivesFromEnv() api.SLOObjectives {
+	objectives := api.Objectives
+	if v, err := strconv.ParseFloat(os.Getenv("SLO_AVAILABILITY"), 64); err == nil {
+		objectives.Availability = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("SLO_LATENCY_P99")); err == nil {
+		objectives.LatencyP99 = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("SLO_RELOAD_FRESHNESS")); err == nil {
+		objectives.ReloadFreshness = v
+	}
+	return objectives
+}
+
+func sessionTTLFromEnv() time.Duration {
+	if v, err := time.ParseDuration(os.Getenv("SESSION_TTL")); err == nil {
+		return v
+	}
+	return api.Sessions.TTL
+}
+
+func jwksRefreshFromEnv() time.Duration {
+	if v, err := time.ParseDuration(os.Getenv("JWKS_REFRESH_INTERVAL")); err == nil {
+		return v
+	}
+	// Refresh before the cached keys expire.
+	return authn.CacheTTL / 2
+}
+
+func jwksRefetchFromEnv() time.Duration {
+	if v, err := time.ParseDuration(os.Getenv("JWKS_REFETCH_INTERVAL")); err == nil && v >= 0 {
+		return v
+	}
+	return authn.JWKSRefetchInterval
+}
+
+func clockSkewFromEnv() time.Duration {
+	if v, err := time.ParseDuration(os.Getenv("JWT_CLOCK_SKEW")); err == nil && v >= 0 {
+		return v
+	}
+	return authn.ClockSkew
+}
+
 func init() {
 	settings.GithubToken = os.Getenv("GITHUB_TOKEN")
+	settings.BundlePublicKey = os.Getenv("BUNDLE_PUBLIC_KEY")
+	settings.PoliciesKey = os.Getenv("POLICIES_KEY")
+	settings.PoliciesSOPS, _ = strconv.ParseBool(os.Getenv("POLICIES_SOPS"))
+	settings.PoliciesAgeIdentity = os.Getenv("POLICIES_AGE_IDENTITY")
+	settings.SessionKey = os.Getenv("SESSION_KEY")
+	settings.SessionTTL = sessionTTLFromEnv()
+	settings.OktaGroups = os.Getenv("OKTA_GROUPS_FILTER")
+	settings.MaxGroups, _ = strconv.Atoi(os.Getenv("MAX_GROUPS"))
+	settings.DecisionHistory, _ = strconv.Atoi(os.Getenv("DECISION_HISTORY_SIZE"))
+	settings.DecisionCacheTTL, _ = time.ParseDuration(os.Getenv("DECISION_CACHE_TTL"))
+	settings.DecisionCacheSize, _ = strconv.Atoi(os.Getenv("DECISION_CACHE_SIZE"))
+	settings.AudienceHeader = os.Getenv("AUDIENCE_HEADER")
+	settings.Audience = os.Getenv("AUDIENCE")
+	settings.InsecurePrincipals = strings.Fields(strings.Replace(os.Getenv("INSECURE_PRINCIPALS"), ",", " ", -1))
+	settings.AzureTenants = strings.Fields(strings.Replace(os.Getenv("AZURE_ALLOWED_TENANTS"), ",", " ", -1))
+	settings.JWKSRefresh = jwksRefreshFromEnv()
+	settings.JWKSRefetch = jwksRefetchFromEnv()
+	settings.ClockSkew = clockSkewFromEnv()
+	settings.ErrorTemplatesFile = os.Getenv("ERROR_TEMPLATES_FILE")
+	settings.ErrorFormat = os.Getenv("ERROR_FORMAT")
+	settings.ErrorTypeBaseURI = os.Getenv("ERROR_TYPE_BASE_URI")
+	settings.ErrorTemplatesLanguage = os.Getenv("ERROR_TEMPLATES_LANGUAGE")
+	if settings.ErrorTemplatesLanguage == "" {
+		settings.ErrorTemplatesLanguage = "en"
+	}
+	settings.TLSCertFile = os.Getenv("TLS_CERT_FILE")
+	settings.TLSKeyFile = os.Getenv("TLS_KEY_FILE")
+	settings.TLSClientCAFile = os.Getenv("TLS_CLIENT_CA_FILE")
+	settings.ExtAuthzPort = os.Getenv("EXTAUTHZ_PORT")
+	settings.ProxyUpstream = os.Getenv("PROXY_UPSTREAM")
+	settings.ProxyPort = os.Getenv("PROXY_PORT")
+	if settings.ProxyPort == "" {
+		settings.ProxyPort = "8000"
+	}
+	settings.TrustedProxies = strings.Fields(strings.Replace(os.Getenv("TRUSTED_PROXIES"), ",", " ", -1))
+	settings.RelationsStore = os.Getenv("RELATIONS_STORE")
+	settings.AdminToken = os.Getenv("ADMIN_TOKEN")
+	settings.AttributesURL = os.Getenv("ATTRIBUTES_URL")
+	settings.AttributesCacheTTL, _ = time.ParseDuration(os.Getenv("ATTRIBUTES_CACHE_TTL"))
+	settings.ExportS3Bucket = os.Getenv("EXPORT_S3_BUCKET")
+	settings.ExportS3Region = os.Getenv("EXPORT_S3_REGION")
+	settings.ExportGCSBucket = os.Getenv("EXPORT_GCS_BUCKET")
+	settings.ExportInterval, _ = time.ParseDuration(os.Getenv("EXPORT_INTERVAL"))
+	settings.ExportACLMapping = os.Getenv("EXPORT_ACL_MAPPING")
+	settings.ExportFormat = os.Getenv("EXPORT_FORMAT")
 	settings.Sources = sources()
+	settings.StandbySources = splitSources(os.Getenv("POLICIES_STANDBY"))
+	settings.StandbyThreshold, _ = time.ParseDuration(os.Getenv("POLICIES_STANDBY_THRESHOLD"))
 	settings.LogLevel = levelFromEnv()
+	settings.Objectives = objectivesFromEnv()
 }
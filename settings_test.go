@@ -3,6 +3,7 @@ package main
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -36,3 +37,44 @@ func TestSources(t *testing.T) {
 	defer os.Unsetenv("POLICIES")
 	assert.Equal(t, []string{"sample.yaml"}, sources())
 }
+
+func TestObjectives(t *testing.T) {
+	os.Setenv("SLO_AVAILABILITY", "0.99")
+	os.Setenv("SLO_LATENCY_P99", "250ms")
+	os.Setenv("SLO_RELOAD_FRESHNESS", "bad")
+	defer os.Unsetenv("SLO_AVAILABILITY")
+	defer os.Unsetenv("SLO_LATENCY_P99")
+	defer os.Unsetenv("SLO_RELOAD_FRESHNESS")
+	objectives := objectivesFromEnv()
+	assert.Equal(t, 0.99, objectives.Availability)
+	assert.Equal(t, 250*time.Millisecond, objectives.LatencyP99)
+	assert.Equal(t, 24*time.Hour, objectives.ReloadFreshness)
+}
+
+func TestSessionTTL(t *testing.T) {
+	assert.Equal(t, time.Hour, sessionTTLFromEnv())
+	os.Setenv("SESSION_TTL", "15m")
+	defer os.Unsetenv("SESSION_TTL")
+	assert.Equal(t, 15*time.Minute, sessionTTLFromEnv())
+}
+
+func TestSplitSources(t *testing.T) {
+	assert.Equal(t, []string{"a.yaml", "b.yaml"}, splitSources(" a.yaml  b.yaml "))
+	assert.Equal(t, []string(nil), splitSources(""))
+}
+
+func TestJWKSRefresh(t *testing.T) {
+	assert.Equal(t, 30*time.Minute, jwksRefreshFromEnv())
+	os.Setenv("JWKS_REFRESH_INTERVAL", "0")
+	defer os.Unsetenv("JWKS_REFRESH_INTERVAL")
+	assert.Equal(t, time.Duration(0), jwksRefreshFromEnv())
+}
+
+func TestJWKSRefetch(t *testing.T) {
+	assert.Equal(t, time.Minute, jwksRefetchFromEnv())
+	os.Setenv("JWKS_REFETCH_INTERVAL", "10s")
+	defer os.Unsetenv("JWKS_REFETCH_INTERVAL")
+	assert.Equal(t, 10*time.Second, jwksRefetchFromEnv())
+	os.Setenv("JWKS_REFETCH_INTERVAL", "-1s")
+	assert.Equal(t, time.Minute, jwksRefetchFromEnv())
+}